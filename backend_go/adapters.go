@@ -1,6 +1,7 @@
 package wrserver
 
 import (
+	"context"
 	"net/http"
 
 	"github.com/bruceesmith/terminator"
@@ -10,24 +11,28 @@ type clientAdapter struct {
 	client ClientInterface
 }
 
-func newClientAdapter() (c *clientAdapter) {
-	return &clientAdapter{client: NewClient("")}
+func newClientAdapter(wikiURL string, options ClientOptions) (c *clientAdapter) {
+	return &clientAdapter{client: NewClientWithOptions(wikiURL, options)}
 }
 
-func (ca *clientAdapter) Get(path string) (body []byte, contentType string, err error) {
-	return ca.client.Get(path)
+func (ca *clientAdapter) Get(ctx context.Context, path string) (body []byte, contentType string, err error) {
+	return ca.client.Get(ctx, path)
 }
 
-func (ca *clientAdapter) GetRandom() (path string) {
-	return ca.client.GetRandom()
+func (ca *clientAdapter) GetRandom(ctx context.Context) (path string, err error) {
+	return ca.client.GetRandom(ctx)
+}
+
+func (ca *clientAdapter) Status() ClientStatus {
+	return clientStatus(ca.client)
 }
 
 type serverAdapter struct {
 	server ServerInterface
 }
 
-func newServerAdapter(port, static string, client ClientInterface) (s *serverAdapter, err error) {
-	svr, err := NewServer(port, static, client)
+func newServerAdapter(port, static string, client ClientInterface, options ServerOptions) (s *serverAdapter, err error) {
+	svr, err := NewServerWithOptions(port, static, client, options)
 	return &serverAdapter{server: svr}, err
 }
 
@@ -35,8 +40,32 @@ func (sa *serverAdapter) API(w http.ResponseWriter, r *http.Request) {
 	sa.server.API(w, r)
 }
 
-func (sa *serverAdapter) MarshalFailure(function string, err error, response any) string {
-	return sa.server.MarshalFailure(function, err, response)
+func (sa *serverAdapter) Daily(w http.ResponseWriter, r *http.Request) {
+	sa.server.Daily(w, r)
+}
+
+func (sa *serverAdapter) Events(w http.ResponseWriter, r *http.Request) {
+	sa.server.Events(w, r)
+}
+
+func (sa *serverAdapter) Games(w http.ResponseWriter, r *http.Request) {
+	sa.server.Games(w, r)
+}
+
+func (sa *serverAdapter) Leaderboards(w http.ResponseWriter, r *http.Request) {
+	sa.server.Leaderboards(w, r)
+}
+
+func (sa *serverAdapter) OpenAPI(w http.ResponseWriter, r *http.Request) {
+	sa.server.OpenAPI(w, r)
+}
+
+func (sa *serverAdapter) RoomSocket(w http.ResponseWriter, r *http.Request) {
+	sa.server.RoomSocket(w, r)
+}
+
+func (sa *serverAdapter) Rooms(w http.ResponseWriter, r *http.Request) {
+	sa.server.Rooms(w, r)
 }
 
 func (sa *serverAdapter) Serve(t *terminator.Terminator) {
@@ -47,6 +76,10 @@ func (sa *serverAdapter) Settings(w http.ResponseWriter, r *http.Request) {
 	sa.server.Settings(w, r)
 }
 
+func (sa *serverAdapter) Solve(w http.ResponseWriter, r *http.Request) {
+	sa.server.Solve(w, r)
+}
+
 func (sa *serverAdapter) SPAFile(w http.ResponseWriter, r *http.Request) {
 	sa.server.SPAFile(w, r)
 }
@@ -55,6 +88,14 @@ func (sa *serverAdapter) SpecialRandom(w http.ResponseWriter, r *http.Request) {
 	sa.server.SpecialRandom(w, r)
 }
 
+func (sa *serverAdapter) Status(w http.ResponseWriter, r *http.Request) {
+	sa.server.Status(w, r)
+}
+
+func (sa *serverAdapter) UploadFile(w http.ResponseWriter, r *http.Request) {
+	sa.server.UploadFile(w, r)
+}
+
 func (sa *serverAdapter) WikiPage(w http.ResponseWriter, r *http.Request) {
 	sa.server.WikiPage(w, r)
 }
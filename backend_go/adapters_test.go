@@ -1,7 +1,7 @@
 package wrserver
 
 import (
-	"errors"
+	"context"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -22,7 +22,7 @@ func Test_newClientAdapter(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := newClientAdapter()
+			got := newClientAdapter("", DefaultClientOptions())
 			assert.NotNil(t, got, "newClientAdapter() should not return nil")
 		})
 	}
@@ -81,7 +81,7 @@ func Test_clientAdapter_Get(t *testing.T) {
 			ca := &clientAdapter{
 				client: tt.fields.client,
 			}
-			gotBody, _, err := ca.Get(tt.args.path)
+			gotBody, _, err := ca.Get(context.Background(), tt.args.path)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("clientAdapter.Get() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -124,7 +124,7 @@ func Test_newServerAdapter(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			gotS, err := newServerAdapter(tt.args.port, tt.args.static, tt.args.client)
+			gotS, err := newServerAdapter(tt.args.port, tt.args.static, tt.args.client, DefaultServerOptions())
 			if (err != nil) != tt.wantErr {
 				t.Errorf("newServerAdapter() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -158,12 +158,66 @@ func Test_serverAdapter_Methods(t *testing.T) {
 			},
 		},
 		{
-			name: "MarshalFailure",
+			name: "Daily",
 			setup: func() {
-				mockServer.EXPECT().MarshalFailure("test", errors.New("test error"), nil).Times(1)
+				mockServer.EXPECT().Daily(gomock.Any(), gomock.Any()).Times(1)
 			},
 			act: func() {
-				sa.MarshalFailure("test", errors.New("test error"), nil)
+				sa.Daily(nil, nil)
+			},
+		},
+		{
+			name: "Events",
+			setup: func() {
+				mockServer.EXPECT().Events(gomock.Any(), gomock.Any()).Times(1)
+			},
+			act: func() {
+				sa.Events(nil, nil)
+			},
+		},
+		{
+			name: "Games",
+			setup: func() {
+				mockServer.EXPECT().Games(gomock.Any(), gomock.Any()).Times(1)
+			},
+			act: func() {
+				sa.Games(nil, nil)
+			},
+		},
+		{
+			name: "Leaderboards",
+			setup: func() {
+				mockServer.EXPECT().Leaderboards(gomock.Any(), gomock.Any()).Times(1)
+			},
+			act: func() {
+				sa.Leaderboards(nil, nil)
+			},
+		},
+		{
+			name: "OpenAPI",
+			setup: func() {
+				mockServer.EXPECT().OpenAPI(gomock.Any(), gomock.Any()).Times(1)
+			},
+			act: func() {
+				sa.OpenAPI(nil, nil)
+			},
+		},
+		{
+			name: "RoomSocket",
+			setup: func() {
+				mockServer.EXPECT().RoomSocket(gomock.Any(), gomock.Any()).Times(1)
+			},
+			act: func() {
+				sa.RoomSocket(nil, nil)
+			},
+		},
+		{
+			name: "Rooms",
+			setup: func() {
+				mockServer.EXPECT().Rooms(gomock.Any(), gomock.Any()).Times(1)
+			},
+			act: func() {
+				sa.Rooms(nil, nil)
 			},
 		},
 		{
@@ -184,6 +238,15 @@ func Test_serverAdapter_Methods(t *testing.T) {
 				sa.Settings(nil, nil)
 			},
 		},
+		{
+			name: "Solve",
+			setup: func() {
+				mockServer.EXPECT().Solve(gomock.Any(), gomock.Any()).Times(1)
+			},
+			act: func() {
+				sa.Solve(nil, nil)
+			},
+		},
 		{
 			name: "SPAFile",
 			setup: func() {
@@ -202,6 +265,24 @@ func Test_serverAdapter_Methods(t *testing.T) {
 				sa.SpecialRandom(nil, nil)
 			},
 		},
+		{
+			name: "Status",
+			setup: func() {
+				mockServer.EXPECT().Status(gomock.Any(), gomock.Any()).Times(1)
+			},
+			act: func() {
+				sa.Status(nil, nil)
+			},
+		},
+		{
+			name: "UploadFile",
+			setup: func() {
+				mockServer.EXPECT().UploadFile(gomock.Any(), gomock.Any()).Times(1)
+			},
+			act: func() {
+				sa.UploadFile(nil, nil)
+			},
+		},
 		{
 			name: "WikiPage",
 			setup: func() {
@@ -1,39 +1,260 @@
 package wrserver
 
+import (
+	"time"
+
+	"github.com/bruceesmith/wrspa/backend/wrserver/api"
+	"github.com/bruceesmith/wrspa/backend/wrserver/leaderboard"
+)
+
+// CreateGameRequest is the request to create a game with POST /api/games
+// It contains the start and goal subjects, and optionally the name of the
+// wiki if it is not the default, or else the ID of a challenge, and the
+// name of the player
+type CreateGameRequest struct {
+	Start     string `json:"start"`
+	Goal      string `json:"goal"`
+	Wiki      string `json:"wiki,omitempty"`
+	Challenge string `json:"challenge,omitempty"` // ID of a challenge, such as a daily, whose start and goal are played instead
+	Player    string `json:"player,omitempty"`    // Name shown on the leaderboard
+	Profile   string `json:"profile,omitempty"`   // Name of the profile which cleans up the game's pages; the server's default if empty
+}
+
+// DailyResponse is the response for the daily endpoint
+// It contains the start and goal shared by every player on a UTC date, the
+// wiki they are on and the length of the shortest path between them
+type DailyResponse struct {
+	Date      string `json:"date"`
+	Challenge string `json:"challenge"` // ID of the challenge, for creating a game and for its leaderboard
+	Wiki      string `json:"wiki"`
+	Start     string `json:"start"`
+	Goal      string `json:"goal"`
+	Length    int    `json:"length"`
+}
+
+// DailyHistoryResponse is the response for the daily/history endpoint
+// It contains every remembered daily challenge, the most recent first
+type DailyHistoryResponse struct {
+	Dailies []DailyResponse `json:"dailies"`
+}
+
+// GameResponse is the response for the games endpoints
+// It describes a game session as measured by the server: its state, the
+// path taken from the start, the number of steps and the time played
+type GameResponse struct {
+	ID        string    `json:"id"`
+	Challenge string    `json:"challenge"` // ID of the challenge whose leaderboard the game is ranked on
+	Player    string    `json:"player"`
+	Wiki      string    `json:"wiki"`
+	Start     string    `json:"start"`
+	Goal      string    `json:"goal"`
+	State     GameState `json:"state"`
+	Path      []string  `json:"path"`
+	Steps     int       `json:"steps"`
+	ElapsedMS int64     `json:"elapsedms"`
+	Created   time.Time `json:"created"`
+	Profile   string    `json:"profile"`         // Name of the profile which cleans up the game's pages
+	Event     string    `json:"event,omitempty"` // Code of the event whose spectators are shown the game's moves
+	Token     string    `json:"token,omitempty"` // Only in the response to creating the game
+}
+
+// LeaderboardResponse is the response for GET /api/leaderboards/{challenge}
+// It contains one page of the finished games of a challenge in the order
+// requested, and the number of games in all
+type LeaderboardResponse struct {
+	Challenge leaderboard.Challenge `json:"challenge"`
+	Order     leaderboard.Ranking   `json:"order"`
+	Offset    int                   `json:"offset"`
+	Limit     int                   `json:"limit"`
+	Total     int                   `json:"total"`
+	Scores    []RankedScore         `json:"scores"`
+}
+
+// RankedScore is a finished game and its place on a leaderboard
+type RankedScore struct {
+	Rank int `json:"rank"`
+	leaderboard.Score
+}
+
+// MoveRequest is the request for POST /api/games/{id}/moves
+// It contains the token issued when the game was created, the action, and
+// the subject navigated to for a navigate action
+type MoveRequest struct {
+	Token   string     `json:"token"`
+	Action  MoveAction `json:"action"`
+	Subject string     `json:"subject,omitempty"`
+}
+
 // SettingsResponse is the response for the settings endpoint
 // It contains the log level and the trace IDs that are used for tracing
 type SettingsResponse struct {
 	LogLevel string   `json:"loglevel"`
 	TraceIDs []string `json:"traceids"`
+	Wiki     string   `json:"wiki"`  // Name of the default wiki
+	Wikis    []string `json:"wikis"` // Names of every wiki a game may be played on
+}
+
+// SolveEvent is one line of a /api/solve response streamed with stream=true
+// It holds either a progress report or, last, the result or the error
+type SolveEvent struct {
+	Progress *SolveProgress `json:"progress,omitempty"`
+	Result   *SolveResponse `json:"result,omitempty"`
+	Error    string         `json:"error,omitempty"`
+}
+
+// SolveProgress reports the progress of a search for the shortest paths
+// It gives the side of the search which was expanded, the length of the
+// paths explored so far and the number of articles fetched and reached
+type SolveProgress struct {
+	Direction string `json:"direction"`
+	Depth     int    `json:"depth"`
+	Expanded  int    `json:"expanded"`
+	Forward   int    `json:"forward"`
+	Backward  int    `json:"backward"`
+	ElapsedMS int64  `json:"elapsedms"`
+}
+
+// SolveResponse is the response for the solve endpoint
+// It contains the shortest paths from the start to the goal, the number of
+// links followed by each and the effort spent finding them
+type SolveResponse struct {
+	Wiki      string     `json:"wiki"`
+	Start     string     `json:"start"`
+	Goal      string     `json:"goal"`
+	Paths     [][]string `json:"paths"`
+	Length    int        `json:"length"`
+	Expanded  int        `json:"expanded"`
+	ElapsedMS int64      `json:"elapsedms"`
 }
 
 // SpecialRandomResponse is the response for the specialrandom endpoint
-// It contains the random Wikipedia start and goal subjects
+// It contains the random Wikipedia start and goal subjects, and the name of
+// the wiki they were chosen from
 type SpecialRandomResponse struct {
 	Start string `json:"start"`
 	Goal  string `json:"goal"`
+	Wiki  string `json:"wiki"`
+}
+
+// StatusResponse is the response for the status endpoint
+// It describes the health of the connection to Wikipedia
+type StatusResponse struct {
+	Upstream ClientStatus            `json:"upstream"`        // The default wiki
+	Wikis    map[string]ClientStatus `json:"wikis,omitempty"` // Every other wiki, by name
+}
+
+// CreateRoomRequest is the request to create a race room with POST /api/rooms
+// It contains the start and goal subjects, and optionally the name of the
+// wiki if it is not the default, or else the ID of a challenge, and when the
+// race ends
+type CreateRoomRequest struct {
+	Start     string  `json:"start"`
+	Goal      string  `json:"goal"`
+	Wiki      string  `json:"wiki,omitempty"`
+	Challenge string  `json:"challenge,omitempty"` // ID of a challenge, such as a daily, whose start and goal are raced instead
+	End       RoomEnd `json:"end,omitempty"`       // When the first player or every player reaches the goal; first if empty
+	Profile   string  `json:"profile,omitempty"`   // Name of the profile which cleans up the racers' pages; the server's default if empty
+}
+
+// RoomResponse is the response for the rooms endpoints, and part of every
+// event sent to the players in a room
+// It describes the race and each player's progress through it
+type RoomResponse struct {
+	Code      string       `json:"code"` // Given to other players so that they can join
+	Challenge string       `json:"challenge"`
+	Wiki      string       `json:"wiki"`
+	Start     string       `json:"start"`
+	Goal      string       `json:"goal"`
+	End       RoomEnd      `json:"end"`
+	Profile   string       `json:"profile"`
+	State     RoomState    `json:"state"`
+	StartsAt  time.Time    `json:"startsat,omitzero"` // When the countdown ends and the race starts
+	Winner    string       `json:"winner,omitempty"`
+	Players   []RoomPlayer `json:"players"`
+	Token     string       `json:"token,omitempty"` // Only in the response to creating the room, making its holder the host
+}
+
+// RoomPlayer is a player's progress through a race
+type RoomPlayer struct {
+	Name      string `json:"name"`
+	Host      bool   `json:"host"`
+	Connected bool   `json:"connected"`
+	Article   string `json:"article"` // The page the player is on
+	Steps     int    `json:"steps"`
+	ElapsedMS int64  `json:"elapsedms"`
+	Rank      int    `json:"rank,omitempty"` // Place in which the player reached the goal
+}
+
+// RoomRequest is a message from a player to their room's WebSocket
+// It contains the action, and the subject navigated to for a navigate action
+type RoomRequest struct {
+	Action  RoomAction `json:"action"`
+	Subject string     `json:"subject,omitempty"`
+}
+
+// RoomEvent is a message from a room's WebSocket to its players
+// It contains the kind of event, the room as it now is, the player the
+// event is about, and for a welcome the player's own game session
+type RoomEvent struct {
+	Type        RoomEventType `json:"type"`
+	Room        RoomResponse  `json:"room"`
+	Player      string        `json:"player,omitempty"`
+	Game        string        `json:"game,omitempty"`        // ID of the player's game session, for /api/wikipage
+	Token       string        `json:"token,omitempty"`       // Token of the player's game session
+	CountdownMS int64         `json:"countdownms,omitempty"` // Time left before the race starts
+	Error       string        `json:"error,omitempty"`
+}
+
+// SpectatorEvent is an event of a stream from /api/events/{code}/stream
+// It describes a player's page load, pause, resume, start or arrival at
+// the goal, and how far they had got
+type SpectatorEvent struct {
+	ID        uint64             `json:"id"` // Also the SSE id, for Last-Event-ID
+	Type      SpectatorEventType `json:"type"`
+	Player    string             `json:"player"`
+	Wiki      string             `json:"wiki"`
+	Subject   string             `json:"subject"`
+	Steps     int                `json:"steps"`     // Only for a player in a game session
+	ElapsedMS int64              `json:"elapsedms"` // Only for a player in a game session
+	Time      time.Time          `json:"time"`
 }
 
 // EndPoint is the type for the endpoint names
 type EndPoint string
 
 const (
+	Daily         EndPoint = "daily"         // Daily challenge endpoint
+	DailyHistory  EndPoint = "daily/history" // Past daily challenges endpoint
+	Events        EndPoint = "events"        // Spectator streams endpoint
+	Games         EndPoint = "games"         // Game sessions endpoint
+	Leaderboards  EndPoint = "leaderboards"  // Leaderboards endpoint
+	OpenAPI       EndPoint = "openapi.json"  // OpenAPI document endpoint
+	Rooms         EndPoint = "rooms"         // Race rooms endpoint
 	Settings      EndPoint = "settings"      // Settings endpoint
+	Solve         EndPoint = "solve"         // Shortest paths endpoint
 	SpecialRandom EndPoint = "specialrandom" // Special random endpoint
+	Status        EndPoint = "status"        // Upstream status endpoint
 	WikiPage      EndPoint = "wikipage"      // Wikipedia page endpoint
 )
 
 // WikiPageRequest is the request for the wikipage endpoint
 // It contains the either the subject of the Wikipedia page to be retrieved
-// or the link to an asset on the Wikipedia website
+// or the link to an asset on the Wikipedia website, and optionally the name
+// of the wiki if it is not the default. A page requested for a game gives
+// the game's ID and token instead of the wiki, and must be the game's
+// current page.
 type WikiPageRequest struct {
 	Subject string `json:"subject"`
+	Wiki    string `json:"wiki,omitempty"`
+	Game    string `json:"game,omitempty"`
+	Token   string `json:"token,omitempty"`
+	Event   string `json:"event,omitempty"`   // Code of an event whose spectators are shown the page load
+	Player  string `json:"player,omitempty"`  // Name shown to spectators, unless the game gives one
+	Profile string `json:"profile,omitempty"` // Name of the profile which cleans up the page, unless the game gives one
 }
 
-// WikiPageResponse is the response for the wikipage endpoint
-// It contains either a (string) page HTML or a (binary) asset,
-// and an error message if the page or asset could not be retrieved
-type WikiPageResponse struct {
-	Page  string `json:"page"`
-	Error string `json:"error"`
-}
+// WikiPageResponse is the response for the wikipage endpoint to a client
+// which prefers JSON to HTML
+// It is the page, shared with the backend of go-app, with its canonical
+// title, revision, links and sections
+type WikiPageResponse = api.Page
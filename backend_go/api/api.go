@@ -0,0 +1,116 @@
+/*
+Package api defines the responses which both Go backends serve, wrserver
+and the backend of go-app, so that either frontend can be served by either
+backend: the response for a page of the wiki, with the kind of each of its
+links, and that for a failure.
+Every endpoint of either backend is under Prefix.
+
+A client which prefers JSON to HTML in its Accept header is sent a Page;
+any other client, such as one which accepts anything, is sent the HTML of
+the page alone, as text/html.
+
+Every failure is answered with an ErrorResponse, whose ErrorCode decides
+the HTTP status and is what a frontend should branch on, rather than the
+status or the message.
+*/
+package api
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Prefix is the prefix of the path of every endpoint of either backend,
+// whose version changes only when an endpoint changes incompatibly. The
+// paths without the version, such as /api/wikipage, are deprecated aliases.
+const Prefix = "/api/v1/"
+
+// PageVersion is the version of the Page served. It changes whenever a
+// field is removed or changes its meaning, but not when one is added.
+const PageVersion = 1
+
+// The media types between which a client chooses with its Accept header
+const (
+	MediaTypeHTML = "text/html"
+	MediaTypeJSON = "application/json"
+)
+
+// Page is a page of the wiki, as it is shown to a player, with what the
+// server learnt about it. Titles are normalised, with underscores for
+// spaces, and without the /wiki/ prefix of their paths.
+type Page struct {
+	Version      int       `json:"version"`      // PageVersion
+	Title        string    `json:"title"`        // Canonical title, after following any redirect
+	Revision     int64     `json:"revision"`     // ID of the revision served, or 0 if the wiki did not give it
+	DisplayTitle string    `json:"displaytitle"` // Title as the page shows it
+	Links        []string  `json:"links"`        // Titles of the articles linked from the page as its profile leaves it, which are its moves, sorted
+	Sections     []Section `json:"sections"`     // Headings of the page's sections, in order
+	HTML         string    `json:"html"`         // HTML of the page's <body>, as the player is shown it
+}
+
+// Section is the heading of a section of a Page
+type Section struct {
+	Level  int    `json:"level"`  // 2 for <h2>, and so on
+	Title  string `json:"title"`  // Text of the heading
+	Anchor string `json:"anchor"` // ID of the heading, as the fragment of a link to it
+}
+
+// LinkKind is the value of the AttrLink attribute which either backend adds
+// to every link in the HTML of a Page, so that no frontend need parse hrefs
+// itself. Only an article link is a move in the game; a frontend should
+// disable every other kind.
+type LinkKind string
+
+const (
+	LinkArticle   LinkKind = "article"   // Another article, whose title is in AttrTarget
+	LinkAnchor    LinkKind = "anchor"    // A section of the same page
+	LinkNamespace LinkKind = "namespace" // A page which is not an article, such as File: or Talk:
+	LinkRed       LinkKind = "redlink"   // An article which does not exist
+	LinkExternal  LinkKind = "external"  // Another site
+	LinkOther     LinkKind = "other"     // Anything else on the wiki, such as an edit link
+)
+
+// The attributes added to a link in the HTML of a Page
+const (
+	AttrLink   = "data-wr-link"   // Its LinkKind
+	AttrTarget = "data-wr-target" // Normalised title of the article it links to, for a LinkArticle only
+)
+
+// PrefersJSON reports whether an Accept header gives JSON a higher quality
+// than HTML. Each is given the quality of the most specific media range
+// which matches it, so that no header, or */*, prefers HTML.
+func PrefersJSON(accept string) bool {
+	return quality(accept, MediaTypeJSON) > quality(accept, MediaTypeHTML)
+}
+
+// quality returns the quality which an Accept header gives a media type,
+// or 0 if no media range matches it
+func quality(accept, mediaType string) float64 {
+	kind, _, _ := strings.Cut(mediaType, "/")
+	q, specificity := 0.0, -1
+	for _, r := range strings.Split(accept, ",") {
+		mediaRange, params, _ := strings.Cut(r, ";")
+		s := -1
+		switch strings.ToLower(strings.TrimSpace(mediaRange)) {
+		case mediaType:
+			s = 2
+		case kind + "/*":
+			s = 1
+		case "*/*":
+			s = 0
+		}
+		if s <= specificity {
+			continue
+		}
+		specificity, q = s, 1
+		for _, param := range strings.Split(params, ";") {
+			key, value, _ := strings.Cut(param, "=")
+			if strings.EqualFold(strings.TrimSpace(key), "q") {
+				if f, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil {
+					q = f
+				}
+			}
+		}
+	}
+	return q
+}
@@ -0,0 +1,31 @@
+package api
+
+import "testing"
+
+func TestPrefersJSON(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   bool
+	}{
+		{accept: "", want: false},
+		{accept: "*/*", want: false},
+		{accept: "text/html", want: false},
+		{accept: "application/json", want: true},
+		{accept: "Application/JSON", want: true},
+		{accept: "application/*", want: true},
+		{accept: "application/json, */*", want: false},
+		{accept: "application/json, text/*;q=0.5", want: true},
+		{accept: "text/html;q=0.9, application/json", want: true},
+		{accept: "text/html, application/json;q=0.9", want: false},
+		{accept: "application/json;q=0, */*", want: false},
+		{accept: "text/html;level=1;q=0.2, application/json;q=0.5", want: true},
+		{accept: "application/json;q=x", want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.accept, func(t *testing.T) {
+			if got := PrefersJSON(tt.accept); got != tt.want {
+				t.Errorf("PrefersJSON(%q) = %v, want %v", tt.accept, got, tt.want)
+			}
+		})
+	}
+}
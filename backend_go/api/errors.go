@@ -0,0 +1,100 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// HeaderRequestID is the header which carries the ID of a request. A
+// request which gives one keeps it; any other is given one by the server.
+// The response carries the ID too, and it is logged with every failure.
+const HeaderRequestID = "X-Request-Id"
+
+// ErrorCode is the machine-readable reason for a failure, on which a
+// frontend can branch. A code is never changed once it is served, though
+// new ones may be added.
+type ErrorCode string
+
+const (
+	CodeInvalidRequest      ErrorCode = "invalid_request"      // The request could not be read, or has an invalid value
+	CodeInvalidSubject      ErrorCode = "invalid_subject"      // A subject is not the path of a page of the wiki
+	CodeInvalidToken        ErrorCode = "invalid_token"        // The token of a game is not the one it was created with
+	CodeNotFound            ErrorCode = "not_found"            // No such game, room, challenge, daily or resource
+	CodeMethodNotAllowed    ErrorCode = "method_not_allowed"   // The resource does not support the method
+	CodeGameState           ErrorCode = "game_state"           // The game's state does not allow the request, such as a move after it finished
+	CodeIllegalMove         ErrorCode = "illegal_move"         // The page is not linked from the game's current page
+	CodeNoPath              ErrorCode = "no_path"              // No path links the start to the goal
+	CodeBudgetExhausted     ErrorCode = "budget_exhausted"     // The search for a path gave up before finding one
+	CodeUpstreamNotFound    ErrorCode = "upstream_not_found"   // The wiki has no such page
+	CodeUpstreamError       ErrorCode = "upstream_error"       // The wiki answered with an error
+	CodeUpstreamTimeout     ErrorCode = "upstream_timeout"     // The wiki did not answer in time
+	CodeUpstreamUnavailable ErrorCode = "upstream_unavailable" // The wiki cannot be reached, or is failing and is not asked again until Retry-After
+	CodeRateLimited         ErrorCode = "rate_limited"         // The server's budget of requests to the wiki is spent until Retry-After
+	CodeUnavailable         ErrorCode = "unavailable"          // The server is at capacity, or not yet ready
+	CodeInternal            ErrorCode = "internal"             // Anything else, which is a fault in the server
+)
+
+// statuses are the HTTP statuses of the responses for each ErrorCode
+var statuses = map[ErrorCode]int{
+	CodeInvalidRequest:      http.StatusBadRequest,
+	CodeInvalidSubject:      http.StatusBadRequest,
+	CodeInvalidToken:        http.StatusForbidden,
+	CodeNotFound:            http.StatusNotFound,
+	CodeMethodNotAllowed:    http.StatusMethodNotAllowed,
+	CodeGameState:           http.StatusConflict,
+	CodeIllegalMove:         http.StatusUnprocessableEntity,
+	CodeNoPath:              http.StatusNotFound,
+	CodeBudgetExhausted:     http.StatusUnprocessableEntity,
+	CodeUpstreamNotFound:    http.StatusNotFound,
+	CodeUpstreamError:       http.StatusBadGateway,
+	CodeUpstreamTimeout:     http.StatusGatewayTimeout,
+	CodeUpstreamUnavailable: http.StatusServiceUnavailable,
+	CodeRateLimited:         http.StatusServiceUnavailable,
+	CodeUnavailable:         http.StatusServiceUnavailable,
+	CodeInternal:            http.StatusInternalServerError,
+}
+
+// Status returns the HTTP status of a response with the code, which is
+// 500 for a code that is not known
+func (c ErrorCode) Status() int {
+	if status, found := statuses[c]; found {
+		return status
+	}
+	return http.StatusInternalServerError
+}
+
+// ErrorResponse is the body of every response from either backend which
+// reports a failure
+type ErrorResponse struct {
+	Error Error `json:"error"`
+}
+
+// Error is a failure to answer a request
+type Error struct {
+	Code       ErrorCode `json:"code"`
+	Message    string    `json:"message"`              // For a person to read, and not to be parsed
+	Function   string    `json:"function"`             // Endpoint which failed, such as wikipage
+	RequestID  string    `json:"requestid"`            // As in the X-Request-Id header
+	RetryAfter int       `json:"retryafter,omitempty"` // Seconds, as in the Retry-After header
+}
+
+// Error returns the code and message of the failure, so that an Error can
+// be returned by a client, which can then branch on its Code
+func (e *Error) Error() string {
+	return string(e.Code) + ": " + e.Message
+}
+
+// Decode unmarshals the body of a response with a status of 2xx into v.
+// Any other status returns the *Error of the body, or, if the body is not
+// an ErrorResponse, an *Error with CodeInternal.
+func Decode(status int, body []byte, v any) error {
+	if status >= 200 && status < 300 {
+		return json.Unmarshal(body, v)
+	}
+	var failure ErrorResponse
+	if err := json.Unmarshal(body, &failure); err != nil || failure.Error.Code == "" {
+		return &Error{Code: CodeInternal, Message: fmt.Sprintf("unexpected response %d: %.100s", status, body)}
+	}
+	return &failure.Error
+}
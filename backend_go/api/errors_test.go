@@ -0,0 +1,49 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		want   string
+		code   ErrorCode
+	}{
+		{name: "success", status: http.StatusOK, body: `{"title":"Go"}`, want: "Go"},
+		{name: "invalid success", status: http.StatusOK, body: `{`, code: "-"},
+		{name: "failure", status: http.StatusNotFound, body: `{"error":{"code":"upstream_not_found","message":"no \"Go\""}}`, code: CodeUpstreamNotFound},
+		{name: "not an ErrorResponse", status: http.StatusBadGateway, body: `<html>Bad gateway</html>`, code: CodeInternal},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var page Page
+			err := Decode(tt.status, []byte(tt.body), &page)
+			var failure *Error
+			switch {
+			case tt.code == "" && (err != nil || page.Title != tt.want):
+				t.Errorf("got %+v, %v, want title %s", page, err, tt.want)
+			case tt.code == "-" && (err == nil || errors.As(err, &failure)):
+				t.Errorf("got %v, want an error unmarshalling", err)
+			case tt.code != "" && tt.code != "-" && (!errors.As(err, &failure) || failure.Code != tt.code):
+				t.Errorf("got %v, want code %s", err, tt.code)
+			}
+		})
+	}
+}
+
+func TestErrorCodeStatus(t *testing.T) {
+	for code, status := range statuses {
+		if code.Status() != status || status < 400 {
+			t.Errorf("code %s has status %d", code, code.Status())
+		}
+	}
+	if got := ErrorCode("unknown").Status(); got != http.StatusInternalServerError {
+		t.Errorf("got status %d for an unknown code", got)
+	}
+}
@@ -0,0 +1,146 @@
+package wrserver
+
+import (
+	"sync"
+	"time"
+
+	"github.com/bruceesmith/logger"
+)
+
+// BreakerState is the position of a Breaker's state machine
+type BreakerState string
+
+const (
+	BreakerClosed   BreakerState = "closed"    // Requests flow normally
+	BreakerOpen     BreakerState = "open"      // Requests fail fast without reaching the upstream
+	BreakerHalfOpen BreakerState = "half-open" // A single trial request is allowed through
+)
+
+// BreakerOptions configures a Breaker
+type BreakerOptions struct {
+	FailureThreshold int           // Consecutive failures which trip the breaker
+	OpenTimeout      time.Duration // Time spent open before a trial request is allowed
+}
+
+// DefaultBreakerOptions returns the BreakerOptions used by NewClient
+func DefaultBreakerOptions() BreakerOptions {
+	return BreakerOptions{
+		FailureThreshold: 5,
+		OpenTimeout:      30 * time.Second,
+	}
+}
+
+// BreakerStatus is a snapshot of a Breaker
+type BreakerStatus struct {
+	State               BreakerState `json:"state"`
+	ConsecutiveFailures int          `json:"consecutivefailures"`
+	Trips               uint64       `json:"trips"`
+	RetryAt             *time.Time   `json:"retryat,omitempty"`
+}
+
+// Breaker is a circuit breaker guarding calls to the upstream. After
+// FailureThreshold consecutive failures it opens and rejects calls for
+// OpenTimeout, then lets one trial call through: success closes it again,
+// failure re-opens it.
+type Breaker struct {
+	options BreakerOptions
+	now     func() time.Time
+
+	mu       sync.Mutex
+	state    BreakerState
+	failures int
+	trips    uint64
+	openedAt time.Time
+	trial    bool // a half-open trial call is in flight
+}
+
+// NewBreaker returns a closed Breaker
+func NewBreaker(options BreakerOptions) *Breaker {
+	return &Breaker{
+		options: options,
+		now:     time.Now,
+		state:   BreakerClosed,
+	}
+}
+
+// Allow reports whether a call may proceed, returning ErrCircuitOpen if not
+func (b *Breaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case BreakerOpen:
+		if b.now().Sub(b.openedAt) < b.options.OpenTimeout {
+			return ErrCircuitOpen
+		}
+		b.state = BreakerHalfOpen
+		b.trial = true
+		logger.Info("circuit breaker half-open, trying upstream")
+	case BreakerHalfOpen:
+		if b.trial {
+			return ErrCircuitOpen
+		}
+		b.trial = true
+	}
+	return nil
+}
+
+// Success records a call which reached the upstream and got a usable answer
+func (b *Breaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state != BreakerClosed {
+		logger.Info("circuit breaker closed")
+	}
+	b.state = BreakerClosed
+	b.failures = 0
+	b.trial = false
+}
+
+// Release records a call which was abandoned before the upstream could
+// answer, so that it neither closes nor trips the Breaker
+func (b *Breaker) Release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.trial = false
+}
+
+// Failure records a call which failed in a way that suggests the upstream
+// is unhealthy
+func (b *Breaker) Failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	b.trial = false
+	if b.state == BreakerHalfOpen || (b.state == BreakerClosed && b.failures >= b.options.FailureThreshold) {
+		b.state = BreakerOpen
+		b.openedAt = b.now()
+		b.trips++
+		logger.Warn("circuit breaker open", "failures", b.failures, "timeout", b.options.OpenTimeout.String())
+	}
+}
+
+// RetryAfter is how long until an open Breaker will allow a trial call
+func (b *Breaker) RetryAfter() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state != BreakerOpen {
+		return 0
+	}
+	return max(b.options.OpenTimeout-b.now().Sub(b.openedAt), 0)
+}
+
+// Status returns a snapshot of the Breaker
+func (b *Breaker) Status() BreakerStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	status := BreakerStatus{
+		State:               b.state,
+		ConsecutiveFailures: b.failures,
+		Trips:               b.trips,
+	}
+	if b.state == BreakerOpen {
+		retryAt := b.openedAt.Add(b.options.OpenTimeout)
+		status.RetryAt = &retryAt
+	}
+	return status
+}
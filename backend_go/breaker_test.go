@@ -0,0 +1,86 @@
+package wrserver
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBreaker(t *testing.T) {
+	now := time.Now()
+	b := NewBreaker(BreakerOptions{FailureThreshold: 3, OpenTimeout: time.Minute})
+	b.now = func() time.Time { return now }
+
+	// Failures below the threshold leave the breaker closed
+	for range 2 {
+		if err := b.Allow(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		b.Failure()
+	}
+	if status := b.Status(); status.State != BreakerClosed || status.ConsecutiveFailures != 2 {
+		t.Errorf("unexpected status %+v", status)
+	}
+
+	// A success resets the count
+	b.Success()
+	for range 3 {
+		b.Allow()
+		b.Failure()
+	}
+	status := b.Status()
+	if status.State != BreakerOpen || status.Trips != 1 || status.RetryAt == nil {
+		t.Fatalf("expected open breaker, got %+v", status)
+	}
+	if err := b.Allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("got %v, want ErrCircuitOpen", err)
+	}
+	if got := b.RetryAfter(); got != time.Minute {
+		t.Errorf("got RetryAfter %v, want 1m", got)
+	}
+
+	// After the timeout exactly one trial call is let through
+	now = now.Add(time.Minute)
+	if err := b.Allow(); err != nil {
+		t.Fatalf("expected trial call, got %v", err)
+	}
+	if b.Status().State != BreakerHalfOpen {
+		t.Errorf("expected half-open, got %s", b.Status().State)
+	}
+	if err := b.Allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("second concurrent trial: got %v, want ErrCircuitOpen", err)
+	}
+
+	// A failed trial re-opens the breaker
+	b.Failure()
+	if status := b.Status(); status.State != BreakerOpen || status.Trips != 2 {
+		t.Errorf("expected re-opened breaker, got %+v", status)
+	}
+
+	// A successful trial closes it
+	now = now.Add(time.Minute)
+	b.Allow()
+	b.Success()
+	if status := b.Status(); status.State != BreakerClosed || status.ConsecutiveFailures != 0 {
+		t.Errorf("expected closed breaker, got %+v", status)
+	}
+}
+
+func TestBreaker_Release(t *testing.T) {
+	now := time.Now()
+	b := NewBreaker(BreakerOptions{FailureThreshold: 1, OpenTimeout: time.Second})
+	b.now = func() time.Time { return now }
+
+	b.Allow()
+	b.Failure()
+	now = now.Add(time.Second)
+	b.Allow()
+	// An abandoned trial lets another trial through without a verdict
+	b.Release()
+	if err := b.Allow(); err != nil {
+		t.Errorf("expected another trial call, got %v", err)
+	}
+	if b.Status().State != BreakerHalfOpen {
+		t.Errorf("expected half-open, got %s", b.Status().State)
+	}
+}
@@ -0,0 +1,206 @@
+package wrserver
+
+import (
+	"container/list"
+	"context"
+	"mime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bruceesmith/logger"
+)
+
+// CacheOptions configures a CachedClient
+type CacheOptions struct {
+	MaxBytes   int64                    // Upper bound on the total size of all cached bodies
+	MaxEntries int                      // Upper bound on the number of cached entries
+	DefaultTTL time.Duration            // TTL for any content type not matched in TTLs
+	TTLs       map[string]time.Duration // TTL by media type ("text/html") or media type prefix ("image/")
+}
+
+// DefaultCacheOptions returns the CacheOptions used by the wrserver daemon
+// unless overridden. Articles change often enough that they are kept only
+// briefly, whereas skin assets and images are effectively immutable
+func DefaultCacheOptions() CacheOptions {
+	return CacheOptions{
+		MaxBytes:   64 << 20,
+		MaxEntries: 4096,
+		DefaultTTL: 10 * time.Minute,
+		TTLs: map[string]time.Duration{
+			"text/html":              5 * time.Minute,
+			"text/css":               time.Hour,
+			"text/javascript":        time.Hour,
+			"application/javascript": time.Hour,
+			"image/":                 24 * time.Hour,
+			"font/":                  24 * time.Hour,
+		},
+	}
+}
+
+// CacheStats is a snapshot of the counters of a CachedClient
+type CacheStats struct {
+	Hits      uint64 `json:"hits"`
+	Misses    uint64 `json:"misses"`
+	Evictions uint64 `json:"evictions"`
+	Entries   int    `json:"entries"`
+	Bytes     int64  `json:"bytes"`
+}
+
+// cacheEntry is a single cached response
+type cacheEntry struct {
+	path        string
+	body        []byte
+	contentType string
+	expires     time.Time
+}
+
+// CachedClient is a ClientInterface decorator which keeps recently fetched
+// pages and assets in memory. Entries are evicted least-recently-used first
+// once either the byte or the entry bound is exceeded, and are discarded
+// once their content-type-specific TTL has expired. GetRandom is never cached.
+type CachedClient struct {
+	client  ClientInterface
+	options CacheOptions
+	now     func() time.Time
+
+	mu        sync.Mutex
+	entries   map[string]*list.Element
+	lru       *list.List // front is most recently used
+	bytes     int64
+	hits      uint64
+	misses    uint64
+	evictions uint64
+}
+
+// NewCachedClient returns a CachedClient wrapping client
+func NewCachedClient(client ClientInterface, options CacheOptions) *CachedClient {
+	return &CachedClient{
+		client:  client,
+		options: options,
+		now:     time.Now,
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+// Get returns the cached body for path if present and fresh, otherwise it
+// fetches path from the wrapped client and caches a successful result.
+// The returned body is shared with the cache and must not be modified.
+func (c *CachedClient) Get(ctx context.Context, path string) (body []byte, contentType string, err error) {
+	if body, contentType, ok := c.lookup(path); ok {
+		logger.TraceID("cache", "hit", "path", path)
+		return body, contentType, nil
+	}
+	logger.TraceID("cache", "miss", "path", path)
+
+	body, contentType, err = c.client.Get(ctx, path)
+	if err != nil {
+		return
+	}
+	c.store(path, body, contentType)
+	return
+}
+
+// GetRandom passes straight through to the wrapped client
+func (c *CachedClient) GetRandom(ctx context.Context) (path string, err error) {
+	return c.client.GetRandom(ctx)
+}
+
+// Status adds the cache counters to the status of the wrapped client
+func (c *CachedClient) Status() ClientStatus {
+	status := clientStatus(c.client)
+	stats := c.Stats()
+	status.Cache = &stats
+	return status
+}
+
+// Stats returns a snapshot of the cache counters
+func (c *CachedClient) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return CacheStats{
+		Hits:      c.hits,
+		Misses:    c.misses,
+		Evictions: c.evictions,
+		Entries:   c.lru.Len(),
+		Bytes:     c.bytes,
+	}
+}
+
+// lookup returns a fresh cached entry for path, dropping it if it has expired
+func (c *CachedClient) lookup(path string) (body []byte, contentType string, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, found := c.entries[path]
+	if !found {
+		c.misses++
+		return
+	}
+	entry := el.Value.(*cacheEntry)
+	if !c.now().Before(entry.expires) {
+		c.remove(el)
+		c.misses++
+		return
+	}
+	c.lru.MoveToFront(el)
+	c.hits++
+	return entry.body, entry.contentType, true
+}
+
+// store adds or replaces the entry for path and then evicts until the cache
+// is back within its bounds
+func (c *CachedClient) store(path string, body []byte, contentType string) {
+	ttl := c.ttl(contentType)
+	if ttl <= 0 || int64(len(body)) > c.options.MaxBytes {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, found := c.entries[path]; found {
+		c.remove(el)
+	}
+	entry := &cacheEntry{
+		path:        path,
+		body:        body,
+		contentType: contentType,
+		expires:     c.now().Add(ttl),
+	}
+	c.entries[path] = c.lru.PushFront(entry)
+	c.bytes += int64(len(body))
+
+	for c.bytes > c.options.MaxBytes || (c.options.MaxEntries > 0 && c.lru.Len() > c.options.MaxEntries) {
+		c.remove(c.lru.Back())
+		c.evictions++
+	}
+}
+
+// remove deletes an entry; the caller must hold c.mu
+func (c *CachedClient) remove(el *list.Element) {
+	entry := c.lru.Remove(el).(*cacheEntry)
+	delete(c.entries, entry.path)
+	c.bytes -= int64(len(entry.body))
+}
+
+// ttl finds the TTL for a Content-Type, preferring an exact media type match
+// over the longest matching prefix
+func (c *CachedClient) ttl(contentType string) time.Duration {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = strings.ToLower(strings.TrimSpace(contentType))
+	}
+	if ttl, ok := c.options.TTLs[mediaType]; ok {
+		return ttl
+	}
+	var (
+		ttl     = c.options.DefaultTTL
+		longest int
+	)
+	for prefix, d := range c.options.TTLs {
+		if strings.HasSuffix(prefix, "/") && strings.HasPrefix(mediaType, prefix) && len(prefix) > longest {
+			ttl, longest = d, len(prefix)
+		}
+	}
+	return ttl
+}
@@ -0,0 +1,196 @@
+package wrserver
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bruceesmith/wrspa/backend/wrserver/mocks"
+	"go.uber.org/mock/gomock"
+)
+
+func TestCachedClient_Get(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient := mocks.NewMockClientInterface(ctrl)
+	mockClient.EXPECT().Get(gomock.Any(), "/wiki/test").Return([]byte("<html></html>"), "text/html; charset=UTF-8", nil).Times(1)
+
+	c := NewCachedClient(mockClient, DefaultCacheOptions())
+	for i := range 3 {
+		body, contentType, err := c.Get(context.Background(), "/wiki/test")
+		if err != nil {
+			t.Fatalf("Get #%d unexpected error: %v", i, err)
+		}
+		if string(body) != "<html></html>" || contentType != "text/html; charset=UTF-8" {
+			t.Errorf("Get #%d got (%s, %s)", i, string(body), contentType)
+		}
+	}
+
+	stats := c.Stats()
+	if stats.Hits != 2 || stats.Misses != 1 || stats.Entries != 1 || stats.Bytes != 13 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestCachedClient_GetError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient := mocks.NewMockClientInterface(ctrl)
+	mockClient.EXPECT().Get(gomock.Any(), "/wiki/missing").Return(nil, "", errors.New("not found")).Times(2)
+
+	c := NewCachedClient(mockClient, DefaultCacheOptions())
+	for range 2 {
+		if _, _, err := c.Get(context.Background(), "/wiki/missing"); err == nil {
+			t.Fatal("expected error, got nil")
+		}
+	}
+	if stats := c.Stats(); stats.Entries != 0 || stats.Misses != 2 {
+		t.Errorf("failures should not be cached, got %+v", stats)
+	}
+}
+
+func TestCachedClient_Expiry(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient := mocks.NewMockClientInterface(ctrl)
+	mockClient.EXPECT().Get(gomock.Any(), "/wiki/test").Return([]byte("page"), "text/html", nil).Times(2)
+	mockClient.EXPECT().Get(gomock.Any(), "/static/logo.png").Return([]byte("png"), "image/png", nil).Times(1)
+
+	now := time.Now()
+	c := NewCachedClient(mockClient, DefaultCacheOptions())
+	c.now = func() time.Time { return now }
+
+	c.Get(context.Background(), "/wiki/test")
+	c.Get(context.Background(), "/static/logo.png")
+
+	// Pages expire well before images
+	now = now.Add(time.Hour)
+	c.Get(context.Background(), "/wiki/test")
+	c.Get(context.Background(), "/static/logo.png")
+}
+
+func TestCachedClient_Eviction(t *testing.T) {
+	tests := []struct {
+		name        string
+		maxBytes    int64
+		maxEntries  int
+		wantEntries int
+		wantEvicted string
+	}{
+		{
+			name:        "byte bound",
+			maxBytes:    10,
+			wantEntries: 2,
+			wantEvicted: "/w/a",
+		},
+		{
+			name:        "entry bound",
+			maxBytes:    1000,
+			maxEntries:  2,
+			wantEntries: 2,
+			wantEvicted: "/w/a",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockClient := mocks.NewMockClientInterface(ctrl)
+			for _, path := range []string{"/w/a", "/w/b", "/w/c"} {
+				mockClient.EXPECT().Get(gomock.Any(), path).Return([]byte("12345"), "text/css", nil).Times(1)
+			}
+			mockClient.EXPECT().Get(gomock.Any(), tt.wantEvicted).Return([]byte("12345"), "text/css", nil).Times(1)
+
+			options := DefaultCacheOptions()
+			options.MaxBytes = tt.maxBytes
+			options.MaxEntries = tt.maxEntries
+			c := NewCachedClient(mockClient, options)
+
+			c.Get(context.Background(), "/w/a")
+			c.Get(context.Background(), "/w/b")
+			c.Get(context.Background(), "/w/c")
+			if stats := c.Stats(); stats.Entries != tt.wantEntries || stats.Evictions != 1 {
+				t.Errorf("unexpected stats %+v", stats)
+			}
+			// The least recently used entry was evicted so must be fetched again
+			c.Get(context.Background(), tt.wantEvicted)
+		})
+	}
+}
+
+func TestCachedClient_TooLarge(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient := mocks.NewMockClientInterface(ctrl)
+	mockClient.EXPECT().Get(gomock.Any(), "/w/big").Return(make([]byte, 100), "image/png", nil).Times(2)
+
+	options := DefaultCacheOptions()
+	options.MaxBytes = 50
+	c := NewCachedClient(mockClient, options)
+	c.Get(context.Background(), "/w/big")
+	c.Get(context.Background(), "/w/big")
+}
+
+func TestCachedClient_GetRandom(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient := mocks.NewMockClientInterface(ctrl)
+	mockClient.EXPECT().GetRandom(gomock.Any()).Return("one", nil)
+	mockClient.EXPECT().GetRandom(gomock.Any()).Return("two", nil)
+
+	c := NewCachedClient(mockClient, DefaultCacheOptions())
+	if got, _ := c.GetRandom(context.Background()); got != "one" {
+		t.Errorf("got %s, want one", got)
+	}
+	if got, _ := c.GetRandom(context.Background()); got != "two" {
+		t.Errorf("got %s, want two", got)
+	}
+}
+
+func TestCachedClient_ttl(t *testing.T) {
+	c := NewCachedClient(nil, CacheOptions{
+		DefaultTTL: time.Minute,
+		TTLs: map[string]time.Duration{
+			"text/html":     time.Second,
+			"image/":        time.Hour,
+			"image/svg+xml": 2 * time.Hour,
+			"text/plain":    0,
+		},
+	})
+
+	tests := []struct {
+		contentType string
+		want        time.Duration
+	}{
+		{contentType: "text/html; charset=UTF-8", want: time.Second},
+		{contentType: "image/png", want: time.Hour},
+		{contentType: "image/svg+xml", want: 2 * time.Hour},
+		{contentType: "text/plain", want: 0},
+		{contentType: "application/json", want: time.Minute},
+		{contentType: "", want: time.Minute},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.contentType, func(t *testing.T) {
+			if got := c.ttl(tt.contentType); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCachedClient_Status(t *testing.T) {
+	c := NewCachedClient(NewClient(""), DefaultCacheOptions())
+	status := c.Status()
+	if status.Cache == nil || status.Breaker.State != BreakerClosed {
+		t.Errorf("unexpected status %+v", status)
+	}
+}
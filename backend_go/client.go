@@ -1,102 +1,303 @@
 package wrserver
 
 import (
-	"fmt"
+	"context"
+	"errors"
 	"io"
+	"math/rand/v2"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/bruceesmith/logger"
 )
 
 const defaultWikiURL = "https://en.wikipedia.org"
 
+// ClientOptions configures a Client
+type ClientOptions struct {
+	Timeout       time.Duration  // Deadline applied to each call, in addition to any deadline on its context, and covering all retries
+	Retries       int            // Number of times a transient failure is retried
+	BackoffBase   time.Duration  // Backoff before the first retry, doubled for each subsequent retry
+	BackoffMax    time.Duration  // Upper bound on the backoff between retries
+	MaxRetryAfter time.Duration  // Longest Retry-After that is honoured; a longer one fails the call immediately
+	Breaker       BreakerOptions // Circuit breaker settings
+	UserAgent     string         // User-Agent sent with every request
+	PageLimit     RateLimit      // Budget for articles and API queries
+	StaticLimit   RateLimit      // Budget for skin assets and images
+}
+
+// DefaultClientOptions returns the ClientOptions used by NewClient
+func DefaultClientOptions() ClientOptions {
+	return ClientOptions{
+		Timeout:       30 * time.Second,
+		Retries:       2,
+		BackoffBase:   250 * time.Millisecond,
+		BackoffMax:    4 * time.Second,
+		MaxRetryAfter: 10 * time.Second,
+		Breaker:       DefaultBreakerOptions(),
+		UserAgent:     UserAgent(""),
+		PageLimit:     DefaultPageRateLimit(),
+		StaticLimit:   DefaultStaticRateLimit(),
+	}
+}
+
+// ClientStatus describes the health of a ClientInterface and of any
+// decorators wrapped around it
+type ClientStatus struct {
+	Breaker   BreakerStatus `json:"breaker"`
+	Cache     *CacheStats   `json:"cache,omitempty"`
+	DiskCache *CacheStats   `json:"diskcache,omitempty"`
+}
+
+// statusReporter is implemented by a ClientInterface which can describe its
+// own health. It is kept apart from ClientInterface, whose mocks cannot
+// refer back to this package's types.
+type statusReporter interface {
+	Status() ClientStatus
+}
+
+// clientStatus returns the status of client if it reports one
+func clientStatus(client ClientInterface) ClientStatus {
+	if sr, ok := client.(statusReporter); ok {
+		return sr.Status()
+	}
+	return ClientStatus{}
+}
+
 type Client struct {
-	wikiURL string
+	wikiURL    string
+	options    ClientOptions
+	breaker    *Breaker
+	pages      *limiter
+	static     *limiter
+	http       *http.Client // follows redirects
+	noRedirect *http.Client // returns redirects to the caller
+}
+
+// upstreamResponse is the part of an upstream answer that a Client needs
+type upstreamResponse struct {
+	status     string
+	statusCode int
+	header     http.Header
+	body       []byte
 }
 
+// NewClient returns a Client for wikiURL with the default options
 func NewClient(wikiURL string) *Client {
+	return NewClientWithOptions(wikiURL, DefaultClientOptions())
+}
+
+// NewClientWithOptions returns a Client for wikiURL. Both of its underlying
+// http.Clients share one Transport and so one pool of connections.
+func NewClientWithOptions(wikiURL string, options ClientOptions) *Client {
 	if wikiURL == "" {
 		wikiURL = defaultWikiURL
 	}
-	return &Client{wikiURL: wikiURL}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	return &Client{
+		wikiURL: wikiURL,
+		options: options,
+		breaker: NewBreaker(options.Breaker),
+		pages:   newLimiter("pages", options.PageLimit),
+		static:  newLimiter("static", options.StaticLimit),
+		http: &http.Client{
+			Transport: transport,
+		},
+		noRedirect: &http.Client{
+			Transport: transport,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
 }
 
 // Get fetches a Wikipedia URL (either a static file or a dynamic page)
-func (c *Client) Get(path string) (body []byte, contentType string, err error) {
-	var resp *http.Response
-	url := c.wikiURL + path
-	logger.TraceID("client", "get", "URL", url)
+func (c *Client) Get(ctx context.Context, path string) (body []byte, contentType string, err error) {
+	logger.TraceID("client", "get", "URL", c.wikiURL+path)
 
-	client := &http.Client{}
-
-	req, err := http.NewRequest("GET", url, nil)
+	resp, err := c.fetch(ctx, c.http, http.MethodGet, path)
 	if err != nil {
-		logger.Error("error creating http.Request", "error", err.Error())
+		logger.Error("error fetching "+path, "error", err.Error())
 		return
 	}
-	req.Header.Add("Accept", "*/*")
-	req.Header.Set("User-Agent", "wrspa/1.0")
+	if resp.statusCode != http.StatusOK {
+		err = &UpstreamError{StatusCode: resp.statusCode, Status: resp.status}
+		return
+	}
+	return resp.body, resp.header.Get("Content-Type"), nil
+}
 
-	resp, err = client.Do(req)
+// GetRandom fetches the URL path but not the page content returned
+// by fetching the path /wiki/SpecialRandom but not redirecting
+func (c *Client) GetRandom(ctx context.Context) (path string, err error) {
+	logger.TraceID("client", "getrandom", "URL", c.wikiURL+"/wiki/Special:Random")
+
+	resp, err := c.fetch(ctx, c.noRedirect, http.MethodHead, "/wiki/Special:Random")
 	if err != nil {
-		logger.Error("error fetching "+path, "error", err.Error())
+		logger.Error("error fetching Special:Random", "error", err.Error())
 		return
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		err = fmt.Errorf("unexpected status: %s", resp.Status)
+	if resp.statusCode != http.StatusFound {
+		logger.Error("unexpected status getting random", "status", resp.status)
+		err = &UpstreamError{StatusCode: resp.statusCode, Status: resp.status}
 		return
 	}
 
-	contentType = resp.Header.Get("Content-Type")
-
-	body, err = io.ReadAll(resp.Body)
+	location := resp.header.Get("Location")
+	if location == "" {
+		logger.Error("error getting location", "error", http.ErrNoLocation.Error())
+		err = http.ErrNoLocation
+		return
+	}
+	l, err := url.Parse(location)
 	if err != nil {
-		logger.Error("error reading response to GET("+path+")", "error", err.Error())
+		logger.Error("error getting location", "error", err.Error())
 		return
 	}
+	path = strings.TrimPrefix(l.Path, "/wiki/")
 	return
 }
 
-// GetRandom fetches the URL path but not the page content returned
-// by fetching the path /wiki/SpecialRandom but not redirecting
-func (c *Client) GetRandom() (path string) {
-	url := c.wikiURL + "/wiki/Special:Random"
-	logger.TraceID("client", "getrandom", "URL", url)
+// Status reports the state of the circuit breaker
+func (c *Client) Status() ClientStatus {
+	return ClientStatus{
+		Breaker: c.breaker.Status(),
+	}
+}
 
-	client := &http.Client{
-		CheckRedirect: func(req *http.Request, via []*http.Request) error {
-			return http.ErrUseLastResponse
-		},
+// fetch performs one logical upstream call, retrying transient failures
+// with jittered exponential backoff (or as directed by Retry-After) and
+// feeding every outcome into the circuit breaker. Each attempt which the
+// breaker allows is charged to the page or static rate limit.
+func (c *Client) fetch(ctx context.Context, hc *http.Client, method, path string) (*upstreamResponse, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	limiter := c.static
+	if isPage(path) {
+		limiter = c.pages
+	}
+	for attempt := 0; ; attempt++ {
+		// A call refused by the breaker spends none of the rate limit
+		err := c.breaker.Allow()
+		if err != nil {
+			return nil, err
+		}
+		err = limiter.Wait(ctx)
+		if err != nil {
+			c.breaker.Release()
+			return nil, err
+		}
+		resp, err := c.attempt(ctx, hc, method, path)
+		if err == nil {
+			c.breaker.Success()
+			return resp, nil
+		}
+		if errors.Is(err, context.Canceled) {
+			// The caller went away, which says nothing about the upstream
+			c.breaker.Release()
+			return nil, err
+		}
+		c.breaker.Failure()
+		if !transient(err) || attempt >= c.options.Retries {
+			return nil, err
+		}
+
+		wait := c.backoff(attempt)
+		var ue *UpstreamError
+		if errors.As(err, &ue) && ue.RetryAfter > 0 {
+			if ue.RetryAfter > c.options.MaxRetryAfter {
+				return nil, err
+			}
+			wait = ue.RetryAfter
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Now().Add(wait).After(deadline) {
+			return nil, err
+		}
+		logger.Warn("retrying upstream request", "path", path, "attempt", attempt+1, "wait", wait.String(), "error", err.Error())
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, err
+		case <-timer.C:
+		}
 	}
+}
 
-	req, err := http.NewRequest("HEAD", url, nil)
+// attempt makes a single upstream request. Throttling and server errors are
+// returned as an *UpstreamError, any other status as an upstreamResponse
+func (c *Client) attempt(ctx context.Context, hc *http.Client, method, path string) (*upstreamResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.wikiURL+path, nil)
 	if err != nil {
-		logger.Error("error creating http.Request", "error", err.Error())
-		return
+		return nil, err
 	}
 	req.Header.Add("Accept", "*/*")
-	req.Header.Set("User-Agent", "wrspa/1.0")
+	req.Header.Set("User-Agent", c.options.UserAgent)
 
-	resp, err := client.Do(req)
+	resp, err := hc.Do(req)
 	if err != nil {
-		logger.Error("error fetching Special:Random", "error", err.Error())
-		return
+		return nil, err
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusFound {
-		logger.Error("unexpected status getting random", "status", resp.Status)
-		return
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError {
+		io.Copy(io.Discard, resp.Body)
+		return nil, &UpstreamError{
+			StatusCode: resp.StatusCode,
+			Status:     resp.Status,
+			RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+		}
 	}
 
-	l, err := resp.Location()
+	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		logger.Error("error getting location", "error", err.Error())
-		return
+		return nil, err
 	}
-	path = strings.TrimPrefix(l.Path, "/wiki/")
-	return
+	return &upstreamResponse{
+		status:     resp.Status,
+		statusCode: resp.StatusCode,
+		header:     resp.Header,
+		body:       body,
+	}, nil
+}
+
+// backoff returns the wait before retry number attempt+1: an exponentially
+// growing interval of which the upper half is randomised
+func (c *Client) backoff(attempt int) time.Duration {
+	d := c.options.BackoffBase << attempt
+	if d <= 0 || d > c.options.BackoffMax {
+		d = c.options.BackoffMax
+	}
+	if d <= 1 {
+		return d
+	}
+	return d/2 + rand.N(d/2)
+}
+
+// withTimeout applies the per-call deadline, if any, to ctx
+func (c *Client) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.options.Timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, c.options.Timeout)
+}
+
+// parseRetryAfter interprets a Retry-After header given either as a number
+// of seconds or as an HTTP date
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return max(time.Duration(seconds)*time.Second, 0)
+	}
+	if when, err := http.ParseTime(value); err == nil {
+		return max(when.Sub(now), 0)
+	}
+	return 0
 }
@@ -1,12 +1,16 @@
 package wrserver
 
 import (
+	"context"
+	"errors"
 	"io"
 	"log/slog"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func TestMain(m *testing.M) {
@@ -77,7 +81,7 @@ func TestGet(t *testing.T) {
 				defer server.Close()
 
 				c := NewClient(server.URL)
-				body, contentType, err := c.Get("")
+				body, contentType, err := c.Get(context.Background(), "")
 				if tt.shouldFail {
 					if err == nil {
 						t.Errorf("expected error, got nil")
@@ -102,7 +106,7 @@ func TestGet(t *testing.T) {
 		server.Close() // Close server immediately
 
 		c := NewClient(server.URL)
-		_, _, err := c.Get("")
+		_, _, err := c.Get(context.Background(), "")
 		if err == nil {
 			t.Fatal("expected a network error, but got nil")
 		}
@@ -128,7 +132,7 @@ func TestGet(t *testing.T) {
 		defer server.Close()
 
 		c := NewClient(server.URL)
-		_, _, err := c.Get("")
+		_, _, err := c.Get(context.Background(), "")
 		if err == nil {
 			t.Fatal("expected an error reading the body, but got nil")
 		}
@@ -144,9 +148,9 @@ func TestGetRandom(t *testing.T) {
 		defer server.Close()
 
 		c := NewClient(server.URL)
-		path := c.GetRandom()
-		if path != "Random_Page" {
-			t.Errorf("got %s, want Random_Page", path)
+		path, err := c.GetRandom(context.Background())
+		if err != nil || path != "Random_Page" {
+			t.Errorf("got (%s, %v), want Random_Page", path, err)
 		}
 	})
 
@@ -157,9 +161,9 @@ func TestGetRandom(t *testing.T) {
 		defer server.Close()
 
 		c := NewClient(server.URL)
-		path := c.GetRandom()
-		if path != "" {
-			t.Errorf("expected empty path, got %s", path)
+		path, err := c.GetRandom(context.Background())
+		if err == nil || path != "" {
+			t.Errorf("expected empty path and an error, got (%s, %v)", path, err)
 		}
 	})
 
@@ -170,9 +174,9 @@ func TestGetRandom(t *testing.T) {
 		defer server.Close()
 
 		c := NewClient(server.URL)
-		path := c.GetRandom()
-		if path != "" {
-			t.Errorf("expected empty path, got %s", path)
+		path, err := c.GetRandom(context.Background())
+		if err == nil || path != "" {
+			t.Errorf("expected empty path and an error, got (%s, %v)", path, err)
 		}
 	})
 
@@ -181,9 +185,289 @@ func TestGetRandom(t *testing.T) {
 		server.Close() // Close server immediately
 
 		c := NewClient(server.URL)
-		path := c.GetRandom()
-		if path != "" {
-			t.Fatalf("expected empty path on network error, but got '%s'", path)
+		path, err := c.GetRandom(context.Background())
+		if err == nil || path != "" {
+			t.Fatalf("expected empty path and an error on network error, but got ('%s', %v)", path, err)
+		}
+	})
+}
+
+func TestClientContext(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	t.Run("cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		c := NewClient(server.URL)
+		if _, _, err := c.Get(ctx, "/wiki/test"); !errors.Is(err, context.Canceled) {
+			t.Errorf("got %v, want context.Canceled", err)
+		}
+		if path, _ := c.GetRandom(ctx); path != "" {
+			t.Errorf("expected empty path, got %s", path)
+		}
+	})
+
+	t.Run("per-call timeout", func(t *testing.T) {
+		c := NewClientWithOptions(server.URL, ClientOptions{Timeout: 50 * time.Millisecond})
+		start := time.Now()
+		_, _, err := c.Get(context.Background(), "/wiki/test")
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("got %v, want context.DeadlineExceeded", err)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("timeout not applied, call took %v", elapsed)
+		}
+	})
+}
+
+func TestClientRetry(t *testing.T) {
+	options := DefaultClientOptions()
+	options.BackoffBase = time.Millisecond
+	options.BackoffMax = 10 * time.Millisecond
+
+	t.Run("transient failure then success", func(t *testing.T) {
+		var calls atomic.Int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if calls.Add(1) < 3 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.Write([]byte("ok"))
+		}))
+		defer server.Close()
+
+		c := NewClientWithOptions(server.URL, options)
+		body, _, err := c.Get(context.Background(), "/wiki/test")
+		if err != nil || string(body) != "ok" {
+			t.Errorf("got (%s, %v), want ok", string(body), err)
+		}
+		if calls.Load() != 3 {
+			t.Errorf("got %d calls, want 3", calls.Load())
+		}
+	})
+
+	t.Run("retries exhausted", func(t *testing.T) {
+		var calls atomic.Int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls.Add(1)
+			w.WriteHeader(http.StatusBadGateway)
+		}))
+		defer server.Close()
+
+		c := NewClientWithOptions(server.URL, options)
+		_, _, err := c.Get(context.Background(), "/wiki/test")
+		var ue *UpstreamError
+		if !errors.As(err, &ue) || ue.StatusCode != http.StatusBadGateway {
+			t.Errorf("got %v, want UpstreamError 502", err)
+		}
+		if calls.Load() != int32(options.Retries+1) {
+			t.Errorf("got %d calls, want %d", calls.Load(), options.Retries+1)
+		}
+	})
+
+	t.Run("not found is not retried", func(t *testing.T) {
+		var calls atomic.Int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls.Add(1)
+			w.WriteHeader(http.StatusNotFound)
+		}))
+		defer server.Close()
+
+		c := NewClientWithOptions(server.URL, options)
+		if _, _, err := c.Get(context.Background(), "/wiki/test"); err == nil {
+			t.Error("expected error, got nil")
+		}
+		if calls.Load() != 1 {
+			t.Errorf("got %d calls, want 1", calls.Load())
+		}
+		if c.Status().Breaker.ConsecutiveFailures != 0 {
+			t.Errorf("a 404 should not count against the breaker")
+		}
+	})
+
+	t.Run("retry-after honoured", func(t *testing.T) {
+		var (
+			calls atomic.Int32
+			first time.Time
+			gap   time.Duration
+		)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if calls.Add(1) == 1 {
+				first = time.Now()
+				w.Header().Set("Retry-After", "1")
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+			gap = time.Since(first)
+			w.Write([]byte("ok"))
+		}))
+		defer server.Close()
+
+		c := NewClientWithOptions(server.URL, options)
+		if _, _, err := c.Get(context.Background(), "/wiki/test"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if gap < time.Second {
+			t.Errorf("retried after %v, want at least 1s", gap)
+		}
+	})
+
+	t.Run("retry-after too long", func(t *testing.T) {
+		var calls atomic.Int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls.Add(1)
+			w.Header().Set("Retry-After", "3600")
+			w.WriteHeader(http.StatusTooManyRequests)
+		}))
+		defer server.Close()
+
+		c := NewClientWithOptions(server.URL, options)
+		if _, _, err := c.Get(context.Background(), "/wiki/test"); err == nil {
+			t.Error("expected error, got nil")
+		}
+		if calls.Load() != 1 {
+			t.Errorf("got %d calls, want 1", calls.Load())
 		}
 	})
+
+	t.Run("circuit breaker trips", func(t *testing.T) {
+		var calls atomic.Int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls.Add(1)
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+		defer server.Close()
+
+		breakerOptions := options
+		breakerOptions.Retries = 0
+		breakerOptions.Breaker = BreakerOptions{FailureThreshold: 2, OpenTimeout: time.Minute}
+		c := NewClientWithOptions(server.URL, breakerOptions)
+		c.Get(context.Background(), "/wiki/test")
+		c.Get(context.Background(), "/wiki/test")
+		if _, _, err := c.Get(context.Background(), "/wiki/test"); !errors.Is(err, ErrCircuitOpen) {
+			t.Errorf("got %v, want ErrCircuitOpen", err)
+		}
+		if _, err := c.GetRandom(context.Background()); !errors.Is(err, ErrCircuitOpen) {
+			t.Errorf("got %v, want ErrCircuitOpen", err)
+		}
+		if calls.Load() != 2 {
+			t.Errorf("got %d calls, want 2", calls.Load())
+		}
+		if c.Status().Breaker.State != BreakerOpen {
+			t.Errorf("got breaker state %s, want open", c.Status().Breaker.State)
+		}
+	})
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{value: "", want: 0},
+		{value: "5", want: 5 * time.Second},
+		{value: "-5", want: 0},
+		{value: now.Add(time.Minute).Format(http.TimeFormat), want: time.Minute},
+		{value: "soon", want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			if got := parseRetryAfter(tt.value, now); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClientUserAgent(t *testing.T) {
+	var got string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get("User-Agent")
+	}))
+	defer server.Close()
+
+	options := DefaultClientOptions()
+	options.UserAgent = UserAgent("ops@example.org")
+	c := NewClientWithOptions(server.URL, options)
+	c.Get(context.Background(), "/wiki/test")
+	if got != "wrspa/1.0 (ops@example.org)" {
+		t.Errorf("got User-Agent %s", got)
+	}
+}
+
+func TestClientRateLimited(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	options := DefaultClientOptions()
+	options.PageLimit = RateLimit{Rate: 0.01, Burst: 1, Queue: 0}
+	c := NewClientWithOptions(server.URL, options)
+	if _, _, err := c.Get(context.Background(), "/wiki/one"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, _, err := c.Get(context.Background(), "/wiki/two"); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("got %v, want ErrRateLimited", err)
+	}
+	// Static assets have their own budget
+	if _, _, err := c.Get(context.Background(), "/static/logo.png"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestClientBreakerBeforeRateLimit(t *testing.T) {
+	var failing atomic.Bool
+	failing.Store(true)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	options := DefaultClientOptions()
+	options.Retries = 0
+	options.PageLimit = RateLimit{Rate: 0.01, Burst: 4, Queue: 0}
+	options.Breaker = BreakerOptions{FailureThreshold: 2, OpenTimeout: time.Minute}
+	c := NewClientWithOptions(server.URL, options)
+	c.Get(context.Background(), "/wiki/one")
+	c.Get(context.Background(), "/wiki/two")
+
+	// Calls refused by the open breaker leave the rest of the budget
+	for range 5 {
+		if _, _, err := c.Get(context.Background(), "/wiki/three"); !errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("got %v, want ErrCircuitOpen", err)
+		}
+	}
+	failing.Store(false)
+	later := time.Now().Add(2 * time.Minute)
+	c.breaker.now = func() time.Time { return later }
+	if _, _, err := c.Get(context.Background(), "/wiki/three"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if c.Status().Breaker.State != BreakerClosed {
+		t.Errorf("got breaker state %s, want closed", c.Status().Breaker.State)
+	}
+
+	// A trial call refused by the rate limit does not hold the half-open
+	// breaker's only trial
+	c.Get(context.Background(), "/wiki/four")
+	c.breaker.Failure()
+	c.breaker.Failure()
+	later = later.Add(2 * time.Minute)
+	if _, _, err := c.Get(context.Background(), "/wiki/five"); !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("got %v, want ErrRateLimited", err)
+	}
+	if _, _, err := c.Get(context.Background(), "/static/logo.png"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
 }
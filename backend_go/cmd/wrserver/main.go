@@ -4,40 +4,363 @@ package main
 
 import (
 	"context"
-	"fmt"
+	"strings"
 
-	"github.com/asaskevich/govalidator"
 	"github.com/bruceesmith/echidna"
 	wrserver "github.com/bruceesmith/wrspa/backend/wrserver"
 	"github.com/urfave/cli/v3"
 )
 
+// env returns the WRSPA_* environment variable which may set a flag, for
+// example WRSPA_CACHE_DIR for --cache-dir
+func env(flag string) cli.ValueSourceChain {
+	return cli.EnvVars("WRSPA_" + strings.ToUpper(strings.ReplaceAll(flag, "-", "_")))
+}
+
 func main() {
+	defaults := wrserver.DefaultConfig()
 	var cmd = &cli.Command{
 		Name:        "wrserver",
 		Action:      wrserver.Daemon,
 		Description: "Wiki Racing Server",
+		Commands: []*cli.Command{
+			{
+				Name:  "config",
+				Usage: "inspect the configuration",
+				Commands: []*cli.Command{
+					{
+						Name:   "print",
+						Usage:  "print the effective configuration after merging the file, environment and flags",
+						Action: wrserver.PrintConfig,
+					},
+				},
+			},
+			{
+				Name:      "solve",
+				Usage:     "print the shortest paths between two articles of the default wiki",
+				ArgsUsage: "<start> <goal>",
+				Action:    wrserver.PrintSolution,
+			},
+		},
 		Flags: []cli.Flag{
+			&cli.Int64Flag{
+				Name:    "cache-bytes",
+				Usage:   "maximum size in bytes of the in-memory cache of each wiki (0 disables the cache)",
+				Sources: env("cache-bytes"),
+				Value:   defaults.Cache.Memory.Bytes,
+			},
 			&cli.StringFlag{
-				Name:  "port",
-				Usage: "port where the server will listen",
-				Validator: func(p string) error {
-					if !govalidator.IsPort(p) {
-						return fmt.Errorf("invalid port %s", p)
-					}
-					return nil
-				},
-				Value: "8080",
+				Name:    "cache-dir",
+				Usage:   "directory for a persistent cache of Wikipedia content, with a subdirectory per wiki (no disk cache if omitted)",
+				Sources: env("cache-dir"),
+			},
+			&cli.DurationFlag{
+				Name:    "cache-dir-age",
+				Usage:   "age after which an entry in the persistent cache is refetched",
+				Sources: env("cache-dir-age"),
+				Value:   defaults.Cache.Disk.MaxAge,
+			},
+			&cli.Int64Flag{
+				Name:    "cache-dir-bytes",
+				Usage:   "maximum size in bytes of the persistent cache of each wiki",
+				Sources: env("cache-dir-bytes"),
+				Value:   defaults.Cache.Disk.Bytes,
+			},
+			&cli.IntFlag{
+				Name:    "cache-entries",
+				Usage:   "maximum number of entries in the in-memory cache of each wiki",
+				Sources: env("cache-entries"),
+				Value:   defaults.Cache.Memory.Entries,
 			},
 			&cli.StringFlag{
-				Name:  "static",
-				Usage: "path to the static SPA flags (CSS, MJS, ...)",
-				Validator: func(p string) error {
-					if len(p) == 0 {
-						return fmt.Errorf("static file path cannot be empty")
-					}
-					return nil
-				},
+				Name:    "config",
+				Usage:   "path to a YAML configuration file such as config.yml",
+				Sources: env("config"),
+			},
+			&cli.StringFlag{
+				Name:    "contact",
+				Usage:   "URL or email address of the operator, included in the User-Agent sent to Wikipedia",
+				Sources: env("contact"),
+			},
+			&cli.IntFlag{
+				Name:    "daily-attempts",
+				Usage:   "candidate pairs tried for a daily challenge before giving up",
+				Sources: env("daily-attempts"),
+				Value:   defaults.Daily.Attempts,
+			},
+			&cli.StringFlag{
+				Name:    "daily-history",
+				Usage:   "JSON file remembering past daily challenges (kept only in memory if not given)",
+				Sources: env("daily-history"),
+			},
+			&cli.StringFlag{
+				Name:    "daily-pool",
+				Usage:   "YAML file of curated pairs or articles for the daily challenge (built-in articles if not given)",
+				Sources: env("daily-pool"),
+			},
+			&cli.BoolFlag{
+				Name:    "daily-prepare",
+				Usage:   "choose today's and tomorrow's daily challenges in the background",
+				Sources: env("daily-prepare"),
+				Value:   defaults.Daily.Prepare,
+			},
+			&cli.StringFlag{
+				Name:    "daily-seed",
+				Usage:   "mixed into the seed of each date, giving this server its own sequence of daily challenges",
+				Sources: env("daily-seed"),
+			},
+			&cli.DurationFlag{
+				Name:    "game-expiry",
+				Usage:   "time after which a game which has not been touched is discarded",
+				Sources: env("game-expiry"),
+				Value:   defaults.Games.Expiry,
+			},
+			&cli.DurationFlag{
+				Name:    "idle-timeout",
+				Usage:   "time a keep-alive connection may wait for its next request (0 is unlimited)",
+				Sources: env("idle-timeout"),
+				Value:   defaults.Server.Timeouts.Idle,
+			},
+			&cli.StringFlag{
+				Name:    "log-level",
+				Usage:   "logging level: trace, debug, info, warn or error",
+				Sources: env("log-level"),
+				Value:   defaults.Log.Level,
+			},
+			&cli.IntFlag{
+				Name:    "max-games",
+				Usage:   "number of games which may be in progress at once",
+				Sources: env("max-games"),
+				Value:   defaults.Games.Max,
+			},
+			&cli.IntFlag{
+				Name:    "max-rooms",
+				Usage:   "number of race rooms which may be open at once",
+				Sources: env("max-rooms"),
+				Value:   defaults.Rooms.Max,
+			},
+			&cli.IntFlag{
+				Name:    "page-burst",
+				Usage:   "number of Wikipedia page requests which may be made at once",
+				Sources: env("page-burst"),
+				Value:   defaults.Upstream.RateLimits.Pages.Burst,
+			},
+			&cli.IntFlag{
+				Name:    "page-queue",
+				Usage:   "number of Wikipedia page requests which may wait for the rate limit before being refused",
+				Sources: env("page-queue"),
+				Value:   defaults.Upstream.RateLimits.Pages.Queue,
+			},
+			&cli.FloatFlag{
+				Name:    "page-rate",
+				Usage:   "sustained Wikipedia page requests per second (0 is unlimited)",
+				Sources: env("page-rate"),
+				Value:   defaults.Upstream.RateLimits.Pages.Rate,
+			},
+			&cli.StringFlag{
+				Name:    "profile",
+				Usage:   "cleanup profile of the pages of a game which chooses none, such as classic, hard or text-only; none if empty",
+				Sources: env("profile"),
+				Value:   defaults.Profiles.Default,
+			},
+			&cli.StringFlag{
+				Name:    "port",
+				Usage:   "port where the server will listen",
+				Sources: env("port"),
+				Value:   defaults.Server.Port,
+			},
+			&cli.DurationFlag{
+				Name:    "read-header-timeout",
+				Usage:   "deadline for reading request headers (0 is unlimited)",
+				Sources: env("read-header-timeout"),
+				Value:   defaults.Server.Timeouts.ReadHeader,
+			},
+			&cli.DurationFlag{
+				Name:    "read-timeout",
+				Usage:   "deadline for reading a whole request (0 is unlimited)",
+				Sources: env("read-timeout"),
+				Value:   defaults.Server.Timeouts.Read,
+			},
+			&cli.DurationFlag{
+				Name:    "room-countdown",
+				Usage:   "time from the host starting a race to it starting for everyone",
+				Sources: env("room-countdown"),
+				Value:   defaults.Rooms.Countdown,
+			},
+			&cli.DurationFlag{
+				Name:    "room-expiry",
+				Usage:   "time after which a race room is closed",
+				Sources: env("room-expiry"),
+				Value:   defaults.Rooms.Expiry,
+			},
+			&cli.IntFlag{
+				Name:    "room-players",
+				Usage:   "number of players who may join a race room",
+				Sources: env("room-players"),
+				Value:   defaults.Rooms.Players,
+			},
+			&cli.BoolFlag{
+				Name:    "sanitize",
+				Usage:   "remove scripts and other active content from Wikipedia pages before serving them",
+				Sources: env("sanitize"),
+				Value:   defaults.Sanitize.Enabled,
+			},
+			&cli.StringSliceFlag{
+				Name:    "sanitize-attributes",
+				Usage:   "comma-separated further attributes kept on any element of a page, other than event handlers",
+				Sources: env("sanitize-attributes"),
+			},
+			&cli.StringSliceFlag{
+				Name:    "sanitize-elements",
+				Usage:   "comma-separated further elements kept in a page, other than scripts and embedded documents",
+				Sources: env("sanitize-elements"),
+			},
+			&cli.BoolFlag{
+				Name:    "sanitize-styles",
+				Usage:   "keep inline CSS in pages, unless it could load anything",
+				Sources: env("sanitize-styles"),
+				Value:   defaults.Sanitize.Styles,
+			},
+			&cli.DurationFlag{
+				Name:    "shutdown-timeout",
+				Usage:   "time allowed for in-flight requests to finish at shutdown (0 is unlimited)",
+				Sources: env("shutdown-timeout"),
+				Value:   defaults.Server.Timeouts.Shutdown,
+			},
+			&cli.IntFlag{
+				Name:    "solve-max-depth",
+				Usage:   "longest path, in links, searched for between two articles",
+				Sources: env("solve-max-depth"),
+				Value:   defaults.Solver.MaxDepth,
+			},
+			&cli.IntFlag{
+				Name:    "solve-max-nodes",
+				Usage:   "number of articles whose links may be fetched in a search for the shortest paths",
+				Sources: env("solve-max-nodes"),
+				Value:   defaults.Solver.MaxNodes,
+			},
+			&cli.IntFlag{
+				Name:    "solve-max-paths",
+				Usage:   "number of optimal paths returned by a search",
+				Sources: env("solve-max-paths"),
+				Value:   defaults.Solver.MaxPaths,
+			},
+			&cli.DurationFlag{
+				Name:    "solve-timeout",
+				Usage:   "time allowed for a search for the shortest paths",
+				Sources: env("solve-timeout"),
+				Value:   defaults.Solver.Timeout,
+			},
+			&cli.IntFlag{
+				Name:    "spectator-codes",
+				Usage:   "number of spectator event codes which may be in use at once",
+				Sources: env("spectator-codes"),
+				Value:   defaults.Spectators.Codes,
+			},
+			&cli.DurationFlag{
+				Name:    "spectator-expiry",
+				Usage:   "time after which a spectator event code with no spectators and no events is discarded",
+				Sources: env("spectator-expiry"),
+				Value:   defaults.Spectators.Expiry,
+			},
+			&cli.IntFlag{
+				Name:    "spectator-log",
+				Usage:   "events kept for each spectator event code, replayed to a spectator who reconnects",
+				Sources: env("spectator-log"),
+				Value:   defaults.Spectators.Log,
+			},
+			&cli.StringFlag{
+				Name:    "static",
+				Usage:   "path to the static SPA flags (CSS, MJS, ...)",
+				Sources: env("static"),
+			},
+			&cli.IntFlag{
+				Name:    "static-burst",
+				Usage:   "number of Wikipedia static asset requests which may be made at once",
+				Sources: env("static-burst"),
+				Value:   defaults.Upstream.RateLimits.Static.Burst,
+			},
+			&cli.IntFlag{
+				Name:    "static-queue",
+				Usage:   "number of Wikipedia static asset requests which may wait for the rate limit before being refused",
+				Sources: env("static-queue"),
+				Value:   defaults.Upstream.RateLimits.Static.Queue,
+			},
+			&cli.FloatFlag{
+				Name:    "static-rate",
+				Usage:   "sustained Wikipedia static asset requests per second (0 is unlimited)",
+				Sources: env("static-rate"),
+				Value:   defaults.Upstream.RateLimits.Static.Rate,
+			},
+			&cli.StringFlag{
+				Name:    "store-file",
+				Usage:   "file of finished games for the leaderboards (kept only in memory if not given)",
+				Sources: env("store-file"),
+			},
+			&cli.StringFlag{
+				Name:    "tls-cert",
+				Usage:   "PEM certificate chain, reloaded when it changes; HTTPS is served when given together with --tls-key",
+				Sources: env("tls-cert"),
+			},
+			&cli.StringFlag{
+				Name:    "tls-key",
+				Usage:   "PEM private key for --tls-cert",
+				Sources: env("tls-key"),
+			},
+			&cli.StringFlag{
+				Name:    "tls-redirect-port",
+				Usage:   "port of an HTTP listener which redirects to HTTPS (none if omitted)",
+				Sources: env("tls-redirect-port"),
+			},
+			&cli.BoolFlag{
+				Name:    "tls-self-signed",
+				Usage:   "serve HTTPS with a generated certificate for localhost, for local testing only",
+				Sources: env("tls-self-signed"),
+			},
+			&cli.StringSliceFlag{
+				Name:    "trace-ids",
+				Usage:   "comma-separated trace IDs to log when --log-level is trace, or all",
+				Sources: env("trace-ids"),
+			},
+			&cli.StringFlag{
+				Name:    "upload-url",
+				Usage:   "base URL of the media host whose images are served through /upload/; empty to link them directly",
+				Sources: env("upload-url"),
+				Value:   defaults.Upstream.Upload,
+			},
+			&cli.IntFlag{
+				Name:    "upstream-retries",
+				Usage:   "number of times a transient Wikipedia failure is retried",
+				Sources: env("upstream-retries"),
+				Value:   defaults.Upstream.Retries,
+			},
+			&cli.DurationFlag{
+				Name:    "upstream-timeout",
+				Usage:   "deadline for each Wikipedia request, covering all retries",
+				Sources: env("upstream-timeout"),
+				Value:   defaults.Upstream.Timeout,
+			},
+			&cli.StringFlag{
+				Name:    "user-agent",
+				Usage:   "complete User-Agent sent to Wikipedia, overriding --contact",
+				Sources: env("user-agent"),
+			},
+			&cli.StringFlag{
+				Name:    "wiki",
+				Usage:   "default wiki, as a Wikipedia language code (de), a base URL, or name=URL for any MediaWiki site",
+				Sources: env("wiki"),
+				Value:   defaults.Upstream.Wiki,
+			},
+			&cli.StringSliceFlag{
+				Name:    "wikis",
+				Usage:   "comma-separated further wikis which players may choose, in the same form as --wiki",
+				Sources: env("wikis"),
+			},
+			&cli.DurationFlag{
+				Name:    "write-timeout",
+				Usage:   "deadline for writing a response (0 is unlimited)",
+				Sources: env("write-timeout"),
+				Value:   defaults.Server.Timeouts.Write,
 			},
 		},
 		Usage:   "Server for Wiki Racing",
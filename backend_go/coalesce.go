@@ -0,0 +1,98 @@
+package wrserver
+
+import (
+	"context"
+	"sync"
+
+	"github.com/bruceesmith/logger"
+)
+
+// flight is one upstream fetch shared by every caller which asked for the
+// same path while it was in progress
+type flight struct {
+	done        chan struct{}
+	cancel      context.CancelFunc
+	waiters     int
+	body        []byte
+	contentType string
+	err         error
+}
+
+// coalescer is a ClientInterface decorator which deduplicates concurrent
+// Gets of the same path, so that a room full of players opening the same
+// article costs one upstream request. The shared fetch runs until the last
+// interested caller has gone away. GetRandom is never coalesced.
+type coalescer struct {
+	client ClientInterface
+
+	mu      sync.Mutex
+	flights map[string]*flight
+}
+
+// newCoalescer returns a coalescer wrapping client
+func newCoalescer(client ClientInterface) *coalescer {
+	return &coalescer{
+		client:  client,
+		flights: make(map[string]*flight),
+	}
+}
+
+// Get joins the in-flight fetch of path, starting one if there is none.
+// The returned body is shared between callers and must not be modified.
+func (c *coalescer) Get(ctx context.Context, path string) (body []byte, contentType string, err error) {
+	c.mu.Lock()
+	f, found := c.flights[path]
+	if !found {
+		// Keep the caller's values (trace IDs etc.) but not its cancellation,
+		// which is replaced by cancellation once no caller is left waiting
+		fctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		f = &flight{
+			done:   make(chan struct{}),
+			cancel: cancel,
+		}
+		c.flights[path] = f
+		go c.fetch(fctx, path, f)
+	} else {
+		logger.TraceID("coalesce", "join", "path", path)
+	}
+	f.waiters++
+	c.mu.Unlock()
+
+	select {
+	case <-f.done:
+		return f.body, f.contentType, f.err
+	case <-ctx.Done():
+		c.mu.Lock()
+		f.waiters--
+		if f.waiters == 0 {
+			f.cancel()
+			if c.flights[path] == f {
+				delete(c.flights, path)
+			}
+		}
+		c.mu.Unlock()
+		return nil, "", ctx.Err()
+	}
+}
+
+// GetRandom passes straight through to the wrapped client
+func (c *coalescer) GetRandom(ctx context.Context) (path string, err error) {
+	return c.client.GetRandom(ctx)
+}
+
+// Status passes straight through to the wrapped client
+func (c *coalescer) Status() ClientStatus {
+	return clientStatus(c.client)
+}
+
+// fetch performs the shared fetch and publishes its result
+func (c *coalescer) fetch(ctx context.Context, path string, f *flight) {
+	f.body, f.contentType, f.err = c.client.Get(ctx, path)
+	c.mu.Lock()
+	if c.flights[path] == f {
+		delete(c.flights, path)
+	}
+	c.mu.Unlock()
+	f.cancel()
+	close(f.done)
+}
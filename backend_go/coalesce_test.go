@@ -0,0 +1,140 @@
+package wrserver
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bruceesmith/wrspa/backend/wrserver/mocks"
+	"go.uber.org/mock/gomock"
+)
+
+// waitForWaiters blocks until n callers have joined the flight for path
+func waitForWaiters(t *testing.T, c *coalescer, path string, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		c.mu.Lock()
+		f := c.flights[path]
+		joined := f != nil && f.waiters == n
+		c.mu.Unlock()
+		if joined {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("%d callers did not join the flight for %s", n, path)
+}
+
+func TestCoalescer_Get(t *testing.T) {
+	const callers = 20
+	tests := []struct {
+		name    string
+		body    []byte
+		err     error
+		wantErr bool
+	}{
+		{
+			name: "shared success",
+			body: []byte("page"),
+		},
+		{
+			name:    "shared failure",
+			err:     errors.New("not found"),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			release := make(chan struct{})
+			mockClient := mocks.NewMockClientInterface(ctrl)
+			mockClient.EXPECT().Get(gomock.Any(), "/wiki/test").DoAndReturn(
+				func(ctx context.Context, path string) ([]byte, string, error) {
+					<-release
+					return tt.body, "text/html", tt.err
+				},
+			).Times(1)
+
+			c := newCoalescer(mockClient)
+			var wg sync.WaitGroup
+			for range callers {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					body, _, err := c.Get(context.Background(), "/wiki/test")
+					if (err != nil) != tt.wantErr || string(body) != string(tt.body) {
+						t.Errorf("got (%s, %v)", string(body), err)
+					}
+				}()
+			}
+			waitForWaiters(t, c, "/wiki/test", callers)
+			close(release)
+			wg.Wait()
+		})
+	}
+}
+
+func TestCoalescer_Cancel(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	upstreamCancelled := make(chan struct{})
+	mockClient := mocks.NewMockClientInterface(ctrl)
+	mockClient.EXPECT().Get(gomock.Any(), "/wiki/slow").DoAndReturn(
+		func(ctx context.Context, path string) ([]byte, string, error) {
+			<-ctx.Done()
+			close(upstreamCancelled)
+			return nil, "", ctx.Err()
+		},
+	).Times(1)
+
+	c := newCoalescer(mockClient)
+	first, cancelFirst := context.WithCancel(context.Background())
+	second, cancelSecond := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	for _, ctx := range []context.Context{first, second} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, _, err := c.Get(ctx, "/wiki/slow"); !errors.Is(err, context.Canceled) {
+				t.Errorf("got %v, want context.Canceled", err)
+			}
+		}()
+	}
+	waitForWaiters(t, c, "/wiki/slow", 2)
+
+	// One caller leaving must not cancel the fetch for the other
+	cancelFirst()
+	waitForWaiters(t, c, "/wiki/slow", 1)
+	select {
+	case <-upstreamCancelled:
+		t.Fatal("upstream fetch cancelled while a caller was still waiting")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	cancelSecond()
+	select {
+	case <-upstreamCancelled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("upstream fetch not cancelled after every caller left")
+	}
+	wg.Wait()
+}
+
+func TestCoalescer_GetRandom(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient := mocks.NewMockClientInterface(ctrl)
+	mockClient.EXPECT().GetRandom(gomock.Any()).Return("one", nil).Times(2)
+
+	c := newCoalescer(mockClient)
+	c.GetRandom(context.Background())
+	c.GetRandom(context.Background())
+}
@@ -0,0 +1,845 @@
+package wrserver
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/asaskevich/govalidator"
+	"github.com/bruceesmith/logger"
+	"github.com/bruceesmith/wrspa/backend/wrserver/sanitize"
+	"github.com/bruceesmith/wrspa/backend/wrserver/solver"
+	"github.com/urfave/cli/v3"
+	"gopkg.in/yaml.v3"
+)
+
+// Config holds every wrserver setting. Settings are layered: the defaults,
+// then a configuration file such as config.yml, then WRSPA_* environment
+// variables, then command-line flags.
+type Config struct {
+	Server     ServerConfig     `yaml:"server"`
+	Log        LogConfig        `yaml:"log"`
+	Cache      CacheConfig      `yaml:"cache"`
+	Daily      DailyConfig      `yaml:"daily"`
+	Games      GamesConfig      `yaml:"games"`
+	Profiles   ProfilesConfig   `yaml:"profiles"`
+	Rooms      RoomsConfig      `yaml:"rooms"`
+	Sanitize   SanitizeConfig   `yaml:"sanitize"`
+	Solver     SolverConfig     `yaml:"solver"`
+	Spectators SpectatorsConfig `yaml:"spectators"`
+	Store      StoreConfig      `yaml:"store"`
+	TLS        TLSConfig        `yaml:"tls"`
+	Upstream   UpstreamConfig   `yaml:"upstream"`
+}
+
+// ServerConfig holds the settings for the HTTP server
+type ServerConfig struct {
+	Port     string         `yaml:"port"`   // Port where the server listens
+	Static   string         `yaml:"static"` // Folder holding the SPA (index.html, CSS, WASM, ...)
+	Timeouts ServerTimeouts `yaml:"timeouts"`
+}
+
+// ServerTimeouts bounds the time spent on each client connection; zero means
+// no limit
+type ServerTimeouts struct {
+	ReadHeader time.Duration `yaml:"readheader"` // Reading the request headers
+	Read       time.Duration `yaml:"read"`       // Reading the whole request
+	Write      time.Duration `yaml:"write"`      // Writing the response
+	Idle       time.Duration `yaml:"idle"`       // Waiting for the next request on a keep-alive connection
+	Shutdown   time.Duration `yaml:"shutdown"`   // Draining in-flight requests at shutdown
+}
+
+// LogConfig holds the logging settings
+type LogConfig struct {
+	Level    string   `yaml:"level"`    // One of trace, debug, info, warn or error
+	TraceIDs []string `yaml:"traceids"` // Trace IDs to log when the level is trace, or "all"
+}
+
+// CacheConfig holds the settings for the caches of Wikipedia content
+type CacheConfig struct {
+	Memory MemoryCacheConfig `yaml:"memory"`
+	Disk   DiskCacheConfig   `yaml:"disk"`
+}
+
+// MemoryCacheConfig holds the settings for the in-memory cache
+type MemoryCacheConfig struct {
+	Bytes   int64 `yaml:"bytes"`   // Maximum size of the cache of each wiki; zero disables the cache
+	Entries int   `yaml:"entries"` // Maximum number of entries in the cache of each wiki
+}
+
+// DiskCacheConfig holds the settings for the persistent cache
+type DiskCacheConfig struct {
+	Dir    string        `yaml:"dir"`    // Folder holding a subfolder per wiki; empty disables the cache
+	Bytes  int64         `yaml:"bytes"`  // Maximum size of the cache of each wiki
+	MaxAge time.Duration `yaml:"maxage"` // Age after which an entry is refetched
+}
+
+// DailyConfig holds the settings for the daily challenge
+type DailyConfig struct {
+	Pool     string `yaml:"pool"`     // YAML file of curated pairs or articles; the built-in articles if empty
+	History  string `yaml:"history"`  // JSON file remembering past dailies; kept only in memory if empty
+	Seed     string `yaml:"seed"`     // Mixed into the seed of each date
+	Attempts int    `yaml:"attempts"` // Candidate pairs tried for a date before giving up
+	Prepare  bool   `yaml:"prepare"`  // Choose today's and tomorrow's dailies in the background
+}
+
+// GamesConfig holds the settings for game sessions
+type GamesConfig struct {
+	Expiry time.Duration `yaml:"expiry"` // A game untouched for this long is discarded
+	Max    int           `yaml:"max"`    // Number of games which may be held at once
+}
+
+// ProfilesConfig holds the cleanup profiles which a game may choose for its
+// pages
+type ProfilesConfig struct {
+	Default string             `yaml:"default"` // Profile of a game or request which chooses none; pages are not cleaned up if empty
+	Custom  map[string]Profile `yaml:"custom"`  // Further profiles by name, replacing any built-in profile of the same name
+}
+
+// RoomsConfig holds the settings for race rooms
+type RoomsConfig struct {
+	Countdown time.Duration `yaml:"countdown"` // Time from the host starting a race to it starting for everyone
+	Expiry    time.Duration `yaml:"expiry"`    // A room is closed this long after it was created
+	Max       int           `yaml:"max"`       // Number of rooms which may be open at once
+	Players   int           `yaml:"players"`   // Number of players who may join a room
+}
+
+// SpectatorsConfig holds the settings for the event logs streamed to
+// spectators
+type SpectatorsConfig struct {
+	Log    int           `yaml:"log"`    // Events kept for each code, replayed to a spectator who reconnects
+	Codes  int           `yaml:"codes"`  // Number of event codes which may be in use at once
+	Expiry time.Duration `yaml:"expiry"` // A code with no spectators and no events for this long is discarded
+}
+
+// SanitizeConfig holds the settings for the allowlist applied to the HTML of
+// Wikipedia pages before they are served
+type SanitizeConfig struct {
+	Enabled    bool     `yaml:"enabled"`    // Remove active content; pages are passed through unchanged if false
+	Styles     bool     `yaml:"styles"`     // Keep inline CSS which cannot load anything
+	Elements   []string `yaml:"elements"`   // Further elements allowed
+	Attributes []string `yaml:"attributes"` // Further attributes allowed on any element
+}
+
+// SolverConfig bounds each search for the shortest paths between articles,
+// by /api/solve or the solve subcommand
+type SolverConfig struct {
+	MaxDepth int           `yaml:"maxdepth"` // Longest path searched for, in links followed
+	MaxNodes int           `yaml:"maxnodes"` // Articles whose links may be fetched
+	Timeout  time.Duration `yaml:"timeout"`  // Time allowed for a search
+	MaxPaths int           `yaml:"maxpaths"` // Optimal paths returned, at most
+}
+
+// StoreConfig holds the settings for the leaderboards of finished games
+type StoreConfig struct {
+	File string `yaml:"file"` // File of finished games, appended to as each game finishes; kept only in memory if empty
+}
+
+// TLSConfig holds the settings for serving HTTPS
+type TLSConfig struct {
+	Cert       string `yaml:"cert"`       // PEM certificate chain, reloaded when it changes; HTTPS is served when set
+	Key        string `yaml:"key"`        // PEM private key for Cert
+	SelfSigned bool   `yaml:"selfsigned"` // Serve HTTPS with a generated certificate, for local testing
+	Redirect   string `yaml:"redirect"`   // Port of an HTTP listener redirecting to HTTPS; none if empty
+}
+
+// UpstreamConfig holds the settings for requests made to Wikipedia
+type UpstreamConfig struct {
+	Wiki       string        `yaml:"wiki"`      // Default wiki, as a Wikipedia language code, a base URL or name=URL
+	Wikis      []string      `yaml:"wikis"`     // Further wikis which a request may select, in the same form as Wiki
+	Timeout    time.Duration `yaml:"timeout"`   // Deadline for each call, covering all retries
+	Retries    int           `yaml:"retries"`   // Times a transient failure is retried
+	UserAgent  string        `yaml:"useragent"` // Complete User-Agent, overriding Contact
+	Contact    string        `yaml:"contact"`   // URL or email address of the operator, included in the default User-Agent
+	Upload     string        `yaml:"upload"`    // Base URL of the media host whose images are proxied; linked directly if empty
+	RateLimits RateLimits    `yaml:"ratelimits"`
+}
+
+// RateLimits holds the separate outbound budgets for pages and static assets
+type RateLimits struct {
+	Pages  RateLimit `yaml:"pages"`
+	Static RateLimit `yaml:"static"`
+}
+
+// ConfigError is a setting with an unacceptable value
+type ConfigError struct {
+	Key    string // Name of the setting in the configuration file, such as server.port
+	Value  any
+	Reason string
+}
+
+func (e *ConfigError) Error() string {
+	return fmt.Sprintf("invalid %s '%v': %s", e.Key, e.Value, e.Reason)
+}
+
+const (
+	configFlag            = "config"
+	contactFlag           = "contact"
+	dailyAttemptsFlag     = "daily-attempts"
+	dailyHistoryFlag      = "daily-history"
+	dailyPoolFlag         = "daily-pool"
+	dailyPrepareFlag      = "daily-prepare"
+	dailySeedFlag         = "daily-seed"
+	gameExpiryFlag        = "game-expiry"
+	gamesMaxFlag          = "max-games"
+	idleTimeoutFlag       = "idle-timeout"
+	logLevelFlag          = "log-level"
+	pageBurstFlag         = "page-burst"
+	pageQueueFlag         = "page-queue"
+	pageRateFlag          = "page-rate"
+	profileFlag           = "profile"
+	readHeaderTimeoutFlag = "read-header-timeout"
+	readTimeoutFlag       = "read-timeout"
+	roomCountdownFlag     = "room-countdown"
+	roomExpiryFlag        = "room-expiry"
+	roomPlayersFlag       = "room-players"
+	roomsMaxFlag          = "max-rooms"
+	sanitizeFlag          = "sanitize"
+	sanitizeAttrsFlag     = "sanitize-attributes"
+	sanitizeElementsFlag  = "sanitize-elements"
+	sanitizeStylesFlag    = "sanitize-styles"
+	shutdownTimeoutFlag   = "shutdown-timeout"
+	solveMaxDepthFlag     = "solve-max-depth"
+	solveMaxNodesFlag     = "solve-max-nodes"
+	solveMaxPathsFlag     = "solve-max-paths"
+	solveTimeoutFlag      = "solve-timeout"
+	spectatorCodesFlag    = "spectator-codes"
+	spectatorExpiryFlag   = "spectator-expiry"
+	spectatorLogFlag      = "spectator-log"
+	staticBurstFlag       = "static-burst"
+	staticQueueFlag       = "static-queue"
+	staticRateFlag        = "static-rate"
+	storeFileFlag         = "store-file"
+	tlsCertFlag           = "tls-cert"
+	tlsKeyFlag            = "tls-key"
+	tlsRedirectFlag       = "tls-redirect-port"
+	tlsSelfSignedFlag     = "tls-self-signed"
+	traceIDsFlag          = "trace-ids"
+	uploadURLFlag         = "upload-url"
+	upstreamRetriesFlag   = "upstream-retries"
+	upstreamTimeoutFlag   = "upstream-timeout"
+	userAgentFlag         = "user-agent"
+	wikiFlag              = "wiki"
+	wikisFlag             = "wikis"
+	writeTimeoutFlag      = "write-timeout"
+)
+
+// DefaultConfig returns the settings used when neither the configuration
+// file, the environment nor a flag says otherwise
+func DefaultConfig() Config {
+	client := DefaultClientOptions()
+	memory := DefaultCacheOptions()
+	disk := DefaultDiskCacheOptions("")
+	server := DefaultServerOptions()
+	return Config{
+		Server: ServerConfig{
+			Port: "8080",
+			Timeouts: ServerTimeouts{
+				ReadHeader: server.ReadHeaderTimeout,
+				Read:       server.ReadTimeout,
+				Write:      server.WriteTimeout,
+				Idle:       server.IdleTimeout,
+				Shutdown:   server.ShutdownTimeout,
+			},
+		},
+		Log: LogConfig{
+			Level:    "info",
+			TraceIDs: []string{},
+		},
+		Cache: CacheConfig{
+			Memory: MemoryCacheConfig{
+				Bytes:   memory.MaxBytes,
+				Entries: memory.MaxEntries,
+			},
+			Disk: DiskCacheConfig{
+				Bytes:  disk.MaxBytes,
+				MaxAge: disk.MaxAge,
+			},
+		},
+		Daily: DailyConfig{
+			Attempts: server.Daily.Attempts,
+			Prepare:  server.Daily.Prepare,
+		},
+		Games: GamesConfig{
+			Expiry: server.Games.Expiry,
+			Max:    server.Games.Max,
+		},
+		Profiles: ProfilesConfig{
+			Default: server.Profile,
+			Custom:  map[string]Profile{},
+		},
+		Rooms: RoomsConfig{
+			Countdown: server.Rooms.Countdown,
+			Expiry:    server.Rooms.Expiry,
+			Max:       server.Rooms.Max,
+			Players:   server.Rooms.Players,
+		},
+		Sanitize: SanitizeConfig{
+			Enabled:    server.Sanitize != nil,
+			Styles:     server.Sanitize.Styles,
+			Elements:   []string{},
+			Attributes: []string{},
+		},
+		Solver: SolverConfig{
+			MaxDepth: server.Solver.MaxDepth,
+			MaxNodes: server.Solver.MaxNodes,
+			Timeout:  server.Solver.Timeout,
+			MaxPaths: server.Solver.MaxPaths,
+		},
+		Spectators: SpectatorsConfig{
+			Log:    server.Spectators.Log,
+			Codes:  server.Spectators.Codes,
+			Expiry: server.Spectators.Expiry,
+		},
+		Upstream: UpstreamConfig{
+			Wiki:    "en",
+			Wikis:   []string{},
+			Timeout: client.Timeout,
+			Retries: client.Retries,
+			Upload:  "https://upload.wikimedia.org",
+			RateLimits: RateLimits{
+				Pages:  DefaultPageRateLimit(),
+				Static: DefaultStaticRateLimit(),
+			},
+		},
+	}
+}
+
+// LoadConfig reads a YAML configuration file over the defaults. Unknown
+// keys are rejected so that a misspelt setting is not silently ignored.
+func LoadConfig(path string) (Config, error) {
+	cfg := DefaultConfig()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, fmt.Errorf("unable to read configuration file '%s': %w", path, err)
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	err = decoder.Decode(&cfg)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return cfg, fmt.Errorf("unable to parse configuration file '%s': %w", path, err)
+	}
+	return cfg, nil
+}
+
+// Validate checks every setting, returning a *ConfigError for each one
+// which is unacceptable
+func (cfg Config) Validate() error {
+	return cfg.validate(true)
+}
+
+// validate checks every setting; serving is false for a subcommand which
+// does not serve the SPA, and so needs no SPA folder
+func (cfg Config) validate(serving bool) error {
+	var errs []error
+	invalid := func(key string, value any, reason string) {
+		errs = append(errs, &ConfigError{Key: key, Value: value, Reason: reason})
+	}
+	notNegative := func(key string, d time.Duration) {
+		if d < 0 {
+			invalid(key, d, "cannot be negative")
+		}
+	}
+
+	if !govalidator.IsPort(cfg.Server.Port) {
+		invalid("server.port", cfg.Server.Port, "not a valid port")
+	}
+	if serving && cfg.Server.Static == "" {
+		invalid("server.static", cfg.Server.Static, "the SPA folder must be given")
+	}
+	notNegative("server.timeouts.readheader", cfg.Server.Timeouts.ReadHeader)
+	notNegative("server.timeouts.read", cfg.Server.Timeouts.Read)
+	notNegative("server.timeouts.write", cfg.Server.Timeouts.Write)
+	notNegative("server.timeouts.idle", cfg.Server.Timeouts.Idle)
+	notNegative("server.timeouts.shutdown", cfg.Server.Timeouts.Shutdown)
+
+	var level logger.LogLevel
+	if err := level.Set(cfg.Log.Level); err != nil {
+		invalid("log.level", cfg.Log.Level, "must be one of trace, debug, info, warn or error")
+	}
+
+	if cfg.Cache.Memory.Bytes < 0 {
+		invalid("cache.memory.bytes", cfg.Cache.Memory.Bytes, "cannot be negative")
+	}
+	if cfg.Cache.Memory.Entries < 0 {
+		invalid("cache.memory.entries", cfg.Cache.Memory.Entries, "cannot be negative")
+	}
+	if cfg.Cache.Disk.Bytes <= 0 {
+		invalid("cache.disk.bytes", cfg.Cache.Disk.Bytes, "must be positive")
+	}
+	notNegative("cache.disk.maxage", cfg.Cache.Disk.MaxAge)
+
+	if cfg.Daily.Attempts <= 0 {
+		invalid("daily.attempts", cfg.Daily.Attempts, "must be positive")
+	}
+
+	if cfg.Games.Expiry <= 0 {
+		invalid("games.expiry", cfg.Games.Expiry, "must be positive")
+	}
+	if cfg.Games.Max <= 0 {
+		invalid("games.max", cfg.Games.Max, "must be positive")
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(cfg.Profiles.Custom)) {
+		profile := cfg.Profiles.Custom[name]
+		if !wikiName.MatchString(name) {
+			invalid("profiles.custom", name, "not a valid profile name")
+		} else if _, err := newCleaner(profile); err != nil {
+			invalid("profiles.custom."+name, profile.Remove, err.Error())
+		}
+	}
+	if _, found := cfg.profiles()[cfg.Profiles.Default]; !found && cfg.Profiles.Default != "" {
+		invalid("profiles.default", cfg.Profiles.Default, "no such profile")
+	}
+
+	notNegative("rooms.countdown", cfg.Rooms.Countdown)
+	if cfg.Rooms.Expiry <= 0 {
+		invalid("rooms.expiry", cfg.Rooms.Expiry, "must be positive")
+	}
+	if cfg.Rooms.Max <= 0 {
+		invalid("rooms.max", cfg.Rooms.Max, "must be positive")
+	}
+	if cfg.Rooms.Players <= 0 {
+		invalid("rooms.players", cfg.Rooms.Players, "must be positive")
+	}
+
+	if cfg.Spectators.Log <= 0 {
+		invalid("spectators.log", cfg.Spectators.Log, "must be positive")
+	}
+	if cfg.Spectators.Codes <= 0 {
+		invalid("spectators.codes", cfg.Spectators.Codes, "must be positive")
+	}
+	if cfg.Spectators.Expiry <= 0 {
+		invalid("spectators.expiry", cfg.Spectators.Expiry, "must be positive")
+	}
+
+	if cfg.Solver.MaxDepth <= 0 {
+		invalid("solver.maxdepth", cfg.Solver.MaxDepth, "must be positive")
+	}
+	if cfg.Solver.MaxNodes <= 0 {
+		invalid("solver.maxnodes", cfg.Solver.MaxNodes, "must be positive")
+	}
+	if cfg.Solver.Timeout <= 0 {
+		invalid("solver.timeout", cfg.Solver.Timeout, "must be positive")
+	}
+	if cfg.Solver.MaxPaths <= 0 {
+		invalid("solver.maxpaths", cfg.Solver.MaxPaths, "must be positive")
+	}
+
+	if (cfg.TLS.Cert == "") != (cfg.TLS.Key == "") {
+		if cfg.TLS.Cert == "" {
+			invalid("tls.cert", cfg.TLS.Cert, "required when tls.key is set")
+		} else {
+			invalid("tls.key", cfg.TLS.Key, "required when tls.cert is set")
+		}
+	}
+	if cfg.TLS.SelfSigned && cfg.TLS.Cert != "" {
+		invalid("tls.selfsigned", cfg.TLS.SelfSigned, "cannot be combined with tls.cert")
+	}
+	if cfg.TLS.Redirect != "" {
+		switch {
+		case !govalidator.IsPort(cfg.TLS.Redirect):
+			invalid("tls.redirect", cfg.TLS.Redirect, "not a valid port")
+		case cfg.TLS.Cert == "" && !cfg.TLS.SelfSigned:
+			invalid("tls.redirect", cfg.TLS.Redirect, "requires tls.cert or tls.selfsigned")
+		case cfg.TLS.Redirect == cfg.Server.Port:
+			invalid("tls.redirect", cfg.TLS.Redirect, "must differ from server.port")
+		}
+	}
+
+	names := make(map[string]bool)
+	if wiki, err := ParseWiki(cfg.Upstream.Wiki); err != nil {
+		invalid("upstream.wiki", cfg.Upstream.Wiki, err.Error())
+	} else {
+		names[wiki.Name] = true
+	}
+	for i, spec := range cfg.Upstream.Wikis {
+		key := fmt.Sprintf("upstream.wikis[%d]", i)
+		wiki, err := ParseWiki(spec)
+		switch {
+		case err != nil:
+			invalid(key, spec, err.Error())
+		case names[wiki.Name]:
+			invalid(key, spec, "the wiki name '"+wiki.Name+"' is already in use")
+		default:
+			names[wiki.Name] = true
+		}
+	}
+	if cfg.Upstream.Upload != "" {
+		if u, err := url.Parse(cfg.Upstream.Upload); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			invalid("upstream.upload", cfg.Upstream.Upload, "not an absolute http or https URL")
+		}
+	}
+	if cfg.Upstream.Timeout <= 0 {
+		invalid("upstream.timeout", cfg.Upstream.Timeout, "must be positive")
+	}
+	if cfg.Upstream.Retries < 0 {
+		invalid("upstream.retries", cfg.Upstream.Retries, "cannot be negative")
+	}
+	budgets := []struct {
+		key   string
+		limit RateLimit
+	}{
+		{"upstream.ratelimits.pages", cfg.Upstream.RateLimits.Pages},
+		{"upstream.ratelimits.static", cfg.Upstream.RateLimits.Static},
+	}
+	for _, budget := range budgets {
+		key, limit := budget.key, budget.limit
+		if limit.Rate < 0 {
+			invalid(key+".rate", limit.Rate, "cannot be negative")
+		}
+		if limit.Burst < 0 {
+			invalid(key+".burst", limit.Burst, "cannot be negative")
+		}
+		if limit.Queue < 0 {
+			invalid(key+".queue", limit.Queue, "cannot be negative")
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// configure loads the configuration file named by the --config flag, if
+// any, applies any flags which were set explicitly or through their
+// WRSPA_* environment variable, and validates the result
+func configure(cmd *cli.Command) (cfg Config, err error) {
+	cfg, err = mergeConfig(cmd)
+	if err != nil {
+		return
+	}
+	err = cfg.Validate()
+	return
+}
+
+// mergeConfig loads the configuration file named by the --config flag, if
+// any, and applies any flags which were set explicitly or through their
+// WRSPA_* environment variable, without validating the result
+func mergeConfig(cmd *cli.Command) (cfg Config, err error) {
+	cfg = DefaultConfig()
+	if path := cmd.String(configFlag); path != "" {
+		cfg, err = LoadConfig(path)
+		if err != nil {
+			return
+		}
+	}
+
+	srv := &cfg.Server
+	if cmd.IsSet(portFlag) {
+		srv.Port = cmd.String(portFlag)
+	}
+	if cmd.IsSet(staticFlag) {
+		srv.Static = cmd.String(staticFlag)
+	}
+	if cmd.IsSet(readHeaderTimeoutFlag) {
+		srv.Timeouts.ReadHeader = cmd.Duration(readHeaderTimeoutFlag)
+	}
+	if cmd.IsSet(readTimeoutFlag) {
+		srv.Timeouts.Read = cmd.Duration(readTimeoutFlag)
+	}
+	if cmd.IsSet(writeTimeoutFlag) {
+		srv.Timeouts.Write = cmd.Duration(writeTimeoutFlag)
+	}
+	if cmd.IsSet(idleTimeoutFlag) {
+		srv.Timeouts.Idle = cmd.Duration(idleTimeoutFlag)
+	}
+	if cmd.IsSet(shutdownTimeoutFlag) {
+		srv.Timeouts.Shutdown = cmd.Duration(shutdownTimeoutFlag)
+	}
+
+	if cmd.IsSet(logLevelFlag) {
+		cfg.Log.Level = cmd.String(logLevelFlag)
+	}
+	if cmd.IsSet(traceIDsFlag) {
+		cfg.Log.TraceIDs = cmd.StringSlice(traceIDsFlag)
+	}
+
+	cache := &cfg.Cache
+	if cmd.IsSet(cacheBytesFlag) {
+		cache.Memory.Bytes = cmd.Int64(cacheBytesFlag)
+	}
+	if cmd.IsSet(cacheEntriesFlag) {
+		cache.Memory.Entries = cmd.Int(cacheEntriesFlag)
+	}
+	if cmd.IsSet(cacheDirFlag) {
+		cache.Disk.Dir = cmd.String(cacheDirFlag)
+	}
+	if cmd.IsSet(cacheDirBytesFlag) {
+		cache.Disk.Bytes = cmd.Int64(cacheDirBytesFlag)
+	}
+	if cmd.IsSet(cacheDirAgeFlag) {
+		cache.Disk.MaxAge = cmd.Duration(cacheDirAgeFlag)
+	}
+
+	if cmd.IsSet(dailyPoolFlag) {
+		cfg.Daily.Pool = cmd.String(dailyPoolFlag)
+	}
+	if cmd.IsSet(dailyHistoryFlag) {
+		cfg.Daily.History = cmd.String(dailyHistoryFlag)
+	}
+	if cmd.IsSet(dailySeedFlag) {
+		cfg.Daily.Seed = cmd.String(dailySeedFlag)
+	}
+	if cmd.IsSet(dailyAttemptsFlag) {
+		cfg.Daily.Attempts = cmd.Int(dailyAttemptsFlag)
+	}
+	if cmd.IsSet(dailyPrepareFlag) {
+		cfg.Daily.Prepare = cmd.Bool(dailyPrepareFlag)
+	}
+
+	if cmd.IsSet(gameExpiryFlag) {
+		cfg.Games.Expiry = cmd.Duration(gameExpiryFlag)
+	}
+	if cmd.IsSet(gamesMaxFlag) {
+		cfg.Games.Max = cmd.Int(gamesMaxFlag)
+	}
+
+	if cmd.IsSet(profileFlag) {
+		cfg.Profiles.Default = cmd.String(profileFlag)
+	}
+
+	if cmd.IsSet(roomCountdownFlag) {
+		cfg.Rooms.Countdown = cmd.Duration(roomCountdownFlag)
+	}
+	if cmd.IsSet(roomExpiryFlag) {
+		cfg.Rooms.Expiry = cmd.Duration(roomExpiryFlag)
+	}
+	if cmd.IsSet(roomsMaxFlag) {
+		cfg.Rooms.Max = cmd.Int(roomsMaxFlag)
+	}
+	if cmd.IsSet(roomPlayersFlag) {
+		cfg.Rooms.Players = cmd.Int(roomPlayersFlag)
+	}
+
+	if cmd.IsSet(sanitizeFlag) {
+		cfg.Sanitize.Enabled = cmd.Bool(sanitizeFlag)
+	}
+	if cmd.IsSet(sanitizeStylesFlag) {
+		cfg.Sanitize.Styles = cmd.Bool(sanitizeStylesFlag)
+	}
+	if cmd.IsSet(sanitizeElementsFlag) {
+		cfg.Sanitize.Elements = cmd.StringSlice(sanitizeElementsFlag)
+	}
+	if cmd.IsSet(sanitizeAttrsFlag) {
+		cfg.Sanitize.Attributes = cmd.StringSlice(sanitizeAttrsFlag)
+	}
+
+	if cmd.IsSet(solveMaxDepthFlag) {
+		cfg.Solver.MaxDepth = cmd.Int(solveMaxDepthFlag)
+	}
+	if cmd.IsSet(solveMaxNodesFlag) {
+		cfg.Solver.MaxNodes = cmd.Int(solveMaxNodesFlag)
+	}
+	if cmd.IsSet(solveTimeoutFlag) {
+		cfg.Solver.Timeout = cmd.Duration(solveTimeoutFlag)
+	}
+	if cmd.IsSet(solveMaxPathsFlag) {
+		cfg.Solver.MaxPaths = cmd.Int(solveMaxPathsFlag)
+	}
+
+	if cmd.IsSet(spectatorLogFlag) {
+		cfg.Spectators.Log = cmd.Int(spectatorLogFlag)
+	}
+	if cmd.IsSet(spectatorCodesFlag) {
+		cfg.Spectators.Codes = cmd.Int(spectatorCodesFlag)
+	}
+	if cmd.IsSet(spectatorExpiryFlag) {
+		cfg.Spectators.Expiry = cmd.Duration(spectatorExpiryFlag)
+	}
+
+	if cmd.IsSet(storeFileFlag) {
+		cfg.Store.File = cmd.String(storeFileFlag)
+	}
+
+	if cmd.IsSet(tlsCertFlag) {
+		cfg.TLS.Cert = cmd.String(tlsCertFlag)
+	}
+	if cmd.IsSet(tlsKeyFlag) {
+		cfg.TLS.Key = cmd.String(tlsKeyFlag)
+	}
+	if cmd.IsSet(tlsSelfSignedFlag) {
+		cfg.TLS.SelfSigned = cmd.Bool(tlsSelfSignedFlag)
+	}
+	if cmd.IsSet(tlsRedirectFlag) {
+		cfg.TLS.Redirect = cmd.String(tlsRedirectFlag)
+	}
+
+	up := &cfg.Upstream
+	if cmd.IsSet(wikiFlag) {
+		up.Wiki = cmd.String(wikiFlag)
+	}
+	if cmd.IsSet(wikisFlag) {
+		up.Wikis = cmd.StringSlice(wikisFlag)
+	}
+	if cmd.IsSet(upstreamTimeoutFlag) {
+		up.Timeout = cmd.Duration(upstreamTimeoutFlag)
+	}
+	if cmd.IsSet(upstreamRetriesFlag) {
+		up.Retries = cmd.Int(upstreamRetriesFlag)
+	}
+	if cmd.IsSet(userAgentFlag) {
+		up.UserAgent = cmd.String(userAgentFlag)
+	}
+	if cmd.IsSet(uploadURLFlag) {
+		up.Upload = cmd.String(uploadURLFlag)
+	}
+	if cmd.IsSet(contactFlag) {
+		up.Contact = cmd.String(contactFlag)
+	}
+	if cmd.IsSet(pageRateFlag) {
+		up.RateLimits.Pages.Rate = cmd.Float(pageRateFlag)
+	}
+	if cmd.IsSet(pageBurstFlag) {
+		up.RateLimits.Pages.Burst = cmd.Int(pageBurstFlag)
+	}
+	if cmd.IsSet(pageQueueFlag) {
+		up.RateLimits.Pages.Queue = cmd.Int(pageQueueFlag)
+	}
+	if cmd.IsSet(staticRateFlag) {
+		up.RateLimits.Static.Rate = cmd.Float(staticRateFlag)
+	}
+	if cmd.IsSet(staticBurstFlag) {
+		up.RateLimits.Static.Burst = cmd.Int(staticBurstFlag)
+	}
+	if cmd.IsSet(staticQueueFlag) {
+		up.RateLimits.Static.Queue = cmd.Int(staticQueueFlag)
+	}
+	return
+}
+
+// PrintConfig is the action for the "config print" subcommand. It writes
+// the effective configuration, after merging every source, as YAML.
+func PrintConfig(ctx context.Context, cmd *cli.Command) error {
+	cfg, err := configure(cmd)
+	if err != nil {
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
+	encoder := yaml.NewEncoder(cmd.Root().Writer)
+	encoder.SetIndent(2)
+	defer encoder.Close()
+	return encoder.Encode(cfg)
+}
+
+// configureLogging applies the logging settings
+func (cfg Config) configureLogging() {
+	var level logger.LogLevel
+	if err := level.Set(cfg.Log.Level); err == nil {
+		logger.SetLevel(slog.Level(level))
+	}
+	logger.SetTraceIds(cfg.Log.TraceIDs...)
+}
+
+// clientOptions converts the upstream settings into ClientOptions
+func (cfg Config) clientOptions() ClientOptions {
+	options := DefaultClientOptions()
+	options.Timeout = cfg.Upstream.Timeout
+	options.Retries = cfg.Upstream.Retries
+	options.UserAgent = cfg.Upstream.UserAgent
+	if options.UserAgent == "" {
+		options.UserAgent = UserAgent(cfg.Upstream.Contact)
+	}
+	options.PageLimit = cfg.Upstream.RateLimits.Pages
+	options.StaticLimit = cfg.Upstream.RateLimits.Static
+	return options
+}
+
+// wikis returns the default wiki followed by the others in the allowlist;
+// the configuration must have been validated
+func (cfg Config) wikis() []Wiki {
+	var wikis []Wiki
+	for _, spec := range append([]string{cfg.Upstream.Wiki}, cfg.Upstream.Wikis...) {
+		wiki, _ := ParseWiki(spec)
+		wikis = append(wikis, wiki)
+	}
+	return wikis
+}
+
+// cacheOptions converts the in-memory cache settings into CacheOptions
+func (cfg Config) cacheOptions() CacheOptions {
+	options := DefaultCacheOptions()
+	options.MaxBytes = cfg.Cache.Memory.Bytes
+	options.MaxEntries = cfg.Cache.Memory.Entries
+	return options
+}
+
+// diskCacheOptions converts the persistent cache settings into
+// DiskCacheOptions for one wiki, which is cached in its own subdirectory
+func (cfg Config) diskCacheOptions(wiki Wiki) DiskCacheOptions {
+	options := DefaultDiskCacheOptions(filepath.Join(cfg.Cache.Disk.Dir, wiki.Name))
+	options.MaxBytes = cfg.Cache.Disk.Bytes
+	options.MaxAge = cfg.Cache.Disk.MaxAge
+	return options
+}
+
+// serverOptions converts the server and TLS settings into ServerOptions
+func (cfg Config) serverOptions() ServerOptions {
+	var sanitizer *sanitize.Options
+	if cfg.Sanitize.Enabled {
+		sanitizer = &sanitize.Options{
+			Styles:     cfg.Sanitize.Styles,
+			Elements:   cfg.Sanitize.Elements,
+			Attributes: cfg.Sanitize.Attributes,
+		}
+	}
+	return ServerOptions{
+		ReadHeaderTimeout: cfg.Server.Timeouts.ReadHeader,
+		ReadTimeout:       cfg.Server.Timeouts.Read,
+		WriteTimeout:      cfg.Server.Timeouts.Write,
+		IdleTimeout:       cfg.Server.Timeouts.Idle,
+		ShutdownTimeout:   cfg.Server.Timeouts.Shutdown,
+		TLSCert:           cfg.TLS.Cert,
+		TLSKey:            cfg.TLS.Key,
+		TLSSelfSigned:     cfg.TLS.SelfSigned,
+		RedirectPort:      cfg.TLS.Redirect,
+		Daily: DailyOptions{
+			Pool:     cfg.Daily.Pool,
+			History:  cfg.Daily.History,
+			Seed:     cfg.Daily.Seed,
+			Attempts: cfg.Daily.Attempts,
+			Prepare:  cfg.Daily.Prepare,
+		},
+		Games: GameOptions{
+			Expiry: cfg.Games.Expiry,
+			Max:    cfg.Games.Max,
+		},
+		Profile:  cfg.Profiles.Default,
+		Profiles: cfg.profiles(),
+		Rooms: RoomOptions{
+			Countdown: cfg.Rooms.Countdown,
+			Expiry:    cfg.Rooms.Expiry,
+			Max:       cfg.Rooms.Max,
+			Players:   cfg.Rooms.Players,
+		},
+		Sanitize: sanitizer,
+		Spectators: SpectatorOptions{
+			Log:    cfg.Spectators.Log,
+			Codes:  cfg.Spectators.Codes,
+			Expiry: cfg.Spectators.Expiry,
+		},
+		Solver: cfg.solverOptions(),
+	}
+}
+
+// profiles returns the built-in profiles and the custom ones, by name
+func (cfg Config) profiles() map[string]Profile {
+	profiles := DefaultProfiles()
+	maps.Copy(profiles, cfg.Profiles.Custom)
+	return profiles
+}
+
+// solverOptions converts the solver settings into solver.Options
+func (cfg Config) solverOptions() solver.Options {
+	options := solver.DefaultOptions()
+	options.MaxDepth = cfg.Solver.MaxDepth
+	options.MaxNodes = cfg.Solver.MaxNodes
+	options.Timeout = cfg.Solver.Timeout
+	options.MaxPaths = cfg.Solver.MaxPaths
+	return options
+}
@@ -0,0 +1,370 @@
+package wrserver
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/urfave/cli/v3"
+	"gopkg.in/yaml.v3"
+)
+
+func TestLoadConfig(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		os.WriteFile(path, []byte(content), 0o644)
+		return path
+	}
+
+	tests := []struct {
+		name       string
+		path       string
+		want       func(Config) bool
+		shouldFail bool
+	}{
+		{
+			name: "repository config.yml documents the defaults",
+			path: "config.yml",
+			want: func(cfg Config) bool { return reflect.DeepEqual(cfg, DefaultConfig()) },
+		},
+		{
+			name: "partial file keeps defaults",
+			path: write("partial.yml", "upstream:\n  contact: ops@example.org\n  ratelimits:\n    pages:\n      rate: 2\n"),
+			want: func(cfg Config) bool {
+				return cfg.Upstream.Contact == "ops@example.org" &&
+					cfg.Upstream.RateLimits.Pages.Rate == 2 &&
+					cfg.Upstream.RateLimits.Static == DefaultStaticRateLimit()
+			},
+		},
+		{
+			name: "empty file",
+			path: write("empty.yml", ""),
+			want: func(cfg Config) bool { return cfg.Upstream.RateLimits.Pages == DefaultPageRateLimit() },
+		},
+		{
+			name:       "unknown key",
+			path:       write("unknown.yml", "upstream:\n  contakt: ops@example.org\n"),
+			shouldFail: true,
+		},
+		{
+			name:       "missing file",
+			path:       filepath.Join(dir, "missing.yml"),
+			shouldFail: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := LoadConfig(tt.path)
+			if tt.shouldFail {
+				if err == nil {
+					t.Errorf("expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !tt.want(cfg) {
+				t.Errorf("unexpected config %+v", cfg)
+			}
+		})
+	}
+}
+
+func TestConfig_Validate(t *testing.T) {
+	valid := func() Config {
+		cfg := DefaultConfig()
+		cfg.Server.Static = "testdata"
+		return cfg
+	}
+
+	tests := []struct {
+		name   string
+		modify func(*Config)
+		keys   []string
+	}{
+		{
+			name:   "defaults with a static folder",
+			modify: func(cfg *Config) {},
+		},
+		{
+			name:   "bad port",
+			modify: func(cfg *Config) { cfg.Server.Port = "http" },
+			keys:   []string{"server.port"},
+		},
+		{
+			name:   "missing static folder",
+			modify: func(cfg *Config) { cfg.Server.Static = "" },
+			keys:   []string{"server.static"},
+		},
+		{
+			name:   "negative timeout",
+			modify: func(cfg *Config) { cfg.Server.Timeouts.Idle = -time.Second },
+			keys:   []string{"server.timeouts.idle"},
+		},
+		{
+			name:   "unknown log level",
+			modify: func(cfg *Config) { cfg.Log.Level = "loud" },
+			keys:   []string{"log.level"},
+		},
+		{
+			name:   "negative cache size",
+			modify: func(cfg *Config) { cfg.Cache.Memory.Bytes = -1 },
+			keys:   []string{"cache.memory.bytes"},
+		},
+		{
+			name:   "zero disk cache size",
+			modify: func(cfg *Config) { cfg.Cache.Disk.Bytes = 0 },
+			keys:   []string{"cache.disk.bytes"},
+		},
+		{
+			name:   "no daily attempts",
+			modify: func(cfg *Config) { cfg.Daily.Attempts = 0 },
+			keys:   []string{"daily.attempts"},
+		},
+		{
+			name:   "unknown profile",
+			modify: func(cfg *Config) { cfg.Profiles.Default = "easy" },
+			keys:   []string{"profiles.default"},
+		},
+		{
+			name: "invalid custom profiles",
+			modify: func(cfg *Config) {
+				cfg.Profiles.Custom = map[string]Profile{"Easy": {}, "tidy": {Remove: []string{"div p"}}}
+			},
+			keys: []string{"profiles.custom", "profiles.custom.tidy"},
+		},
+		{
+			name: "custom default profile",
+			modify: func(cfg *Config) {
+				cfg.Profiles.Custom = map[string]Profile{"tidy": {Remove: []string{".mw-editsection"}}}
+				cfg.Profiles.Default = "tidy"
+			},
+		},
+		{
+			name: "rooms without players",
+			modify: func(cfg *Config) {
+				cfg.Rooms.Countdown = -time.Second
+				cfg.Rooms.Players = 0
+			},
+			keys: []string{"rooms.countdown", "rooms.players"},
+		},
+		{
+			name:   "no spectator log",
+			modify: func(cfg *Config) { cfg.Spectators.Log = 0 },
+			keys:   []string{"spectators.log"},
+		},
+		{
+			name: "unbounded solver",
+			modify: func(cfg *Config) {
+				cfg.Solver.MaxDepth, cfg.Solver.MaxNodes = 0, -1
+				cfg.Solver.Timeout, cfg.Solver.MaxPaths = 0, 0
+			},
+			keys: []string{"solver.maxdepth", "solver.maxnodes", "solver.timeout", "solver.maxpaths"},
+		},
+		{
+			name:   "certificate without key",
+			modify: func(cfg *Config) { cfg.TLS.Cert = "cert.pem" },
+			keys:   []string{"tls.key"},
+		},
+		{
+			name: "self-signed with a certificate",
+			modify: func(cfg *Config) {
+				cfg.TLS.Cert, cfg.TLS.Key = "cert.pem", "key.pem"
+				cfg.TLS.SelfSigned = true
+			},
+			keys: []string{"tls.selfsigned"},
+		},
+		{
+			name:   "redirect without TLS",
+			modify: func(cfg *Config) { cfg.TLS.Redirect = "8081" },
+			keys:   []string{"tls.redirect"},
+		},
+		{
+			name: "redirect to the same port",
+			modify: func(cfg *Config) {
+				cfg.TLS.SelfSigned = true
+				cfg.TLS.Redirect = cfg.Server.Port
+			},
+			keys: []string{"tls.redirect"},
+		},
+		{
+			name:   "relative wiki URL",
+			modify: func(cfg *Config) { cfg.Upstream.Wiki = "en.wikipedia.org" },
+			keys:   []string{"upstream.wiki"},
+		},
+		{
+			name:   "allowlist of wikis",
+			modify: func(cfg *Config) { cfg.Upstream.Wikis = []string{"de", "fr", "example=https://wiki.example.org"} },
+		},
+		{
+			name:   "bad and repeated wikis",
+			modify: func(cfg *Config) { cfg.Upstream.Wikis = []string{"de", "Fr", "https://de.wikipedia.org"} },
+			keys:   []string{"upstream.wikis[1]", "upstream.wikis[2]"},
+		},
+		{
+			name:   "default wiki repeated",
+			modify: func(cfg *Config) { cfg.Upstream.Wikis = []string{"en"} },
+			keys:   []string{"upstream.wikis[0]"},
+		},
+		{
+			name:   "relative upload URL",
+			modify: func(cfg *Config) { cfg.Upstream.Upload = "/upload" },
+			keys:   []string{"upstream.upload"},
+		},
+		{
+			name: "several bad settings",
+			modify: func(cfg *Config) {
+				cfg.Upstream.Timeout = 0
+				cfg.Upstream.RateLimits.Static.Queue = -1
+			},
+			keys: []string{"upstream.timeout", "upstream.ratelimits.static.queue"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := valid()
+			tt.modify(&cfg)
+			err := cfg.Validate()
+			if len(tt.keys) == 0 {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("expected errors for %v, got nil", tt.keys)
+			}
+			var keys []string
+			for _, e := range err.(interface{ Unwrap() []error }).Unwrap() {
+				var ce *ConfigError
+				if !errors.As(e, &ce) {
+					t.Fatalf("expected *ConfigError, got %T", e)
+				}
+				keys = append(keys, ce.Key)
+			}
+			if !reflect.DeepEqual(keys, tt.keys) {
+				t.Errorf("got errors for %v, want %v", keys, tt.keys)
+			}
+			for _, key := range tt.keys {
+				if !strings.Contains(err.Error(), key) {
+					t.Errorf("error %q does not name %s", err.Error(), key)
+				}
+			}
+		})
+	}
+}
+
+// configCommand returns a Command with a subset of the wrserver flags which
+// runs action
+func configCommand(action cli.ActionFunc) *cli.Command {
+	return &cli.Command{
+		Flags: []cli.Flag{
+			&cli.StringFlag{Name: configFlag},
+			&cli.StringFlag{Name: contactFlag},
+			&cli.StringFlag{Name: logLevelFlag, Sources: cli.EnvVars("WRSPA_LOG_LEVEL")},
+			&cli.FloatFlag{Name: pageRateFlag},
+			&cli.IntFlag{Name: pageBurstFlag, Value: 99},
+			&cli.StringFlag{Name: portFlag, Sources: cli.EnvVars("WRSPA_PORT")},
+			&cli.StringFlag{Name: staticFlag},
+			&cli.StringSliceFlag{Name: traceIDsFlag, Sources: cli.EnvVars("WRSPA_TRACE_IDS")},
+			&cli.DurationFlag{Name: upstreamTimeoutFlag, Sources: cli.EnvVars("WRSPA_UPSTREAM_TIMEOUT")},
+		},
+		Commands: []*cli.Command{
+			{
+				Name:   "print",
+				Action: action,
+			},
+		},
+		Action: action,
+	}
+}
+
+func TestConfigure(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	os.WriteFile(path, []byte("server:\n  port: \"9000\"\n  static: testdata\nlog:\n  level: debug\nupstream:\n  contact: file@example.org\n  timeout: 5s\n  ratelimits:\n    pages:\n      rate: 2\n      burst: 3\n"), 0o644)
+	t.Setenv("WRSPA_PORT", "9001")
+	t.Setenv("WRSPA_LOG_LEVEL", "warn")
+	t.Setenv("WRSPA_TRACE_IDS", "client,server")
+
+	var cfg Config
+	cmd := configCommand(func(ctx context.Context, cmd *cli.Command) (err error) {
+		cfg, err = configure(cmd)
+		return
+	})
+	err := cmd.Run(context.Background(), []string{"wrserver", "--config", path, "--page-rate", "5", "--port", "9002"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if cfg.Server.Port != "9002" {
+		t.Errorf("a flag should override the environment and the file, got port %s", cfg.Server.Port)
+	}
+	if cfg.Log.Level != "warn" || !reflect.DeepEqual(cfg.Log.TraceIDs, []string{"client", "server"}) {
+		t.Errorf("the environment should override the file, got %+v", cfg.Log)
+	}
+	if cfg.Upstream.Timeout != 5*time.Second || cfg.Server.Static != "testdata" {
+		t.Errorf("the file should override the defaults, got timeout %v and static %s", cfg.Upstream.Timeout, cfg.Server.Static)
+	}
+	pages := cfg.Upstream.RateLimits.Pages
+	if pages.Rate != 5 || pages.Burst != 3 {
+		t.Errorf("flags set explicitly should override the file, and defaults should not, got %+v", pages)
+	}
+	options := cfg.clientOptions()
+	if options.UserAgent != "wrspa/1.0 (file@example.org)" || options.Timeout != 5*time.Second {
+		t.Errorf("got client options %+v", options)
+	}
+}
+
+func TestConfigure_Invalid(t *testing.T) {
+	t.Setenv("WRSPA_UPSTREAM_TIMEOUT", "-1s")
+
+	cmd := configCommand(func(ctx context.Context, cmd *cli.Command) error {
+		_, err := configure(cmd)
+		return err
+	})
+	err := cmd.Run(context.Background(), []string{"wrserver", "--static", "testdata", "--port", "none"})
+	if err == nil {
+		t.Fatal("expected an error, got nil")
+	}
+	for _, key := range []string{"server.port", "upstream.timeout"} {
+		if !strings.Contains(err.Error(), key) {
+			t.Errorf("error %q does not name %s", err.Error(), key)
+		}
+	}
+}
+
+func TestPrintConfig(t *testing.T) {
+	t.Setenv("WRSPA_PORT", "9001")
+
+	var out bytes.Buffer
+	cmd := configCommand(PrintConfig)
+	cmd.Writer = &out
+	err := cmd.Run(context.Background(), []string{"wrserver", "--static", "testdata", "print"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var printed Config
+	if err := yaml.Unmarshal(out.Bytes(), &printed); err != nil {
+		t.Fatalf("printed configuration is not YAML: %v\n%s", err, out.String())
+	}
+	want := DefaultConfig()
+	want.Server.Port = "9001"
+	want.Server.Static = "testdata"
+	if !reflect.DeepEqual(printed, want) {
+		t.Errorf("got\n%s", out.String())
+	}
+	if !strings.Contains(out.String(), "timeout: 30s") {
+		t.Errorf("durations should be printed in Go syntax, got\n%s", out.String())
+	}
+}
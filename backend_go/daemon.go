@@ -3,9 +3,12 @@ package wrserver
 import (
 	"context"
 	"fmt"
+	"net/url"
+	"strings"
 
 	"github.com/bruceesmith/logger"
 	"github.com/bruceesmith/terminator"
+	"github.com/bruceesmith/wrspa/backend/wrserver/title"
 	"github.com/urfave/cli/v3"
 )
 
@@ -24,14 +27,87 @@ func daemon(svr ServerInterface, t *terminator.Terminator) error {
 }
 
 const (
-	portFlag   = "port"
-	staticFlag = "static"
+	cacheBytesFlag    = "cache-bytes"
+	cacheDirFlag      = "cache-dir"
+	cacheDirAgeFlag   = "cache-dir-age"
+	cacheDirBytesFlag = "cache-dir-bytes"
+	cacheEntriesFlag  = "cache-entries"
+	portFlag          = "port"
+	staticFlag        = "static"
 )
 
 func Daemon(ctx context.Context, cmd *cli.Command) error {
-	svr, err := newServerAdapter(cmd.String(portFlag), cmd.String(staticFlag), newClientAdapter())
+	cfg, err := configure(cmd)
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+	cfg.configureLogging()
+
+	// Each wiki has its own client and caches, so that neither its rate
+	// limits nor its cache namespace are shared with any other wiki
+	wikis := cfg.wikis()
+	options := cfg.serverOptions()
+	options.Wiki = wikis[0].Name
+	options.Wikis = make(map[string]ClientInterface)
+	options.Namespaces = make(map[string]title.Namespaces)
+	var def ClientInterface
+	for i, wiki := range wikis {
+		client, closer, err := cfg.client(wiki)
+		if err != nil {
+			return err
+		}
+		defer closer()
+		options.Namespaces[wiki.Name] = wikiNamespaces(ctx, client, wiki.Name)
+		if i == 0 {
+			def = client
+		} else {
+			options.Wikis[wiki.Name] = client
+		}
+	}
+	// Images are proxied from the media host through a client of its own,
+	// cached under the host's name, which no wiki name can clash with
+	if cfg.Upstream.Upload != "" {
+		upload, err := url.Parse(cfg.Upstream.Upload)
+		if err != nil {
+			return fmt.Errorf("invalid upload URL: %w", err)
+		}
+		client, closer, err := cfg.client(Wiki{Name: upload.Host, URL: strings.TrimSuffix(cfg.Upstream.Upload, "/")})
+		if err != nil {
+			return err
+		}
+		defer closer()
+		options.Upload = client
+		options.UploadHost = upload.Host
+	}
+	if cfg.Store.File != "" {
+		store, err := NewFileStore(cfg.Store.File)
+		if err != nil {
+			return fmt.Errorf("failed to open store: %w", err)
+		}
+		defer store.Close()
+		options.Store = store
+	}
+	svr, err := newServerAdapter(cfg.Server.Port, cfg.Server.Static, def, options)
 	if err != nil {
 		return fmt.Errorf("failed to create server adapter: %w", err)
 	}
 	return daemon(svr, terminator.New())
 }
+
+// client returns the client for a wiki, behind its caches, and a function
+// which closes the caches
+func (cfg Config) client(wiki Wiki) (client ClientInterface, closer func(), err error) {
+	client = newClientAdapter(wiki.URL, cfg.clientOptions())
+	closer = func() {}
+	if cfg.Cache.Disk.Dir != "" {
+		disk, err := NewDiskCache(client, cfg.diskCacheOptions(wiki))
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create disk cache for %s: %w", wiki.Name, err)
+		}
+		client, closer = disk, func() { disk.Close() }
+	}
+	if cfg.Cache.Memory.Bytes > 0 {
+		client = NewCachedClient(client, cfg.cacheOptions())
+	}
+	return client, closer, nil
+}
@@ -0,0 +1,317 @@
+package wrserver
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bruceesmith/logger"
+	"github.com/bruceesmith/terminator"
+	"github.com/bruceesmith/wrspa/backend/wrserver/solver"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	// ErrDailyNotFound is returned for a date in the future, or a past date
+	// whose daily challenge is not remembered
+	ErrDailyNotFound = errors.New("no daily challenge for that date")
+	// ErrNoDaily is returned when none of the candidate pairs for a date
+	// could be shown to be solvable
+	ErrNoDaily = errors.New("no solvable daily challenge found")
+)
+
+// DailyOptions configures the daily challenge, the start and goal shared by
+// every player on a UTC date
+type DailyOptions struct {
+	Pool     string // YAML file of curated pairs or articles; the built-in articles if empty
+	History  string // JSON file remembering past dailies; kept only in memory if empty
+	Seed     string // Mixed into the seed of each date, so that a deployment has its own sequence
+	Attempts int    // Candidate pairs tried for a date before giving up
+	Prepare  bool   // Choose today's and tomorrow's dailies in the background while serving
+}
+
+// DefaultDailyOptions returns the DailyOptions used by NewServer
+func DefaultDailyOptions() DailyOptions {
+	return DailyOptions{
+		Attempts: 10,
+		Prepare:  true,
+	}
+}
+
+// DailyPair is a start and goal in a daily pool
+type DailyPair struct {
+	Start string `yaml:"start"`
+	Goal  string `yaml:"goal"`
+}
+
+// DailyPool holds the candidates for the daily challenge. Curated pairs are
+// used when there are any; otherwise each pair is drawn from the articles.
+type DailyPool struct {
+	Pairs    []DailyPair `yaml:"pairs"`
+	Articles []string    `yaml:"articles"`
+}
+
+// defaultDailyArticles are drawn from when no pool file is given. They are
+// broad articles with many links, so that most pairs are solvable.
+var defaultDailyArticles = []string{
+	"/wiki/Albert_Einstein", "/wiki/Ancient_Egypt", "/wiki/Association_football",
+	"/wiki/Australia", "/wiki/Bicycle", "/wiki/Black_hole", "/wiki/Chess",
+	"/wiki/Chocolate", "/wiki/Climate_change", "/wiki/Coffee", "/wiki/Computer",
+	"/wiki/DNA", "/wiki/Dinosaur", "/wiki/Electricity", "/wiki/French_Revolution",
+	"/wiki/Honey_bee", "/wiki/Internet", "/wiki/Jazz", "/wiki/Leonardo_da_Vinci",
+	"/wiki/Moon", "/wiki/Mount_Everest", "/wiki/Olympic_Games", "/wiki/Penguin",
+	"/wiki/Photosynthesis", "/wiki/Pizza", "/wiki/Roman_Empire", "/wiki/Shakespeare",
+	"/wiki/Silk_Road", "/wiki/Tea", "/wiki/The_Beatles", "/wiki/Volcano",
+	"/wiki/World_War_II",
+}
+
+// LoadDailyPool reads a pool of daily challenge candidates from a YAML file
+func LoadDailyPool(path string) (DailyPool, error) {
+	var pool DailyPool
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return pool, fmt.Errorf("unable to read daily pool '%s': %w", path, err)
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&pool); err != nil {
+		return pool, fmt.Errorf("unable to parse daily pool '%s': %w", path, err)
+	}
+	if err := pool.validate(); err != nil {
+		return pool, fmt.Errorf("invalid daily pool '%s': %w", path, err)
+	}
+	return pool, nil
+}
+
+// validate checks that a pool can provide a pair of distinct articles
+func (p DailyPool) validate() error {
+	for _, pair := range p.Pairs {
+		if !strings.HasPrefix(pair.Start, "/wiki/") || !strings.HasPrefix(pair.Goal, "/wiki/") {
+			return fmt.Errorf("invalid pair: %s, %s", pair.Start, pair.Goal)
+		}
+		if normaliseSubject(pair.Start) == normaliseSubject(pair.Goal) {
+			return fmt.Errorf("start and goal are both %s", pair.Start)
+		}
+	}
+	for _, article := range p.Articles {
+		if !strings.HasPrefix(article, "/wiki/") {
+			return fmt.Errorf("invalid article: %s", article)
+		}
+	}
+	if len(p.Pairs) == 0 && len(p.Articles) < 2 {
+		return errors.New("at least one pair or two articles are needed")
+	}
+	return nil
+}
+
+// dailies chooses and remembers the daily challenge of each date. A date's
+// candidates are drawn from the pool by a generator seeded with the date, so
+// every server with the same pool and seed chooses the same pair, and the
+// first candidate which the solver shows to be solvable is chosen. Once
+// chosen, a daily is remembered, and so does not change if the pool does.
+type dailies struct {
+	options DailyOptions
+	pool    DailyPool
+	wiki    string
+	graph   solver.Graph
+	solver  solver.Options
+	now     func() time.Time
+
+	choosing sync.Mutex // Held while a daily is chosen, so that each is chosen once
+	mu       sync.Mutex
+	history  map[string]DailyResponse // By date
+}
+
+// newDailies returns the daily challenges of a wiki, loading the pool and
+// the history of past dailies
+func newDailies(options DailyOptions, wiki string, graph solver.Graph, solverOptions solver.Options) (*dailies, error) {
+	d := &dailies{
+		options: options,
+		pool:    DailyPool{Articles: defaultDailyArticles},
+		wiki:    wiki,
+		graph:   graph,
+		solver:  solverOptions,
+		now:     time.Now,
+		history: make(map[string]DailyResponse),
+	}
+	if options.Pool != "" {
+		pool, err := LoadDailyPool(options.Pool)
+		if err != nil {
+			return nil, err
+		}
+		d.pool = pool
+	}
+	if options.History != "" {
+		data, err := os.ReadFile(options.History)
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+		case err != nil:
+			return nil, fmt.Errorf("unable to read daily history '%s': %w", options.History, err)
+		default:
+			if err := json.Unmarshal(data, &d.history); err != nil {
+				return nil, fmt.Errorf("unable to parse daily history '%s': %w", options.History, err)
+			}
+		}
+	}
+	return d, nil
+}
+
+// today returns the current UTC date
+func (d *dailies) today() string {
+	return d.now().UTC().Format(time.DateOnly)
+}
+
+// Get returns the daily challenge of a date, choosing it if it is today's
+// and has not yet been chosen
+func (d *dailies) Get(ctx context.Context, date string) (DailyResponse, error) {
+	if _, err := time.Parse(time.DateOnly, date); err != nil {
+		return DailyResponse{}, fmt.Errorf("invalid date '%s': must be YYYY-MM-DD", date)
+	}
+	today := d.today()
+	if date > today {
+		return DailyResponse{}, fmt.Errorf("%w: %s", ErrDailyNotFound, date)
+	}
+	d.mu.Lock()
+	daily, found := d.history[date]
+	d.mu.Unlock()
+	switch {
+	case found:
+		return daily, nil
+	case date < today:
+		return DailyResponse{}, fmt.Errorf("%w: %s", ErrDailyNotFound, date)
+	}
+	return d.choose(ctx, date)
+}
+
+// History returns the dailies up to today, the most recent first
+func (d *dailies) History() []DailyResponse {
+	today := d.today()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	history := make([]DailyResponse, 0, len(d.history))
+	for date, daily := range d.history {
+		if date <= today {
+			history = append(history, daily)
+		}
+	}
+	slices.SortFunc(history, func(a, b DailyResponse) int {
+		return strings.Compare(b.Date, a.Date)
+	})
+	return history
+}
+
+// choose picks the daily challenge of a date from its candidates, and
+// remembers it
+func (d *dailies) choose(ctx context.Context, date string) (DailyResponse, error) {
+	d.choosing.Lock()
+	defer d.choosing.Unlock()
+	d.mu.Lock()
+	daily, found := d.history[date]
+	d.mu.Unlock()
+	if found {
+		return daily, nil
+	}
+
+	for _, pair := range d.candidates(date) {
+		start, goal := normaliseSubject(pair.Start), normaliseSubject(pair.Goal)
+		result, err := solver.Solve(ctx, d.graph, start, goal, d.solver)
+		if errors.Is(err, solver.ErrNoPath) || (errors.Is(err, solver.ErrBudgetExhausted) && ctx.Err() == nil) {
+			logger.TraceID("daily", "unsolvable", "date", date, "start", start, "goal", goal, "error", err.Error())
+			continue
+		}
+		if err != nil {
+			return DailyResponse{}, err
+		}
+		daily = DailyResponse{
+			Date:      date,
+			Challenge: dailyChallengeID(date),
+			Wiki:      d.wiki,
+			Start:     start,
+			Goal:      goal,
+			Length:    result.Length,
+		}
+		logger.TraceID("daily", "chosen", "date", date, "start", start, "goal", goal, "length", result.Length)
+		d.mu.Lock()
+		d.history[date] = daily
+		err = d.save()
+		d.mu.Unlock()
+		if err != nil {
+			logger.Error("daily history not saved", "error", err.Error())
+		}
+		return daily, nil
+	}
+	return DailyResponse{}, fmt.Errorf("%w for %s after %d attempts", ErrNoDaily, date, d.options.Attempts)
+}
+
+// candidates returns the pairs to try for a date, in order. They are drawn
+// by a generator seeded from the date, so that they are the same each time.
+func (d *dailies) candidates(date string) []DailyPair {
+	sum := sha256.Sum256([]byte(d.options.Seed + "|" + date))
+	rng := rand.New(rand.NewPCG(binary.BigEndian.Uint64(sum[:8]), binary.BigEndian.Uint64(sum[8:16])))
+
+	n := max(d.options.Attempts, 1)
+	var pairs []DailyPair
+	if len(d.pool.Pairs) > 0 {
+		for _, i := range rng.Perm(len(d.pool.Pairs)) {
+			if len(pairs) == n {
+				break
+			}
+			pairs = append(pairs, d.pool.Pairs[i])
+		}
+		return pairs
+	}
+	articles := d.pool.Articles
+	for range n {
+		i := rng.IntN(len(articles))
+		j := rng.IntN(len(articles) - 1)
+		if j >= i {
+			j++
+		}
+		pairs = append(pairs, DailyPair{Start: articles[i], Goal: articles[j]})
+	}
+	return pairs
+}
+
+// save writes the history of dailies to its file, if there is one; the
+// caller must hold d.mu
+func (d *dailies) save() error {
+	if d.options.History == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(d.history, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(d.options.History, data)
+}
+
+// prepare chooses today's and tomorrow's dailies ahead of time, and again
+// after each UTC midnight, so that no player waits for the solver
+func (d *dailies) prepare(ctx context.Context, t *terminator.Terminator) {
+	defer t.Done()
+	for {
+		now := d.now().UTC()
+		for _, day := range []time.Time{now, now.AddDate(0, 0, 1)} {
+			if _, err := d.choose(ctx, day.Format(time.DateOnly)); err != nil && ctx.Err() == nil {
+				logger.Error("daily challenge not prepared", "date", day.Format(time.DateOnly), "error", err.Error())
+			}
+		}
+		// Wake at least hourly, to retry a daily which could not be chosen
+		midnight := now.Truncate(24 * time.Hour).Add(24 * time.Hour)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(min(time.Until(midnight), time.Hour)):
+		}
+	}
+}
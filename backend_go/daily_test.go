@@ -0,0 +1,221 @@
+package wrserver
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/bruceesmith/wrspa/backend/wrserver/solver"
+)
+
+// dailyGraph is a solver.Graph given by the links on each article
+type dailyGraph map[string][]string
+
+func (g dailyGraph) Links(ctx context.Context, article string) (string, []string, error) {
+	return article, g[article], nil
+}
+
+func (g dailyGraph) Backlinks(ctx context.Context, article string) ([]string, error) {
+	var sources []string
+	for source, links := range g {
+		for _, link := range links {
+			if link == article {
+				sources = append(sources, source)
+			}
+		}
+	}
+	return sources, nil
+}
+
+// testDailies returns the dailies of a pool at a fixed time
+func testDailies(t *testing.T, options DailyOptions, pool DailyPool, graph solver.Graph, now time.Time) *dailies {
+	t.Helper()
+	d, err := newDailies(options, "en", graph, solver.DefaultOptions())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	d.pool = pool
+	d.now = func() time.Time { return now }
+	return d
+}
+
+func TestDailies_Choose(t *testing.T) {
+	graph := dailyGraph{
+		"/wiki/A": {"/wiki/B"},
+		"/wiki/B": {"/wiki/C"},
+		"/wiki/C": {"/wiki/A"},
+	}
+	ctx := context.Background()
+	now := time.Date(2026, 10, 17, 23, 30, 0, 0, time.UTC)
+
+	t.Run("same pair for every server", func(t *testing.T) {
+		pool := DailyPool{Articles: []string{"/wiki/A", "/wiki/B", "/wiki/C"}}
+		first := testDailies(t, DefaultDailyOptions(), pool, graph, now)
+		second := testDailies(t, DefaultDailyOptions(), pool, graph, now)
+		a, err := first.Get(ctx, "2026-10-17")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		b, err := second.Get(ctx, "2026-10-17")
+		if err != nil || a != b {
+			t.Errorf("got %+v and %+v (error %v), want the same daily", a, b, err)
+		}
+		if a.Start == a.Goal || a.Length == 0 || a.Wiki != "en" || a.Date != "2026-10-17" {
+			t.Errorf("got %+v", a)
+		}
+	})
+
+	t.Run("seed and date vary the pair", func(t *testing.T) {
+		pairs := make([]DailyPair, 0, 6)
+		for _, start := range []string{"/wiki/A", "/wiki/B", "/wiki/C"} {
+			for _, goal := range []string{"/wiki/A", "/wiki/B", "/wiki/C"} {
+				if start != goal {
+					pairs = append(pairs, DailyPair{Start: start, Goal: goal})
+				}
+			}
+		}
+		d := testDailies(t, DefaultDailyOptions(), DailyPool{Pairs: pairs}, graph, now)
+		seen := make(map[DailyPair]bool)
+		for day := range 10 {
+			seen[d.candidates(now.AddDate(0, 0, day).Format(time.DateOnly))[0]] = true
+		}
+		if len(seen) < 2 {
+			t.Errorf("got the same pair for 10 dates: %v", seen)
+		}
+		options := DefaultDailyOptions()
+		options.Seed = "another"
+		other := testDailies(t, options, DailyPool{Pairs: pairs}, graph, now)
+		if reflect.DeepEqual(d.candidates("2026-10-17"), other.candidates("2026-10-17")) {
+			t.Errorf("got the same candidates with a different seed")
+		}
+	})
+
+	t.Run("unsolvable pairs are skipped", func(t *testing.T) {
+		pool := DailyPool{Pairs: []DailyPair{
+			{Start: "/wiki/A", Goal: "/wiki/Island"},
+			{Start: "/wiki/B", Goal: "/wiki/C"},
+			{Start: "/wiki/Island", Goal: "/wiki/C"},
+		}}
+		d := testDailies(t, DefaultDailyOptions(), pool, graph, now)
+		got, err := d.Get(ctx, "2026-10-17")
+		if want := (DailyResponse{Date: "2026-10-17", Challenge: "daily-2026-10-17", Wiki: "en", Start: "/wiki/B", Goal: "/wiki/C", Length: 1}); err != nil || got != want {
+			t.Errorf("got %+v and error %v, want %+v", got, err, want)
+		}
+
+		pool.Pairs = []DailyPair{{Start: "/wiki/A", Goal: "/wiki/Island"}}
+		d = testDailies(t, DefaultDailyOptions(), pool, graph, now)
+		if _, err := d.Get(ctx, "2026-10-17"); !errors.Is(err, ErrNoDaily) {
+			t.Errorf("got %v, want ErrNoDaily", err)
+		}
+	})
+}
+
+func TestDailies_History(t *testing.T) {
+	graph := dailyGraph{"/wiki/A": {"/wiki/B"}, "/wiki/B": {"/wiki/A"}}
+	pool := DailyPool{Articles: []string{"/wiki/A", "/wiki/B"}}
+	options := DefaultDailyOptions()
+	options.History = filepath.Join(t.TempDir(), "history.json")
+	ctx := context.Background()
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+
+	d := testDailies(t, options, pool, graph, now)
+	yesterday, err := d.Get(ctx, "2026-10-16")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// Tomorrow's is chosen ahead of time, but not given out
+	if _, err := d.choose(ctx, "2026-10-17"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := d.Get(ctx, "2026-10-17"); !errors.Is(err, ErrDailyNotFound) {
+		t.Errorf("got %v for tomorrow, want ErrDailyNotFound", err)
+	}
+
+	// A day later, on a restarted server with a different pool
+	pool = DailyPool{Articles: []string{"/wiki/C", "/wiki/D"}}
+	d = testDailies(t, options, pool, graph, now.AddDate(0, 0, 1))
+	got, err := d.Get(ctx, "2026-10-16")
+	if err != nil || got != yesterday {
+		t.Errorf("got %+v and error %v, want %+v", got, err, yesterday)
+	}
+	if _, err := d.Get(ctx, "2026-10-15"); !errors.Is(err, ErrDailyNotFound) {
+		t.Errorf("got %v for a forgotten date, want ErrDailyNotFound", err)
+	}
+	if _, err := d.Get(ctx, "16/10/2026"); err == nil {
+		t.Errorf("expected an error for an invalid date, got nil")
+	}
+	history := d.History()
+	if len(history) != 2 || history[0].Date != "2026-10-17" || history[1] != yesterday {
+		t.Errorf("got history %+v", history)
+	}
+
+	if err := os.WriteFile(options.History, []byte("not json"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newDailies(options, "en", graph, solver.DefaultOptions()); err == nil {
+		t.Errorf("expected an error for a corrupt history, got nil")
+	}
+}
+
+func TestLoadDailyPool(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		pool    DailyPool
+		wantErr bool
+	}{
+		{
+			name:    "pairs",
+			content: "pairs:\n  - start: /wiki/Coffee\n    goal: /wiki/Moon\n",
+			pool:    DailyPool{Pairs: []DailyPair{{Start: "/wiki/Coffee", Goal: "/wiki/Moon"}}},
+		},
+		{
+			name:    "articles",
+			content: "articles: [/wiki/Coffee, /wiki/Moon]\n",
+			pool:    DailyPool{Articles: []string{"/wiki/Coffee", "/wiki/Moon"}},
+		},
+		{
+			name:    "too few articles",
+			content: "articles: [/wiki/Coffee]\n",
+			wantErr: true,
+		},
+		{
+			name:    "not a subject",
+			content: "pairs:\n  - start: Coffee\n    goal: /wiki/Moon\n",
+			wantErr: true,
+		},
+		{
+			name:    "start is the goal",
+			content: "pairs:\n  - start: /wiki/Moon\n    goal: /wiki/Moon#Orbit\n",
+			wantErr: true,
+		},
+		{
+			name:    "unknown key",
+			content: "subjects: [/wiki/Coffee, /wiki/Moon]\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "pool.yml")
+			if err := os.WriteFile(path, []byte(tt.content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			pool, err := LoadDailyPool(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(pool, tt.pool) {
+				t.Errorf("got %+v, want %+v", pool, tt.pool)
+			}
+		})
+	}
+	if _, err := LoadDailyPool(filepath.Join(t.TempDir(), "missing.yml")); err == nil {
+		t.Errorf("expected an error for a missing pool, got nil")
+	}
+}
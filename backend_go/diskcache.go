@@ -0,0 +1,474 @@
+package wrserver
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bruceesmith/logger"
+)
+
+const (
+	diskIndexFile    = "index.json"
+	diskIndexVersion = 1
+	diskObjectsDir   = "objects"
+)
+
+// DiskCacheOptions configures a DiskCache
+type DiskCacheOptions struct {
+	Dir      string        // Directory holding the index and the content-addressed objects
+	MaxBytes int64         // Upper bound on the total size of the stored objects
+	MaxAge   time.Duration // Age after which an entry is refetched; a stale entry is still served if the refetch fails
+	Flush    time.Duration // Interval at which changes to the index are written, as well as on Close; zero for only on Close
+}
+
+// DefaultDiskCacheOptions returns the DiskCacheOptions used by the wrserver
+// daemon unless overridden
+func DefaultDiskCacheOptions(dir string) DiskCacheOptions {
+	return DiskCacheOptions{
+		Dir:      dir,
+		MaxBytes: 1 << 30,
+		MaxAge:   24 * time.Hour,
+		Flush:    30 * time.Second,
+	}
+}
+
+// diskEntry is the index record for one cached path
+type diskEntry struct {
+	Path        string    `json:"path"`
+	Hash        string    `json:"hash"`
+	ContentType string    `json:"contenttype"`
+	Size        int64     `json:"size"`
+	Fetched     time.Time `json:"fetched"`
+	Accessed    time.Time `json:"accessed"`
+}
+
+// diskIndex is the on-disk format of the index file
+type diskIndex struct {
+	Version int          `json:"version"`
+	Entries []*diskEntry `json:"entries"`
+}
+
+// DiskCache is a ClientInterface decorator which stores fetched pages and
+// assets in a content-addressed directory so that they survive a restart.
+// Bodies are stored once per distinct SHA-256 under objects/, and index.json
+// maps each path onto its object. When the objects exceed MaxBytes the least
+// recently accessed paths are evicted. GetRandom is never cached.
+//
+// The index is written every Flush and on Close rather than on every store,
+// so after a crash it may be stale: warming discards its entries whose
+// objects are gone and deletes the objects it does not know.
+type DiskCache struct {
+	client  ClientInterface
+	options DiskCacheOptions
+	now     func() time.Time
+	stop    chan struct{} // closed by Close to end the flushing
+	stopped sync.Once
+	saving  sync.Mutex // serialises writes of the index, which are made without holding mu
+
+	mu        sync.Mutex
+	entries   map[string]*diskEntry // keyed by path
+	refs      map[string]int        // number of entries referencing each object
+	bytes     int64
+	dirty     bool // the index has changed since it was last written
+	hits      uint64
+	misses    uint64
+	evictions uint64
+}
+
+// NewDiskCache returns a DiskCache wrapping client, warmed from any index
+// and objects already present in options.Dir
+func NewDiskCache(client ClientInterface, options DiskCacheOptions) (*DiskCache, error) {
+	if options.Dir == "" {
+		return nil, fmt.Errorf("disk cache directory cannot be empty")
+	}
+	err := os.MkdirAll(filepath.Join(options.Dir, diskObjectsDir), 0o755)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create disk cache directory '%s': %w", options.Dir, err)
+	}
+	d := &DiskCache{
+		client:  client,
+		options: options,
+		now:     time.Now,
+		stop:    make(chan struct{}),
+		entries: make(map[string]*diskEntry),
+		refs:    make(map[string]int),
+	}
+	err = d.warm()
+	if err != nil {
+		return nil, err
+	}
+	if options.Flush > 0 {
+		go d.flushEvery(options.Flush)
+	}
+	return d, nil
+}
+
+// Close stops the periodic flushing and writes any outstanding index changes
+// to disk
+func (d *DiskCache) Close() error {
+	d.stopped.Do(func() { close(d.stop) })
+	return d.flush()
+}
+
+// Get returns the stored body for path if present and fresh, otherwise it
+// fetches path from the wrapped client and stores a successful result. If
+// the fetch fails but a stale copy exists then the stale copy is returned.
+func (d *DiskCache) Get(ctx context.Context, path string) (body []byte, contentType string, err error) {
+	d.mu.Lock()
+	entry, found := d.entries[path]
+	var stale bool
+	if found {
+		stale = d.now().Sub(entry.Fetched) >= d.options.MaxAge
+	}
+	d.mu.Unlock()
+
+	if found && !stale {
+		body, err = d.read(entry)
+		if err == nil {
+			logger.TraceID("diskcache", "hit", "path", path)
+			d.touch(path, true)
+			return body, entry.ContentType, nil
+		}
+		logger.Warn("disk cache object unreadable", "path", path, "error", err.Error())
+		d.drop(path)
+		found = false
+	}
+	logger.TraceID("diskcache", "miss", "path", path, "stale", stale)
+
+	body, contentType, err = d.client.Get(ctx, path)
+	if err != nil {
+		if found {
+			if staleBody, readErr := d.read(entry); readErr == nil {
+				logger.Warn("serving stale cached copy", "path", path, "error", err.Error())
+				d.touch(path, true)
+				return staleBody, entry.ContentType, nil
+			}
+		}
+		d.touch(path, false)
+		return
+	}
+	d.touch(path, false)
+	if storeErr := d.store(path, body, contentType); storeErr != nil {
+		logger.Error("unable to store in disk cache", "path", path, "error", storeErr.Error())
+	}
+	return
+}
+
+// GetRandom passes straight through to the wrapped client
+func (d *DiskCache) GetRandom(ctx context.Context) (path string, err error) {
+	return d.client.GetRandom(ctx)
+}
+
+// Status adds the cache counters to the status of the wrapped client
+func (d *DiskCache) Status() ClientStatus {
+	status := clientStatus(d.client)
+	stats := d.Stats()
+	status.DiskCache = &stats
+	return status
+}
+
+// Stats returns a snapshot of the cache counters
+func (d *DiskCache) Stats() CacheStats {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return CacheStats{
+		Hits:      d.hits,
+		Misses:    d.misses,
+		Evictions: d.evictions,
+		Entries:   len(d.entries),
+		Bytes:     d.bytes,
+	}
+}
+
+// warm loads the index, discards entries whose objects are missing or
+// damaged, deletes unreferenced objects and enforces the size bound
+func (d *DiskCache) warm() error {
+	jason, err := os.ReadFile(filepath.Join(d.options.Dir, diskIndexFile))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("unable to read disk cache index: %w", err)
+	}
+	if err == nil {
+		var index diskIndex
+		err = json.Unmarshal(jason, &index)
+		if err != nil || index.Version != diskIndexVersion {
+			logger.Warn("discarding unusable disk cache index", "dir", d.options.Dir)
+		} else {
+			for _, entry := range index.Entries {
+				// The hash names a file, so one which is not a hash could
+				// reach outside the cache
+				if !validHash(entry.Hash) {
+					logger.Warn("discarding disk cache entry with an invalid hash", "path", entry.Path)
+					continue
+				}
+				info, err := os.Stat(d.objectPath(entry.Hash))
+				if err != nil || info.Size() != entry.Size {
+					continue
+				}
+				d.add(entry)
+			}
+		}
+	}
+
+	// Remove objects that no entry refers to, e.g. left over from a crash
+	objects := filepath.Join(d.options.Dir, diskObjectsDir)
+	err = filepath.WalkDir(objects, func(path string, de fs.DirEntry, err error) error {
+		if err != nil || de.IsDir() {
+			return err
+		}
+		if d.refs[de.Name()] == 0 {
+			os.Remove(path)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("unable to scan disk cache objects: %w", err)
+	}
+
+	d.mu.Lock()
+	d.evict()
+	d.dirty = true
+	logger.Info("disk cache warmed", "dir", d.options.Dir, "entries", len(d.entries), "bytes", d.bytes)
+	d.mu.Unlock()
+	return d.flush()
+}
+
+// store writes body as an object (unless an identical one already exists)
+// and points the index entry for path at it
+func (d *DiskCache) store(path string, body []byte, contentType string) error {
+	if int64(len(body)) > d.options.MaxBytes {
+		return nil
+	}
+	sum := sha256.Sum256(body)
+	hash := hex.EncodeToString(sum[:])
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	now := d.now()
+	// An unchanged refetch, such as the refresh of a stale entry, keeps its
+	// object, which removing the entry would delete
+	if entry, found := d.entries[path]; found && entry.Hash == hash {
+		entry.ContentType = contentType
+		entry.Fetched, entry.Accessed = now, now
+		d.dirty = true
+		return nil
+	}
+	if d.refs[hash] == 0 {
+		err := d.writeObject(hash, body)
+		if err != nil {
+			return err
+		}
+	}
+	d.remove(path)
+	d.add(&diskEntry{
+		Path:        path,
+		Hash:        hash,
+		ContentType: contentType,
+		Size:        int64(len(body)),
+		Fetched:     now,
+		Accessed:    now,
+	})
+	d.evict()
+	d.dirty = true
+	return nil
+}
+
+// add inserts an entry into the index; the caller must hold d.mu unless
+// the cache is still being warmed
+func (d *DiskCache) add(entry *diskEntry) {
+	d.entries[entry.Path] = entry
+	if d.refs[entry.Hash] == 0 {
+		d.bytes += entry.Size
+	}
+	d.refs[entry.Hash]++
+}
+
+// remove deletes the entry for path, and its object if no longer
+// referenced; the caller must hold d.mu
+func (d *DiskCache) remove(path string) {
+	entry, found := d.entries[path]
+	if !found {
+		return
+	}
+	delete(d.entries, path)
+	d.refs[entry.Hash]--
+	if d.refs[entry.Hash] > 0 {
+		return
+	}
+	delete(d.refs, entry.Hash)
+	d.bytes -= entry.Size
+	err := os.Remove(d.objectPath(entry.Hash))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		logger.Warn("unable to remove disk cache object", "hash", entry.Hash, "error", err.Error())
+	}
+}
+
+// evict removes the least recently accessed entries until the objects fit
+// within MaxBytes; the caller must hold d.mu
+func (d *DiskCache) evict() {
+	if d.bytes <= d.options.MaxBytes {
+		return
+	}
+	entries := make([]*diskEntry, 0, len(d.entries))
+	for _, entry := range d.entries {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Accessed.Before(entries[j].Accessed)
+	})
+	for _, entry := range entries {
+		if d.bytes <= d.options.MaxBytes {
+			break
+		}
+		d.remove(entry.Path)
+		d.evictions++
+	}
+}
+
+// drop removes the entry for path after its object proved unreadable
+func (d *DiskCache) drop(path string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.remove(path)
+	d.dirty = true
+}
+
+// touch records a hit or a miss, updating the access time on a hit
+func (d *DiskCache) touch(path string, hit bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !hit {
+		d.misses++
+		return
+	}
+	d.hits++
+	if entry, found := d.entries[path]; found {
+		entry.Accessed = d.now()
+		d.dirty = true
+	}
+}
+
+// read returns the object referenced by entry
+func (d *DiskCache) read(entry *diskEntry) ([]byte, error) {
+	return os.ReadFile(d.objectPath(entry.Hash))
+}
+
+// flushEvery writes the index at each interval until the cache is closed
+func (d *DiskCache) flushEvery(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-d.stop:
+			return
+		case <-ticker.C:
+			if err := d.flush(); err != nil {
+				logger.Error("unable to flush disk cache index", "dir", d.options.Dir, "error", err.Error())
+			}
+		}
+	}
+}
+
+// flush atomically rewrites the index file if it has changed. Only the copy
+// of the entries is made holding d.mu, so that stores and hits are not held
+// up by the write.
+func (d *DiskCache) flush() error {
+	d.saving.Lock()
+	defer d.saving.Unlock()
+	d.mu.Lock()
+	if !d.dirty {
+		d.mu.Unlock()
+		return nil
+	}
+	index := diskIndex{
+		Version: diskIndexVersion,
+		Entries: make([]*diskEntry, 0, len(d.entries)),
+	}
+	for _, entry := range d.entries {
+		copied := *entry
+		index.Entries = append(index.Entries, &copied)
+	}
+	d.dirty = false
+	d.mu.Unlock()
+
+	sort.Slice(index.Entries, func(i, j int) bool {
+		return index.Entries[i].Path < index.Entries[j].Path
+	})
+	jason, err := json.Marshal(index)
+	if err == nil {
+		err = writeFileAtomic(filepath.Join(d.options.Dir, diskIndexFile), jason)
+	}
+	if err != nil {
+		d.mu.Lock()
+		d.dirty = true
+		d.mu.Unlock()
+		return fmt.Errorf("unable to write disk cache index: %w", err)
+	}
+	return nil
+}
+
+// writeObject stores body under its hash
+func (d *DiskCache) writeObject(hash string, body []byte) error {
+	path := d.objectPath(hash)
+	err := os.MkdirAll(filepath.Dir(path), 0o755)
+	if err != nil {
+		return fmt.Errorf("unable to create disk cache object directory: %w", err)
+	}
+	err = writeFileAtomic(path, body)
+	if err != nil {
+		return fmt.Errorf("unable to write disk cache object: %w", err)
+	}
+	return nil
+}
+
+// objectPath is the location of an object, fanned out by the first two
+// hex digits of its hash to keep directories small
+func (d *DiskCache) objectPath(hash string) string {
+	if len(hash) < 2 {
+		return filepath.Join(d.options.Dir, diskObjectsDir, hash)
+	}
+	return filepath.Join(d.options.Dir, diskObjectsDir, hash[:2], hash)
+}
+
+// validHash reports whether hash is the lowercase hex SHA-256 which names
+// an object
+func validHash(hash string) bool {
+	if len(hash) != 2*sha256.Size {
+		return false
+	}
+	for _, c := range hash {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// writeFileAtomic writes data to a temporary file then renames it over path,
+// so that a crash never leaves a partially written file behind
+func writeFileAtomic(path string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
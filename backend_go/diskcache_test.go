@@ -0,0 +1,401 @@
+package wrserver
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bruceesmith/wrspa/backend/wrserver/mocks"
+	"go.uber.org/mock/gomock"
+)
+
+func TestNewDiskCache(t *testing.T) {
+	tests := []struct {
+		name       string
+		dir        string
+		shouldFail bool
+	}{
+		{
+			name: "success",
+			dir:  t.TempDir(),
+		},
+		{
+			name:       "empty directory",
+			dir:        "",
+			shouldFail: true,
+		},
+		{
+			name:       "directory is a file",
+			dir:        "testdata/test.txt",
+			shouldFail: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewDiskCache(nil, DefaultDiskCacheOptions(tt.dir))
+			if tt.shouldFail {
+				if err == nil {
+					t.Errorf("expected error, got nil")
+				}
+			} else if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestDiskCache_Get(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient := mocks.NewMockClientInterface(ctrl)
+	mockClient.EXPECT().Get(gomock.Any(), "/wiki/test").Return([]byte("page"), "text/html", nil).Times(1)
+
+	d, err := NewDiskCache(mockClient, DefaultDiskCacheOptions(t.TempDir()))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for i := range 2 {
+		body, contentType, err := d.Get(context.Background(), "/wiki/test")
+		if err != nil || string(body) != "page" || contentType != "text/html" {
+			t.Errorf("Get #%d got (%s, %s, %v)", i, string(body), contentType, err)
+		}
+	}
+	if stats := d.Stats(); stats.Hits != 1 || stats.Misses != 1 || stats.Entries != 1 || stats.Bytes != 4 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestDiskCache_SurvivesRestart(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	dir := t.TempDir()
+	mockClient := mocks.NewMockClientInterface(ctrl)
+	mockClient.EXPECT().Get(gomock.Any(), "/wiki/test").Return([]byte("page"), "text/html", nil).Times(1)
+
+	d, err := NewDiskCache(mockClient, DefaultDiskCacheOptions(dir))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	d.Get(context.Background(), "/wiki/test")
+	d.Close()
+
+	// A fresh cache over the same directory serves without going upstream
+	restarted, err := NewDiskCache(mockClient, DefaultDiskCacheOptions(dir))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	body, _, err := restarted.Get(context.Background(), "/wiki/test")
+	if err != nil || string(body) != "page" {
+		t.Errorf("got (%s, %v), want page", string(body), err)
+	}
+}
+
+func TestDiskCache_Stale(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient := mocks.NewMockClientInterface(ctrl)
+	gomock.InOrder(
+		mockClient.EXPECT().Get(gomock.Any(), "/wiki/test").Return([]byte("old"), "text/html", nil),
+		mockClient.EXPECT().Get(gomock.Any(), "/wiki/test").Return(nil, "", errors.New("uplink down")),
+		mockClient.EXPECT().Get(gomock.Any(), "/wiki/test").Return([]byte("new"), "text/html", nil),
+	)
+
+	now := time.Now()
+	d, err := NewDiskCache(mockClient, DefaultDiskCacheOptions(t.TempDir()))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	d.now = func() time.Time { return now }
+	d.Get(context.Background(), "/wiki/test")
+
+	now = now.Add(48 * time.Hour)
+	body, _, err := d.Get(context.Background(), "/wiki/test")
+	if err != nil || string(body) != "old" {
+		t.Errorf("expected stale copy when upstream fails, got (%s, %v)", string(body), err)
+	}
+	body, _, err = d.Get(context.Background(), "/wiki/test")
+	if err != nil || string(body) != "new" {
+		t.Errorf("expected refreshed copy, got (%s, %v)", string(body), err)
+	}
+}
+
+func TestDiskCache_UnchangedRefetch(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient := mocks.NewMockClientInterface(ctrl)
+	mockClient.EXPECT().Get(gomock.Any(), "/wiki/test").Return([]byte("same"), "text/html", nil).Times(2)
+
+	now := time.Now()
+	d, err := NewDiskCache(mockClient, DefaultDiskCacheOptions(t.TempDir()))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	d.now = func() time.Time { return now }
+	d.Get(context.Background(), "/wiki/test")
+
+	// Refreshing the stale entry fetches the same body again
+	now = now.Add(48 * time.Hour)
+	body, _, err := d.Get(context.Background(), "/wiki/test")
+	if err != nil || string(body) != "same" {
+		t.Errorf("expected refreshed copy, got (%s, %v)", string(body), err)
+	}
+	entry := d.entries["/wiki/test"]
+	if _, err := os.Stat(d.objectPath(entry.Hash)); err != nil {
+		t.Errorf("object of an unchanged refetch was removed: %v", err)
+	}
+	if !entry.Fetched.Equal(now) {
+		t.Errorf("got fetched %v, want %v", entry.Fetched, now)
+	}
+	body, _, err = d.Get(context.Background(), "/wiki/test")
+	if err != nil || string(body) != "same" {
+		t.Errorf("expected cached copy, got (%s, %v)", string(body), err)
+	}
+	if stats := d.Stats(); stats.Entries != 1 || stats.Bytes != 4 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestDiskCache_Eviction(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient := mocks.NewMockClientInterface(ctrl)
+	mockClient.EXPECT().Get(gomock.Any(), "/w/a").Return([]byte("aaaaa"), "text/css", nil).Times(2)
+	mockClient.EXPECT().Get(gomock.Any(), "/w/b").Return([]byte("bbbbb"), "text/css", nil).Times(1)
+	mockClient.EXPECT().Get(gomock.Any(), "/w/c").Return([]byte("ccccc"), "text/css", nil).Times(1)
+
+	now := time.Now()
+	options := DefaultDiskCacheOptions(t.TempDir())
+	options.MaxBytes = 10
+	d, err := NewDiskCache(mockClient, options)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	d.now = func() time.Time {
+		now = now.Add(time.Second)
+		return now
+	}
+
+	d.Get(context.Background(), "/w/a")
+	d.Get(context.Background(), "/w/b")
+	d.Get(context.Background(), "/w/c")
+	if stats := d.Stats(); stats.Entries != 2 || stats.Bytes != 10 || stats.Evictions != 1 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+	// The least recently accessed entry was evicted so must be fetched again
+	d.Get(context.Background(), "/w/a")
+}
+
+func TestDiskCache_SharedObjects(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient := mocks.NewMockClientInterface(ctrl)
+	mockClient.EXPECT().Get(gomock.Any(), "/w/a").Return([]byte("same"), "image/png", nil)
+	mockClient.EXPECT().Get(gomock.Any(), "/w/b").Return([]byte("same"), "image/png", nil)
+
+	dir := t.TempDir()
+	d, err := NewDiskCache(mockClient, DefaultDiskCacheOptions(dir))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	d.Get(context.Background(), "/w/a")
+	d.Get(context.Background(), "/w/b")
+	if stats := d.Stats(); stats.Entries != 2 || stats.Bytes != 4 {
+		t.Errorf("identical bodies should share one object, got %+v", stats)
+	}
+}
+
+func TestDiskCache_Warm(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	dir := t.TempDir()
+	mockClient := mocks.NewMockClientInterface(ctrl)
+	mockClient.EXPECT().Get(gomock.Any(), "/w/a").Return([]byte("aaaa"), "text/css", nil)
+	mockClient.EXPECT().Get(gomock.Any(), "/w/b").Return([]byte("bbbb"), "text/css", nil)
+
+	d, err := NewDiskCache(mockClient, DefaultDiskCacheOptions(dir))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	d.Get(context.Background(), "/w/a")
+	d.Get(context.Background(), "/w/b")
+	d.Close()
+
+	// Damage one object and leave an orphan behind
+	os.Remove(d.objectPath(d.entries["/w/a"].Hash))
+	orphan := filepath.Join(dir, diskObjectsDir, "ff", "ffff")
+	os.MkdirAll(filepath.Dir(orphan), 0o755)
+	os.WriteFile(orphan, []byte("orphan"), 0o644)
+
+	warmed, err := NewDiskCache(mockClient, DefaultDiskCacheOptions(dir))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if stats := warmed.Stats(); stats.Entries != 1 || stats.Bytes != 4 {
+		t.Errorf("unexpected stats after warming %+v", stats)
+	}
+	if _, err := os.Stat(orphan); !os.IsNotExist(err) {
+		t.Errorf("orphaned object was not removed")
+	}
+}
+
+func TestDiskCache_Flush(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	dir := t.TempDir()
+	mockClient := mocks.NewMockClientInterface(ctrl)
+	mockClient.EXPECT().Get(gomock.Any(), "/w/a").Return([]byte("aaaa"), "text/css", nil)
+
+	options := DefaultDiskCacheOptions(dir)
+	options.Flush = 0
+	d, err := NewDiskCache(mockClient, options)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	d.Get(context.Background(), "/w/a")
+	if entries := indexEntries(t, dir); entries != 0 {
+		t.Errorf("a store should not write the index, got %d entries", entries)
+	}
+	d.Close()
+	if entries := indexEntries(t, dir); entries != 1 {
+		t.Errorf("Close should write the index, got %d entries", entries)
+	}
+}
+
+func TestDiskCache_FlushEvery(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	dir := t.TempDir()
+	mockClient := mocks.NewMockClientInterface(ctrl)
+	mockClient.EXPECT().Get(gomock.Any(), "/w/a").Return([]byte("aaaa"), "text/css", nil)
+
+	options := DefaultDiskCacheOptions(dir)
+	options.Flush = 10 * time.Millisecond
+	d, err := NewDiskCache(mockClient, options)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer d.Close()
+	d.Get(context.Background(), "/w/a")
+	deadline := time.Now().Add(5 * time.Second)
+	for indexEntries(t, dir) != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("the index was not flushed")
+		}
+		time.Sleep(options.Flush)
+	}
+}
+
+func TestDiskCache_StaleIndex(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	dir := t.TempDir()
+	mockClient := mocks.NewMockClientInterface(ctrl)
+	mockClient.EXPECT().Get(gomock.Any(), "/w/a").Return([]byte("aaaa"), "text/css", nil)
+	mockClient.EXPECT().Get(gomock.Any(), "/w/b").Return([]byte("bbbb"), "text/css", nil).Times(2)
+
+	options := DefaultDiskCacheOptions(dir)
+	options.Flush = 0
+	d, err := NewDiskCache(mockClient, options)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	d.Get(context.Background(), "/w/a")
+	d.Close()
+	// A crash after this store leaves an object which the index does not know
+	d.Get(context.Background(), "/w/b")
+	orphan := d.objectPath(d.entries["/w/b"].Hash)
+
+	warmed, err := NewDiskCache(mockClient, options)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer warmed.Close()
+	if stats := warmed.Stats(); stats.Entries != 1 || stats.Bytes != 4 {
+		t.Errorf("unexpected stats after warming %+v", stats)
+	}
+	if _, err := os.Stat(orphan); !os.IsNotExist(err) {
+		t.Errorf("object missing from the index was not removed")
+	}
+	for _, path := range []string{"/w/a", "/w/b"} {
+		if _, _, err := warmed.Get(context.Background(), path); err != nil {
+			t.Errorf("Get %s: unexpected error: %v", path, err)
+		}
+	}
+}
+
+// indexEntries returns the number of entries in the index file in dir
+func indexEntries(t *testing.T, dir string) int {
+	t.Helper()
+	jason, err := os.ReadFile(filepath.Join(dir, diskIndexFile))
+	if err != nil {
+		t.Fatalf("unable to read the index: %v", err)
+	}
+	var index diskIndex
+	if err := json.Unmarshal(jason, &index); err != nil {
+		t.Fatalf("invalid index: %v", err)
+	}
+	return len(index.Entries)
+}
+
+func TestDiskCache_CorruptIndex(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, diskIndexFile), []byte("not json"), 0o644)
+
+	d, err := NewDiskCache(nil, DefaultDiskCacheOptions(dir))
+	if err != nil {
+		t.Fatalf("a corrupt index should be discarded, got error: %v", err)
+	}
+	if stats := d.Stats(); stats.Entries != 0 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestDiskCache_InvalidHash(t *testing.T) {
+	// The objects of an entry whose hash is ../outside would be in parent
+	parent := t.TempDir()
+	outside := filepath.Join(parent, "outside")
+	os.WriteFile(outside, []byte("secret"), 0o644)
+	dir := filepath.Join(parent, "cache")
+	valid := strings.Repeat("ab", sha256.Size)
+	os.MkdirAll(filepath.Join(dir, diskObjectsDir, "ab"), 0o755)
+	os.WriteFile(filepath.Join(dir, diskObjectsDir, "ab", valid), []byte("page"), 0o644)
+	jason, _ := json.Marshal(diskIndex{
+		Version: diskIndexVersion,
+		Entries: []*diskEntry{
+			{Path: "/wiki/valid", Hash: valid, Size: 4},
+			{Path: "/wiki/escape", Hash: "../outside", Size: 6},
+			{Path: "/wiki/upper", Hash: strings.ToUpper(valid), Size: 4},
+			{Path: "/wiki/short", Hash: "ab", Size: 4},
+		},
+	})
+	os.WriteFile(filepath.Join(dir, diskIndexFile), jason, 0o644)
+
+	d, err := NewDiskCache(nil, DefaultDiskCacheOptions(dir))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer d.Close()
+	if _, found := d.entries["/wiki/valid"]; !found || len(d.entries) != 1 {
+		t.Errorf("got entries %v, want only /wiki/valid", d.entries)
+	}
+	if _, err := os.Stat(outside); err != nil {
+		t.Errorf("file outside the cache was touched: %v", err)
+	}
+}
@@ -0,0 +1,74 @@
+package wrserver
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+
+	"github.com/bruceesmith/wrspa/backend/wrserver/api"
+)
+
+// ErrCircuitOpen is returned by a Client whose circuit breaker is open
+var ErrCircuitOpen = errors.New("upstream unavailable: circuit breaker open")
+
+// UpstreamError is returned when Wikipedia answers with an unexpected status
+type UpstreamError struct {
+	StatusCode int
+	Status     string
+	RetryAfter time.Duration // From the Retry-After header, if any
+}
+
+func (e *UpstreamError) Error() string {
+	return "unexpected status: " + e.Status
+}
+
+// transient reports whether a failed upstream call is worth retrying:
+// throttling, server errors, timeouts and dropped connections
+func transient(err error) bool {
+	var ue *UpstreamError
+	if errors.As(err, &ue) {
+		return ue.StatusCode == http.StatusTooManyRequests || ue.StatusCode >= http.StatusInternalServerError
+	}
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	var ne net.Error
+	if errors.As(err, &ne) && ne.Timeout() {
+		return true
+	}
+	return errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, io.EOF)
+}
+
+// upstreamCode maps an error from a ClientInterface onto the code of the
+// failure reported to the SPA. Only a 404 from the wiki means that it has no
+// such page; a wiki which cannot be reached is unavailable, and any other
+// failure is an upstream error.
+func upstreamCode(err error) api.ErrorCode {
+	var ue *UpstreamError
+	var ne net.Error
+	switch {
+	case errors.Is(err, ErrCircuitOpen):
+		return api.CodeUpstreamUnavailable
+	case errors.Is(err, ErrRateLimited):
+		return api.CodeRateLimited
+	case errors.Is(err, context.DeadlineExceeded):
+		return api.CodeUpstreamTimeout
+	case errors.As(err, &ue):
+		if ue.StatusCode == http.StatusNotFound {
+			return api.CodeUpstreamNotFound
+		}
+		return api.CodeUpstreamError
+	case errors.As(err, &ne):
+		if ne.Timeout() {
+			return api.CodeUpstreamTimeout
+		}
+		return api.CodeUpstreamUnavailable
+	}
+	return api.CodeUpstreamError
+}
@@ -0,0 +1,80 @@
+package wrserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/bruceesmith/wrspa/backend/wrserver/api"
+)
+
+func TestTransient(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "too many requests", err: &UpstreamError{StatusCode: http.StatusTooManyRequests}, want: true},
+		{name: "server error", err: &UpstreamError{StatusCode: http.StatusBadGateway}, want: true},
+		{name: "not found", err: &UpstreamError{StatusCode: http.StatusNotFound}, want: false},
+		{name: "connection reset", err: fmt.Errorf("read: %w", syscall.ECONNRESET), want: true},
+		{name: "truncated body", err: io.ErrUnexpectedEOF, want: true},
+		{name: "deadline", err: context.DeadlineExceeded, want: true},
+		{name: "cancelled", err: context.Canceled, want: false},
+		{name: "other", err: errors.New("boom"), want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := transient(tt.err); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpstreamCode(t *testing.T) {
+	// A dial to a port on which nothing listens fails as a dial to a wiki
+	// which is down does
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	l.Close()
+	_, dialErr := http.Get("http://" + l.Addr().String())
+	if dialErr == nil {
+		t.Fatal("dial succeeded")
+	}
+
+	tests := []struct {
+		name   string
+		err    error
+		want   api.ErrorCode
+		status int
+	}{
+		{name: "circuit open", err: fmt.Errorf("fetch: %w", ErrCircuitOpen), want: api.CodeUpstreamUnavailable, status: http.StatusServiceUnavailable},
+		{name: "rate limited", err: &RateLimitError{Budget: "pages"}, want: api.CodeRateLimited, status: http.StatusServiceUnavailable},
+		{name: "deadline", err: context.DeadlineExceeded, want: api.CodeUpstreamTimeout, status: http.StatusGatewayTimeout},
+		{name: "upstream not found", err: &UpstreamError{StatusCode: http.StatusNotFound}, want: api.CodeUpstreamNotFound, status: http.StatusNotFound},
+		{name: "upstream failure", err: &UpstreamError{StatusCode: http.StatusInternalServerError}, want: api.CodeUpstreamError, status: http.StatusBadGateway},
+		{name: "upstream throttling", err: &UpstreamError{StatusCode: http.StatusTooManyRequests}, want: api.CodeUpstreamError, status: http.StatusBadGateway},
+		{name: "dial failure", err: fmt.Errorf("fetch: %w", dialErr), want: api.CodeUpstreamUnavailable, status: http.StatusServiceUnavailable},
+		{name: "network timeout", err: &net.OpError{Op: "read", Net: "tcp", Err: os.ErrDeadlineExceeded}, want: api.CodeUpstreamTimeout, status: http.StatusGatewayTimeout},
+		{name: "other", err: errors.New("not found"), want: api.CodeUpstreamError, status: http.StatusBadGateway},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := upstreamCode(tt.err)
+			if got != tt.want || got.Status() != tt.status {
+				t.Errorf("got %s (%d), want %s (%d)", got, got.Status(), tt.want, tt.status)
+			}
+		})
+	}
+}
@@ -0,0 +1,403 @@
+package wrserver
+
+import (
+	"cmp"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/bruceesmith/logger"
+	"github.com/bruceesmith/wrspa/backend/wrserver/leaderboard"
+)
+
+// GameState is the position of a game's state machine, matching the states
+// of the frontends
+type GameState string
+
+const (
+	GameReady    GameState = "ready"    // Start and goal are known but the clock has not started
+	GamePlaying  GameState = "playing"  // The clock is running and moves are accepted
+	GamePaused   GameState = "paused"   // The clock is stopped and moves are refused
+	GameFinished GameState = "finished" // The goal has been reached
+)
+
+// MoveAction is the kind of a move
+type MoveAction string
+
+const (
+	MoveStart    MoveAction = "start"    // ready to playing, starting the clock
+	MoveNavigate MoveAction = "navigate" // Follow a link to another article
+	MovePause    MoveAction = "pause"    // playing to paused
+	MoveResume   MoveAction = "resume"   // paused to playing
+)
+
+var (
+	// ErrGameNotFound is returned for an unknown or expired game
+	ErrGameNotFound = errors.New("game not found")
+	// ErrGameToken is returned when a request about a game does not carry
+	// the token issued when it was created
+	ErrGameToken = errors.New("invalid game token")
+	// ErrIllegalMove matches any *MoveError
+	ErrIllegalMove = errors.New("illegal move")
+	// ErrInvalidSubject is returned for a start, goal or move which is not
+	// the path of a page of the wiki
+	ErrInvalidSubject = errors.New("invalid subject")
+	// ErrTooManyGames is returned when a game cannot be created because the
+	// limit on sessions has been reached
+	ErrTooManyGames = errors.New("too many games in progress")
+)
+
+// MoveError is returned for a navigation to an article which is not linked
+// from the player's current page, or a request for a page other than the
+// current one
+type MoveError struct {
+	From   string // The player's current page
+	To     string // The page the player asked for
+	Reason string
+}
+
+func (e *MoveError) Error() string {
+	return fmt.Sprintf("%s from %s to %s: %s", ErrIllegalMove.Error(), e.From, e.To, e.Reason)
+}
+
+func (e *MoveError) Is(target error) bool {
+	return target == ErrIllegalMove
+}
+
+// GameStateError is returned for a move which is not allowed in the game's
+// current state, such as navigating while paused
+type GameStateError struct {
+	State  GameState
+	Action MoveAction
+}
+
+func (e *GameStateError) Error() string {
+	return fmt.Sprintf("cannot %s a game which is %s", e.Action, e.State)
+}
+
+// GameOptions configures the game sessions held by a Server
+type GameOptions struct {
+	Expiry time.Duration // A game untouched for this long is discarded
+	Max    int           // Number of games which may be held at once
+}
+
+// DefaultGameOptions returns the GameOptions used by NewServer
+func DefaultGameOptions() GameOptions {
+	return GameOptions{
+		Expiry: 2 * time.Hour,
+		Max:    10000,
+	}
+}
+
+// game is one session. The clock runs only while the game is playing:
+// elapsed holds the time played up to since, when the clock last started.
+// current is the subject the player last navigated to, as requested, and
+// page what was learnt about it when the server fetched it.
+type game struct {
+	id        string
+	token     string
+	challenge leaderboard.Challenge
+	player    string
+	wiki      string
+	start     string
+	goal      string
+	canonical string // Subject of the goal after following any redirect
+	state     GameState
+	path      []string
+	current   string
+	page      page
+	profile   string // Name of the profile which cleans up the game's pages
+	event     string // Code of the event whose spectators are shown the game
+	created   time.Time
+	touched   time.Time
+	finished  time.Time
+	since     time.Time
+	elapsed   time.Duration
+}
+
+// games holds the game sessions of a Server
+type games struct {
+	options GameOptions
+	now     func() time.Time
+
+	mu       sync.Mutex
+	sessions map[string]*game
+}
+
+// newGames returns an empty set of sessions
+func newGames(options GameOptions) *games {
+	return &games{
+		options:  options,
+		now:      time.Now,
+		sessions: make(map[string]*game),
+	}
+}
+
+// Create starts a session of a challenge in the ready state on the start
+// page, returning the token which must accompany every later request about
+// the game. Its pages are cleaned up by the named profile. goal is the
+// canonical subject of the goal, which a player may reach by any redirect.
+func (gs *games) Create(challenge leaderboard.Challenge, player, profile string, startPage page, goal string) (GameResponse, error) {
+	id, err := newGameID()
+	if err != nil {
+		return GameResponse{}, err
+	}
+	token, err := newGameID()
+	if err != nil {
+		return GameResponse{}, err
+	}
+
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	now := gs.now()
+	gs.expire(now)
+	if len(gs.sessions) >= gs.options.Max {
+		return GameResponse{}, ErrTooManyGames
+	}
+	g := &game{
+		id:        id,
+		token:     token,
+		challenge: challenge,
+		player:    player,
+		wiki:      challenge.Wiki,
+		start:     challenge.Start,
+		goal:      challenge.Goal,
+		canonical: cmp.Or(goal, normaliseSubject(challenge.Goal)),
+		state:     GameReady,
+		path:      []string{startPage.canonical},
+		current:   challenge.Start,
+		page:      startPage,
+		profile:   profile,
+		created:   now,
+		touched:   now,
+	}
+	gs.sessions[id] = g
+	logger.TraceID("games", "create", "id", id, "challenge", challenge.ID, "start", challenge.Start, "goal", challenge.Goal)
+	response := g.response(now)
+	response.Token = token
+	return response, nil
+}
+
+// Get returns the current state of a session
+func (gs *games) Get(id string) (GameResponse, error) {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	now := gs.now()
+	g, err := gs.find(id, now)
+	if err != nil {
+		return GameResponse{}, err
+	}
+	return g.response(now), nil
+}
+
+// Check reports whether a move would be accepted, without applying it, so
+// that the target of a navigation need only be fetched for a legal move. It
+// returns the name of the game's wiki and of its profile, by which that
+// target is fetched.
+func (gs *games) Check(id, token string, move MoveRequest) (wiki, profile string, err error) {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	g, err := gs.authorised(id, token, gs.now())
+	if err != nil {
+		return "", "", err
+	}
+	return g.wiki, g.profile, g.check(move)
+}
+
+// Move applies a move to a session. For a navigation, target is what was
+// learnt by fetching the page navigated to; the game is finished if that is
+// the goal, directly or by a redirect.
+func (gs *games) Move(id, token string, move MoveRequest, target page) (GameResponse, error) {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	now := gs.now()
+	g, err := gs.authorised(id, token, now)
+	if err != nil {
+		return GameResponse{}, err
+	}
+	if err := g.check(move); err != nil {
+		return GameResponse{}, err
+	}
+
+	switch move.Action {
+	case MoveStart, MoveResume:
+		g.state, g.since = GamePlaying, now
+	case MovePause:
+		g.elapsed += now.Sub(g.since)
+		g.state = GamePaused
+	case MoveNavigate:
+		g.current, g.page = move.Subject, target
+		g.path = append(g.path, target.canonical)
+		goal := normaliseSubject(g.goal)
+		if reached := normaliseSubject(move.Subject); reached == goal || reached == g.canonical ||
+			target.canonical == goal || target.canonical == g.canonical {
+			g.elapsed += now.Sub(g.since)
+			g.state = GameFinished
+			g.finished = now
+			logger.TraceID("games", "finished", "id", id, "steps", len(g.path)-1, "elapsed", g.elapsed.String())
+		}
+	}
+	g.touched = now
+	return g.response(now), nil
+}
+
+// Score returns the challenge of a finished session and its score for the
+// challenge's leaderboard
+func (gs *games) Score(id string) (leaderboard.Challenge, leaderboard.Score, error) {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	now := gs.now()
+	g, err := gs.find(id, now)
+	if err != nil {
+		return leaderboard.Challenge{}, leaderboard.Score{}, err
+	}
+	if g.state != GameFinished {
+		return leaderboard.Challenge{}, leaderboard.Score{}, &GameStateError{State: g.state, Action: "score"}
+	}
+	return g.challenge, leaderboard.Score{
+		Game:      g.id,
+		Player:    g.player,
+		Steps:     len(g.path) - 1,
+		ElapsedMS: g.elapsed.Milliseconds(),
+		Path:      slices.Clone(g.path),
+		Finished:  g.finished,
+	}, nil
+}
+
+// Spectate shows a session to the spectators of an event from now on, if
+// code is not empty, and returns the session's current state
+func (gs *games) Spectate(id, token, code string) (GameResponse, error) {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	now := gs.now()
+	g, err := gs.authorised(id, token, now)
+	if err != nil {
+		return GameResponse{}, err
+	}
+	if code != "" && code != g.event {
+		g.event = code
+		logger.TraceID("games", "spectate", "id", id, "event", code)
+	}
+	return g.response(now), nil
+}
+
+// Current returns the wiki and the current page of a session, which is the
+// only page that may be served to its player, and the name of its profile
+func (gs *games) Current(id, token string) (wiki, current, profile string, err error) {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	g, err := gs.authorised(id, token, gs.now())
+	if err != nil {
+		return "", "", "", err
+	}
+	return g.wiki, g.current, g.profile, nil
+}
+
+// authorised returns a session which has not expired, provided that token
+// is the one issued for it; the caller must hold gs.mu
+func (gs *games) authorised(id, token string, now time.Time) (*game, error) {
+	g, err := gs.find(id, now)
+	if err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(token), []byte(g.token)) != 1 {
+		return nil, ErrGameToken
+	}
+	return g, nil
+}
+
+// check reports whether a move is allowed in the game's current state and,
+// for a navigation, whether it follows a link on the current page
+func (g *game) check(move MoveRequest) error {
+	stateError := &GameStateError{State: g.state, Action: move.Action}
+	switch move.Action {
+	case MoveStart:
+		if g.state != GameReady {
+			return stateError
+		}
+	case MovePause, MoveNavigate:
+		if g.state != GamePlaying {
+			return stateError
+		}
+	case MoveResume:
+		if g.state != GamePaused {
+			return stateError
+		}
+	default:
+		return fmt.Errorf("unknown move action '%s'", move.Action)
+	}
+	if move.Action == MoveNavigate {
+		target := g.page.namespaces.Path(move.Subject)
+		switch {
+		case !g.page.namespaces.IsArticle(target):
+			return &MoveError{From: g.page.canonical, To: move.Subject, Reason: "not an article"}
+		case target == g.page.canonical || target == normaliseSubject(g.current):
+			return &MoveError{From: g.page.canonical, To: move.Subject, Reason: "already on that page"}
+		case !g.page.links[target]:
+			return &MoveError{From: g.page.canonical, To: move.Subject, Reason: "not linked from the current page"}
+		}
+	}
+	return nil
+}
+
+// find returns a session which has not expired; the caller must hold gs.mu
+func (gs *games) find(id string, now time.Time) (*game, error) {
+	g, found := gs.sessions[id]
+	if !found || gs.expired(g, now) {
+		delete(gs.sessions, id)
+		return nil, ErrGameNotFound
+	}
+	return g, nil
+}
+
+// expire discards every expired session; the caller must hold gs.mu
+func (gs *games) expire(now time.Time) {
+	for id, g := range gs.sessions {
+		if gs.expired(g, now) {
+			logger.TraceID("games", "expired", "id", id)
+			delete(gs.sessions, id)
+		}
+	}
+}
+
+// expired reports whether a session has been untouched for too long
+func (gs *games) expired(g *game, now time.Time) bool {
+	return gs.options.Expiry > 0 && now.Sub(g.touched) >= gs.options.Expiry
+}
+
+// response describes a session at time now
+func (g *game) response(now time.Time) GameResponse {
+	elapsed := g.elapsed
+	if g.state == GamePlaying {
+		elapsed += now.Sub(g.since)
+	}
+	return GameResponse{
+		ID:        g.id,
+		Challenge: g.challenge.ID,
+		Player:    g.player,
+		Wiki:      g.wiki,
+		Start:     g.start,
+		Goal:      g.goal,
+		State:     g.state,
+		Path:      append([]string(nil), g.path...),
+		Steps:     len(g.path) - 1,
+		ElapsedMS: elapsed.Milliseconds(),
+		Created:   g.created,
+		Profile:   g.profile,
+		Event:     g.event,
+	}
+}
+
+// newGameID returns a random identifier for a session
+func newGameID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("unable to generate game ID: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
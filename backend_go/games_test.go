@@ -0,0 +1,310 @@
+package wrserver
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/bruceesmith/wrspa/backend/wrserver/leaderboard"
+	"github.com/bruceesmith/wrspa/backend/wrserver/title"
+)
+
+func TestGames_Move(t *testing.T) {
+	gs := newGames(DefaultGameOptions())
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	gs.now = func() time.Time { return now }
+
+	challenge := customChallenge("en", "/wiki/Start", "/wiki/Goal")
+	created, err := gs.Create(challenge, "alice", ProfileHard, testPage("/wiki/Start", "/wiki/A"), "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	id, token := created.ID, created.Token
+	if token == "" {
+		t.Fatal("expected a token for a new game")
+	}
+	if got, _ := gs.Get(id); got.Token != "" {
+		t.Errorf("got token %s describing a game, want none", got.Token)
+	}
+	if created.Challenge != challenge.ID || created.Player != "alice" || created.Profile != ProfileHard {
+		t.Errorf("got challenge %s, player %s and profile %s", created.Challenge, created.Player, created.Profile)
+	}
+	if _, _, err := gs.Score(id); !reflect.DeepEqual(err, &GameStateError{State: GameReady, Action: "score"}) {
+		t.Errorf("got %v scoring an unfinished game", err)
+	}
+
+	steps := []struct {
+		name      string
+		advance   time.Duration
+		move      MoveRequest
+		target    page
+		state     GameState
+		elapsedMS int64
+		steps     int
+		err       error
+	}{
+		{
+			name:  "navigate before starting",
+			move:  MoveRequest{Action: MoveNavigate, Subject: "/wiki/A"},
+			state: GameReady,
+			err:   &GameStateError{State: GameReady, Action: MoveNavigate},
+		},
+		{
+			name:    "start",
+			advance: time.Minute, // time in the ready state is not counted
+			move:    MoveRequest{Action: MoveStart},
+			state:   GamePlaying,
+		},
+		{
+			name:      "navigate",
+			advance:   10 * time.Second,
+			move:      MoveRequest{Action: MoveNavigate, Subject: "/wiki/A"},
+			target:    testPage("/wiki/A", "/wiki/B", "/wiki/Goal"),
+			state:     GamePlaying,
+			elapsedMS: 10000,
+			steps:     1,
+		},
+		{
+			name:      "pause",
+			advance:   5 * time.Second,
+			move:      MoveRequest{Action: MovePause},
+			state:     GamePaused,
+			elapsedMS: 15000,
+			steps:     1,
+		},
+		{
+			name:      "navigate while paused",
+			advance:   time.Hour,
+			move:      MoveRequest{Action: MoveNavigate, Subject: "/wiki/B"},
+			state:     GamePaused,
+			elapsedMS: 15000,
+			steps:     1,
+			err:       &GameStateError{State: GamePaused, Action: MoveNavigate},
+		},
+		{
+			name:      "resume",
+			move:      MoveRequest{Action: MoveResume},
+			state:     GamePlaying,
+			elapsedMS: 15000,
+			steps:     1,
+		},
+		{
+			name:      "start twice",
+			move:      MoveRequest{Action: MoveStart},
+			state:     GamePlaying,
+			elapsedMS: 15000,
+			steps:     1,
+			err:       &GameStateError{State: GamePlaying, Action: MoveStart},
+		},
+		{
+			name:      "reach the goal",
+			advance:   20 * time.Second,
+			move:      MoveRequest{Action: MoveNavigate, Subject: "/wiki/Goal"},
+			target:    testPage("/wiki/Goal"),
+			state:     GameFinished,
+			elapsedMS: 35000,
+			steps:     2,
+		},
+		{
+			name:      "navigate after finishing",
+			advance:   time.Minute,
+			move:      MoveRequest{Action: MoveNavigate, Subject: "/wiki/C"},
+			state:     GameFinished,
+			elapsedMS: 35000,
+			steps:     2,
+			err:       &GameStateError{State: GameFinished, Action: MoveNavigate},
+		},
+	}
+
+	for _, step := range steps {
+		now = now.Add(step.advance)
+		_, err := gs.Move(id, token, step.move, step.target)
+		if !reflect.DeepEqual(err, step.err) {
+			t.Errorf("%s: got error %v, want %v", step.name, err, step.err)
+		}
+		got, _ := gs.Get(id)
+		if got.State != step.state || got.ElapsedMS != step.elapsedMS || got.Steps != step.steps {
+			t.Errorf("%s: got state %s, elapsed %dms and %d steps, want %s, %dms and %d", step.name,
+				got.State, got.ElapsedMS, got.Steps, step.state, step.elapsedMS, step.steps)
+		}
+	}
+
+	got, _ := gs.Get(id)
+	if want := []string{"/wiki/Start", "/wiki/A", "/wiki/Goal"}; !reflect.DeepEqual(got.Path, want) {
+		t.Errorf("got path %v, want %v", got.Path, want)
+	}
+	gotChallenge, score, err := gs.Score(id)
+	want := leaderboard.Score{
+		Game:      id,
+		Player:    "alice",
+		Steps:     2,
+		ElapsedMS: 35000,
+		Path:      got.Path,
+		Finished:  time.Date(2025, 1, 1, 13, 1, 35, 0, time.UTC),
+	}
+	if err != nil || gotChallenge != challenge || !reflect.DeepEqual(score, want) {
+		t.Errorf("got %+v, %+v and error %v, want %+v", gotChallenge, score, err, want)
+	}
+	if _, err := gs.Move(id, token, MoveRequest{Action: "jump"}, page{}); err == nil {
+		t.Error("expected an error for an unknown action, got nil")
+	}
+}
+
+func TestGames_Expiry(t *testing.T) {
+	gs := newGames(GameOptions{Expiry: time.Hour, Max: 2})
+	now := time.Now()
+	gs.now = func() time.Time { return now }
+
+	first, _ := gs.Create(customChallenge("en", "/wiki/A", "/wiki/B"), "", "", testPage("/wiki/A"), "")
+	now = now.Add(30 * time.Minute)
+	second, _ := gs.Create(customChallenge("en", "/wiki/C", "/wiki/D"), "", "", testPage("/wiki/C"), "")
+	if _, err := gs.Create(customChallenge("en", "/wiki/E", "/wiki/F"), "", "", testPage("/wiki/E"), ""); !errors.Is(err, ErrTooManyGames) {
+		t.Errorf("got %v, want ErrTooManyGames", err)
+	}
+
+	// Touching the second game keeps it alive while the first expires
+	now = now.Add(45 * time.Minute)
+	if _, err := gs.Move(second.ID, second.Token, MoveRequest{Action: MoveStart}, page{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := gs.Get(first.ID); !errors.Is(err, ErrGameNotFound) {
+		t.Errorf("got %v, want ErrGameNotFound for an expired game", err)
+	}
+	if _, err := gs.Create(customChallenge("en", "/wiki/E", "/wiki/F"), "", "", testPage("/wiki/E"), ""); err != nil {
+		t.Errorf("expired game should make room for another, got %v", err)
+	}
+
+	now = now.Add(time.Hour)
+	if _, err := gs.Move(second.ID, second.Token, MoveRequest{Action: MovePause}, page{}); !errors.Is(err, ErrGameNotFound) {
+		t.Errorf("got %v, want ErrGameNotFound for an expired game", err)
+	}
+	if _, err := gs.Get("unknown"); !errors.Is(err, ErrGameNotFound) {
+		t.Errorf("got %v, want ErrGameNotFound", err)
+	}
+}
+
+func TestGames_Navigate(t *testing.T) {
+	gs := newGames(DefaultGameOptions())
+	start := testPage("/wiki/Start", "/wiki/A", "/wiki/Café", "/wiki/Goal_(redirect)")
+	created, _ := gs.Create(customChallenge("en", "/wiki/Start", "/wiki/Goal"), "", "", start, "")
+	id, token := created.ID, created.Token
+
+	if _, err := gs.Move(id, "wrong", MoveRequest{Action: MoveStart}, page{}); !errors.Is(err, ErrGameToken) {
+		t.Errorf("got %v, want ErrGameToken", err)
+	}
+	if _, err := gs.Move(id, token, MoveRequest{Action: MoveStart}, page{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		subject string
+		err     error
+	}{
+		{
+			name:    "not linked",
+			subject: "/wiki/B",
+			err:     &MoveError{From: "/wiki/Start", To: "/wiki/B", Reason: "not linked from the current page"},
+		},
+		{
+			name:    "another namespace",
+			subject: "/wiki/Special:Random",
+			err:     &MoveError{From: "/wiki/Start", To: "/wiki/Special:Random", Reason: "not an article"},
+		},
+		{
+			name:    "the current page",
+			subject: "/wiki/Start#History",
+			err:     &MoveError{From: "/wiki/Start", To: "/wiki/Start#History", Reason: "already on that page"},
+		},
+		{
+			name:    "with an anchor",
+			subject: "/wiki/A#History",
+		},
+		{
+			name:    "percent-encoded",
+			subject: "/wiki/Caf%C3%A9",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := gs.Check(id, token, MoveRequest{Action: MoveNavigate, Subject: tt.subject})
+			if !reflect.DeepEqual(err, tt.err) {
+				t.Errorf("got error %v, want %v", err, tt.err)
+			}
+			if tt.err != nil && !errors.Is(err, ErrIllegalMove) {
+				t.Errorf("got %v, want ErrIllegalMove", err)
+			}
+		})
+	}
+
+	// A redirect to the goal finishes the game, recording the article
+	// reached rather than the redirect
+	move := MoveRequest{Action: MoveNavigate, Subject: "/wiki/Goal_(redirect)"}
+	got, err := gs.Move(id, token, move, testPage("/wiki/Goal"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []string{"/wiki/Start", "/wiki/Goal"}; got.State != GameFinished || !reflect.DeepEqual(got.Path, want) {
+		t.Errorf("got %s with path %v, want finished with %v", got.State, got.Path, want)
+	}
+	if _, current, _, _ := gs.Current(id, token); current != move.Subject {
+		t.Errorf("got current page %s, want %s", current, move.Subject)
+	}
+}
+
+func TestGames_NavigateNamespaces(t *testing.T) {
+	gs := newGames(DefaultGameOptions())
+	start := testPage("/wiki/Start", "/wiki/Ziel")
+	start.namespaces = title.Namespaces{"datei": "Datei", "file": "Datei", "spezial": "Spezial"}
+	created, _ := gs.Create(customChallenge("de", "/wiki/Start", "/wiki/Ziel"), "", "", start, "")
+	if _, err := gs.Move(created.ID, created.Token, MoveRequest{Action: MoveStart}, page{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The namespaces are those of the game's wiki
+	for _, subject := range []string{"/wiki/Datei:Go.svg", "/wiki/file:Go.svg", "/wiki/Spezial:Zufällige_Seite"} {
+		_, _, err := gs.Check(created.ID, created.Token, MoveRequest{Action: MoveNavigate, Subject: subject})
+		if want := (&MoveError{From: "/wiki/Start", To: subject, Reason: "not an article"}); !reflect.DeepEqual(err, want) {
+			t.Errorf("%s: got error %v, want %v", subject, err, want)
+		}
+	}
+	if _, _, err := gs.Check(created.ID, created.Token, MoveRequest{Action: MoveNavigate, Subject: "/wiki/Ziel"}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestGames_RedirectedGoal(t *testing.T) {
+	tests := []struct {
+		name    string
+		subject string
+		target  page
+	}{
+		{name: "the goal's canonical subject", subject: "/wiki/united_States", target: testPage("/wiki/United_States")},
+		{name: "the goal's redirect", subject: "/wiki/USA", target: testPage("/wiki/United_States")},
+		{name: "another redirect to the goal", subject: "/wiki/U.S.", target: testPage("/wiki/United_States")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gs := newGames(DefaultGameOptions())
+			created, _ := gs.Create(customChallenge("en", "/wiki/Start", "/wiki/USA"), "", "", testPage("/wiki/Start", normaliseSubject(tt.subject)), "/wiki/United_States")
+			gs.Move(created.ID, created.Token, MoveRequest{Action: MoveStart}, page{})
+			got, err := gs.Move(created.ID, created.Token, MoveRequest{Action: MoveNavigate, Subject: tt.subject}, tt.target)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got.State != GameFinished {
+				t.Errorf("got state %s navigating to %s", got.State, tt.subject)
+			}
+		})
+	}
+}
+
+// testPage returns a page with a canonical subject and links
+func testPage(canonical string, links ...string) page {
+	p := page{canonical: canonical, links: make(map[string]bool)}
+	for _, link := range links {
+		p.links[link] = true
+	}
+	return p
+}
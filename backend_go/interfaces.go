@@ -1,25 +1,49 @@
 package wrserver
 
 import (
+	"context"
 	"net/http"
 
 	"github.com/bruceesmith/terminator"
+	"github.com/bruceesmith/wrspa/backend/wrserver/leaderboard"
 )
 
 // ClientInterface is an interface for the Client struct
 type ClientInterface interface {
-	Get(path string) (body []byte, contentType string, err error)
-	GetRandom() (path string)
+	Get(ctx context.Context, path string) (body []byte, contentType string, err error)
+	GetRandom(ctx context.Context) (path string, err error)
 }
 
 // ServerInterface is an interface for the Server struct
 type ServerInterface interface {
 	API(w http.ResponseWriter, r *http.Request)
-	MarshalFailure(function string, err error, response any) string
+	Daily(w http.ResponseWriter, r *http.Request)
+	Events(w http.ResponseWriter, r *http.Request)
+	Games(w http.ResponseWriter, r *http.Request)
+	Leaderboards(w http.ResponseWriter, r *http.Request)
+	OpenAPI(w http.ResponseWriter, r *http.Request)
+	RoomSocket(w http.ResponseWriter, r *http.Request)
+	Rooms(w http.ResponseWriter, r *http.Request)
 	Serve(t *terminator.Terminator)
 	Settings(w http.ResponseWriter, r *http.Request)
+	Solve(w http.ResponseWriter, r *http.Request)
 	SPAFile(w http.ResponseWriter, r *http.Request)
 	SpecialRandom(w http.ResponseWriter, r *http.Request)
+	Status(w http.ResponseWriter, r *http.Request)
+	UploadFile(w http.ResponseWriter, r *http.Request)
 	WikiPage(w http.ResponseWriter, r *http.Request)
 	WikipediaFile(w http.ResponseWriter, r *http.Request)
 }
+
+// Store persists the leaderboards of finished games, one per challenge
+type Store interface {
+	// Record adds a finished game to the leaderboard of its challenge
+	Record(ctx context.Context, challenge leaderboard.Challenge, score leaderboard.Score) error
+	// Challenge returns a challenge with at least one finished game
+	Challenge(ctx context.Context, id string) (leaderboard.Challenge, error)
+	// Leaderboard returns up to limit scores of a challenge in the order of
+	// ranking, after skipping offset of them, and the number of scores in all
+	Leaderboard(ctx context.Context, id string, ranking leaderboard.Ranking, offset, limit int) (scores []leaderboard.Score, total int, err error)
+	// Close releases the resources held by the store
+	Close() error
+}
@@ -0,0 +1,61 @@
+/*
+Package leaderboard holds the challenges which finished games are ranked
+against and the scores on their leaderboards, shared by the Store of
+wrserver and the implementations of it.
+*/
+package leaderboard
+
+import (
+	"cmp"
+	"strings"
+	"time"
+)
+
+// Kind is the way a challenge's start and goal were chosen
+type Kind string
+
+const (
+	Daily  Kind = "daily"  // The daily challenge of a date
+	Custom Kind = "custom" // A pair chosen by a player, or shared by a link to its ID
+)
+
+// Challenge is a start and goal on a wiki, against which finished games are
+// ranked
+type Challenge struct {
+	ID    string `json:"id"`
+	Kind  Kind   `json:"kind"`
+	Wiki  string `json:"wiki"`
+	Start string `json:"start"`
+	Goal  string `json:"goal"`
+	Date  string `json:"date,omitempty"` // Of a daily challenge
+}
+
+// Score is a finished game on a leaderboard
+type Score struct {
+	Game      string    `json:"game"`
+	Player    string    `json:"player"`
+	Steps     int       `json:"steps"`
+	ElapsedMS int64     `json:"elapsedms"`
+	Path      []string  `json:"path"`
+	Finished  time.Time `json:"finished"`
+}
+
+// Ranking is the order of a leaderboard
+type Ranking string
+
+const (
+	ByClicks Ranking = "clicks" // Fewest steps, then least time
+	ByTime   Ranking = "time"   // Least time, then fewest steps
+)
+
+// Compare orders two scores by a ranking, the earlier finisher first on a
+// tie, for use with slices.SortFunc
+func (r Ranking) Compare(a, b Score) int {
+	var c int
+	if r == ByTime {
+		c = cmp.Or(cmp.Compare(a.ElapsedMS, b.ElapsedMS), cmp.Compare(a.Steps, b.Steps))
+	} else {
+		c = cmp.Or(cmp.Compare(a.Steps, b.Steps), cmp.Compare(a.ElapsedMS, b.ElapsedMS))
+	}
+	return cmp.Or(c, a.Finished.Compare(b.Finished), strings.Compare(a.Game, b.Game))
+}
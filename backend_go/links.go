@@ -0,0 +1,91 @@
+package wrserver
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"fmt"
+
+	"github.com/bruceesmith/wrspa/backend/wrserver/links"
+	"github.com/bruceesmith/wrspa/backend/wrserver/title"
+	"golang.org/x/net/html"
+)
+
+// page is what the server learnt about an article when it fetched it
+type page struct {
+	canonical  string           // Subject after following any redirect
+	links      map[string]bool  // Outbound article links, normalised
+	namespaces title.Namespaces // Of the page's wiki
+}
+
+// normaliseSubject puts a /wiki/ subject into the form used to compare
+// links, which is the path of its normalised title
+func normaliseSubject(subject string) string {
+	return title.Path(subject)
+}
+
+// articleLinks parses a Wikipedia page, returning its canonical subject and
+// the articles it links to. MediaWiki serves a redirect's target at the
+// redirect's own URL, so the canonical subject comes from the page's
+// <link rel="canonical"> and defaults to subject. Links are told from those
+// to other namespaces by the namespaces of the page's wiki.
+func articleLinks(subject string, body []byte, ns title.Namespaces) (page, error) {
+	doc, err := html.Parse(bytes.NewReader(body))
+	if err != nil {
+		return page{}, fmt.Errorf("failed to parse html: %w", err)
+	}
+
+	return page{
+		canonical:  cmp.Or(links.Canonical(doc, ns), ns.Path(subject)),
+		links:      links.Outbound(doc, ns),
+		namespaces: ns,
+	}, nil
+}
+
+// pageLinks fetches a page and returns its canonical subject and all the
+// articles it links to, whatever a profile would remove of them
+func pageLinks(ctx context.Context, client ClientInterface, ns title.Namespaces, subject string) (page, error) {
+	body, _, err := client.Get(ctx, subject)
+	if err != nil {
+		return page{}, err
+	}
+	return articleLinks(subject, body, ns)
+}
+
+// gamePage fetches a page for a game, as its player is served it, and
+// returns its canonical subject and the articles it links to. Only the links
+// left by the game's profile are moves, so that a player cannot follow one
+// the page does not show.
+func (s *Server) gamePage(ctx context.Context, client ClientInterface, wiki, profile, subject string) (page, error) {
+	_, cleaner, err := s.profile(profile)
+	if err != nil {
+		return page{}, err
+	}
+	body, _, err := client.Get(ctx, subject)
+	if err != nil {
+		return page{}, err
+	}
+	extracted, err := s.extractBody(body, wiki, cleaner)
+	if err != nil {
+		return page{}, err
+	}
+	ns := s.namespaces(wiki)
+	p := page{canonical: ns.Path(subject), links: make(map[string]bool, len(extracted.Links)), namespaces: ns}
+	if extracted.Title != "" {
+		p.canonical = title.Prefix + extracted.Title
+	}
+	for _, link := range extracted.Links {
+		p.links[title.Prefix+link] = true
+	}
+	return p, nil
+}
+
+// attribute returns the value of an attribute of an element
+func attribute(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
@@ -0,0 +1,167 @@
+/*
+Package links finds the links of a parsed wiki page, and annotates them, for
+both Go backends, wrserver and the backend of go-app, so that the two agree
+on which links are moves in the game.
+
+A link is a move if its href is a relative path below /wiki/ to an article,
+rather than to a page in another namespace such as File: or Talk:, whose
+names are those of the page's wiki. Its
+target is the normalised subject of that path, without its fragment. The
+canonical subject of a page is that of its <link rel="canonical">, which
+MediaWiki gives as the target of a redirect.
+
+Annotate marks every link of a page with its api.LinkKind, so that no
+frontend need parse hrefs itself.
+*/
+package links
+
+import (
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/bruceesmith/wrspa/backend/wrserver/api"
+	"github.com/bruceesmith/wrspa/backend/wrserver/title"
+	"golang.org/x/net/html"
+)
+
+// Canonical returns the normalised subject of the <link rel="canonical"> of
+// a page of a wiki with namespaces ns, or the empty string if it has none
+func Canonical(doc *html.Node, ns title.Namespaces) string {
+	for n := range doc.Descendants() {
+		if n.Type == html.ElementNode && n.Data == "link" && slices.Contains(strings.Fields(attribute(n, "rel")), "canonical") {
+			if target, ok := wikiLink(attribute(n, "href"), ns, true); ok {
+				return target
+			}
+		}
+	}
+	return ""
+}
+
+// Outbound returns the normalised subjects of the articles which the links
+// below n, on a page of a wiki with namespaces ns, lead to
+func Outbound(n *html.Node, ns title.Namespaces) map[string]bool {
+	links := make(map[string]bool)
+	for d := range n.Descendants() {
+		// Links to other hosts, such as the same article in other
+		// languages, are not moves
+		if d.Type == html.ElementNode && d.Data == "a" {
+			if target, ok := wikiLink(attribute(d, "href"), ns, false); ok {
+				links[target] = true
+			}
+		}
+	}
+	return links
+}
+
+// Annotate adds to every link below n, on a page of a wiki with namespaces
+// ns, its api.LinkKind as api.AttrLink and, for an article, its normalised
+// title as api.AttrTarget. The links which are articles are those which
+// Outbound finds. If uploadHost is not empty,
+// images from that host are rewritten to be fetched through /upload/. If
+// assets is not empty, the files of the wiki itself, below /w/ and /static/,
+// are rewritten to be fetched below assets, so that a server can tell which
+// wiki they are from.
+func Annotate(n *html.Node, ns title.Namespaces, uploadHost, assets string) {
+	for d := range n.Descendants() {
+		if d.Type != html.ElementNode {
+			continue
+		}
+		if d.Data == "a" {
+			if href := attribute(d, "href"); href != "" {
+				kind, target := linkKind(href, attribute(d, "class"), ns)
+				d.Attr = append(d.Attr, html.Attribute{Key: api.AttrLink, Val: string(kind)})
+				if kind == api.LinkArticle {
+					d.Attr = append(d.Attr, html.Attribute{Key: api.AttrTarget, Val: target})
+				}
+			}
+		}
+		if uploadHost != "" || assets != "" {
+			for i, a := range d.Attr {
+				switch {
+				case a.Key == "src", a.Key == "href" && d.Data != "a":
+					d.Attr[i].Val = proxy(a.Val, uploadHost, assets)
+				case a.Key == "srcset":
+					candidates := strings.Split(a.Val, ",")
+					for j, candidate := range candidates {
+						u, descriptor, _ := strings.Cut(strings.TrimSpace(candidate), " ")
+						candidates[j] = strings.TrimSpace(proxy(u, uploadHost, assets) + " " + descriptor)
+					}
+					d.Attr[i].Val = strings.Join(candidates, ", ")
+				}
+			}
+		}
+	}
+}
+
+// wikiLink returns the normalised subject of an href which links to an
+// article. Only a relative href such as /wiki/Go is accepted unless absolute
+// is true, as it is for canonical links.
+func wikiLink(href string, ns title.Namespaces, absolute bool) (string, bool) {
+	u, err := url.Parse(href)
+	if err != nil || u.RawQuery != "" || (u.Host != "" && !absolute) || !strings.HasPrefix(u.Path, title.Prefix) {
+		return "", false
+	}
+	subject := ns.Path(u.EscapedPath())
+	return subject, ns.IsArticle(subject)
+}
+
+// linkKind classifies an href, returning the normalised title of an article
+func linkKind(href, class string, ns title.Namespaces) (api.LinkKind, string) {
+	if strings.HasPrefix(href, "#") {
+		return api.LinkAnchor, ""
+	}
+	u, err := url.Parse(href)
+	switch {
+	case err != nil:
+		return api.LinkOther, ""
+	case u.Scheme != "" || u.Host != "":
+		return api.LinkExternal, ""
+	case slices.Contains(strings.Fields(class), "new") || u.Query().Get("redlink") == "1":
+		return api.LinkRed, ""
+	}
+	if subject, article := wikiLink(href, ns, false); article {
+		return api.LinkArticle, strings.TrimPrefix(subject, title.Prefix)
+	}
+	if strings.HasPrefix(u.Path, title.Prefix) {
+		return api.LinkNamespace, ""
+	}
+	return api.LinkOther, ""
+}
+
+// proxy rewrites the URL of a file of the wiki to below assets, and that of
+// an image on uploadHost to the server's /upload/ proxy, unless either is
+// empty
+func proxy(src, uploadHost, assets string) string {
+	switch {
+	case assets != "" && (strings.HasPrefix(src, "/w/") || strings.HasPrefix(src, "/static/")):
+		return assets + src
+	case uploadHost != "":
+		return proxyImage(src, uploadHost)
+	}
+	return src
+}
+
+// proxyImage rewrites the URL of an image on uploadHost, absolute or
+// protocol-relative, to the server's /upload/ proxy
+func proxyImage(src, uploadHost string) string {
+	u, err := url.Parse(src)
+	if err != nil || u.Host != uploadHost || (u.Scheme != "" && u.Scheme != "http" && u.Scheme != "https") {
+		return src
+	}
+	proxied := "/upload" + u.EscapedPath()
+	if u.RawQuery != "" {
+		proxied += "?" + u.RawQuery
+	}
+	return proxied
+}
+
+// attribute returns the value of an attribute of an element
+func attribute(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
@@ -0,0 +1,119 @@
+package links
+
+import (
+	"bytes"
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/bruceesmith/wrspa/backend/wrserver/title"
+	"golang.org/x/net/html"
+)
+
+func TestCanonical(t *testing.T) {
+	tests := []struct {
+		name string
+		head string
+		want string
+	}{
+		{name: "rel first", head: `<link rel="canonical" href="https://en.wikipedia.org/wiki/Go_(programming_language)">`, want: "/wiki/Go_(programming_language)"},
+		{name: "href first", head: `<link href="//en.wikipedia.org/wiki/Golang" rel="canonical">`, want: "/wiki/Golang"},
+		{name: "single quotes", head: `<link rel='canonical' href='/wiki/Go%20language'>`, want: "/wiki/Go_language"},
+		{name: "other rel", head: `<link rel="stylesheet" href="/wiki/Go">`},
+		{name: "not an article", head: `<link rel="canonical" href="https://en.wikipedia.org/wiki/Special:Random">`},
+		{name: "none"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := html.Parse(strings.NewReader("<html><head>" + tt.head + "</head><body></body></html>"))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := Canonical(doc, title.English); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOutbound(t *testing.T) {
+	doc, err := html.Parse(strings.NewReader(`<html><body>` +
+		`<a href="/wiki/Go">a</a><a class="x" href='/wiki/Robert_Griesemer#Career'>b</a><a href=/wiki/Ken_Thompson>c</a>` +
+		`<a href="/wiki/File:Go.svg">d</a><a href="https://de.wikipedia.org/wiki/Go">e</a><a href="/wiki/Go?action=edit">f</a>` +
+		`</body></html>`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []string{"/wiki/Go", "/wiki/Ken_Thompson", "/wiki/Robert_Griesemer"}
+	if got := slices.Sorted(maps.Keys(Outbound(doc, title.English))); !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestAnnotate(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		ns         title.Namespaces
+		uploadHost string
+		assets     string
+		want       string
+	}{
+		{
+			name: "article",
+			body: `<a href="/wiki/Cr%C3%A8me_br%C3%BBl%C3%A9e#History">dessert</a>`,
+			want: `<a href="/wiki/Cr%C3%A8me_br%C3%BBl%C3%A9e#History" data-wr-link="article" data-wr-target="Crème_brûlée">dessert</a>`,
+		},
+		{
+			name: "disabled",
+			body: `<a href="#History">a</a><a href="/wiki/Talk:Go">b</a><a href="/wiki/Gopher" class="new">c</a><a href="https://go.dev/">d</a>`,
+			want: `<a href="#History" data-wr-link="anchor">a</a><a href="/wiki/Talk:Go" data-wr-link="namespace">b</a>` +
+				`<a href="/wiki/Gopher" class="new" data-wr-link="redlink">c</a><a href="https://go.dev/" data-wr-link="external">d</a>`,
+		},
+		{
+			name: "namespaces of the wiki",
+			body: `<a href="/wiki/Datei:Go.svg">a</a><a href="/wiki/File:Go.svg">b</a><a href="/wiki/Berlin">c</a>`,
+			ns:   title.Namespaces{"datei": "Datei", "file": "Datei"},
+			want: `<a href="/wiki/Datei:Go.svg" data-wr-link="namespace">a</a><a href="/wiki/File:Go.svg" data-wr-link="namespace">b</a>` +
+				`<a href="/wiki/Berlin" data-wr-link="article" data-wr-target="Berlin">c</a>`,
+		},
+		{
+			name:       "image",
+			body:       `<img src="https://upload.wikimedia.org/a/ab/Go.png?x=1"/>`,
+			uploadHost: "upload.wikimedia.org",
+			want:       `<img src="/upload/a/ab/Go.png?x=1"/>`,
+		},
+		{
+			name:   "assets",
+			body:   `<img src="/static/images/icons/wikipedia.png" srcset="/w/extensions/a.svg 1.5x"/><a href="/w/index.php?action=edit">e</a>`,
+			assets: "/wikis/de",
+			want: `<img src="/wikis/de/static/images/icons/wikipedia.png" srcset="/wikis/de/w/extensions/a.svg 1.5x"/>` +
+				`<a href="/w/index.php?action=edit" data-wr-link="other">e</a>`,
+		},
+		{
+			name: "default wiki assets",
+			body: `<img src="/static/images/icons/wikipedia.png"/>`,
+			want: `<img src="/static/images/icons/wikipedia.png"/>`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := html.Parse(strings.NewReader("<html><body>" + tt.body + "</body></html>"))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			body := doc.LastChild.LastChild
+			Annotate(body, tt.ns, tt.uploadHost, tt.assets)
+			var buf bytes.Buffer
+			for c := body.FirstChild; c != nil; c = c.NextSibling {
+				html.Render(&buf, c)
+			}
+			if got := buf.String(); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
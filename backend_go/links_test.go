@@ -0,0 +1,141 @@
+package wrserver
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/bruceesmith/wrspa/backend/wrserver/mocks"
+	"github.com/bruceesmith/wrspa/backend/wrserver/title"
+	"go.uber.org/mock/gomock"
+)
+
+func TestArticleLinks(t *testing.T) {
+	tests := []struct {
+		name      string
+		subject   string
+		body      string
+		ns        title.Namespaces
+		canonical string
+		links     []string
+	}{
+		{
+			name:      "articles",
+			subject:   "/wiki/Go",
+			body:      `<html><body><a href="/wiki/Golang">Go</a><a href="/wiki/Robert_Griesemer#Career">Robert</a></body></html>`,
+			canonical: "/wiki/Go",
+			links:     []string{"/wiki/Golang", "/wiki/Robert_Griesemer"},
+		},
+		{
+			name:    "other namespaces",
+			subject: "/wiki/Go",
+			body: `<html><body><a href="/wiki/File:Go.svg">file</a><a href="/wiki/Category:Languages">category</a>` +
+				`<a href="/wiki/Talk:Go">talk</a><a href="/wiki/User_talk:Gopher">user talk</a>` +
+				`<a href="/wiki/Help:Contents">help</a><a href="/wiki/Go:_The_Game">game</a></body></html>`,
+			canonical: "/wiki/Go",
+			links:     []string{"/wiki/Go:_The_Game"},
+		},
+		{
+			name:    "namespaces of the wiki",
+			subject: "/wiki/Go_(Spiel)",
+			body: `<html><body><a href="/wiki/Datei:Go.svg">file</a><a href="/wiki/Kategorie:Brettspiel">category</a>` +
+				`<a href="/wiki/Spezial:Zufällige_Seite">random</a><a href="/wiki/Help:Go">help</a><a href="/wiki/Brettspiel">game</a></body></html>`,
+			ns:        title.Namespaces{"datei": "Datei", "file": "Datei", "kategorie": "Kategorie", "spezial": "Spezial"},
+			canonical: "/wiki/Go_(Spiel)",
+			links:     []string{"/wiki/Brettspiel", "/wiki/Help:Go"},
+		},
+		{
+			name:    "not article links",
+			subject: "/wiki/Go",
+			body: `<html><body><a href="https://de.wikipedia.org/wiki/Go">de</a><a href="/w/index.php?title=Go&action=edit">edit</a>` +
+				`<a href="/wiki/Go?action=history">history</a><a href="#History">history</a><a>none</a></body></html>`,
+			canonical: "/wiki/Go",
+		},
+		{
+			name:      "percent-encoded",
+			subject:   "/wiki/Caf%C3%A9",
+			body:      `<html><body><a href="/wiki/Cr%C3%A8me_br%C3%BBl%C3%A9e">dessert</a><a href="/wiki/Coffee%20bean">bean</a></body></html>`,
+			canonical: "/wiki/Café",
+			links:     []string{"/wiki/Crème_brûlée", "/wiki/Coffee_bean"},
+		},
+		{
+			name:      "redirect",
+			subject:   "/wiki/Golang",
+			body:      `<html><head><link rel="canonical" href="https://en.wikipedia.org/wiki/Go_(programming_language)"></head><body></body></html>`,
+			canonical: "/wiki/Go_(programming_language)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := articleLinks(tt.subject, []byte(tt.body), tt.ns)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got.canonical != tt.canonical {
+				t.Errorf("got canonical %s, want %s", got.canonical, tt.canonical)
+			}
+			want := make(map[string]bool)
+			for _, link := range tt.links {
+				want[link] = true
+			}
+			if !reflect.DeepEqual(got.links, want) {
+				t.Errorf("got links %v, want %v", got.links, want)
+			}
+		})
+	}
+}
+
+func TestAnnotateLinks(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		uploadHost string
+		want       string
+	}{
+		{
+			name: "articles",
+			body: `<a href="/wiki/Go">Go</a><a href="/wiki/Cr%C3%A8me_br%C3%BBl%C3%A9e#History">dessert</a>`,
+			want: `<a href="/wiki/Go" data-wr-link="article" data-wr-target="Go">Go</a>` +
+				`<a href="/wiki/Cr%C3%A8me_br%C3%BBl%C3%A9e#History" data-wr-link="article" data-wr-target="Crème_brûlée">dessert</a>`,
+		},
+		{
+			name: "links which are not moves",
+			body: `<a href="#History">a</a><a href="/wiki/File:Go.svg">b</a><a href="/wiki/Special:Random">c</a>` +
+				`<a href="https://go.dev/">d</a><a href="//de.wikipedia.org/wiki/Go">e</a>` +
+				`<a href="/w/index.php?title=Gopher&action=edit&redlink=1" class="new">f</a>` +
+				`<a href="/w/index.php?title=Go&action=history">g</a><a>h</a>`,
+			want: `<a href="#History" data-wr-link="anchor">a</a><a href="/wiki/File:Go.svg" data-wr-link="namespace">b</a>` +
+				`<a href="/wiki/Special:Random" data-wr-link="namespace">c</a>` +
+				`<a href="https://go.dev/" data-wr-link="external">d</a><a href="//de.wikipedia.org/wiki/Go" data-wr-link="external">e</a>` +
+				`<a href="/w/index.php?title=Gopher&amp;action=edit&amp;redlink=1" class="new" data-wr-link="redlink">f</a>` +
+				`<a href="/w/index.php?title=Go&amp;action=history" data-wr-link="other">g</a><a>h</a>`,
+		},
+		{
+			name:       "images proxied",
+			body:       `<img src="//upload.wikimedia.org/a/ab/Go.png" srcset="https://upload.wikimedia.org/a/ab/Go2.png 2x, //example.org/Go3.png 3x"/><img src="/static/logo.svg"/>`,
+			uploadHost: "upload.wikimedia.org",
+			want:       `<img src="/upload/a/ab/Go.png" srcset="/upload/a/ab/Go2.png 2x, //example.org/Go3.png 3x"/><img src="/static/logo.svg"/>`,
+		},
+		{
+			name: "images not proxied",
+			body: `<img src="//upload.wikimedia.org/a/ab/Go.png"/>`,
+			want: `<img src="//upload.wikimedia.org/a/ab/Go.png"/>`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Server{options: ServerOptions{UploadHost: tt.uploadHost}}
+			if tt.uploadHost != "" {
+				s.upload = mocks.NewMockClientInterface(gomock.NewController(t))
+			}
+			got, err := s.extractBody([]byte("<html><body>"+tt.body+"</body></html>"), "", nil)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got.HTML != tt.want {
+				t.Errorf("got %s, want %s", got.HTML, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,139 @@
+/*
+Package metadata finds what a parsed wiki page gives of its metadata, for
+both Go backends, wrserver and the backend of go-app, so that the two serve
+the same api.Page for the same page.
+
+The revision of a page is that in the configuration which MediaWiki gives
+its scripts or, in the HTML of the REST API, in the about attribute of its
+<html>. Its display title is the text of its first heading, and its
+sections are its headings from <h2> to <h6>, whether bare, wrapped in a
+<div class="mw-heading"> or leading a <section>.
+*/
+package metadata
+
+import (
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/bruceesmith/wrspa/backend/wrserver/api"
+	"golang.org/x/net/html"
+)
+
+// revisionRe matches the ID of the revision in the configuration which
+// MediaWiki gives the scripts of a page
+var revisionRe = regexp.MustCompile(`"wgRevisionId"\s*:\s*(\d+)`)
+
+// Revision returns the ID of the revision of a page, parsed as doc, or 0 if
+// the page does not give it
+func Revision(doc *html.Node, page []byte) int64 {
+	if m := revisionRe.FindSubmatch(page); m != nil {
+		id, _ := strconv.ParseInt(string(m[1]), 10, 64)
+		return id
+	}
+	for n := range doc.Descendants() {
+		if n.Type == html.ElementNode && n.Data == "html" {
+			if _, id, found := strings.Cut(attribute(n, "about"), "/revision/"); found {
+				revision, _ := strconv.ParseInt(id, 10, 64)
+				return revision
+			}
+			break
+		}
+	}
+	return 0
+}
+
+// DisplayTitle returns the text of the first heading of a page, which is
+// its title as the page shows it, or the empty string if it has none
+func DisplayTitle(doc *html.Node) string {
+	for n := range doc.Descendants() {
+		if n.Type == html.ElementNode && attribute(n, "id") == "firstHeading" {
+			return strings.Join(strings.Fields(HeadingText(n)), " ")
+		}
+	}
+	return ""
+}
+
+// Sections returns the headings below n of the sections of a page
+func Sections(n *html.Node) []api.Section {
+	headings := []api.Section{}
+	for d := range n.Descendants() {
+		level := HeadingLevel(d)
+		if level < 2 || d.Data == "div" || d.Data == "section" {
+			continue
+		}
+		anchor := attribute(d, "id")
+		// Older skins give the ID to a <span class="mw-headline">
+		for c := d.FirstChild; c != nil && anchor == ""; c = c.NextSibling {
+			if c.Type == html.ElementNode && hasClass(c, "mw-headline") {
+				anchor = attribute(c, "id")
+			}
+		}
+		headings = append(headings, api.Section{
+			Level:  level,
+			Title:  strings.Join(strings.Fields(HeadingText(d)), " "),
+			Anchor: anchor,
+		})
+	}
+	return headings
+}
+
+// HeadingLevel returns the level of a heading, of a <div class="mw-heading">
+// wrapping one, or of a <section> which one leads, and 0 for any other node
+func HeadingLevel(n *html.Node) int {
+	if n == nil || n.Type != html.ElementNode {
+		return 0
+	}
+	switch {
+	case len(n.Data) == 2 && n.Data[0] == 'h' && n.Data[1] >= '1' && n.Data[1] <= '6':
+		return int(n.Data[1] - '0')
+	case n.Data == "div" && hasClass(n, "mw-heading"), n.Data == "section":
+		return HeadingLevel(firstElement(n))
+	}
+	return 0
+}
+
+// HeadingText returns the text of a heading, without that of its edit link
+func HeadingText(n *html.Node) string {
+	var b strings.Builder
+	var f func(*html.Node)
+	f = func(n *html.Node) {
+		switch {
+		case n.Type == html.TextNode:
+			b.WriteString(n.Data)
+		case n.Type == html.ElementNode && hasClass(n, "mw-editsection"):
+			return
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			f(c)
+		}
+	}
+	f(n)
+	return b.String()
+}
+
+// firstElement returns the first child of n which is an element
+func firstElement(n *html.Node) *html.Node {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.ElementNode {
+			return c
+		}
+	}
+	return nil
+}
+
+// hasClass reports whether an element has a class
+func hasClass(n *html.Node, class string) bool {
+	return slices.Contains(strings.Fields(attribute(n, "class")), class)
+}
+
+// attribute returns the value of an attribute of an element
+func attribute(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
@@ -0,0 +1,86 @@
+package metadata
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bruceesmith/wrspa/backend/wrserver/api"
+	"golang.org/x/net/html"
+)
+
+func TestRevision(t *testing.T) {
+	tests := []struct {
+		name string
+		page string
+		want int64
+	}{
+		{
+			name: "configuration",
+			page: `<html><head><script>RLCONF={"wgCurRevisionId":1234568,"wgRevisionId": 1234567};</script></head><body></body></html>`,
+			want: 1234567,
+		},
+		{
+			name: "rest api",
+			page: `<html about="https://en.wikipedia.org/wiki/Special:Redirect/revision/7654321"><body></body></html>`,
+			want: 7654321,
+		},
+		{name: "none", page: `<html><body><p about="/revision/1">p</p></body></html>`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := html.Parse(strings.NewReader(tt.page))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := Revision(doc, []byte(tt.page)); got != tt.want {
+				t.Errorf("got %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDisplayTitle(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{name: "heading", body: `<h1 id="firstHeading"><span>United</span>
+			<i>States</i><span class="mw-editsection">[edit]</span></h1>`, want: "United States"},
+		{name: "none", body: `<h1>United States</h1>`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := html.Parse(strings.NewReader("<html><body>" + tt.body + "</body></html>"))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := DisplayTitle(doc); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSections(t *testing.T) {
+	doc, err := html.Parse(strings.NewReader(`<html><body><h1 id="firstHeading">Go</h1>` +
+		`<div class="mw-heading mw-heading2"><h2 id="History">History</h2><span class="mw-editsection">[edit]</span></div>` +
+		`<section><h3 id="Early_years">Early  years</h3><p>p</p></section>` +
+		`<h2><span class="mw-headline" id="See_also">See also</span></h2>` +
+		`<h6>Smallest</h6></body></html>`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []api.Section{
+		{Level: 2, Title: "History", Anchor: "History"},
+		{Level: 3, Title: "Early years", Anchor: "Early_years"},
+		{Level: 2, Title: "See also", Anchor: "See_also"},
+		{Level: 6, Title: "Smallest"},
+	}
+	if got := Sections(doc); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
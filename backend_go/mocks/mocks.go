@@ -10,10 +10,12 @@
 package mocks
 
 import (
+	context "context"
 	http "net/http"
 	reflect "reflect"
 
 	terminator "github.com/bruceesmith/terminator"
+	leaderboard "github.com/bruceesmith/wrspa/backend/wrserver/leaderboard"
 	gomock "go.uber.org/mock/gomock"
 )
 
@@ -42,9 +44,9 @@ func (m *MockClientInterface) EXPECT() *MockClientInterfaceMockRecorder {
 }
 
 // Get mocks base method.
-func (m *MockClientInterface) Get(path string) ([]byte, string, error) {
+func (m *MockClientInterface) Get(ctx context.Context, path string) ([]byte, string, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Get", path)
+	ret := m.ctrl.Call(m, "Get", ctx, path)
 	ret0, _ := ret[0].([]byte)
 	ret1, _ := ret[1].(string)
 	ret2, _ := ret[2].(error)
@@ -52,23 +54,24 @@ func (m *MockClientInterface) Get(path string) ([]byte, string, error) {
 }
 
 // Get indicates an expected call of Get.
-func (mr *MockClientInterfaceMockRecorder) Get(path any) *gomock.Call {
+func (mr *MockClientInterfaceMockRecorder) Get(ctx, path any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockClientInterface)(nil).Get), path)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockClientInterface)(nil).Get), ctx, path)
 }
 
 // GetRandom mocks base method.
-func (m *MockClientInterface) GetRandom() string {
+func (m *MockClientInterface) GetRandom(ctx context.Context) (string, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetRandom")
+	ret := m.ctrl.Call(m, "GetRandom", ctx)
 	ret0, _ := ret[0].(string)
-	return ret0
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
 }
 
 // GetRandom indicates an expected call of GetRandom.
-func (mr *MockClientInterfaceMockRecorder) GetRandom() *gomock.Call {
+func (mr *MockClientInterfaceMockRecorder) GetRandom(ctx any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetRandom", reflect.TypeOf((*MockClientInterface)(nil).GetRandom))
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetRandom", reflect.TypeOf((*MockClientInterface)(nil).GetRandom), ctx)
 }
 
 // MockServerInterface is a mock of ServerInterface interface.
@@ -107,18 +110,88 @@ func (mr *MockServerInterfaceMockRecorder) API(w, r any) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "API", reflect.TypeOf((*MockServerInterface)(nil).API), w, r)
 }
 
-// MarshalFailure mocks base method.
-func (m *MockServerInterface) MarshalFailure(function string, err error, response any) string {
+// Daily mocks base method.
+func (m *MockServerInterface) Daily(w http.ResponseWriter, r *http.Request) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "MarshalFailure", function, err, response)
-	ret0, _ := ret[0].(string)
-	return ret0
+	m.ctrl.Call(m, "Daily", w, r)
 }
 
-// MarshalFailure indicates an expected call of MarshalFailure.
-func (mr *MockServerInterfaceMockRecorder) MarshalFailure(function, err, response any) *gomock.Call {
+// Daily indicates an expected call of Daily.
+func (mr *MockServerInterfaceMockRecorder) Daily(w, r any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MarshalFailure", reflect.TypeOf((*MockServerInterface)(nil).MarshalFailure), function, err, response)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Daily", reflect.TypeOf((*MockServerInterface)(nil).Daily), w, r)
+}
+
+// Events mocks base method.
+func (m *MockServerInterface) Events(w http.ResponseWriter, r *http.Request) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "Events", w, r)
+}
+
+// Events indicates an expected call of Events.
+func (mr *MockServerInterfaceMockRecorder) Events(w, r any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Events", reflect.TypeOf((*MockServerInterface)(nil).Events), w, r)
+}
+
+// Games mocks base method.
+func (m *MockServerInterface) Games(w http.ResponseWriter, r *http.Request) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "Games", w, r)
+}
+
+// Games indicates an expected call of Games.
+func (mr *MockServerInterfaceMockRecorder) Games(w, r any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Games", reflect.TypeOf((*MockServerInterface)(nil).Games), w, r)
+}
+
+// Leaderboards mocks base method.
+func (m *MockServerInterface) Leaderboards(w http.ResponseWriter, r *http.Request) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "Leaderboards", w, r)
+}
+
+// Leaderboards indicates an expected call of Leaderboards.
+func (mr *MockServerInterfaceMockRecorder) Leaderboards(w, r any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Leaderboards", reflect.TypeOf((*MockServerInterface)(nil).Leaderboards), w, r)
+}
+
+// OpenAPI mocks base method.
+func (m *MockServerInterface) OpenAPI(w http.ResponseWriter, r *http.Request) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "OpenAPI", w, r)
+}
+
+// OpenAPI indicates an expected call of OpenAPI.
+func (mr *MockServerInterfaceMockRecorder) OpenAPI(w, r any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "OpenAPI", reflect.TypeOf((*MockServerInterface)(nil).OpenAPI), w, r)
+}
+
+// RoomSocket mocks base method.
+func (m *MockServerInterface) RoomSocket(w http.ResponseWriter, r *http.Request) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "RoomSocket", w, r)
+}
+
+// RoomSocket indicates an expected call of RoomSocket.
+func (mr *MockServerInterfaceMockRecorder) RoomSocket(w, r any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RoomSocket", reflect.TypeOf((*MockServerInterface)(nil).RoomSocket), w, r)
+}
+
+// Rooms mocks base method.
+func (m *MockServerInterface) Rooms(w http.ResponseWriter, r *http.Request) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "Rooms", w, r)
+}
+
+// Rooms indicates an expected call of Rooms.
+func (mr *MockServerInterfaceMockRecorder) Rooms(w, r any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Rooms", reflect.TypeOf((*MockServerInterface)(nil).Rooms), w, r)
 }
 
 // SPAFile mocks base method.
@@ -157,6 +230,18 @@ func (mr *MockServerInterfaceMockRecorder) Settings(w, r any) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Settings", reflect.TypeOf((*MockServerInterface)(nil).Settings), w, r)
 }
 
+// Solve mocks base method.
+func (m *MockServerInterface) Solve(w http.ResponseWriter, r *http.Request) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "Solve", w, r)
+}
+
+// Solve indicates an expected call of Solve.
+func (mr *MockServerInterfaceMockRecorder) Solve(w, r any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Solve", reflect.TypeOf((*MockServerInterface)(nil).Solve), w, r)
+}
+
 // SpecialRandom mocks base method.
 func (m *MockServerInterface) SpecialRandom(w http.ResponseWriter, r *http.Request) {
 	m.ctrl.T.Helper()
@@ -169,6 +254,30 @@ func (mr *MockServerInterfaceMockRecorder) SpecialRandom(w, r any) *gomock.Call
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SpecialRandom", reflect.TypeOf((*MockServerInterface)(nil).SpecialRandom), w, r)
 }
 
+// Status mocks base method.
+func (m *MockServerInterface) Status(w http.ResponseWriter, r *http.Request) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "Status", w, r)
+}
+
+// Status indicates an expected call of Status.
+func (mr *MockServerInterfaceMockRecorder) Status(w, r any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Status", reflect.TypeOf((*MockServerInterface)(nil).Status), w, r)
+}
+
+// UploadFile mocks base method.
+func (m *MockServerInterface) UploadFile(w http.ResponseWriter, r *http.Request) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "UploadFile", w, r)
+}
+
+// UploadFile indicates an expected call of UploadFile.
+func (mr *MockServerInterfaceMockRecorder) UploadFile(w, r any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UploadFile", reflect.TypeOf((*MockServerInterface)(nil).UploadFile), w, r)
+}
+
 // WikiPage mocks base method.
 func (m *MockServerInterface) WikiPage(w http.ResponseWriter, r *http.Request) {
 	m.ctrl.T.Helper()
@@ -192,3 +301,86 @@ func (mr *MockServerInterfaceMockRecorder) WikipediaFile(w, r any) *gomock.Call
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WikipediaFile", reflect.TypeOf((*MockServerInterface)(nil).WikipediaFile), w, r)
 }
+
+// MockStore is a mock of Store interface.
+type MockStore struct {
+	ctrl     *gomock.Controller
+	recorder *MockStoreMockRecorder
+	isgomock struct{}
+}
+
+// MockStoreMockRecorder is the mock recorder for MockStore.
+type MockStoreMockRecorder struct {
+	mock *MockStore
+}
+
+// NewMockStore creates a new mock instance.
+func NewMockStore(ctrl *gomock.Controller) *MockStore {
+	mock := &MockStore{ctrl: ctrl}
+	mock.recorder = &MockStoreMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockStore) EXPECT() *MockStoreMockRecorder {
+	return m.recorder
+}
+
+// Challenge mocks base method.
+func (m *MockStore) Challenge(ctx context.Context, id string) (leaderboard.Challenge, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Challenge", ctx, id)
+	ret0, _ := ret[0].(leaderboard.Challenge)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Challenge indicates an expected call of Challenge.
+func (mr *MockStoreMockRecorder) Challenge(ctx, id any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Challenge", reflect.TypeOf((*MockStore)(nil).Challenge), ctx, id)
+}
+
+// Close mocks base method.
+func (m *MockStore) Close() error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Close")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Close indicates an expected call of Close.
+func (mr *MockStoreMockRecorder) Close() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Close", reflect.TypeOf((*MockStore)(nil).Close))
+}
+
+// Leaderboard mocks base method.
+func (m *MockStore) Leaderboard(ctx context.Context, id string, ranking leaderboard.Ranking, offset, limit int) ([]leaderboard.Score, int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Leaderboard", ctx, id, ranking, offset, limit)
+	ret0, _ := ret[0].([]leaderboard.Score)
+	ret1, _ := ret[1].(int)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// Leaderboard indicates an expected call of Leaderboard.
+func (mr *MockStoreMockRecorder) Leaderboard(ctx, id, ranking, offset, limit any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Leaderboard", reflect.TypeOf((*MockStore)(nil).Leaderboard), ctx, id, ranking, offset, limit)
+}
+
+// Record mocks base method.
+func (m *MockStore) Record(ctx context.Context, challenge leaderboard.Challenge, score leaderboard.Score) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Record", ctx, challenge, score)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Record indicates an expected call of Record.
+func (mr *MockStoreMockRecorder) Record(ctx, challenge, score any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Record", reflect.TypeOf((*MockStore)(nil).Record), ctx, challenge, score)
+}
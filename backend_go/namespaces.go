@@ -0,0 +1,87 @@
+package wrserver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+
+	"github.com/bruceesmith/logger"
+	"github.com/bruceesmith/wrspa/backend/wrserver/title"
+)
+
+// siteinfoResponse is the part of a MediaWiki meta=siteinfo query giving the
+// names of a wiki's namespaces. Each namespace has its local name and the
+// canonical name which every wiki also accepts, such as Datei and File.
+type siteinfoResponse struct {
+	Query struct {
+		Namespaces map[string]struct {
+			ID        int    `json:"id"`
+			Name      string `json:"name"`
+			Canonical string `json:"canonical"`
+		} `json:"namespaces"`
+		NamespaceAliases []struct {
+			ID    int    `json:"id"`
+			Alias string `json:"alias"`
+		} `json:"namespacealiases"`
+	} `json:"query"`
+	Error *struct {
+		Code string `json:"code"`
+		Info string `json:"info"`
+	} `json:"error"`
+}
+
+// fetchNamespaces queries the MediaWiki API of a wiki for the names and
+// aliases of its namespaces other than that of articles
+func fetchNamespaces(ctx context.Context, client ClientInterface) (title.Namespaces, error) {
+	query := url.Values{
+		"action":        {"query"},
+		"format":        {"json"},
+		"formatversion": {"2"},
+		"meta":          {"siteinfo"},
+		"siprop":        {"namespaces|namespacealiases"},
+	}
+	body, _, err := client.Get(ctx, "/w/api.php?"+query.Encode())
+	if err != nil {
+		return nil, err
+	}
+	var response siteinfoResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, fmt.Errorf("unable to parse namespaces: %w", err)
+	}
+	if response.Error != nil {
+		return nil, fmt.Errorf("unable to query namespaces: %s: %s", response.Error.Code, response.Error.Info)
+	}
+	ns := title.Namespaces{}
+	names := make(map[int]string)
+	for _, namespace := range response.Query.Namespaces {
+		if namespace.ID == 0 {
+			continue
+		}
+		names[namespace.ID] = namespace.Name
+		ns.Add(namespace.Name, namespace.Name)
+		if namespace.Canonical != "" {
+			ns.Add(namespace.Canonical, namespace.Name)
+		}
+	}
+	for _, alias := range response.Query.NamespaceAliases {
+		if name, found := names[alias.ID]; found {
+			ns.Add(alias.Alias, name)
+		}
+	}
+	if len(ns) == 0 {
+		return nil, fmt.Errorf("no namespaces given")
+	}
+	return ns, nil
+}
+
+// wikiNamespaces returns the namespaces of a wiki or, if they cannot be
+// fetched, nil, which stands for those of the English Wikipedia
+func wikiNamespaces(ctx context.Context, client ClientInterface, wiki string) title.Namespaces {
+	ns, err := fetchNamespaces(ctx, client)
+	if err != nil {
+		logger.Warn("namespaces unavailable, assuming English", "wiki", wiki, "error", err.Error())
+		return nil
+	}
+	return ns
+}
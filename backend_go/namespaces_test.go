@@ -0,0 +1,88 @@
+package wrserver
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bruceesmith/wrspa/backend/wrserver/mocks"
+	"github.com/bruceesmith/wrspa/backend/wrserver/title"
+	"go.uber.org/mock/gomock"
+)
+
+func TestFetchNamespaces(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	siteinfo := `{"query":{"namespaces":{` +
+		`"-1":{"id":-1,"name":"Spezial","canonical":"Special"},` +
+		`"0":{"id":0,"name":""},` +
+		`"6":{"id":6,"name":"Datei","canonical":"File"},` +
+		`"14":{"id":14,"name":"Kategorie","canonical":"Category"},` +
+		`"3":{"id":3,"name":"Benutzer Diskussion","canonical":"User talk"}},` +
+		`"namespacealiases":[{"id":6,"alias":"Bild"},{"id":99,"alias":"Unknown"}]}}`
+	client := mocks.NewMockClientInterface(ctrl)
+	client.EXPECT().Get(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, path string) ([]byte, string, error) {
+			query, found := strings.CutPrefix(path, "/w/api.php?")
+			values, _ := url.ParseQuery(query)
+			if !found || values.Get("meta") != "siteinfo" || values.Get("siprop") != "namespaces|namespacealiases" {
+				t.Errorf("unexpected request %s", path)
+			}
+			return []byte(siteinfo), "application/json", nil
+		},
+	)
+	got, err := fetchNamespaces(context.Background(), client)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := title.Namespaces{
+		"spezial":             "Spezial",
+		"special":             "Spezial",
+		"datei":               "Datei",
+		"file":                "Datei",
+		"bild":                "Datei",
+		"kategorie":           "Kategorie",
+		"category":            "Kategorie",
+		"benutzer_diskussion": "Benutzer_Diskussion",
+		"user_talk":           "Benutzer_Diskussion",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if !got.IsArticle("/wiki/Go") || got.IsArticle("/wiki/Bild:Go.svg") {
+		t.Errorf("got articles by %v", got)
+	}
+}
+
+func TestFetchNamespaces_Errors(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	for _, body := range []string{
+		`not json`,
+		`{"error":{"code":"unknown_siprop","info":"Unrecognized value"}}`,
+		`{"query":{"namespaces":{"0":{"id":0,"name":""}}}}`,
+	} {
+		client := mocks.NewMockClientInterface(ctrl)
+		client.EXPECT().Get(gomock.Any(), gomock.Any()).Return([]byte(body), "application/json", nil)
+		if _, err := fetchNamespaces(context.Background(), client); err == nil {
+			t.Errorf("%s: expected an error, got nil", body)
+		}
+		// The wiki is then taken to have the namespaces of the English
+		// Wikipedia
+		client.EXPECT().Get(gomock.Any(), gomock.Any()).Return([]byte(body), "application/json", nil)
+		if ns := wikiNamespaces(context.Background(), client, "de"); ns != nil {
+			t.Errorf("%s: got %v, want nil", body, ns)
+		}
+	}
+
+	failing := mocks.NewMockClientInterface(ctrl)
+	failing.EXPECT().Get(gomock.Any(), gomock.Any()).Return(nil, "", ErrCircuitOpen)
+	if _, err := fetchNamespaces(context.Background(), failing); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("got %v, want ErrCircuitOpen", err)
+	}
+}
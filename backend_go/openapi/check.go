@@ -0,0 +1,190 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"math"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Match returns the path of the Document, such as /api/games/{id}, whose
+// operation for a method answers a request for a path, such as
+// /api/games/abc, and that operation. It returns no operation if there is
+// none.
+func (d *Document) Match(method, path string) (string, *Operation) {
+	segments := strings.Split(path, "/")
+	for template, operations := range d.Paths {
+		operation, found := operations[strings.ToLower(method)]
+		if !found {
+			continue
+		}
+		parts := strings.Split(template, "/")
+		if len(parts) != len(segments) {
+			continue
+		}
+		matched := true
+		for i, part := range parts {
+			if strings.HasPrefix(part, "{") && strings.HasSuffix(part, "}") {
+				matched = segments[i] != ""
+			} else {
+				matched = strings.EqualFold(part, segments[i])
+			}
+			if !matched {
+				break
+			}
+		}
+		if matched {
+			return template, operation
+		}
+	}
+	return "", nil
+}
+
+// CheckResponse checks that a response to a request for a method and path
+// is one which the Document describes: that its status is one of its
+// operation's responses, or that the operation has a default response, that
+// its media type is one of that response's, and that its body matches the
+// schema of that media type. A body of JSON, or of newline-delimited JSON
+// each of whose lines is checked, is checked against its schema; any other
+// body is not.
+func (d *Document) CheckResponse(method, path string, status int, header http.Header, body []byte) error {
+	template, operation := d.Match(method, path)
+	if operation == nil {
+		return fmt.Errorf("no operation for %s %s", method, path)
+	}
+	response, found := operation.Responses[strconv.Itoa(status)]
+	if !found {
+		response, found = operation.Responses["default"]
+	}
+	if !found {
+		return fmt.Errorf("%s %s: no response for status %d", method, template, status)
+	}
+	if len(response.Content) == 0 {
+		if len(body) > 0 {
+			return fmt.Errorf("%s %s: unexpected body with status %d", method, template, status)
+		}
+		return nil
+	}
+	mediaType, _, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		return fmt.Errorf("%s %s: invalid Content-Type '%s': %w", method, template, header.Get("Content-Type"), err)
+	}
+	content, found := response.Content[mediaType]
+	if !found {
+		return fmt.Errorf("%s %s: no %s content with status %d", method, template, mediaType, status)
+	}
+	var documents [][]byte
+	switch {
+	case content.Schema == nil:
+	case mediaType == "application/json":
+		documents = [][]byte{body}
+	case mediaType == "application/x-ndjson":
+		for line := range bytes.SplitSeq(body, []byte("\n")) {
+			if len(bytes.TrimSpace(line)) > 0 {
+				documents = append(documents, line)
+			}
+		}
+	}
+	for _, document := range documents {
+		var v any
+		if err := json.Unmarshal(document, &v); err != nil {
+			return fmt.Errorf("%s %s: invalid JSON with status %d: %w", method, template, status, err)
+		}
+		if err := d.Validate(content.Schema, v); err != nil {
+			return fmt.Errorf("%s %s: status %d: %w", method, template, status, err)
+		}
+	}
+	return nil
+}
+
+// Validate checks that a value, as encoding/json unmarshals JSON into an
+// any, matches a schema of the Document: that it is of the schema's type,
+// and that an object has each property which the schema requires and none
+// which it does not describe
+func (d *Document) Validate(s *Schema, v any) error {
+	return d.validate(s, v, "$")
+}
+
+// validate checks that the value at a location matches a schema
+func (d *Document) validate(s *Schema, v any, at string) error {
+	if s.Ref != "" {
+		referred, found := d.Components.Schemas[strings.TrimPrefix(s.Ref, refPrefix)]
+		if !found {
+			return fmt.Errorf("%s: unknown schema %s", at, s.Ref)
+		}
+		return d.validate(referred, v, at)
+	}
+	if s.Type == "" {
+		return nil
+	}
+	if v == nil {
+		if s.Nullable {
+			return nil
+		}
+		return fmt.Errorf("%s: null, want %s", at, s.Type)
+	}
+	switch s.Type {
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			return fmt.Errorf("%s: %T, want boolean", at, v)
+		}
+	case "integer":
+		if n, ok := v.(float64); !ok || n != math.Trunc(n) {
+			return fmt.Errorf("%s: %v, want integer", at, v)
+		}
+	case "number":
+		if _, ok := v.(float64); !ok {
+			return fmt.Errorf("%s: %T, want number", at, v)
+		}
+	case "string":
+		text, ok := v.(string)
+		if !ok {
+			return fmt.Errorf("%s: %T, want string", at, v)
+		}
+		if _, err := time.Parse(time.RFC3339, text); s.Format == "date-time" && err != nil {
+			return fmt.Errorf("%s: '%s', want date-time", at, text)
+		}
+	case "array":
+		items, ok := v.([]any)
+		if !ok {
+			return fmt.Errorf("%s: %T, want array", at, v)
+		}
+		for i, item := range items {
+			if err := d.validate(s.Items, item, fmt.Sprintf("%s[%d]", at, i)); err != nil {
+				return err
+			}
+		}
+	case "object":
+		properties, ok := v.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s: %T, want object", at, v)
+		}
+		for _, name := range s.Required {
+			if _, found := properties[name]; !found {
+				return fmt.Errorf("%s: missing property %s", at, name)
+			}
+		}
+		for _, name := range slices.Sorted(maps.Keys(properties)) {
+			property, found := s.Properties[name]
+			if !found {
+				property = s.AdditionalProperties
+			}
+			if property == nil {
+				return fmt.Errorf("%s: unexpected property %s", at, name)
+			}
+			if err := d.validate(property, properties[name], at+"."+name); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("%s: unknown type %s", at, s.Type)
+	}
+	return nil
+}
@@ -0,0 +1,229 @@
+/*
+Package openapi describes a REST API as an OpenAPI 3 document. The schemas
+of its requests and responses are generated from their Go types, by the
+same rules as encoding/json, so that they cannot drift from the types, and
+a response can be checked against its operation, so that a test fails when
+a handler drifts from the document.
+*/
+package openapi
+
+import (
+	"path"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Version is the version of OpenAPI to which a Document conforms
+const Version = "3.0.3"
+
+// Document is an OpenAPI document
+type Document struct {
+	OpenAPI    string                           `json:"openapi"`
+	Info       Info                             `json:"info"`
+	Paths      map[string]map[string]*Operation `json:"paths"` // By path, then lowercase method
+	Components Components                       `json:"components"`
+
+	types map[string]reflect.Type // Of each schema in Components, by name
+}
+
+// Info describes the API
+type Info struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+// Components holds the schemas of the named Go types, to which other
+// schemas refer
+type Components struct {
+	Schemas map[string]*Schema `json:"schemas"`
+}
+
+// Operation is one method of a path
+type Operation struct {
+	OperationID string              `json:"operationId"`
+	Summary     string              `json:"summary,omitempty"`
+	Description string              `json:"description,omitempty"`
+	Deprecated  bool                `json:"deprecated,omitempty"`
+	Parameters  []Parameter         `json:"parameters,omitempty"`
+	RequestBody *RequestBody        `json:"requestBody,omitempty"`
+	Responses   map[string]Response `json:"responses"` // By status, or default for any other
+}
+
+// Parameter is a parameter of an Operation, in its path, query or headers
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"` // path, query or header
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+// RequestBody is the body of the request of an Operation
+type RequestBody struct {
+	Required bool                 `json:"required,omitempty"`
+	Content  map[string]MediaType `json:"content"` // By media type
+}
+
+// Response is a response of an Operation, which has no body if it has no
+// Content
+type Response struct {
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content,omitempty"` // By media type
+}
+
+// MediaType is the schema of a body of one media type. A body with no
+// schema is not described.
+type MediaType struct {
+	Schema *Schema `json:"schema,omitempty"`
+}
+
+// Schema is the schema of a JSON value. A Schema with neither a Ref nor a
+// Type allows any value.
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+}
+
+// refPrefix is the prefix of a Ref to a schema in Components
+const refPrefix = "#/components/schemas/"
+
+var timeType = reflect.TypeFor[time.Time]()
+
+// New returns a Document with no paths
+func New(info Info) *Document {
+	return &Document{
+		OpenAPI:    Version,
+		Info:       info,
+		Paths:      make(map[string]map[string]*Operation),
+		Components: Components{Schemas: make(map[string]*Schema)},
+		types:      make(map[string]reflect.Type),
+	}
+}
+
+// Add adds an operation for a method of a path, in which a parameter is
+// written {name}
+func (d *Document) Add(method, path string, operation Operation) {
+	if d.Paths[path] == nil {
+		d.Paths[path] = make(map[string]*Operation)
+	}
+	d.Paths[path][strings.ToLower(method)] = &operation
+}
+
+// Schema returns the schema of the Go type of v, as encoding/json encodes
+// it. A named struct is a reference to its schema in Components, which is
+// added along with those of the types it refers to.
+func (d *Document) Schema(v any) *Schema {
+	return d.schema(reflect.TypeOf(v))
+}
+
+// JSON returns the content of a body of JSON with the schema of the Go type
+// of v
+func (d *Document) JSON(v any) map[string]MediaType {
+	return map[string]MediaType{"application/json": {Schema: d.Schema(v)}}
+}
+
+// schema returns the schema of a Go type
+func (d *Document) schema(t reflect.Type) *Schema {
+	if t == nil {
+		return &Schema{}
+	}
+	if t == timeType {
+		return &Schema{Type: "string", Format: "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		return d.schema(t.Elem())
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Uint, reflect.Uint8, reflect.Uint16:
+		return &Schema{Type: "integer"}
+	case reflect.Int32, reflect.Uint32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte", Nullable: true}
+		}
+		return &Schema{Type: "array", Items: d.schema(t.Elem()), Nullable: true}
+	case reflect.Array:
+		return &Schema{Type: "array", Items: d.schema(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: d.schema(t.Elem()), Nullable: true}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return d.object(t)
+		}
+		return &Schema{Ref: refPrefix + d.component(t)}
+	}
+	return &Schema{}
+}
+
+// component adds the schema of a named struct to Components, if it is not
+// there already, and returns its name. A type whose name is taken by
+// another type is named for its package too.
+func (d *Document) component(t reflect.Type) string {
+	name := t.Name()
+	if other, found := d.types[name]; found && other != t {
+		name = path.Base(t.PkgPath()) + "." + name
+	}
+	if _, found := d.types[name]; !found {
+		d.types[name] = t
+		d.Components.Schemas[name] = d.object(t)
+	}
+	return name
+}
+
+// object returns the schema of a struct, whose fields are required unless
+// they are omitted when empty or zero
+func (d *Document) object(t reflect.Type) *Schema {
+	s := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+	d.fields(t, s)
+	return s
+}
+
+// fields adds the fields of a struct to the schema of an object, and those
+// of a struct which it embeds without a name
+func (d *Document) fields(t reflect.Type, s *Schema) {
+	for i := range t.NumField() {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" {
+			embedded := f.Type
+			if embedded.Kind() == reflect.Pointer {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				d.fields(embedded, s)
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		s.Properties[name] = d.schema(f.Type)
+		if !strings.Contains(","+options+",", ",omitempty,") && !strings.Contains(","+options+",", ",omitzero,") {
+			s.Required = append(s.Required, name)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type inner struct {
+	Name string `json:"name"`
+}
+
+type embedded struct {
+	Rank int `json:"rank"`
+}
+
+type outer struct {
+	embedded
+	ID       string           `json:"id"`
+	Count    int64            `json:"count"`
+	Ratio    float64          `json:"ratio,omitempty"`
+	Done     bool             `json:"done"`
+	At       time.Time        `json:"at,omitzero"`
+	Tags     []string         `json:"tags"`
+	Inner    inner            `json:"inner"`
+	Optional *inner           `json:"optional,omitempty"`
+	ByName   map[string]inner `json:"byname,omitempty"`
+	Any      any              `json:"any,omitempty"`
+	Skipped  string           `json:"-"`
+	Untagged string
+	hidden   string
+}
+
+func TestSchema(t *testing.T) {
+	d := New(Info{Title: "test", Version: "1"})
+	s := d.Schema(outer{})
+	if s.Ref != refPrefix+"outer" {
+		t.Fatalf("got %+v, want a reference to outer", s)
+	}
+	object := d.Components.Schemas["outer"]
+	want := map[string]string{
+		"rank": "integer", "id": "string", "count": "integer", "ratio": "number", "done": "boolean",
+		"at": "string", "tags": "array", "inner": "", "optional": "", "byname": "object", "any": "",
+		"Untagged": "string",
+	}
+	if len(object.Properties) != len(want) {
+		t.Errorf("got properties %v, want %v", reflect.ValueOf(object.Properties).MapKeys(), want)
+	}
+	for name, typ := range want {
+		property, found := object.Properties[name]
+		if !found || property.Type != typ {
+			t.Errorf("got property %s %+v, want type %s", name, property, typ)
+		}
+	}
+	required := []string{"rank", "id", "count", "done", "tags", "inner", "Untagged"}
+	if !reflect.DeepEqual(object.Required, required) {
+		t.Errorf("got required %v, want %v", object.Required, required)
+	}
+	if object.Properties["at"].Format != "date-time" || object.Properties["count"].Format != "int64" {
+		t.Errorf("got formats %+v, %+v", object.Properties["at"], object.Properties["count"])
+	}
+	if !object.Properties["tags"].Nullable || object.Properties["tags"].Items.Type != "string" {
+		t.Errorf("got tags %+v, want a nullable array of strings", object.Properties["tags"])
+	}
+	if object.Properties["inner"].Ref != refPrefix+"inner" || object.Properties["optional"].Ref != refPrefix+"inner" {
+		t.Errorf("got inner %+v and optional %+v, want references to inner", object.Properties["inner"], object.Properties["optional"])
+	}
+	if _, found := d.Components.Schemas["inner"]; !found {
+		t.Errorf("inner is not a component")
+	}
+}
+
+func TestSchemaNameTaken(t *testing.T) {
+	d := New(Info{Title: "test", Version: "1"})
+	type inner struct {
+		Other string `json:"other"`
+	}
+	d.Schema(struct {
+		A inner `json:"a"`
+	}{})
+	if s := d.Schema(outer{}); s.Ref != refPrefix+"outer" {
+		t.Fatalf("got %+v", s)
+	}
+	if got := d.Components.Schemas["outer"].Properties["inner"].Ref; got != refPrefix+"openapi.inner" {
+		t.Errorf("got %s, want the name qualified by its package", got)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	d := New(Info{Title: "test", Version: "1"})
+	s := d.Schema(outer{})
+
+	tests := []struct {
+		name    string
+		json    string
+		wantErr string
+	}{
+		{name: "valid", json: `{"rank":1,"id":"a","count":2,"done":true,"tags":["x"],"inner":{"name":"n"},"Untagged":"u","at":"2026-10-17T09:00:00Z","byname":{"k":{"name":"m"}},"any":[1]}`},
+		{name: "null slice", json: `{"rank":1,"id":"a","count":2,"done":true,"tags":null,"inner":{"name":"n"},"Untagged":"u"}`},
+		{name: "missing", json: `{"rank":1,"count":2,"done":true,"tags":[],"inner":{"name":"n"},"Untagged":"u"}`, wantErr: "$: missing property id"},
+		{name: "unexpected", json: `{"rank":1,"id":"a","count":2,"done":true,"tags":[],"inner":{"name":"n","extra":1},"Untagged":"u"}`, wantErr: "$.inner: unexpected property extra"},
+		{name: "not an integer", json: `{"rank":1.5,"id":"a","count":2,"done":true,"tags":[],"inner":{"name":"n"},"Untagged":"u"}`, wantErr: "$.rank: 1.5, want integer"},
+		{name: "wrong item", json: `{"rank":1,"id":"a","count":2,"done":true,"tags":["x",2],"inner":{"name":"n"},"Untagged":"u"}`, wantErr: "$.tags[1]: float64, want string"},
+		{name: "not a time", json: `{"rank":1,"id":"a","count":2,"done":true,"tags":[],"inner":{"name":"n"},"Untagged":"u","at":"today"}`, wantErr: "$.at: 'today', want date-time"},
+		{name: "null object", json: `{"rank":1,"id":"a","count":2,"done":true,"tags":[],"inner":null,"Untagged":"u"}`, wantErr: "$.inner: null, want object"},
+		{name: "not an object", json: `[]`, wantErr: "$: []interface {}, want object"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var v any
+			if err := json.Unmarshal([]byte(tt.json), &v); err != nil {
+				t.Fatalf("invalid JSON: %v", err)
+			}
+			err := d.Validate(s, v)
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("got error %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || err.Error() != tt.wantErr) {
+				t.Errorf("got error %v, want %s", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckResponse(t *testing.T) {
+	d := New(Info{Title: "test", Version: "1"})
+	d.Add(http.MethodGet, "/api/items/{id}", Operation{
+		OperationID: "getItem",
+		Responses: map[string]Response{
+			"200":     {Description: "the item", Content: d.JSON(inner{})},
+			"204":     {Description: "no item"},
+			"default": {Description: "a failure", Content: map[string]MediaType{"text/plain": {}}},
+		},
+	})
+	d.Add(http.MethodGet, "/api/items", Operation{
+		OperationID: "listItems",
+		Responses: map[string]Response{
+			"200": {Description: "the items", Content: map[string]MediaType{"application/x-ndjson": {Schema: d.Schema(inner{})}}},
+		},
+	})
+	header := func(contentType string) http.Header {
+		return http.Header{"Content-Type": []string{contentType}}
+	}
+
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		status  int
+		header  http.Header
+		body    string
+		wantErr string
+	}{
+		{name: "valid", method: http.MethodGet, path: "/api/items/a", status: http.StatusOK, header: header("application/json; charset=utf-8"), body: `{"name":"a"}`},
+		{name: "case", method: http.MethodGet, path: "/API/Items/a", status: http.StatusOK, header: header("application/json"), body: `{"name":"a"}`},
+		{name: "no content", method: http.MethodGet, path: "/api/items/a", status: http.StatusNoContent},
+		{name: "default", method: http.MethodGet, path: "/api/items/a", status: http.StatusNotFound, header: header("text/plain"), body: "gone"},
+		{name: "ndjson", method: http.MethodGet, path: "/api/items", status: http.StatusOK, header: header("application/x-ndjson"), body: "{\"name\":\"a\"}\n{\"name\":\"b\"}\n"},
+		{name: "bad ndjson line", method: http.MethodGet, path: "/api/items", status: http.StatusOK, header: header("application/x-ndjson"), body: "{\"name\":\"a\"}\n{\"id\":\"b\"}\n", wantErr: "missing property name"},
+		{name: "no operation", method: http.MethodPost, path: "/api/items/a", status: http.StatusOK, wantErr: "no operation for POST /api/items/a"},
+		{name: "no path", method: http.MethodGet, path: "/api/items/a/b", status: http.StatusOK, wantErr: "no operation"},
+		{name: "no status", method: http.MethodGet, path: "/api/items", status: http.StatusNotFound, wantErr: "no response for status 404"},
+		{name: "body without content", method: http.MethodGet, path: "/api/items/a", status: http.StatusNoContent, body: "x", wantErr: "unexpected body"},
+		{name: "media type", method: http.MethodGet, path: "/api/items/a", status: http.StatusOK, header: header("text/html"), body: "<p>", wantErr: "no text/html content"},
+		{name: "drifted", method: http.MethodGet, path: "/api/items/a", status: http.StatusOK, header: header("application/json"), body: `{"title":"a"}`, wantErr: "missing property name"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := d.CheckResponse(tt.method, tt.path, tt.status, tt.header, []byte(tt.body))
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("got error %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("got error %v, want %s", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,171 @@
+package wrserver
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/bruceesmith/wrspa/backend/wrserver/metadata"
+	"golang.org/x/net/html"
+)
+
+// The profiles built into the server
+const (
+	ProfileClassic  = "classic"   // Without edit links, hatnotes, coordinates and references
+	ProfileHard     = "hard"      // Classic, and without navboxes or See also sections
+	ProfileTextOnly = "text-only" // Classic, and without images or infoboxes
+)
+
+// ErrUnknownProfile is returned for the name of a profile which the server
+// does not have
+var ErrUnknownProfile = errors.New("unknown page profile")
+
+// Profile is a named set of cleanups applied to the pages of a game, which
+// removes parts of a page that make the game easier or just noisier.
+// A profile changes only what a player is shown: every link of a page is
+// still a move, so that games with different profiles are ranked alike and
+// compared with the same shortest paths.
+type Profile struct {
+	Remove   []string `yaml:"remove"`   // Selectors of the elements removed: name, .class, #id or name.class
+	Sections []string `yaml:"sections"` // Headings of the sections removed with their content, in any case
+}
+
+// DefaultProfiles returns the profiles built into the server
+func DefaultProfiles() map[string]Profile {
+	classic := Profile{
+		Remove: []string{
+			".mw-editsection", ".mw-jump-link", "#siteSub", "#contentSub", "#mp-topbanner",
+			".hatnote", ".dablink", "#coordinates",
+			"sup.reference", ".reflist", ".mw-references-wrap", "ol.references",
+		},
+		Sections: []string{"References", "Notes", "Citations", "Footnotes"},
+	}
+	hard := Profile{
+		Remove:   append(slices.Clone(classic.Remove), ".navbox", ".navbox-styles", ".vertical-navbox", ".sidebar", ".portalbox"),
+		Sections: append(slices.Clone(classic.Sections), "See also"),
+	}
+	textOnly := Profile{
+		Remove: append(slices.Clone(classic.Remove),
+			"figure", "img", "picture", "audio", "video", ".thumb", ".gallery", ".infobox"),
+		Sections: slices.Clone(classic.Sections),
+	}
+	return map[string]Profile{
+		ProfileClassic:  classic,
+		ProfileHard:     hard,
+		ProfileTextOnly: textOnly,
+	}
+}
+
+// selectorRe matches a selector: an element name, a class, an ID, or an
+// element name with a class or an ID
+var selectorRe = regexp.MustCompile(`^([a-z][a-z0-9]*)?(?:\.([A-Za-z0-9_-]+)|#([A-Za-z0-9_.:-]+))?$`)
+
+// selector is a parsed selector of a Profile
+type selector struct {
+	name  string
+	class string
+	id    string
+}
+
+// matches reports whether an element matches the selector
+func (sel selector) matches(n *html.Node) bool {
+	return (sel.name == "" || n.Data == sel.name) &&
+		(sel.class == "" || hasClass(n, sel.class)) &&
+		(sel.id == "" || attribute(n, "id") == sel.id)
+}
+
+// cleaner applies a Profile to the <body> of a page
+type cleaner struct {
+	selectors []selector
+	sections  map[string]bool // Lowercased headings
+}
+
+// newCleaner parses the selectors of a profile
+func newCleaner(p Profile) (*cleaner, error) {
+	c := &cleaner{sections: make(map[string]bool)}
+	for _, s := range p.Remove {
+		m := selectorRe.FindStringSubmatch(s)
+		if m == nil || s == "" {
+			return nil, fmt.Errorf("invalid selector '%s'", s)
+		}
+		c.selectors = append(c.selectors, selector{name: m[1], class: m[2], id: m[3]})
+	}
+	for _, heading := range p.Sections {
+		c.sections[strings.ToLower(strings.TrimSpace(heading))] = true
+	}
+	return c, nil
+}
+
+// clean removes from the descendants of n, in place, the sections and then
+// the elements which the profile removes. A nil cleaner removes nothing.
+func (c *cleaner) clean(n *html.Node) {
+	if c == nil {
+		return
+	}
+	var removed []*html.Node
+	if len(c.sections) > 0 {
+		for d := range n.Descendants() {
+			if level := metadata.HeadingLevel(d); level > 0 && d.Data != "div" && d.Data != "section" &&
+				c.sections[strings.ToLower(strings.TrimSpace(metadata.HeadingText(d)))] {
+				removed = append(removed, section(d, level)...)
+			}
+		}
+	}
+	for _, r := range removed {
+		if r.Parent != nil {
+			r.Parent.RemoveChild(r)
+		}
+	}
+
+	removed = removed[:0]
+	for d := range n.Descendants() {
+		if d.Type == html.ElementNode && slices.ContainsFunc(c.selectors, func(sel selector) bool { return sel.matches(d) }) {
+			removed = append(removed, d)
+		}
+	}
+	for _, r := range removed {
+		if r.Parent != nil {
+			r.Parent.RemoveChild(r)
+		}
+	}
+}
+
+// section returns the nodes making up the section which a heading begins.
+// That is the enclosing <section> if the heading leads one, as it does in
+// Parsoid HTML, and otherwise the heading, with any <div class="mw-heading">
+// wrapping it, and every following sibling up to the next heading of the
+// same or a higher level.
+func section(heading *html.Node, level int) []*html.Node {
+	start := heading
+	if p := heading.Parent; p != nil && p.Data == "div" && hasClass(p, "mw-heading") {
+		start = p
+	}
+	if p := start.Parent; p != nil && p.Data == "section" && firstElement(p) == start {
+		return []*html.Node{p}
+	}
+	nodes := []*html.Node{start}
+	for s := start.NextSibling; s != nil; s = s.NextSibling {
+		if l := metadata.HeadingLevel(s); l > 0 && l <= level {
+			break
+		}
+		nodes = append(nodes, s)
+	}
+	return nodes
+}
+
+// firstElement returns the first child of n which is an element
+func firstElement(n *html.Node) *html.Node {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.ElementNode {
+			return c
+		}
+	}
+	return nil
+}
+
+// hasClass reports whether an element has a class
+func hasClass(n *html.Node, class string) bool {
+	return slices.Contains(strings.Fields(attribute(n, "class")), class)
+}
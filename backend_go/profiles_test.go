@@ -0,0 +1,202 @@
+package wrserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"io"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"go.uber.org/mock/gomock"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files of the profile tests")
+
+// TestProfiles_Golden extracts the body of each testdata/pages/*.html with
+// each built-in profile and compares the result with the matching
+// {page}.{profile}.golden file. Run the tests with -update to rewrite the
+// golden files after a deliberate change.
+func TestProfiles_Golden(t *testing.T) {
+	pages, err := filepath.Glob(filepath.Join("testdata", "pages", "*.html"))
+	if err != nil || len(pages) == 0 {
+		t.Fatalf("no test pages: %v", err)
+	}
+	s := &Server{}
+	profiles := DefaultProfiles()
+	for _, name := range slices.Sorted(maps.Keys(profiles)) {
+		c, err := newCleaner(profiles[name])
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		for _, page := range pages {
+			golden := strings.TrimSuffix(page, ".html") + "." + name + ".golden"
+			t.Run(filepath.Base(golden), func(t *testing.T) {
+				input, err := os.ReadFile(page)
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				extracted, err := s.extractBody(input, "", c)
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				got := extracted.HTML
+				if *update {
+					if err := os.WriteFile(golden, []byte(got), 0o644); err != nil {
+						t.Fatalf("unexpected error: %v", err)
+					}
+				}
+				want, err := os.ReadFile(golden)
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if got != string(want) {
+					t.Errorf("%s with profile %s differs from %s:\n%s", page, name, golden, got)
+				}
+			})
+		}
+	}
+}
+
+func TestProfiles_Clean(t *testing.T) {
+	tests := []struct {
+		name    string
+		profile Profile
+		body    string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:    "selectors",
+			profile: Profile{Remove: []string{"img", ".box", "#top", "span.note"}},
+			body:    `<p id="top">a</p><p class="x box">b<img src="c.png"/></p><span class="note">d</span><p class="note">e</p>`,
+			want:    `<p class="note">e</p>`,
+		},
+		{
+			name:    "section up to the next heading of its level",
+			profile: Profile{Sections: []string{"see ALSO "}},
+			body:    `<h2>History</h2><p>a</p><h2>See also</h2><h3>More</h3><p>b</p><h2>Notes</h2><p>c</p>`,
+			want:    `<h2>History</h2><p>a</p><h2>Notes</h2><p>c</p>`,
+		},
+		{
+			name:    "section to the end",
+			profile: Profile{Sections: []string{"Notes"}},
+			body:    `<h2>History</h2><p>a</p><div class="mw-heading mw-heading2"><h2>Notes</h2><span class="mw-editsection">edit</span></div><p>c</p>`,
+			want:    `<h2>History</h2><p>a</p>`,
+		},
+		{
+			name:    "invalid selector",
+			profile: Profile{Remove: []string{"div > p"}},
+			wantErr: true,
+		},
+		{
+			name:    "empty selector",
+			profile: Profile{Remove: []string{""}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := newCleaner(tt.profile)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newCleaner() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			got, err := (&Server{}).extractBody([]byte("<html><body>"+tt.body+"</body></html>"), "", c)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got.HTML != tt.want {
+				t.Errorf("got %s, want %s", got.HTML, tt.want)
+			}
+		})
+	}
+}
+
+func TestProfilesAPI(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	pages := map[string]string{
+		"/wiki/Start": `<html><body><p><a href="/wiki/Goal">Goal</a></p><div class="navbox"><a href="/wiki/A">A</a></div></body></html>`,
+		"/wiki/A":     `<html><body><a href="/wiki/Goal">Goal</a></body></html>`,
+		"/wiki/Goal":  `<html><body><p>goal</p></body></html>`,
+	}
+	options := DefaultServerOptions()
+	options.Wiki = "en"
+	svr, err := NewServerWithOptions("8080", "testdata", testWiki(ctrl, pages, nil), options)
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+	ts := httptest.NewServer(svr.(*Server).server.Handler)
+	defer ts.Close()
+
+	var plain, hard GameResponse
+	post(t, ts, "/api/games", CreateGameRequest{Start: "/wiki/Start", Goal: "/wiki/Goal"}, http.StatusCreated, &plain)
+	post(t, ts, "/api/games", CreateGameRequest{Start: "/wiki/Start", Goal: "/wiki/Goal", Profile: ProfileHard}, http.StatusCreated, &hard)
+	post(t, ts, "/api/games", CreateGameRequest{Start: "/wiki/Start", Goal: "/wiki/Goal", Profile: "easy"}, http.StatusBadRequest, nil)
+	post(t, ts, "/api/rooms", CreateRoomRequest{Start: "/wiki/Start", Goal: "/wiki/Goal", Profile: "easy"}, http.StatusBadRequest, nil)
+	// A game which chooses no profile has none by default
+	if plain.Profile != "" || hard.Profile != ProfileHard {
+		t.Errorf("got profiles %q and %q", plain.Profile, hard.Profile)
+	}
+
+	tests := []struct {
+		name    string
+		request WikiPageRequest
+		status  int
+		navbox  bool
+	}{
+		{name: "default profile", request: WikiPageRequest{Subject: "/wiki/Start"}, status: http.StatusOK, navbox: true},
+		{name: "chosen profile", request: WikiPageRequest{Subject: "/wiki/Start", Profile: ProfileHard}, status: http.StatusOK},
+		{name: "unknown profile", request: WikiPageRequest{Subject: "/wiki/Start", Profile: "easy"}, status: http.StatusBadRequest},
+		{
+			name:    "game's profile",
+			request: WikiPageRequest{Subject: "/wiki/Start", Game: plain.ID, Token: plain.Token},
+			status:  http.StatusOK,
+			navbox:  true,
+		},
+		{
+			name:    "game's profile overrides the request's",
+			request: WikiPageRequest{Subject: "/wiki/Start", Game: hard.ID, Token: hard.Token, Profile: ProfileClassic},
+			status:  http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, _ := json.Marshal(tt.request)
+			resp, err := http.Post(ts.URL+"/api/wikipage", "application/json", bytes.NewReader(body))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			defer resp.Body.Close()
+			page, _ := io.ReadAll(resp.Body)
+			if resp.StatusCode != tt.status {
+				t.Fatalf("got status code %d, want %d", resp.StatusCode, tt.status)
+			}
+			if tt.status == http.StatusOK && strings.Contains(string(page), "navbox") != tt.navbox {
+				t.Errorf("got page %s, want navbox %v", page, tt.navbox)
+			}
+		})
+	}
+
+	// Links which a profile removes are not moves, but those it leaves are
+	post(t, ts, "/api/games/"+hard.ID+"/moves", MoveRequest{Token: hard.Token, Action: MoveStart}, http.StatusOK, nil)
+	post(t, ts, "/api/games/"+hard.ID+"/moves", MoveRequest{Token: hard.Token, Action: MoveNavigate, Subject: "/wiki/A"}, http.StatusUnprocessableEntity, nil)
+	post(t, ts, "/api/games/"+plain.ID+"/moves", MoveRequest{Token: plain.Token, Action: MoveStart}, http.StatusOK, nil)
+	post(t, ts, "/api/games/"+plain.ID+"/moves", MoveRequest{Token: plain.Token, Action: MoveNavigate, Subject: "/wiki/A"}, http.StatusOK, nil)
+	var finished GameResponse
+	post(t, ts, "/api/games/"+hard.ID+"/moves", MoveRequest{Token: hard.Token, Action: MoveNavigate, Subject: "/wiki/Goal"}, http.StatusOK, &finished)
+	if finished.State != GameFinished {
+		t.Errorf("got state %s, want finished", finished.State)
+	}
+}
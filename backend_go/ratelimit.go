@@ -0,0 +1,150 @@
+package wrserver
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bruceesmith/logger"
+)
+
+// ErrRateLimited matches any *RateLimitError
+var ErrRateLimited = errors.New("outbound rate limit exceeded")
+
+// RateLimitError is returned when an outbound request cannot be queued
+// because its budget is exhausted
+type RateLimitError struct {
+	Budget     string        // "pages" or "static"
+	RetryAfter time.Duration // When the queue is expected to have room again
+}
+
+func (e *RateLimitError) Error() string {
+	return ErrRateLimited.Error() + " for " + e.Budget
+}
+
+func (e *RateLimitError) Is(target error) bool {
+	return target == ErrRateLimited
+}
+
+// RateLimit is an outbound request budget
+type RateLimit struct {
+	Rate  float64 `yaml:"rate"`  // Sustained requests per second; zero or less means unlimited
+	Burst int     `yaml:"burst"` // Requests which may be made at once after a quiet period
+	Queue int     `yaml:"queue"` // Requests which may wait for a token before further requests are refused
+}
+
+// DefaultPageRateLimit is the budget for articles and API queries
+func DefaultPageRateLimit() RateLimit {
+	return RateLimit{Rate: 10, Burst: 20, Queue: 50}
+}
+
+// DefaultStaticRateLimit is the budget for skin assets and images
+func DefaultStaticRateLimit() RateLimit {
+	return RateLimit{Rate: 50, Burst: 100, Queue: 200}
+}
+
+// limiter is a token bucket with a bounded queue of waiters. A waiter
+// reserves a token immediately, driving the bucket negative, and then
+// sleeps until the bucket would have refilled to cover it.
+type limiter struct {
+	budget string
+	limit  RateLimit
+	now    func() time.Time
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+	queued int
+}
+
+// newLimiter returns a full token bucket for limit
+func newLimiter(budget string, limit RateLimit) *limiter {
+	return &limiter{
+		budget: budget,
+		limit:  limit,
+		now:    time.Now,
+		tokens: float64(max(limit.Burst, 1)),
+	}
+}
+
+// Wait blocks until a request may be made, returning a *RateLimitError at
+// once if the queue is full, or the context's error if it ends first
+func (l *limiter) Wait(ctx context.Context) error {
+	if l == nil || l.limit.Rate <= 0 {
+		return nil
+	}
+
+	l.mu.Lock()
+	now := l.now()
+	l.refill(now)
+	if l.tokens >= 1 {
+		l.tokens--
+		l.mu.Unlock()
+		return nil
+	}
+	if l.queued >= l.limit.Queue {
+		retryAfter := l.delay(l.tokens - 1)
+		queued := l.queued
+		l.mu.Unlock()
+		logger.Warn("outbound rate limit exceeded", "budget", l.budget, "queued", queued)
+		return &RateLimitError{Budget: l.budget, RetryAfter: retryAfter}
+	}
+	l.tokens--
+	wait := l.delay(l.tokens)
+	l.queued++
+	l.mu.Unlock()
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		l.mu.Lock()
+		l.tokens++
+		l.queued--
+		l.mu.Unlock()
+		return ctx.Err()
+	case <-timer.C:
+		l.mu.Lock()
+		l.queued--
+		l.mu.Unlock()
+		return nil
+	}
+}
+
+// refill adds the tokens accrued since the last refill; the caller must
+// hold l.mu
+func (l *limiter) refill(now time.Time) {
+	if !l.last.IsZero() {
+		l.tokens = math.Min(l.tokens+now.Sub(l.last).Seconds()*l.limit.Rate, float64(max(l.limit.Burst, 1)))
+	}
+	l.last = now
+}
+
+// delay is how long until a bucket holding tokens (which may be negative)
+// is back to zero
+func (l *limiter) delay(tokens float64) time.Duration {
+	if tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-tokens / l.limit.Rate * float64(time.Second))
+}
+
+// isPage reports whether path is charged to the page budget rather than
+// the static asset budget
+func isPage(path string) bool {
+	return strings.HasPrefix(path, "/wiki/") ||
+		strings.HasPrefix(path, "/w/api.php") ||
+		strings.HasPrefix(path, "/w/index.php")
+}
+
+// UserAgent builds a User-Agent which follows the Wikimedia policy of
+// identifying the tool and a way to contact its operator
+func UserAgent(contact string) string {
+	if contact == "" {
+		contact = "https://github.com/bruceesmith/wrspa"
+	}
+	return "wrspa/1.0 (" + contact + ")"
+}
@@ -0,0 +1,108 @@
+package wrserver
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLimiter(t *testing.T) {
+	t.Run("burst then queue then refuse", func(t *testing.T) {
+		l := newLimiter("pages", RateLimit{Rate: 20, Burst: 2, Queue: 1})
+		for i := range 2 {
+			if err := l.Wait(context.Background()); err != nil {
+				t.Fatalf("burst request %d: unexpected error %v", i, err)
+			}
+		}
+
+		var wg sync.WaitGroup
+		wg.Add(1)
+		start := time.Now()
+		go func() {
+			defer wg.Done()
+			if err := l.Wait(context.Background()); err != nil {
+				t.Errorf("queued request: unexpected error %v", err)
+			}
+			if elapsed := time.Since(start); elapsed < 25*time.Millisecond {
+				t.Errorf("queued request was not delayed, took %v", elapsed)
+			}
+		}()
+		// Let the goroutine join the queue
+		for {
+			l.mu.Lock()
+			queued := l.queued
+			l.mu.Unlock()
+			if queued == 1 {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+
+		err := l.Wait(context.Background())
+		var rle *RateLimitError
+		if !errors.As(err, &rle) || !errors.Is(err, ErrRateLimited) {
+			t.Fatalf("got %v, want RateLimitError", err)
+		}
+		if rle.Budget != "pages" || rle.RetryAfter <= 0 {
+			t.Errorf("unexpected error details %+v", rle)
+		}
+		wg.Wait()
+	})
+
+	t.Run("cancelled while queued", func(t *testing.T) {
+		l := newLimiter("static", RateLimit{Rate: 0.1, Burst: 1, Queue: 5})
+		l.Wait(context.Background())
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		if err := l.Wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("got %v, want context.DeadlineExceeded", err)
+		}
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		if l.queued != 0 || l.tokens < -0.01 {
+			t.Errorf("abandoned reservation not returned, queued %d tokens %f", l.queued, l.tokens)
+		}
+	})
+
+	t.Run("unlimited", func(t *testing.T) {
+		l := newLimiter("pages", RateLimit{})
+		for range 100 {
+			if err := l.Wait(context.Background()); err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+		}
+	})
+}
+
+func TestIsPage(t *testing.T) {
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{path: "/wiki/Go_(programming_language)", want: true},
+		{path: "/w/api.php?action=query", want: true},
+		{path: "/w/index.php?title=Go", want: true},
+		{path: "/w/load.php?modules=site.styles", want: false},
+		{path: "/static/images/icons/wikipedia.png", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := isPage(tt.path); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUserAgent(t *testing.T) {
+	if got := UserAgent("ops@example.org"); got != "wrspa/1.0 (ops@example.org)" {
+		t.Errorf("got %s", got)
+	}
+	if got := UserAgent(""); got != "wrspa/1.0 (https://github.com/bruceesmith/wrspa)" {
+		t.Errorf("got %s", got)
+	}
+}
@@ -0,0 +1,36 @@
+package wrserver
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"regexp"
+
+	"github.com/bruceesmith/wrspa/backend/wrserver/api"
+)
+
+// requestIDRe matches a request ID given by a client or a proxy, which is
+// kept only if it is safe to log and to echo in a header
+var requestIDRe = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,64}$`)
+
+// withRequestID returns a handler which gives every request an ID, in the
+// X-Request-Id header of its response, before passing it to next. An ID
+// given in the request is kept if it is valid. The ID is that of every
+// failure reported for the request.
+func withRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(api.HeaderRequestID)
+		if !requestIDRe.MatchString(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(api.HeaderRequestID, id)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// newRequestID returns a random request ID
+func newRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
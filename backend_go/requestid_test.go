@@ -0,0 +1,48 @@
+package wrserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bruceesmith/wrspa/backend/wrserver/api"
+)
+
+func TestWithRequestID(t *testing.T) {
+	tests := []struct {
+		name    string
+		given   string
+		kept    bool
+		wantLen int
+	}{
+		{name: "none", wantLen: 16},
+		{name: "valid", given: "req-42.a:b_c", kept: true},
+		{name: "header injection", given: "a\r\nSet-Cookie: x=y", wantLen: 16},
+		{name: "too long", given: string(make([]byte, 65)), wantLen: 16},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var seen string
+			handler := withRequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				seen = w.Header().Get(api.HeaderRequestID)
+			}))
+			req := httptest.NewRequest(http.MethodGet, "/api/settings", nil)
+			if tt.given != "" {
+				req.Header[api.HeaderRequestID] = []string{tt.given}
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+			got := w.Header().Get(api.HeaderRequestID)
+			if got != seen {
+				t.Errorf("handler saw ID %s, response has %s", seen, got)
+			}
+			if tt.kept && got != tt.given {
+				t.Errorf("got ID %s, want %s", got, tt.given)
+			}
+			if !tt.kept && len(got) != tt.wantLen {
+				t.Errorf("got ID %q, want a new one", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,587 @@
+package wrserver
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bruceesmith/logger"
+	"github.com/bruceesmith/wrspa/backend/wrserver/leaderboard"
+	"golang.org/x/net/websocket"
+)
+
+// RoomState is the position of a race room's state machine
+type RoomState string
+
+const (
+	RoomWaiting   RoomState = "waiting"   // Players are joining, until the host starts the race
+	RoomCountdown RoomState = "countdown" // The race starts for everyone when the countdown ends
+	RoomRacing    RoomState = "racing"    // Moves are accepted and broadcast
+	RoomFinished  RoomState = "finished"  // The race is over, and the room closed
+)
+
+// RoomEnd is the condition which ends a race
+type RoomEnd string
+
+const (
+	RoomEndFirst RoomEnd = "first" // The first player to reach the goal wins, and the race ends
+	RoomEndAll   RoomEnd = "all"   // The race ends when every connected player has reached the goal
+)
+
+// RoomAction is the kind of a message from a player
+type RoomAction string
+
+const (
+	RoomStart    RoomAction = "start"    // Start the countdown; only the host may
+	RoomNavigate RoomAction = "navigate" // Follow a link to another article
+)
+
+// RoomEventType is the kind of a message to the players
+type RoomEventType string
+
+const (
+	RoomWelcome  RoomEventType = "welcome"   // To a player who has joined, with their game session
+	RoomJoined   RoomEventType = "joined"    // A player has joined
+	RoomLeft     RoomEventType = "left"      // A player has disconnected
+	RoomCounting RoomEventType = "countdown" // The host has started the countdown
+	RoomStarted  RoomEventType = "started"   // The race has started
+	RoomProgress RoomEventType = "progress"  // A player has navigated
+	RoomReached  RoomEventType = "reached"   // A player has reached the goal
+	RoomEnded    RoomEventType = "ended"     // The race is over
+	RoomFailed   RoomEventType = "error"     // A player's message was refused
+)
+
+const (
+	roomBuffer    = 64               // Events queued for a player before they are disconnected as too slow
+	roomSendLimit = 10 * time.Second // Time allowed for writing an event to a player
+)
+
+var (
+	// ErrRoomNotFound is returned for an unknown or closed room
+	ErrRoomNotFound = errors.New("room not found")
+	// ErrTooManyRooms is returned when a room cannot be created because the
+	// limit on rooms has been reached
+	ErrTooManyRooms = errors.New("too many rooms open")
+	// ErrRoomJoin is wrapped by the reason a player may not join a room
+	ErrRoomJoin = errors.New("unable to join room")
+)
+
+// RoomOptions configures the race rooms held by a Server
+type RoomOptions struct {
+	Countdown time.Duration // Time from the host starting the race to it starting for everyone
+	Expiry    time.Duration // A room is closed this long after it was created, however far the race has got
+	Max       int           // Number of rooms which may be open at once
+	Players   int           // Number of players who may join a room
+}
+
+// DefaultRoomOptions returns the RoomOptions used by NewServer
+func DefaultRoomOptions() RoomOptions {
+	return RoomOptions{
+		Countdown: 5 * time.Second,
+		Expiry:    time.Hour,
+		Max:       1000,
+		Players:   16,
+	}
+}
+
+// roomCodeAlphabet spells room codes without letters and digits which are
+// easily confused when read aloud or copied by hand
+const roomCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+// newRoomCode returns a random code for a room
+func newRoomCode() (string, error) {
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	for i := range b {
+		b[i] = roomCodeAlphabet[int(b[i])%len(roomCodeAlphabet)]
+	}
+	return string(b), nil
+}
+
+// rooms holds the race rooms of a Server. Each room is run by its own
+// goroutine, which alone changes the room, so that every player is sent
+// its events in the same order.
+type rooms struct {
+	options RoomOptions
+	games   *games
+	record  func(ctx context.Context, game string) // Adds a finished game to its leaderboard
+
+	wg     sync.WaitGroup // Room goroutines and player connections
+	mu     sync.Mutex
+	byCode map[string]*room
+}
+
+// newRooms returns an empty set of rooms, whose players' moves are made in
+// game sessions
+func newRooms(options RoomOptions, games *games, record func(context.Context, string)) *rooms {
+	return &rooms{
+		options: options,
+		games:   games,
+		record:  record,
+		byCode:  make(map[string]*room),
+	}
+}
+
+// Create opens a room racing a challenge from its start page, and starts
+// its goroutine, which runs until the race is over or ctx is cancelled.
+// Every racer's pages are cleaned up by the named profile, and goal is the
+// canonical subject of the goal.
+func (rs *rooms) Create(ctx context.Context, challenge leaderboard.Challenge, end RoomEnd, profile string, startPage page, goal string) (RoomResponse, error) {
+	token, err := newGameID()
+	if err != nil {
+		return RoomResponse{}, err
+	}
+
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	if len(rs.byCode) >= rs.options.Max {
+		return RoomResponse{}, ErrTooManyRooms
+	}
+	var code string
+	for code == "" || rs.byCode[code] != nil {
+		if code, err = newRoomCode(); err != nil {
+			return RoomResponse{}, err
+		}
+	}
+	r := &room{
+		code:      code,
+		token:     token,
+		challenge: challenge,
+		end:       end,
+		profile:   profile,
+		startPage: startPage,
+		goal:      goal,
+		rooms:     rs,
+		joins:     make(chan roomJoin),
+		leaves:    make(chan *roomPlayer),
+		requests:  make(chan roomRequest),
+		done:      make(chan struct{}),
+		state:     RoomWaiting,
+	}
+	r.update()
+	rs.byCode[code] = r
+	rs.wg.Add(1)
+	go func() {
+		defer rs.wg.Done()
+		r.run(ctx)
+		rs.mu.Lock()
+		delete(rs.byCode, code)
+		rs.mu.Unlock()
+	}()
+	logger.TraceID("rooms", "create", "code", code, "challenge", challenge.ID, "end", r.end)
+	response := *r.snapshot.Load()
+	response.Token = token
+	return response, nil
+}
+
+// Get returns an open room
+func (rs *rooms) Get(code string) (*room, error) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	r, found := rs.byCode[code]
+	if !found {
+		return nil, fmt.Errorf("%w: %s", ErrRoomNotFound, code)
+	}
+	return r, nil
+}
+
+// Wait waits for every room to close and every player to be disconnected
+func (rs *rooms) Wait() {
+	rs.wg.Wait()
+}
+
+// room is one race. Its fields below done are changed only by run.
+type room struct {
+	code      string
+	token     string // Makes the player who presents it the host
+	challenge leaderboard.Challenge
+	end       RoomEnd
+	profile   string // Name of the profile which cleans up the racers' pages
+	startPage page
+	goal      string // Canonical subject of the goal
+	rooms     *rooms
+
+	joins    chan roomJoin
+	leaves   chan *roomPlayer
+	requests chan roomRequest
+	done     chan struct{}                // Closed when run returns
+	snapshot atomic.Pointer[RoomResponse] // The room as last broadcast, for /api/rooms/{code}
+
+	state    RoomState
+	startsAt time.Time
+	winner   string
+	reached  int // Players who have reached the goal
+	players  []*roomPlayer
+}
+
+// roomPlayer is a player in a room, and the queue of events to be written
+// to their connection
+type roomPlayer struct {
+	name   string
+	host   bool
+	game   string
+	token  string
+	events chan RoomEvent
+	closed bool // events is closed, and the player disconnected
+
+	article   string
+	steps     int
+	elapsedMS int64
+	rank      int
+}
+
+// roomJoin asks run to add a player, and carries the reason they may not
+type roomJoin struct {
+	player *roomPlayer
+	token  string
+	result chan error
+}
+
+// roomRequest is a message from a player, and for a navigation the move
+// already made in their game session
+type roomRequest struct {
+	player *roomPlayer
+	action RoomAction
+	game   GameResponse
+	err    error
+}
+
+// join adds a player to the room, unless the race has started, the room is
+// full or their name is taken
+func (r *room) join(player *roomPlayer, token string) error {
+	result := make(chan error, 1)
+	select {
+	case r.joins <- roomJoin{player: player, token: token, result: result}:
+		return <-result
+	case <-r.done:
+		return fmt.Errorf("%w: %s", ErrRoomNotFound, r.code)
+	}
+}
+
+// leave disconnects a player
+func (r *room) leave(player *roomPlayer) {
+	select {
+	case r.leaves <- player:
+	case <-r.done:
+	}
+}
+
+// request passes a message from a player to run
+func (r *room) request(request roomRequest) {
+	select {
+	case r.requests <- request:
+	case <-r.done:
+	}
+}
+
+// run makes every change to a room, until the race is over, the room
+// expires, every player has left or ctx is cancelled
+func (r *room) run(ctx context.Context) {
+	defer close(r.done)
+	expiry := time.NewTimer(r.rooms.options.Expiry)
+	defer expiry.Stop()
+	countdown := time.NewTimer(0)
+	countdown.Stop()
+	defer countdown.Stop()
+	joined := false
+	for r.state != RoomFinished {
+		select {
+		case <-ctx.Done():
+			r.finish("the server is shutting down")
+		case <-expiry.C:
+			r.finish("the room has expired")
+		case join := <-r.joins:
+			err := r.add(join)
+			join.result <- err
+			if err == nil {
+				joined = true
+				r.update()
+				r.send(join.player, RoomEvent{Type: RoomWelcome, Player: join.player.name, Game: join.player.game, Token: join.player.token})
+				for _, player := range r.players {
+					if player != join.player {
+						r.send(player, RoomEvent{Type: RoomJoined, Player: join.player.name})
+					}
+				}
+			}
+		case player := <-r.leaves:
+			r.remove(player)
+			switch {
+			case joined && !slices.ContainsFunc(r.players, func(p *roomPlayer) bool { return !p.closed }):
+				r.finish("every player has left")
+			default:
+				r.broadcast(RoomEvent{Type: RoomLeft, Player: player.name})
+				r.checkEnd(ctx)
+			}
+		case request := <-r.requests:
+			switch {
+			case request.err != nil:
+				r.send(request.player, RoomEvent{Type: RoomFailed, Player: request.player.name, Error: request.err.Error()})
+			case request.action == RoomStart:
+				if err := r.countdown(request.player); err != nil {
+					r.send(request.player, RoomEvent{Type: RoomFailed, Player: request.player.name, Error: err.Error()})
+					break
+				}
+				countdown.Reset(r.rooms.options.Countdown)
+				r.broadcast(RoomEvent{Type: RoomCounting, Player: request.player.name})
+			case request.action == RoomNavigate:
+				r.progress(ctx, request.player, request.game)
+			}
+		case <-countdown.C:
+			r.race()
+		}
+	}
+	for _, player := range r.players {
+		if !player.closed {
+			player.closed = true
+			close(player.events)
+		}
+	}
+	logger.TraceID("rooms", "closed", "code", r.code, "winner", r.winner)
+}
+
+// add adds a player to a waiting room, creating their game session
+func (r *room) add(join roomJoin) error {
+	switch {
+	case r.state != RoomWaiting:
+		return fmt.Errorf("%w: the race has started", ErrRoomJoin)
+	case len(r.players) >= r.rooms.options.Players:
+		return fmt.Errorf("%w: the room is full", ErrRoomJoin)
+	case slices.ContainsFunc(r.players, func(p *roomPlayer) bool { return p.name == join.player.name }):
+		return fmt.Errorf("%w: %s is already playing", ErrRoomJoin, join.player.name)
+	}
+	game, err := r.rooms.games.Create(r.challenge, join.player.name, r.profile, r.startPage, r.goal)
+	if err != nil {
+		return err
+	}
+	player := join.player
+	player.game, player.token = game.ID, game.Token
+	player.article = r.startPage.canonical
+	player.host = subtle.ConstantTimeCompare([]byte(join.token), []byte(r.token)) == 1 ||
+		!slices.ContainsFunc(r.players, func(p *roomPlayer) bool { return p.host })
+	if player.host {
+		for _, p := range r.players {
+			p.host = false
+		}
+	}
+	r.players = append(r.players, player)
+	logger.TraceID("rooms", "join", "code", r.code, "player", player.name, "host", player.host)
+	return nil
+}
+
+// remove disconnects a player. A player leaving a waiting room is forgotten,
+// and if they were the host it passes to the player who joined next.
+func (r *room) remove(player *roomPlayer) {
+	if !player.closed {
+		player.closed = true
+		close(player.events)
+	}
+	if r.state != RoomWaiting {
+		return
+	}
+	r.players = slices.DeleteFunc(r.players, func(p *roomPlayer) bool { return p == player })
+	if player.host && len(r.players) > 0 {
+		r.players[0].host = true
+	}
+}
+
+// countdown starts the countdown of a waiting room, if the host asks
+func (r *room) countdown(player *roomPlayer) error {
+	switch {
+	case !player.host:
+		return errors.New("only the host may start the race")
+	case r.state != RoomWaiting:
+		return fmt.Errorf("cannot start a race which is %s", r.state)
+	}
+	r.state = RoomCountdown
+	r.startsAt = time.Now().Add(r.rooms.options.Countdown)
+	return nil
+}
+
+// race starts the clock of every player's game at once
+func (r *room) race() {
+	r.state = RoomRacing
+	for _, player := range r.players {
+		if _, err := r.rooms.games.Move(player.game, player.token, MoveRequest{Action: MoveStart}, page{}); err != nil {
+			logger.Error("race not started", "code", r.code, "player", player.name, "error", err.Error())
+		}
+	}
+	logger.TraceID("rooms", "started", "code", r.code, "players", len(r.players))
+	r.broadcast(RoomEvent{Type: RoomStarted})
+}
+
+// progress records a player's navigation, ranking them if they have reached
+// the goal
+func (r *room) progress(ctx context.Context, player *roomPlayer, game GameResponse) {
+	if len(game.Path) > 0 {
+		player.article = game.Path[len(game.Path)-1]
+	}
+	player.steps, player.elapsedMS = game.Steps, game.ElapsedMS
+	if game.State != GameFinished || player.rank != 0 {
+		r.broadcast(RoomEvent{Type: RoomProgress, Player: player.name})
+		return
+	}
+	r.reached++
+	player.rank = r.reached
+	if r.winner == "" {
+		r.winner = player.name
+	}
+	r.rooms.record(ctx, player.game)
+	r.broadcast(RoomEvent{Type: RoomReached, Player: player.name})
+	r.checkEnd(ctx)
+}
+
+// checkEnd ends a race which has met its end condition
+func (r *room) checkEnd(ctx context.Context) {
+	if r.state != RoomRacing || r.reached == 0 {
+		return
+	}
+	if r.end == RoomEndFirst || !slices.ContainsFunc(r.players, func(p *roomPlayer) bool { return !p.closed && p.rank == 0 }) {
+		r.finish("")
+	}
+}
+
+// finish ends the race, telling the players why if it is not because it
+// was won
+func (r *room) finish(reason string) {
+	r.state = RoomFinished
+	r.broadcast(RoomEvent{Type: RoomEnded, Error: reason})
+}
+
+// update stores the room as it now is, for readers outside run
+func (r *room) update() {
+	response := RoomResponse{
+		Code:      r.code,
+		Challenge: r.challenge.ID,
+		Wiki:      r.challenge.Wiki,
+		Start:     r.challenge.Start,
+		Goal:      r.challenge.Goal,
+		End:       r.end,
+		Profile:   r.profile,
+		State:     r.state,
+		StartsAt:  r.startsAt,
+		Winner:    r.winner,
+		Players:   make([]RoomPlayer, 0, len(r.players)),
+	}
+	for _, p := range r.players {
+		response.Players = append(response.Players, RoomPlayer{
+			Name:      p.name,
+			Host:      p.host,
+			Connected: !p.closed,
+			Article:   p.article,
+			Steps:     p.steps,
+			ElapsedMS: p.elapsedMS,
+			Rank:      p.rank,
+		})
+	}
+	r.snapshot.Store(&response)
+}
+
+// broadcast sends an event, with the room as it now is, to every player
+func (r *room) broadcast(event RoomEvent) {
+	r.update()
+	for _, player := range r.players {
+		r.send(player, event)
+	}
+}
+
+// send queues an event for one player. A player too slow to keep up with
+// the race is disconnected rather than holding up everyone else.
+func (r *room) send(player *roomPlayer, event RoomEvent) {
+	if player.closed {
+		return
+	}
+	event.Room = *r.snapshot.Load()
+	if event.Type == RoomCounting {
+		event.CountdownMS = time.Until(r.startsAt).Milliseconds()
+	}
+	select {
+	case player.events <- event:
+	default:
+		logger.Warn("room player too slow", "code", r.code, "player", player.name)
+		player.closed = true
+		close(player.events)
+	}
+}
+
+// race serves a player's connection to a room: it queues their events to be
+// written, and reads their messages until they disconnect
+func (s *Server) race(ws *websocket.Conn, r *room, name, token string) {
+	defer ws.Close()
+	// The server's read and write timeouts do not suit a connection which
+	// lasts the whole race
+	ws.SetDeadline(time.Time{})
+	player := &roomPlayer{name: name, events: make(chan RoomEvent, roomBuffer)}
+	if err := r.join(player, token); err != nil {
+		ws.SetWriteDeadline(time.Now().Add(roomSendLimit))
+		websocket.JSON.Send(ws, RoomEvent{Type: RoomFailed, Room: *r.snapshot.Load(), Player: name, Error: err.Error()})
+		return
+	}
+
+	written := make(chan struct{})
+	go func() {
+		defer close(written)
+		for event := range player.events {
+			ws.SetWriteDeadline(time.Now().Add(roomSendLimit))
+			if err := websocket.JSON.Send(ws, event); err != nil {
+				break
+			}
+		}
+		ws.Close()
+		for range player.events {
+		}
+	}()
+
+	ctx := ws.Request().Context()
+	for {
+		var request RoomRequest
+		if err := websocket.JSON.Receive(ws, &request); err != nil {
+			break
+		}
+		switch request.Action {
+		case RoomStart:
+			r.request(roomRequest{player: player, action: RoomStart})
+		case RoomNavigate:
+			game, err := s.raceMove(ctx, player, request.Subject)
+			r.request(roomRequest{player: player, action: RoomNavigate, game: game, err: err})
+		default:
+			r.request(roomRequest{player: player, err: fmt.Errorf("unknown room action '%s'", request.Action)})
+		}
+	}
+	r.leave(player)
+	<-written
+}
+
+// raceMove makes a player's navigation in their game session, which checks
+// it against the links of their current page
+func (s *Server) raceMove(ctx context.Context, player *roomPlayer, subject string) (GameResponse, error) {
+	move := MoveRequest{Token: player.token, Action: MoveNavigate, Subject: subject}
+	if !strings.HasPrefix(subject, "/wiki/") {
+		return GameResponse{}, fmt.Errorf("invalid subject: %s", subject)
+	}
+	wiki, profile, err := s.games.Check(player.game, player.token, move)
+	if err != nil {
+		return GameResponse{}, err
+	}
+	client, err := s.wiki(wiki)
+	if err != nil {
+		return GameResponse{}, err
+	}
+	target, err := s.gamePage(ctx, client, wiki, profile, subject)
+	if err != nil {
+		return GameResponse{}, err
+	}
+	game, err := s.games.Move(player.game, player.token, move, target)
+	if err == nil {
+		s.spectate(game, MoveNavigate)
+	}
+	return game, err
+}
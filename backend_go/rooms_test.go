@@ -0,0 +1,297 @@
+package wrserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bruceesmith/wrspa/backend/wrserver/leaderboard"
+	"go.uber.org/mock/gomock"
+	"golang.org/x/net/websocket"
+)
+
+// testRooms returns a Server with race rooms on a small wiki, and an HTTP
+// server for its handlers
+func testRooms(t *testing.T, options RoomOptions) (*Server, *httptest.Server) {
+	t.Helper()
+	ctrl := gomock.NewController(t)
+	pages := map[string]string{
+		"/wiki/Start": `<html><body><a href="/wiki/A">A</a><a href="/wiki/Goal">Goal</a></body></html>`,
+		"/wiki/A":     `<html><body><a href="/wiki/Goal">Goal</a></body></html>`,
+		"/wiki/Goal":  `<html><body><p>goal</p></body></html>`,
+	}
+	serverOptions := DefaultServerOptions()
+	serverOptions.Wiki = "en"
+	serverOptions.Rooms = options
+	svr, err := NewServerWithOptions("8080", "testdata", testWiki(ctrl, pages, nil), serverOptions)
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+	s := svr.(*Server)
+	ts := httptest.NewServer(s.server.Handler)
+	t.Cleanup(func() {
+		s.cancel()
+		s.rooms.Wait()
+		ts.Close()
+	})
+	return s, ts
+}
+
+// createRoom creates a room racing from Start to Goal
+func createRoom(t *testing.T, ts *httptest.Server, end RoomEnd) RoomResponse {
+	t.Helper()
+	body, _ := json.Marshal(CreateRoomRequest{Start: "/wiki/Start", Goal: "/wiki/Goal", End: end})
+	resp, err := http.Post(ts.URL+"/api/rooms", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer resp.Body.Close()
+	var room RoomResponse
+	json.NewDecoder(resp.Body).Decode(&room)
+	if resp.StatusCode != http.StatusCreated || room.Code == "" || room.Token == "" {
+		t.Fatalf("got status code %d creating room %+v", resp.StatusCode, room)
+	}
+	return room
+}
+
+// joinRoom opens a player's WebSocket to a room
+func joinRoom(t *testing.T, ts *httptest.Server, code, player, token string) *websocket.Conn {
+	t.Helper()
+	url := strings.Replace(ts.URL, "http", "ws", 1) + "/rooms/" + strings.ToLower(code) + "?player=" + player + "&token=" + token
+	ws, err := websocket.Dial(url, "", ts.URL)
+	if err != nil {
+		t.Fatalf("unable to join room %s as %s: %v", code, player, err)
+	}
+	t.Cleanup(func() { ws.Close() })
+	return ws
+}
+
+// nextEvent reads a player's events until one of a type, failing the test
+// if there is none
+func nextEvent(t *testing.T, ws *websocket.Conn, eventType RoomEventType) RoomEvent {
+	t.Helper()
+	ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		var event RoomEvent
+		if err := websocket.JSON.Receive(ws, &event); err != nil {
+			t.Fatalf("no %s event: %v", eventType, err)
+		}
+		if event.Type == eventType {
+			return event
+		}
+	}
+}
+
+// send writes a player's message to their room
+func send(t *testing.T, ws *websocket.Conn, request RoomRequest) {
+	t.Helper()
+	if err := websocket.JSON.Send(ws, request); err != nil {
+		t.Fatalf("unable to send %+v: %v", request, err)
+	}
+}
+
+func TestRooms_Race(t *testing.T) {
+	options := DefaultRoomOptions()
+	options.Countdown = 50 * time.Millisecond
+	s, ts := testRooms(t, options)
+	room := createRoom(t, ts, "")
+	if room.End != RoomEndFirst || room.State != RoomWaiting || room.Challenge != customChallenge("en", "/wiki/Start", "/wiki/Goal").ID {
+		t.Errorf("unexpected room %+v", room)
+	}
+
+	// A guest who joins first is the host only until the holder of the token joins
+	guest := joinRoom(t, ts, room.Code, "guest", "")
+	if welcome := nextEvent(t, guest, RoomWelcome); welcome.Game == "" || welcome.Token == "" || !welcome.Room.Players[0].Host {
+		t.Errorf("unexpected welcome %+v", welcome)
+	}
+	host := joinRoom(t, ts, room.Code, "host", room.Token)
+	nextEvent(t, host, RoomWelcome)
+	joined := nextEvent(t, guest, RoomJoined)
+	if joined.Player != "host" || joined.Room.Players[0].Host || !joined.Room.Players[1].Host {
+		t.Errorf("unexpected players %+v", joined.Room.Players)
+	}
+
+	// Taken names and unknown rooms are refused
+	taken := joinRoom(t, ts, room.Code, "guest", "")
+	if refused := nextEvent(t, taken, RoomFailed); !strings.Contains(refused.Error, "already playing") {
+		t.Errorf("got %q joining with a taken name", refused.Error)
+	}
+	if resp, _ := http.Get(ts.URL + "/rooms/NOROOM?player=x"); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("got status code %d for an unknown room", resp.StatusCode)
+	}
+
+	send(t, guest, RoomRequest{Action: RoomNavigate, Subject: "/wiki/A"})
+	if refused := nextEvent(t, guest, RoomFailed); refused.Player != "guest" {
+		t.Errorf("got %+v navigating before the race", refused)
+	}
+	send(t, guest, RoomRequest{Action: RoomStart})
+	if refused := nextEvent(t, guest, RoomFailed); refused.Error != "only the host may start the race" {
+		t.Errorf("got %q starting as a guest", refused.Error)
+	}
+	send(t, host, RoomRequest{Action: RoomStart})
+	if countdown := nextEvent(t, guest, RoomCounting); countdown.Room.StartsAt.IsZero() || countdown.CountdownMS > 50 {
+		t.Errorf("unexpected countdown %+v", countdown)
+	}
+	nextEvent(t, guest, RoomStarted)
+	if late := joinRoom(t, ts, room.Code, "late", ""); !strings.Contains(nextEvent(t, late, RoomFailed).Error, "the race has started") {
+		t.Errorf("a player joined after the race started")
+	}
+
+	send(t, host, RoomRequest{Action: RoomNavigate, Subject: "/wiki/A"})
+	progress := nextEvent(t, guest, RoomProgress)
+	if p := progress.Room.Players[1]; progress.Player != "host" || p.Article != "/wiki/A" || p.Steps != 1 {
+		t.Errorf("unexpected progress %+v", progress)
+	}
+	send(t, guest, RoomRequest{Action: RoomNavigate, Subject: "/wiki/B"})
+	nextEvent(t, guest, RoomFailed)
+	send(t, guest, RoomRequest{Action: RoomNavigate, Subject: "/wiki/Goal"})
+	reached := nextEvent(t, host, RoomReached)
+	if reached.Player != "guest" || reached.Room.Players[0].Rank != 1 {
+		t.Errorf("unexpected %+v", reached)
+	}
+	ended := nextEvent(t, host, RoomEnded)
+	if ended.Room.State != RoomFinished || ended.Room.Winner != "guest" || ended.Error != "" {
+		t.Errorf("unexpected end %+v", ended)
+	}
+	var event RoomEvent
+	if err := websocket.JSON.Receive(host, &event); err == nil {
+		t.Errorf("got %+v after the race ended, want the connection closed", event)
+	}
+
+	scores, _, err := s.store.Leaderboard(context.Background(), room.Challenge, leaderboard.ByClicks, 0, 10)
+	if err != nil || len(scores) != 1 || scores[0].Player != "guest" {
+		t.Errorf("got %+v and error %v on the leaderboard", scores, err)
+	}
+	s.rooms.Wait()
+	if resp, _ := http.Get(ts.URL + "/api/rooms/" + room.Code); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("got status code %d for a closed room", resp.StatusCode)
+	}
+}
+
+func TestRooms_EveryoneFinishes(t *testing.T) {
+	options := DefaultRoomOptions()
+	options.Countdown = 0
+	_, ts := testRooms(t, options)
+	room := createRoom(t, ts, RoomEndAll)
+
+	host := joinRoom(t, ts, room.Code, "host", room.Token)
+	nextEvent(t, host, RoomWelcome)
+	quitter := joinRoom(t, ts, room.Code, "quitter", "")
+	nextEvent(t, quitter, RoomWelcome)
+	slow := joinRoom(t, ts, room.Code, "slow", "")
+	nextEvent(t, slow, RoomWelcome)
+	send(t, host, RoomRequest{Action: RoomStart})
+	nextEvent(t, slow, RoomStarted)
+
+	send(t, host, RoomRequest{Action: RoomNavigate, Subject: "/wiki/Goal"})
+	nextEvent(t, slow, RoomReached)
+	quitter.Close()
+	if left := nextEvent(t, slow, RoomLeft); left.Player != "quitter" || left.Room.Players[1].Connected {
+		t.Errorf("unexpected %+v", left)
+	}
+	send(t, slow, RoomRequest{Action: RoomNavigate, Subject: "/wiki/A"})
+	nextEvent(t, slow, RoomProgress)
+
+	resp, err := http.Get(ts.URL + "/api/rooms/" + room.Code)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var described RoomResponse
+	json.NewDecoder(resp.Body).Decode(&described)
+	resp.Body.Close()
+	if described.State != RoomRacing || described.Token != "" || len(described.Players) != 3 {
+		t.Errorf("unexpected room %+v", described)
+	}
+
+	send(t, slow, RoomRequest{Action: RoomNavigate, Subject: "/wiki/Goal"})
+	ended := nextEvent(t, host, RoomEnded)
+	var ranks []int
+	for _, p := range ended.Room.Players {
+		ranks = append(ranks, p.Rank)
+	}
+	if !reflect.DeepEqual(ranks, []int{1, 0, 2}) || ended.Room.Winner != "host" {
+		t.Errorf("got ranks %v and winner %s", ranks, ended.Room.Winner)
+	}
+}
+
+func TestRooms_Shutdown(t *testing.T) {
+	s, ts := testRooms(t, DefaultRoomOptions())
+	room := createRoom(t, ts, RoomEndFirst)
+	player := joinRoom(t, ts, room.Code, "player", "")
+	nextEvent(t, player, RoomWelcome)
+
+	s.cancel()
+	if ended := nextEvent(t, player, RoomEnded); ended.Error != "the server is shutting down" {
+		t.Errorf("got %+v", ended)
+	}
+	done := make(chan struct{})
+	go func() {
+		s.rooms.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("rooms still open after shutdown")
+	}
+}
+
+func TestRoomsAPI(t *testing.T) {
+	options := DefaultRoomOptions()
+	options.Max = 1
+	_, ts := testRooms(t, options)
+	room := createRoom(t, ts, RoomEndAll)
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		statusCode int
+	}{
+		{name: "describe", method: http.MethodGet, path: "/api/rooms/" + strings.ToLower(room.Code), statusCode: http.StatusOK},
+		{name: "unknown room", method: http.MethodGet, path: "/api/rooms/NOROOM", statusCode: http.StatusNotFound},
+		{name: "unknown resource", method: http.MethodGet, path: "/api/rooms/" + room.Code + "/players", statusCode: http.StatusNotFound},
+		{name: "wrong method", method: http.MethodPost, path: "/api/rooms/" + room.Code, statusCode: http.StatusMethodNotAllowed},
+		{name: "unknown end", method: http.MethodPost, path: "/api/rooms", body: `{"start":"/wiki/Start","goal":"/wiki/Goal","end":"last"}`, statusCode: http.StatusBadRequest},
+		{name: "bad goal", method: http.MethodPost, path: "/api/rooms", body: `{"start":"/wiki/Start","goal":"Goal"}`, statusCode: http.StatusBadRequest},
+		{name: "missing start page", method: http.MethodPost, path: "/api/rooms", body: `{"start":"/wiki/Missing","goal":"/wiki/Goal"}`, statusCode: http.StatusNotFound},
+		{name: "too many rooms", method: http.MethodPost, path: "/api/rooms", body: `{"start":"/wiki/Start","goal":"/wiki/Goal"}`, statusCode: http.StatusServiceUnavailable},
+		{name: "join without a name", method: http.MethodGet, path: "/rooms/" + room.Code + "?player=%20", statusCode: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(tt.method, ts.URL+tt.path, strings.NewReader(tt.body))
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.statusCode {
+				t.Errorf("got status code %d, want %d", resp.StatusCode, tt.statusCode)
+			}
+		})
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+"/rooms/"+room.Code+"?player=x", nil)
+	req.Header.Set("Origin", "https://elsewhere.example.org")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("got status code %d for another site's page, want %d", resp.StatusCode, http.StatusForbidden)
+	}
+}
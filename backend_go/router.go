@@ -0,0 +1,182 @@
+package wrserver
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/bruceesmith/wrspa/backend/wrserver/api"
+	"github.com/bruceesmith/wrspa/backend/wrserver/openapi"
+)
+
+// routeMethods are the methods for which a path is tried when finding those
+// it allows. HEAD is allowed wherever GET is, and OPTIONS everywhere.
+var routeMethods = []string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+
+// routes returns the router of the REST API, and the OpenAPI document which
+// describes it. Each endpoint is registered with its operation, so that the
+// two cannot differ in their paths and methods. The patterns are lowercase,
+// and are matched against the lowercased path of a request.
+func (s *Server) routes() (*http.ServeMux, *openapi.Document) {
+	mux := http.NewServeMux()
+	doc := openapi.New(openapi.Info{
+		Title:   "WikiRacing",
+		Version: strings.Trim(strings.TrimPrefix(api.Prefix, "/api/"), "/"),
+		Description: "The REST API of wrserver. Every failure is an ErrorResponse, whose code decides its status. " +
+			"The same paths without " + api.Prefix + " in place of /api/ are deprecated aliases.",
+	})
+	add := func(method string, endpoint EndPoint, handler http.HandlerFunc, operation openapi.Operation) {
+		path := api.Prefix + string(endpoint)
+		mux.HandleFunc(method+" "+strings.ToLower(path), handler)
+		operation.Responses["default"] = openapi.Response{Description: "A failure", Content: doc.JSON(api.ErrorResponse{})}
+		doc.Add(method, path, operation)
+	}
+	ok := func(description string, content map[string]openapi.MediaType) map[string]openapi.Response {
+		return map[string]openapi.Response{"200": {Description: description, Content: content}}
+	}
+	created := func(description string, v any) map[string]openapi.Response {
+		return map[string]openapi.Response{"201": {Description: description, Content: doc.JSON(v)}}
+	}
+	body := func(v any) *openapi.RequestBody {
+		return &openapi.RequestBody{Required: true, Content: doc.JSON(v)}
+	}
+	parameter := func(in, name, typ, description string) openapi.Parameter {
+		return openapi.Parameter{Name: name, In: in, Description: description, Required: in == "path", Schema: &openapi.Schema{Type: typ}}
+	}
+	wiki := parameter("query", "wiki", "string", "Name of the wiki, if not the default")
+
+	add(http.MethodGet, Daily, s.Daily, openapi.Operation{
+		OperationID: "getDaily",
+		Summary:     "The daily challenge of today or of a date",
+		Parameters:  []openapi.Parameter{parameter("query", "date", "string", "UTC date as YYYY-MM-DD; today if not given")},
+		Responses:   ok("The daily challenge", doc.JSON(DailyResponse{})),
+	})
+	add(http.MethodGet, DailyHistory, s.Daily, openapi.Operation{
+		OperationID: "getDailyHistory",
+		Summary:     "Every remembered daily challenge up to today",
+		Responses:   ok("The daily challenges, the most recent first", doc.JSON(DailyHistoryResponse{})),
+	})
+	add(http.MethodGet, Events+"/{code}/stream", s.Events, openapi.Operation{
+		OperationID: "streamEvents",
+		Summary:     "The events of players tagged with a code, as Server-Sent Events",
+		Parameters: []openapi.Parameter{
+			parameter("path", "code", "string", "Code of the event"),
+			{Name: "Last-Event-ID", In: "header", Description: "ID of the last event received, after which the stream resumes", Schema: &openapi.Schema{Type: "integer", Format: "int64"}},
+		},
+		Responses: ok("A stream whose data is a SpectatorEvent, or a gap or shutdown", map[string]openapi.MediaType{
+			"text/event-stream": {Schema: doc.Schema(SpectatorEvent{})},
+		}),
+	})
+	add(http.MethodPost, Games, s.Games, openapi.Operation{
+		OperationID: "createGame",
+		Summary:     "Create a game",
+		RequestBody: body(CreateGameRequest{}),
+		Responses:   created("The game, with the token for its moves", GameResponse{}),
+	})
+	add(http.MethodGet, Games+"/{id}", s.Games, openapi.Operation{
+		OperationID: "getGame",
+		Summary:     "Describe a game",
+		Parameters:  []openapi.Parameter{parameter("path", "id", "string", "ID of the game")},
+		Responses:   ok("The game", doc.JSON(GameResponse{})),
+	})
+	add(http.MethodPost, Games+"/{id}/moves", s.Games, openapi.Operation{
+		OperationID: "moveGame",
+		Summary:     "Start, pause or resume a game, or navigate to a page linked from its current page",
+		Parameters:  []openapi.Parameter{parameter("path", "id", "string", "ID of the game")},
+		RequestBody: body(MoveRequest{}),
+		Responses:   ok("The game after the move", doc.JSON(GameResponse{})),
+	})
+	add(http.MethodGet, Leaderboards+"/{challenge}", s.Leaderboards, openapi.Operation{
+		OperationID: "getLeaderboard",
+		Summary:     "The finished games of a challenge",
+		Parameters: []openapi.Parameter{
+			parameter("path", "challenge", "string", "ID of the challenge"),
+			parameter("query", "order", "string", "clicks (the default) or time"),
+			parameter("query", "offset", "integer", "Games skipped"),
+			parameter("query", "limit", "integer", "Most games returned"),
+		},
+		Responses: ok("One page of the leaderboard", doc.JSON(LeaderboardResponse{})),
+	})
+	add(http.MethodPost, Rooms, s.Rooms, openapi.Operation{
+		OperationID: "createRoom",
+		Summary:     "Create a race room, which players join over the WebSocket at /rooms/{code}",
+		RequestBody: body(CreateRoomRequest{}),
+		Responses:   created("The room, with the token of its host", RoomResponse{}),
+	})
+	add(http.MethodGet, Rooms+"/{code}", s.Rooms, openapi.Operation{
+		OperationID: "getRoom",
+		Summary:     "Describe a race room",
+		Parameters:  []openapi.Parameter{parameter("path", "code", "string", "Code of the room")},
+		Responses:   ok("The room", doc.JSON(RoomResponse{})),
+	})
+	add(http.MethodGet, Settings, s.Settings, openapi.Operation{
+		OperationID: "getSettings",
+		Summary:     "The log level, trace IDs and wikis of the server",
+		Responses:   ok("The settings", doc.JSON(SettingsResponse{})),
+	})
+	add(http.MethodGet, Solve, s.Solve, openapi.Operation{
+		OperationID: "solve",
+		Summary:     "The shortest paths from a start to a goal",
+		Parameters: []openapi.Parameter{
+			parameter("query", "start", "string", "Subject of the start, such as /wiki/Go"),
+			parameter("query", "goal", "string", "Subject of the goal"),
+			wiki,
+			parameter("query", "stream", "boolean", "Whether to stream the progress of the search"),
+		},
+		Responses: ok("The paths, or with stream=true a SolveEvent per line", map[string]openapi.MediaType{
+			"application/json":     {Schema: doc.Schema(SolveResponse{})},
+			"application/x-ndjson": {Schema: doc.Schema(SolveEvent{})},
+		}),
+	})
+	add(http.MethodGet, SpecialRandom, s.SpecialRandom, openapi.Operation{
+		OperationID: "getSpecialRandom",
+		Summary:     "A random start and goal",
+		Parameters:  []openapi.Parameter{wiki},
+		Responses:   ok("The start and goal", doc.JSON(SpecialRandomResponse{})),
+	})
+	add(http.MethodGet, Status, s.Status, openapi.Operation{
+		OperationID: "getStatus",
+		Summary:     "The health of the connection to each wiki",
+		Responses:   ok("The status", doc.JSON(StatusResponse{})),
+	})
+	add(http.MethodPost, WikiPage, s.WikiPage, openapi.Operation{
+		OperationID: "getWikiPage",
+		Summary:     "A page of a wiki, cleaned up for the player",
+		Description: "A client which prefers JSON to HTML in its Accept header is sent the page with its metadata, and any other its HTML alone.",
+		RequestBody: body(WikiPageRequest{}),
+		Responses: ok("The page", map[string]openapi.MediaType{
+			api.MediaTypeJSON: {Schema: doc.Schema(WikiPageResponse{})},
+			api.MediaTypeHTML: {Schema: &openapi.Schema{Type: "string"}},
+		}),
+	})
+	add(http.MethodGet, OpenAPI, s.OpenAPI, openapi.Operation{
+		OperationID: "getOpenAPI",
+		Summary:     "This document",
+		Responses:   ok("The OpenAPI document", map[string]openapi.MediaType{"application/json": {}}),
+	})
+	return mux, doc
+}
+
+// lowered returns a copy of a request whose path is lowercased, so that
+// endpoints are matched whatever their case, such as /api/SpecialRandom
+func lowered(r *http.Request) *http.Request {
+	route := r.Clone(r.Context())
+	route.URL.Path = strings.ToLower(r.URL.Path)
+	route.URL.RawPath = ""
+	return route
+}
+
+// allowed returns the methods which a router allows for the path of a
+// request, which are none if it has no such endpoint
+func allowed(mux *http.ServeMux, r *http.Request) (methods []string) {
+	probe := *r
+	for _, method := range routeMethods {
+		probe.Method = method
+		if _, pattern := mux.Handler(&probe); pattern != "" {
+			methods = append(methods, method)
+		}
+	}
+	if len(methods) > 0 {
+		methods = append(methods, http.MethodOptions)
+	}
+	return
+}
@@ -0,0 +1,177 @@
+package wrserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bruceesmith/wrspa/backend/wrserver/api"
+	"github.com/bruceesmith/wrspa/backend/wrserver/openapi"
+	"go.uber.org/mock/gomock"
+)
+
+func TestAPIVersions(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	svr, err := NewServer("8080", "testdata", testWiki(ctrl, nil, nil))
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		path       string
+		statusCode int
+		successor  string
+	}{
+		{name: "versioned", path: "/api/v1/settings", statusCode: http.StatusOK},
+		{name: "versioned mixed case", path: "/API/V1/Settings", statusCode: http.StatusOK},
+		{name: "alias", path: "/api/settings", statusCode: http.StatusOK, successor: "/api/v1/settings"},
+		{name: "alias mixed case", path: "/api/Settings", statusCode: http.StatusOK, successor: "/api/v1/Settings"},
+		{name: "alias of no endpoint", path: "/api/nothing", statusCode: http.StatusNotFound, successor: "/api/v1/nothing"},
+		{name: "unknown version", path: "/api/v2/settings", statusCode: http.StatusNotFound, successor: "/api/v1/v2/settings"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			svr.API(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if w.Code != tt.statusCode {
+				t.Errorf("got status code %d, want %d: %s", w.Code, tt.statusCode, w.Body.String())
+			}
+			deprecation, link := w.Header().Get("Deprecation"), w.Header().Get("Link")
+			switch {
+			case tt.successor == "" && (deprecation != "" || link != ""):
+				t.Errorf("got Deprecation %s and Link %s, want neither", deprecation, link)
+			case tt.successor != "" && (deprecation != "true" || link != "<"+tt.successor+`>; rel="successor-version"`):
+				t.Errorf("got Deprecation %s and Link %s, want a link to %s", deprecation, link, tt.successor)
+			}
+		})
+	}
+}
+
+// TestOpenAPI checks every operation of the OpenAPI document against the
+// responses of its handler, so that it fails if they drift apart
+func TestOpenAPI(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	pages := map[string]string{
+		"/wiki/Start": `<html><body><a href="/wiki/A">A</a><a href="/wiki/Goal">Goal</a></body></html>`,
+		"/wiki/A":     `<html><body><a href="/wiki/Start">Start</a></body></html>`,
+		"/wiki/Goal":  `<html><body><h2 id="Goal">Goal</h2><p>goal</p></body></html>`,
+	}
+	backlinks := map[string]string{
+		"Goal|": `{"query":{"backlinks":[{"title":"Start"}]}}`,
+	}
+	pool := filepath.Join(t.TempDir(), "pool.yml")
+	os.WriteFile(pool, []byte("pairs:\n  - start: /wiki/Start\n    goal: /wiki/Goal\n"), 0o644)
+	client := testWiki(ctrl, pages, backlinks)
+	client.EXPECT().GetRandom(gomock.Any()).Return("/wiki/Start", nil).AnyTimes()
+	options := DefaultServerOptions()
+	options.Wiki = "en"
+	options.Daily.Pool = pool
+	svr, err := NewServerWithOptions("8080", "testdata", client, options)
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+	s := svr.(*Server)
+	t.Cleanup(func() {
+		s.cancel()
+		s.rooms.Wait()
+	})
+	now := time.Date(2026, 10, 17, 9, 0, 0, 0, time.UTC)
+	s.daily.now = func() time.Time { return now }
+
+	covered := make(map[string]bool)
+	call := func(ctx context.Context, method, target string, body any, accept string) *httptest.ResponseRecorder {
+		t.Helper()
+		var reader io.Reader
+		if body != nil {
+			bodyBytes, _ := json.Marshal(body)
+			reader = bytes.NewReader(bodyBytes)
+		}
+		req := httptest.NewRequestWithContext(ctx, method, target, reader)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		w := httptest.NewRecorder()
+		s.API(w, req)
+		if err := s.spec.CheckResponse(method, req.URL.Path, w.Code, w.Header(), w.Body.Bytes()); err != nil {
+			t.Errorf("response does not match the document: %v: %s", err, w.Body.String())
+		}
+		path, _ := s.spec.Match(method, req.URL.Path)
+		covered[method+" "+path] = true
+		return w
+	}
+	get := func(target string) *httptest.ResponseRecorder {
+		t.Helper()
+		return call(context.Background(), http.MethodGet, target, nil, "")
+	}
+	post := func(target string, body any) *httptest.ResponseRecorder {
+		t.Helper()
+		return call(context.Background(), http.MethodPost, target, body, "")
+	}
+
+	var daily DailyResponse
+	json.Unmarshal(get(api.Prefix+"daily").Body.Bytes(), &daily)
+	get(api.Prefix + "daily?date=yesterday")
+	get(api.Prefix + "daily/history")
+
+	var game GameResponse
+	json.Unmarshal(post(api.Prefix+"games", CreateGameRequest{Challenge: daily.Challenge, Player: "ann"}).Body.Bytes(), &game)
+	get(api.Prefix + "games/" + game.ID)
+	get(api.Prefix + "games/unknown")
+	moves := api.Prefix + "games/" + game.ID + "/moves"
+	post(moves, MoveRequest{Token: game.Token, Action: MoveStart})
+	post(moves, MoveRequest{Token: game.Token, Action: MoveNavigate, Subject: "/wiki/Goal"})
+	post(moves, MoveRequest{Token: "wrong", Action: MoveNavigate, Subject: "/wiki/Goal"})
+	get(api.Prefix + "leaderboards/" + daily.Challenge)
+	get(api.Prefix + "leaderboards/" + daily.Challenge + "?order=time&limit=1")
+
+	var room RoomResponse
+	json.Unmarshal(post(api.Prefix+"rooms", CreateRoomRequest{Start: "/wiki/Start", Goal: "/wiki/Goal"}).Body.Bytes(), &room)
+	get(api.Prefix + "rooms/" + room.Code)
+
+	get(api.Prefix + "settings")
+	get(api.Prefix + "solve?start=/wiki/Start&goal=/wiki/Goal")
+	get(api.Prefix + "solve?start=/wiki/Start&goal=/wiki/Goal&stream=true")
+	get(api.Prefix + "solve?start=Start&goal=/wiki/Goal")
+	get(api.Prefix + "specialrandom")
+	get(api.Prefix + "status")
+	call(context.Background(), http.MethodPost, api.Prefix+"wikipage", WikiPageRequest{Subject: "/wiki/Goal"}, api.MediaTypeJSON)
+	call(context.Background(), http.MethodPost, api.Prefix+"wikipage", WikiPageRequest{Subject: "/wiki/Goal"}, "")
+	call(context.Background(), http.MethodPost, api.Prefix+"wikipage", WikiPageRequest{Subject: "/wiki/Missing"}, api.MediaTypeJSON)
+
+	// A stream ends when its request does
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	call(ctx, http.MethodGet, api.Prefix+"events/race-1/stream", nil, "")
+
+	// The document served is the one the router was built with
+	w := get(api.Prefix + "openapi.json")
+	var served openapi.Document
+	if err := json.Unmarshal(w.Body.Bytes(), &served); err != nil {
+		t.Fatalf("invalid document: %v", err)
+	}
+	if served.OpenAPI != openapi.Version || len(served.Paths) != len(s.spec.Paths) || len(served.Components.Schemas) != len(s.spec.Components.Schemas) {
+		t.Errorf("got document %s", w.Body.String())
+	}
+
+	for path, operations := range s.spec.Paths {
+		for method := range operations {
+			if !covered[strings.ToUpper(method)+" "+path] {
+				t.Errorf("%s %s is not checked", strings.ToUpper(method), path)
+			}
+		}
+	}
+}
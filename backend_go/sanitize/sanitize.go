@@ -0,0 +1,282 @@
+/*
+Package sanitize removes active content from the HTML of Wikipedia pages
+before it is handed to a browser, which inserts it into the game's own page.
+
+A Policy keeps only the elements and attributes on its allowlist, which
+covers the markup of Wikipedia articles, their classes and their MathML.
+Scripts, embedded documents and forms are removed with their content, event
+handler attributes are dropped, and a link or image whose URL has a scheme
+other than http, https, mailto or tel loses the URL. An element which is
+not allowed but is harmless, such as <font>, is replaced by its children.
+*/
+package sanitize
+
+import (
+	"maps"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"golang.org/x/net/html"
+)
+
+// Options configures a Policy
+type Options struct {
+	Styles     bool     // Keep style attributes and <style> elements, unless their CSS could load anything
+	Elements   []string // Further HTML elements allowed, other than those removed with their content
+	Attributes []string // Further attributes allowed on any element, other than event handlers
+}
+
+// DefaultOptions returns the Options used when none are given
+func DefaultOptions() Options {
+	return Options{
+		Styles: true,
+	}
+}
+
+// Policy is an allowlist of elements and attributes
+type Policy struct {
+	options    Options
+	elements   map[string]bool
+	attributes map[string]bool
+}
+
+var (
+	// elements are the HTML elements of Wikipedia articles
+	elements = set(
+		"a", "abbr", "audio", "b", "bdi", "bdo", "big", "blockquote", "br", "caption", "center", "cite",
+		"code", "col", "colgroup", "data", "dd", "del", "details", "dfn", "div", "dl", "dt", "em",
+		"figcaption", "figure", "h1", "h2", "h3", "h4", "h5", "h6", "hr", "i", "img", "ins", "kbd", "li",
+		"main", "mark", "ol", "p", "picture", "pre", "q", "rb", "rp", "rt", "rtc", "ruby", "s", "samp",
+		"section", "small", "source", "span", "strike", "strong", "style", "sub", "summary", "sup",
+		"table", "tbody", "td", "tfoot", "th", "thead", "time", "tr", "track", "tt", "u", "ul", "var",
+		"video", "wbr",
+	)
+	// mathElements are the MathML elements rendered by Wikipedia's Math
+	// extension
+	mathElements = set(
+		"maction", "math", "menclose", "merror", "mfenced", "mfrac", "mi", "mmultiscripts", "mn", "mo",
+		"mover", "mpadded", "mphantom", "mprescripts", "mroot", "mrow", "ms", "mspace", "msqrt", "mstyle",
+		"msub", "msubsup", "msup", "mtable", "mtd", "mtext", "mtr", "munder", "munderover", "none",
+		"semantics", "annotation",
+	)
+	// attributes are the attributes allowed on any element
+	attributes = set(
+		"abbr", "about", "align", "alt", "bgcolor", "border", "cellpadding", "cellspacing", "cite",
+		"class", "colspan", "controls", "datetime", "decoding", "default", "dir", "headers", "height",
+		"href", "hreflang", "id", "kind", "label", "lang", "loading", "loop", "muted", "nowrap", "open",
+		"poster", "preload", "property", "rel", "resource", "reversed", "role", "rowspan", "scope",
+		"span", "src", "srclang", "srcset", "start", "style", "title", "type", "typeof", "valign",
+		"value", "width",
+	)
+	// mathAttributes are the further attributes allowed on MathML elements
+	mathAttributes = set(
+		"accent", "accentunder", "alttext", "columnalign", "columnlines", "columnspacing", "depth",
+		"display", "displaystyle", "encoding", "fence", "form", "largeop", "linethickness", "lspace",
+		"mathbackground", "mathcolor", "mathsize", "mathvariant", "maxsize", "minsize", "movablelimits",
+		"rowalign", "rowlines", "rowspacing", "rspace", "scriptlevel", "separator", "stretchy",
+		"symmetric", "voffset",
+	)
+	// dropped are the elements removed together with their content
+	dropped = set(
+		"annotation-xml", "applet", "button", "embed", "form", "frame", "frameset", "head", "iframe",
+		"noembed", "noframes", "noscript", "object", "script", "select", "svg", "template", "textarea",
+		"title",
+	)
+	// urlAttributes are the attributes holding a URL, or a list of them
+	urlAttributes = set("cite", "href", "poster", "src", "srcset")
+	// schemes are the URL schemes allowed
+	schemes = set("http", "https", "mailto", "tel")
+	// unsafeCSS matches CSS which could load a resource or run a script,
+	// once its escapes are decoded
+	unsafeCSS = regexp.MustCompile(`(?i)url\s*\(|image-set\s*\(|@import|expression\s*\(|javascript:|behavior\s*:|-moz-binding`)
+)
+
+// New returns the Policy of a set of options
+func New(options Options) *Policy {
+	p := &Policy{
+		options:    options,
+		elements:   maps.Clone(elements),
+		attributes: maps.Clone(attributes),
+	}
+	for _, name := range options.Elements {
+		if name = strings.ToLower(name); !dropped[name] {
+			p.elements[name] = true
+		}
+	}
+	for _, name := range options.Attributes {
+		p.attributes[strings.ToLower(name)] = true
+	}
+	if !options.Styles {
+		delete(p.elements, "style")
+		delete(p.attributes, "style")
+	}
+	return p
+}
+
+// Clean removes from the descendants of n everything the policy does not
+// allow, in place. It is typically given the <body> of a page.
+func (p *Policy) Clean(n *html.Node) {
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		switch c.Type {
+		case html.ElementNode:
+			p.element(n, c)
+		case html.CommentNode:
+			n.RemoveChild(c)
+		}
+		c = next
+	}
+}
+
+// element cleans an element and its descendants, removing or unwrapping it
+// if it is not allowed
+func (p *Policy) element(parent, n *html.Node) {
+	allowed := false
+	switch n.Namespace {
+	case "":
+		allowed = p.elements[n.Data]
+	case "math":
+		allowed = mathElements[n.Data]
+	}
+	switch {
+	case dropped[n.Data] || !allowed && n.Namespace != "" && n.Namespace != "math":
+		parent.RemoveChild(n)
+	case n.Data == "style" && n.Namespace == "":
+		if !allowed || unsafeStyle(text(n)) {
+			parent.RemoveChild(n)
+			return
+		}
+		p.keepAttributes(n)
+	case !allowed:
+		p.Clean(n)
+		for c := n.FirstChild; c != nil; c = n.FirstChild {
+			n.RemoveChild(c)
+			parent.InsertBefore(c, n)
+		}
+		parent.RemoveChild(n)
+	default:
+		p.keepAttributes(n)
+		p.Clean(n)
+	}
+}
+
+// keepAttributes removes the attributes of an element which are not allowed
+// or whose values are not safe
+func (p *Policy) keepAttributes(n *html.Node) {
+	kept := n.Attr[:0]
+	for _, a := range n.Attr {
+		key := a.Key
+		allowed := p.attributes[key] || strings.HasPrefix(key, "data-") || strings.HasPrefix(key, "aria-") ||
+			n.Namespace == "math" && mathAttributes[key]
+		switch {
+		case !allowed, a.Namespace != "", strings.HasPrefix(key, "on"):
+			continue
+		case key == "style" && unsafeStyle(a.Val):
+			continue
+		case key == "srcset" && !safeSrcset(a.Val):
+			continue
+		case urlAttributes[key] && key != "srcset" && !safeURL(a.Val):
+			continue
+		}
+		kept = append(kept, a)
+	}
+	n.Attr = kept
+}
+
+// safeURL reports whether a URL is relative or has an allowed scheme.
+// Browsers ignore whitespace and control characters in a scheme, so they
+// are ignored here too.
+func safeURL(u string) bool {
+	u = strings.Map(func(r rune) rune {
+		if r <= ' ' || r == 0x7f {
+			return -1
+		}
+		return r
+	}, u)
+	colon := strings.IndexByte(u, ':')
+	if colon < 0 || strings.ContainsAny(u[:colon], "/?#") {
+		return true
+	}
+	return schemes[strings.ToLower(u[:colon])]
+}
+
+// safeSrcset reports whether every URL of a srcset is safe
+func safeSrcset(srcset string) bool {
+	for candidate := range strings.SplitSeq(srcset, ",") {
+		fields := strings.Fields(candidate)
+		if len(fields) > 0 && !safeURL(fields[0]) {
+			return false
+		}
+	}
+	return true
+}
+
+// unsafeStyle reports whether CSS could load a resource or run a script.
+// Browsers read an escape such as \72 or \r as the character it stands for,
+// so that u\72l( is url(, and the escapes are decoded before matching.
+func unsafeStyle(css string) bool {
+	if !strings.Contains(css, `\`) {
+		return unsafeCSS.MatchString(css)
+	}
+	var b strings.Builder
+	for i := 0; i < len(css); i++ {
+		if css[i] != '\\' || i+1 == len(css) {
+			b.WriteByte(css[i])
+			continue
+		}
+		i++
+		hex := 0
+		for hex < 6 && i+hex < len(css) && isHex(css[i+hex]) {
+			hex++
+		}
+		switch {
+		case hex > 0:
+			code, _ := strconv.ParseUint(css[i:i+hex], 16, 32)
+			if code == 0 || code > unicode.MaxRune || code >= 0xd800 && code <= 0xdfff {
+				code = unicode.ReplacementChar
+			}
+			b.WriteRune(rune(code))
+			i += hex
+			// A single whitespace character ends the escape
+			if i < len(css) && strings.IndexByte(" \t\n\r\f", css[i]) >= 0 {
+				if css[i] == '\r' && i+1 < len(css) && css[i+1] == '\n' {
+					i++
+				}
+			} else {
+				i--
+			}
+		case css[i] == '\n' || css[i] == '\r' || css[i] == '\f':
+			// An escaped newline continues a string
+		default:
+			b.WriteByte(css[i])
+		}
+	}
+	return unsafeCSS.MatchString(b.String())
+}
+
+// isHex reports whether a byte is a hexadecimal digit
+func isHex(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+// text returns the text content of an element
+func text(n *html.Node) string {
+	var b strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.TextNode {
+			b.WriteString(c.Data)
+		}
+	}
+	return b.String()
+}
+
+// set returns a set of names
+func set(names ...string) map[string]bool {
+	s := make(map[string]bool, len(names))
+	for _, name := range names {
+		s[name] = true
+	}
+	return s
+}
@@ -0,0 +1,166 @@
+package sanitize
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files of the sanitizer tests")
+
+// clean sanitizes the <body> of a page and renders its children
+func clean(t *testing.T, p *Policy, page string) string {
+	t.Helper()
+	doc, err := html.Parse(strings.NewReader(page))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var body *html.Node
+	for n := range doc.Descendants() {
+		if n.Type == html.ElementNode && n.Data == "body" {
+			body = n
+			break
+		}
+	}
+	if body == nil {
+		t.Fatalf("no <body> in %q", page)
+	}
+	p.Clean(body)
+	var buf bytes.Buffer
+	for c := body.FirstChild; c != nil; c = c.NextSibling {
+		if err := html.Render(&buf, c); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	return buf.String()
+}
+
+// TestClean_Golden sanitizes each testdata/*.html with the default options
+// and compares the result with the matching .golden file. Run the tests
+// with -update to rewrite the golden files after a deliberate change.
+func TestClean_Golden(t *testing.T) {
+	pages, err := filepath.Glob(filepath.Join("testdata", "*.html"))
+	if err != nil || len(pages) == 0 {
+		t.Fatalf("no test pages: %v", err)
+	}
+	p := New(DefaultOptions())
+	for _, page := range pages {
+		t.Run(filepath.Base(page), func(t *testing.T) {
+			input, err := os.ReadFile(page)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			got := clean(t, p, string(input))
+			golden := strings.TrimSuffix(page, ".html") + ".golden"
+			if *update {
+				if err := os.WriteFile(golden, []byte(got), 0o644); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != string(want) {
+				t.Errorf("sanitized %s differs from %s:\n%s", page, golden, got)
+			}
+		})
+	}
+}
+
+func TestClean_Options(t *testing.T) {
+	tests := []struct {
+		name    string
+		options Options
+		page    string
+		want    string
+	}{
+		{
+			name:    "without styles",
+			options: Options{},
+			page:    `<style>.a{color:red}</style><p style="color:red" class="a">text</p>`,
+			want:    `<p class="a">text</p>`,
+		},
+		{
+			name:    "further elements and attributes",
+			options: Options{Styles: true, Elements: []string{"Font"}, Attributes: []string{"color"}},
+			page:    `<font color="red" face="serif">text</font>`,
+			want:    `<font color="red">text</font>`,
+		},
+		{
+			name:    "event handlers are never allowed",
+			options: Options{Attributes: []string{"onclick"}},
+			page:    `<p onclick="alert(1)">text</p>`,
+			want:    `<p>text</p>`,
+		},
+		{
+			name:    "active elements are never allowed",
+			options: Options{Elements: []string{"script", "iframe"}},
+			page:    `<script>alert(1)</script><iframe src="https://example.org/"></iframe><p>text</p>`,
+			want:    `<p>text</p>`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page := "<html><body>" + tt.page + "</body></html>"
+			if got := clean(t, New(tt.options), page); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSafeURL(t *testing.T) {
+	tests := []struct {
+		url  string
+		want bool
+	}{
+		{url: "/wiki/Coffee", want: true},
+		{url: "//upload.wikimedia.org/a.png", want: true},
+		{url: "#cite_note-1", want: true},
+		{url: "https://en.wikipedia.org/wiki/Tea", want: true},
+		{url: "HTTP://example.org", want: true},
+		{url: "mailto:editor@example.org", want: true},
+		{url: "/wiki/Ratio:_of_things", want: true},
+		{url: "?title=a:b", want: true},
+		{url: "javascript:alert(1)", want: false},
+		{url: " java\tscript:alert(1)", want: false},
+		{url: "vbscript:msgbox(1)", want: false},
+		{url: "data:text/html,<script>alert(1)</script>", want: false},
+	}
+	for _, tt := range tests {
+		if got := safeURL(tt.url); got != tt.want {
+			t.Errorf("safeURL(%q) = %v, want %v", tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestUnsafeStyle(t *testing.T) {
+	tests := []struct {
+		css  string
+		want bool
+	}{
+		{css: "color: red", want: false},
+		{css: `content: "\2014\A"`, want: false},
+		{css: "background: url(/a.png)", want: true},
+		{css: `background: u\72l(/a.png)`, want: true},
+		{css: `background: u\000072l(/a.png)`, want: true},
+		{css: `background: \75 \72 \6c (/a.png)`, want: true},
+		{css: `background: \55\52\4c(/a.png)`, want: true},
+		{css: `background: ur\l(/a.png)`, want: true},
+		{css: `@\69mport "x.css"`, want: true},
+		{css: `width: e\xpression(alert(1))`, want: true},
+		{css: "background: u\\\nrl(/a.png)", want: true},
+		{css: `color: red\`, want: false},
+	}
+	for _, tt := range tests {
+		if got := unsafeStyle(tt.css); got != tt.want {
+			t.Errorf("unsafeStyle(%q) = %v, want %v", tt.css, got, tt.want)
+		}
+	}
+}
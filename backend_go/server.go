@@ -7,35 +7,118 @@ package wrserver
 
 import (
 	"bytes"
+	"cmp"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"maps"
+	"math"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/bruceesmith/logger"
 	"github.com/bruceesmith/terminator"
+	"github.com/bruceesmith/wrspa/backend/wrserver/api"
+	"github.com/bruceesmith/wrspa/backend/wrserver/leaderboard"
+	"github.com/bruceesmith/wrspa/backend/wrserver/links"
+	"github.com/bruceesmith/wrspa/backend/wrserver/metadata"
+	"github.com/bruceesmith/wrspa/backend/wrserver/openapi"
+	"github.com/bruceesmith/wrspa/backend/wrserver/sanitize"
+	"github.com/bruceesmith/wrspa/backend/wrserver/solver"
+	"github.com/bruceesmith/wrspa/backend/wrserver/title"
 	"golang.org/x/net/html"
+	"golang.org/x/net/websocket"
 )
 
 // Server is the HTTP server for this program
 type Server struct {
-	client ClientInterface
-	port   string
-	root   string
-	server *http.Server
+	daily      *dailies
+	games      *games
+	profiles   map[string]*cleaner // by name
+	rooms      *rooms
+	sanitizer  *sanitize.Policy // removes active content from pages; nil if pages are passed through
+	spectators *spectators
+	store      Store                      // leaderboards of finished games
+	client     ClientInterface            // the default wiki
+	upload     ClientInterface            // the media host whose images are proxied; nil if they are not
+	wikis      map[string]ClientInterface // every other allowed wiki, by name
+	options    ServerOptions
+	port       string
+	root       string
+	router     *http.ServeMux    // the REST API
+	spec       *openapi.Document // describes router
+	server     *http.Server
+	redirect   *http.Server       // redirects HTTP to HTTPS, if enabled
+	ctx        context.Context    // the context of every in-flight request
+	cancel     context.CancelFunc // cancels ctx
 }
 
-// NewServer returns a Server
+// ServerOptions configures a Server
+type ServerOptions struct {
+	ReadHeaderTimeout time.Duration               // Deadline for reading the request headers
+	ReadTimeout       time.Duration               // Deadline for reading the whole request
+	WriteTimeout      time.Duration               // Deadline for writing the response
+	IdleTimeout       time.Duration               // Time a keep-alive connection may wait for its next request
+	ShutdownTimeout   time.Duration               // Time allowed for in-flight requests to finish at shutdown
+	TLSCert           string                      // PEM certificate chain, reloaded when it changes; HTTPS is served when set
+	TLSKey            string                      // PEM private key for TLSCert
+	TLSSelfSigned     bool                        // Serve HTTPS with a generated certificate, for local testing
+	RedirectPort      string                      // Port of an HTTP listener redirecting to HTTPS; none if empty
+	Wiki              string                      // Name of the default wiki, whose client is passed to NewServerWithOptions
+	Wikis             map[string]ClientInterface  // Further wikis which a request may select, by name
+	Namespaces        map[string]title.Namespaces // Namespaces of each wiki, by name; those of the English Wikipedia if not given
+	Daily             DailyOptions                // The daily challenge, on the default wiki
+	Games             GameOptions                 // Game sessions
+	Rooms             RoomOptions                 // Race rooms
+	Profile           string                      // Profile applied to pages when a request or game chooses none; none if empty
+	Profiles          map[string]Profile          // Cleanup profiles which a request or game may choose, by name
+	Sanitize          *sanitize.Options           // Allowlist for the HTML of pages; passed through unchanged if nil
+	Spectators        SpectatorOptions            // Event logs streamed to spectators
+	Solver            solver.Options              // Budgets of each search by /api/solve
+	Store             Store                       // Leaderboards of finished games; in memory if nil
+	Upload            ClientInterface             // Media host whose images are served through /upload/; linked directly if nil
+	UploadHost        string                      // Host of Upload as pages link to it, such as upload.wikimedia.org
+}
+
+// DefaultServerOptions returns the ServerOptions used by NewServer
+func DefaultServerOptions() ServerOptions {
+	sanitizer := sanitize.DefaultOptions()
+	return ServerOptions{
+		ReadHeaderTimeout: 10 * time.Second,
+		IdleTimeout:       2 * time.Minute,
+		ShutdownTimeout:   10 * time.Second,
+		Daily:             DefaultDailyOptions(),
+		Games:             DefaultGameOptions(),
+		Rooms:             DefaultRoomOptions(),
+		Profiles:          DefaultProfiles(),
+		Sanitize:          &sanitizer,
+		Spectators:        DefaultSpectatorOptions(),
+		Solver:            solver.DefaultOptions(),
+	}
+}
+
+// NewServer returns a Server with the default options
 func NewServer(port, static string, client ClientInterface) (svr ServerInterface, err error) {
+	return NewServerWithOptions(port, static, client, DefaultServerOptions())
+}
+
+// NewServerWithOptions returns a Server
+func NewServerWithOptions(port, static string, client ClientInterface, options ServerOptions) (svr ServerInterface, err error) {
 	p, err := strconv.ParseInt(port, 10, 32)
 	if err != nil {
 		return nil, fmt.Errorf("unable to parse port %s: %w", port, err)
 	}
-	if p <= 1024 || p > 65535 {
+	// A privileged port such as 443 is allowed, as the server may terminate
+	// TLS itself; binding it is left to the operating system to permit
+	if p < 1 || p > 65535 {
 		return nil, fmt.Errorf("invalid port %s", port)
 	}
 
@@ -50,76 +133,763 @@ func NewServer(port, static string, client ClientInterface) (svr ServerInterface
 		return nil, fmt.Errorf("static path '%s' is not a directory", static)
 	}
 
+	tlsConfig, err := tlsConfig(options)
+	if err != nil {
+		return nil, err
+	}
+	if options.RedirectPort != "" && tlsConfig == nil {
+		return nil, fmt.Errorf("redirect port %s given without TLS", options.RedirectPort)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
 	s := &Server{
-		client: client,
-		port:   port,
-		root:   static,
+		client:     newCoalescer(client),
+		wikis:      make(map[string]ClientInterface),
+		games:      newGames(options.Games),
+		profiles:   make(map[string]*cleaner),
+		spectators: newSpectators(options.Spectators),
+		store:      options.Store,
+		options:    options,
+		port:       port,
+		root:       static,
+		ctx:        ctx,
+		cancel:     cancel,
+	}
+	for name, wiki := range options.Wikis {
+		s.wikis[name] = newCoalescer(wiki)
+	}
+	for name, profile := range options.Profiles {
+		if s.profiles[name], err = newCleaner(profile); err != nil {
+			cancel()
+			return nil, fmt.Errorf("invalid profile '%s': %w", name, err)
+		}
+	}
+	if options.Profile != "" && s.profiles[options.Profile] == nil {
+		cancel()
+		return nil, fmt.Errorf("%w: %s", ErrUnknownProfile, options.Profile)
+	}
+	if s.store == nil {
+		s.store = NewMemoryStore()
+	}
+	if options.Sanitize != nil {
+		s.sanitizer = sanitize.New(*options.Sanitize)
+	}
+	if options.Upload != nil {
+		s.upload = newCoalescer(options.Upload)
+	}
+	s.rooms = newRooms(options.Rooms, s.games, s.record)
+	s.router, s.spec = s.routes()
+	s.daily, err = newDailies(options.Daily, options.Wiki, wikiGraph{client: s.client, namespaces: s.namespaces("")}, options.Solver)
+	if err != nil {
+		cancel()
+		return nil, err
 	}
 
 	mux := http.NewServeMux()
 	mux.HandleFunc("/", s.SPAFile)
 	mux.HandleFunc("/api/", s.API)
+	mux.HandleFunc("/rooms/", s.RoomSocket)
 	mux.HandleFunc("/static/", s.WikipediaFile)
+	mux.HandleFunc("/upload/", s.UploadFile)
 	mux.HandleFunc("/w/", s.WikipediaFile)
+	mux.HandleFunc("/wikis/", s.WikipediaFile)
 
 	s.server = &http.Server{
-		Addr:    ":" + port,
-		Handler: mux,
+		Addr:              ":" + port,
+		Handler:           withRequestID(mux),
+		ReadHeaderTimeout: options.ReadHeaderTimeout,
+		ReadTimeout:       options.ReadTimeout,
+		WriteTimeout:      options.WriteTimeout,
+		IdleTimeout:       options.IdleTimeout,
+		TLSConfig:         tlsConfig,
+		BaseContext: func(net.Listener) context.Context {
+			return ctx
+		},
+	}
+	if options.RedirectPort != "" {
+		s.redirect = &http.Server{
+			Addr:              ":" + options.RedirectPort,
+			Handler:           httpsRedirect(port),
+			ReadHeaderTimeout: options.ReadHeaderTimeout,
+			IdleTimeout:       options.IdleTimeout,
+		}
 	}
 	svr = s
 	return
 }
 
-// API provides the REST interface for the SPA
+// API provides the REST interface for the SPA, passing each request to the
+// handler of its endpoint whatever the case of its path. A path without the
+// version of api.Prefix is a deprecated alias, whose response says so in its
+// Deprecation header and links to its successor. A request for no endpoint
+// fails with CodeNotFound, and one with a method which its endpoint does not
+// allow fails with CodeMethodNotAllowed and the Allow header. A request with
+// OPTIONS is answered with the Allow header alone.
 func (s *Server) API(w http.ResponseWriter, r *http.Request) {
-	function := EndPoint(strings.ToLower(strings.TrimPrefix(r.URL.Path, "/api/")))
+	route := lowered(r)
+	if rest, found := strings.CutPrefix(route.URL.Path, "/api/"); found && !strings.HasPrefix(route.URL.Path, api.Prefix) {
+		w.Header().Set("Deprecation", "true")
+		w.Header().Set("Link", "<"+api.Prefix+strings.TrimPrefix(r.URL.Path, "/api/")+`>; rel="successor-version"`)
+		route.URL.Path = api.Prefix + rest
+	}
+	if _, pattern := s.router.Handler(route); pattern != "" && r.Method != http.MethodOptions {
+		s.router.ServeHTTP(w, route)
+		return
+	}
+	function := strings.TrimPrefix(route.URL.Path, api.Prefix)
+	methods := allowed(s.router, route)
 	switch {
-	case r.Method == http.MethodGet && function == Settings:
-		s.Settings(w, r)
+	case len(methods) == 0:
+		s.handleError(w, function, fmt.Errorf("no such endpoint: %s", r.URL.Path), api.CodeNotFound, r.Method)
+	case r.Method == http.MethodOptions:
+		w.Header().Set("Allow", strings.Join(methods, ", "))
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", strings.Join(methods, ", "))
+		s.handleError(w, function, fmt.Errorf("method %s not allowed", r.Method), api.CodeMethodNotAllowed, r.URL.Path)
+	}
+}
+
+// Daily is the handler for the /api/daily REST endpoints:
+//
+//	GET /api/daily                 today's challenge, or that of the date query parameter
+//	GET /api/daily/history         every remembered challenge up to today
+//
+// Every player is given the same start and goal on a UTC date.
+func (s *Server) Daily(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	var response any
+	if r.URL.Path == api.Prefix+string(DailyHistory) {
+		response = DailyHistoryResponse{Dailies: s.daily.History()}
+	} else {
+		date := r.URL.Query().Get("date")
+		if date == "" {
+			date = s.daily.today()
+		} else if _, err := time.Parse(time.DateOnly, date); err != nil {
+			s.handleError(w, "daily", fmt.Errorf("invalid date '%s': must be YYYY-MM-DD", date), api.CodeInvalidRequest, date)
+			return
+		}
+		daily, err := s.daily.Get(r.Context(), date)
+		switch {
+		case errors.Is(err, ErrDailyNotFound):
+			s.handleError(w, "daily", err, api.CodeNotFound, date)
+			return
+		case errors.Is(err, ErrNoDaily):
+			s.handleError(w, "daily", err, api.CodeUnavailable, date)
+			return
+		case err != nil:
+			s.upstreamError(w, s.client, "daily", err, date)
+			return
+		}
+		response = daily
+	}
+	jason, err := json.Marshal(response)
+	if err != nil {
+		s.handleError(w, "daily", err, api.CodeInternal, response)
 		return
-	case r.Method == http.MethodGet && function == SpecialRandom:
-		s.SpecialRandom(w, r)
+	}
+	w.Write(jason)
+}
+
+// Events is the handler for the /api/events Server-Sent Events endpoint:
+//
+//	GET /api/events/{code}/stream  the events of players tagged with a code
+//
+// Each event is a SpectatorEvent whose SSE id is its number, so a spectator
+// who reconnects with Last-Event-ID is sent only the events they missed,
+// preceded by a gap event if some were dropped from the log. The stream
+// ends with a shutdown event when the server stops.
+func (s *Server) Events(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	code, err := eventCode(r.PathValue("code"))
+	if err != nil {
+		s.handleError(w, "events", err, api.CodeInvalidRequest, r.PathValue("code"))
 		return
-	case r.Method == http.MethodPost && function == WikiPage:
-		s.WikiPage(w, r)
+	}
+	var last uint64
+	if text := r.Header.Get("Last-Event-ID"); text != "" {
+		last, err = strconv.ParseUint(text, 10, 64)
+		if err != nil {
+			s.handleError(w, "events", fmt.Errorf("invalid Last-Event-ID '%s'", text), api.CodeInvalidRequest, text)
+			return
+		}
+	}
+	wake, stop, err := s.spectators.Watch(code)
+	if err != nil {
+		s.handleError(w, "events", err, api.CodeUnavailable, code)
 		return
 	}
+	defer stop()
+
+	// A stream lasts as long as the spectator watches, so it is exempt from
+	// the server's write timeout
+	rc := http.NewResponseController(w)
+	rc.SetWriteDeadline(time.Time{})
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	fmt.Fprintf(w, "retry: %d\n\n", spectatorRetry.Milliseconds())
+	heartbeat := time.NewTicker(spectatorHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		events, missed := s.spectators.Since(code, last)
+		if missed > 0 {
+			fmt.Fprintf(w, "event: gap\ndata: {\"missed\":%d}\n\n", missed)
+		}
+		for _, event := range events {
+			jason, err := json.Marshal(event)
+			if err != nil {
+				logger.Error("events failure", "error", err.Error())
+				continue
+			}
+			fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, jason)
+			last = event.ID
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+		select {
+		case <-s.ctx.Done():
+			io.WriteString(w, "event: shutdown\ndata: {}\n\n")
+			rc.Flush()
+			return
+		case <-r.Context().Done():
+			return
+		case <-wake:
+		case <-heartbeat.C:
+			io.WriteString(w, ": keepalive\n\n")
+		}
+	}
+}
+
+// handleError reports a failure as an api.ErrorResponse, with the status of
+// its code. The details, which are not sent, are logged with the error and
+// the request ID, which is sent.
+func (s *Server) handleError(w http.ResponseWriter, function string, err error, code api.ErrorCode, details any) {
+	id := w.Header().Get(api.HeaderRequestID)
+	logger.Error(function+" failure", "error", err.Error(), "code", string(code), "request", id, "details", fmt.Sprintf("%+v", details))
+	response := api.ErrorResponse{
+		Error: api.Error{
+			Code:      code,
+			Message:   err.Error(),
+			Function:  function,
+			RequestID: id,
+		},
+	}
+	response.Error.RetryAfter, _ = strconv.Atoi(w.Header().Get("Retry-After"))
+	jason, _ := json.Marshal(response)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code.Status())
+	w.Write(jason)
+}
+
+// upstreamError reports a failure of the upstream client of a wiki, telling
+// the SPA when to retry if the circuit breaker of that client is open or the
+// rate limit exhausted
+func (s *Server) upstreamError(w http.ResponseWriter, client ClientInterface, function string, err error, details any) {
+	code := upstreamCode(err)
+	if code == api.CodeUpstreamUnavailable || code == api.CodeRateLimited {
+		var (
+			rle        *RateLimitError
+			retryAfter time.Duration
+		)
+		if errors.As(err, &rle) {
+			retryAfter = rle.RetryAfter
+		} else if retryAt := clientStatus(client).Breaker.RetryAt; retryAt != nil {
+			retryAfter = time.Until(*retryAt)
+		}
+		if retryAfter > 0 {
+			seconds := int(math.Ceil(retryAfter.Seconds()))
+			w.Header().Set("Retry-After", strconv.Itoa(max(seconds, 1)))
+		}
+	}
+	s.handleError(w, function, err, code, details)
+}
+
+// wiki returns the client for the wiki named in a request, where an empty
+// name means the default wiki
+func (s *Server) wiki(name string) (ClientInterface, error) {
+	if name == "" || name == s.options.Wiki {
+		return s.client, nil
+	}
+	if client, found := s.wikis[name]; found {
+		return client, nil
+	}
+	return nil, fmt.Errorf("%w: %s", ErrWikiNotAllowed, name)
+}
+
+// assets returns the prefix of the paths at which the files of a wiki are
+// served, which is empty for the default wiki, whose files keep their own
+func (s *Server) assets(wiki string) string {
+	if wiki == "" || wiki == s.options.Wiki {
+		return ""
+	}
+	return "/wikis/" + url.PathEscape(wiki)
+}
+
+// namespaces returns the namespaces of a wiki, where an empty name means the
+// default wiki
+func (s *Server) namespaces(wiki string) title.Namespaces {
+	return s.options.Namespaces[cmp.Or(wiki, s.options.Wiki)]
 }
 
-// handleError is a helper function to handle errors in a consistent way
-func (s *Server) handleError(w http.ResponseWriter, function string, err error, statusCode int, details any) {
-	logger.Error(function+" failure", "error", err.Error())
-	w.WriteHeader(statusCode)
-	w.Write([]byte(s.MarshalFailure(function, err, details)))
+// profile returns the name of the profile chosen by a request or game, or
+// the default profile if it chose none, and the profile's cleaner
+func (s *Server) profile(name string) (string, *cleaner, error) {
+	name = cmp.Or(name, s.options.Profile)
+	if name == "" {
+		return "", nil, nil
+	}
+	c, found := s.profiles[name]
+	if !found {
+		return "", nil, fmt.Errorf("%w: %s", ErrUnknownProfile, name)
+	}
+	return name, c, nil
 }
 
-// MarshalFailure creates a sensible JSON-format error message
-func (s *Server) MarshalFailure(function string, err error, response any) string {
-	return `{"msg": "unable to marshal API response", ` +
-		`"function": "` + function + `", ` +
-		`"error": "` + err.Error() + `", ` +
-		`"response": "` + fmt.Sprintf("%+v", response) + `"}`
+// gameError reports a failure of a games endpoint
+func (s *Server) gameError(w http.ResponseWriter, function string, err error, details any) {
+	var gse *GameStateError
+	code := api.CodeInvalidRequest
+	switch {
+	case errors.Is(err, ErrGameNotFound), errors.Is(err, ErrChallengeNotFound), errors.Is(err, ErrDailyNotFound),
+		errors.Is(err, ErrRoomNotFound):
+		code = api.CodeNotFound
+	case errors.Is(err, ErrGameToken):
+		code = api.CodeInvalidToken
+	case errors.As(err, &gse):
+		code = api.CodeGameState
+	case errors.Is(err, ErrIllegalMove):
+		code = api.CodeIllegalMove
+	case errors.Is(err, ErrInvalidSubject):
+		code = api.CodeInvalidSubject
+	case errors.Is(err, ErrTooManyGames), errors.Is(err, ErrNoDaily), errors.Is(err, ErrTooManyRooms):
+		code = api.CodeUnavailable
+	}
+	s.handleError(w, function, err, code, details)
 }
 
 // Serve handles all HTTP(S) requests
 func (s *Server) Serve(t *terminator.Terminator) {
+	if s.options.Daily.Prepare {
+		t.Add(1)
+		go s.daily.prepare(s.ctx, t)
+	}
 	t.Add(1)
 	go func() {
 		<-t.ShutDown()
-		s.server.Shutdown(context.Background())
+		// Abandon upstream fetches rather than waiting for Wikipedia to answer
+		s.cancel()
+		ctx := context.Background()
+		if s.options.ShutdownTimeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, s.options.ShutdownTimeout)
+			defer cancel()
+		}
+		if s.redirect != nil {
+			s.redirect.Shutdown(ctx)
+		}
+		s.server.Shutdown(ctx)
+		// Shutdown does not wait for the WebSockets of race rooms, which
+		// are closed by their rooms once s.ctx is cancelled
+		s.rooms.Wait()
 		t.Done()
 	}()
 
+	if s.redirect != nil {
+		go func() {
+			logger.Debug("HTTPS redirect server starting on " + s.redirect.Addr)
+			if err := s.redirect.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				logger.Error("Server.Serve() redirect ListenAndServe error", "error", err.Error())
+			}
+		}()
+	}
+
 	// Start the server
-	logger.Debug("API server starting on :" + s.port)
-	if err := s.server.ListenAndServe(); err != nil {
-		if err != http.ErrServerClosed {
-			logger.Error("Server.Serve() ListenAndServe error", "error", err.Error())
-		}
+	var err error
+	if s.server.TLSConfig != nil {
+		logger.Debug("API server starting with TLS on :" + s.port)
+		err = s.server.ListenAndServeTLS("", "")
+	} else {
+		logger.Debug("API server starting on :" + s.port)
+		err = s.server.ListenAndServe()
+	}
+	if err != nil && err != http.ErrServerClosed {
+		logger.Error("Server.Serve() ListenAndServe error", "error", err.Error())
 	}
 	logger.Debug("API server exiting")
 }
 
+// Games is the handler for the /api/games REST endpoints:
+//
+//	POST /api/games                create a game
+//	GET  /api/games/{id}           describe a game
+//	POST /api/games/{id}/moves     start, pause or resume a game, or navigate
+//
+// A navigation is only accepted to an article linked from the game's current
+// page, so each page navigated to is fetched to learn its links.
+func (s *Server) Games(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	id := r.PathValue("id")
+	var (
+		response GameResponse
+		err      error
+	)
+	switch {
+	case id == "":
+		var request CreateGameRequest
+		if err := s.readRequest(w, r, "games", &request); err != nil {
+			return
+		}
+		var (
+			client    ClientInterface
+			challenge leaderboard.Challenge
+		)
+		client, challenge, err = s.checkGame(r.Context(), &request)
+		if err != nil {
+			break
+		}
+		var start, goal page
+		start, err = s.gamePage(r.Context(), client, request.Wiki, request.Profile, request.Start)
+		if err != nil {
+			s.upstreamError(w, client, "games", err, request.Start)
+			return
+		}
+		// The goal is fetched for its canonical subject, so that reaching
+		// it by a redirect is recognised
+		goal, err = s.gamePage(r.Context(), client, request.Wiki, request.Profile, request.Goal)
+		if err != nil {
+			s.upstreamError(w, client, "games", err, request.Goal)
+			return
+		}
+		response, err = s.games.Create(challenge, request.Player, request.Profile, start, goal.canonical)
+		if err == nil {
+			w.Header().Set("Location", api.Prefix+string(Games)+"/"+response.ID)
+			w.WriteHeader(http.StatusCreated)
+		}
+	case r.Method != http.MethodPost:
+		response, err = s.games.Get(id)
+	default:
+		var request MoveRequest
+		if err := s.readRequest(w, r, "games", &request); err != nil {
+			return
+		}
+		if request.Action == MoveNavigate && !strings.HasPrefix(request.Subject, "/wiki/") {
+			s.handleError(w, "games", fmt.Errorf("%w: %s", ErrInvalidSubject, request.Subject), api.CodeInvalidSubject, request)
+			return
+		}
+		var wiki, profile string
+		wiki, profile, err = s.games.Check(id, request.Token, request)
+		if err != nil {
+			break
+		}
+		var target page
+		if request.Action == MoveNavigate {
+			var client ClientInterface
+			client, err = s.wiki(wiki)
+			if err != nil {
+				break
+			}
+			target, err = s.gamePage(r.Context(), client, wiki, profile, request.Subject)
+			if err != nil {
+				s.upstreamError(w, client, "games", err, request.Subject)
+				return
+			}
+		}
+		response, err = s.games.Move(id, request.Token, request, target)
+		if err == nil && request.Action == MoveNavigate && response.State == GameFinished {
+			s.record(r.Context(), id)
+		}
+		if err == nil {
+			s.spectate(response, request.Action)
+		}
+	}
+	if err != nil {
+		s.gameError(w, "games", err, r.URL.Path)
+		return
+	}
+	jason, err := json.Marshal(response)
+	if err != nil {
+		s.handleError(w, "games", err, api.CodeInternal, response)
+		return
+	}
+	w.Write(jason)
+}
+
+// checkGame checks a request to create a game, filling in the start, goal
+// and wiki of a challenge named by its ID, or else the default wiki, and the
+// player's name. It returns the client for the game's wiki and the challenge
+// the game is ranked on.
+func (s *Server) checkGame(ctx context.Context, request *CreateGameRequest) (ClientInterface, leaderboard.Challenge, error) {
+	var challenge leaderboard.Challenge
+	if request.Challenge != "" {
+		var err error
+		challenge, err = s.challenge(ctx, strings.ToLower(request.Challenge))
+		if err != nil {
+			return nil, challenge, err
+		}
+		request.Wiki, request.Start, request.Goal = challenge.Wiki, challenge.Start, challenge.Goal
+	}
+	if !strings.HasPrefix(request.Start, "/wiki/") || !strings.HasPrefix(request.Goal, "/wiki/") {
+		return nil, challenge, fmt.Errorf("%w: start %s or goal %s", ErrInvalidSubject, request.Start, request.Goal)
+	}
+	if normaliseSubject(request.Start) == normaliseSubject(request.Goal) {
+		return nil, challenge, fmt.Errorf("start and goal are both %s", request.Start)
+	}
+	client, err := s.wiki(request.Wiki)
+	if err != nil {
+		return nil, challenge, err
+	}
+	if request.Wiki == "" {
+		request.Wiki = s.options.Wiki
+	}
+	if challenge.ID == "" {
+		challenge = customChallenge(request.Wiki, request.Start, request.Goal)
+	}
+	request.Player = cmp.Or(playerName(request.Player), "anonymous")
+	if request.Profile, _, err = s.profile(request.Profile); err != nil {
+		return nil, challenge, err
+	}
+	return client, challenge, nil
+}
+
+// playerName returns a player's name as it is shown to others: trimmed, and
+// truncated if it is too long
+func playerName(name string) string {
+	name = strings.TrimSpace(name)
+	if runes := []rune(name); len(runes) > maxPlayerName {
+		name = strings.TrimSpace(string(runes[:maxPlayerName]))
+	}
+	return name
+}
+
+// challenge returns the challenge with an ID: a daily, or a custom pair
+// which has been finished at least once
+func (s *Server) challenge(ctx context.Context, id string) (leaderboard.Challenge, error) {
+	if date, found := strings.CutPrefix(id, string(leaderboard.Daily)+"-"); found {
+		daily, err := s.daily.Get(ctx, date)
+		if err != nil {
+			return leaderboard.Challenge{}, err
+		}
+		return dailyChallenge(daily), nil
+	}
+	return s.store.Challenge(ctx, id)
+}
+
+// record adds a finished game to the leaderboard of its challenge. A game
+// which cannot be recorded is still finished, so the failure is only logged.
+func (s *Server) record(ctx context.Context, id string) {
+	challenge, score, err := s.games.Score(id)
+	if err == nil {
+		err = s.store.Record(ctx, challenge, score)
+	}
+	if err != nil {
+		logger.Error("finished game not recorded", "id", id, "error", err.Error())
+	}
+}
+
+// Leaderboards is the handler for the /api/leaderboards REST endpoint:
+//
+//	GET /api/leaderboards/{challenge}   the finished games of a challenge
+//
+// The games are ranked by the order query parameter, clicks (the default)
+// or time, and paged by the offset and limit parameters.
+func (s *Server) Leaderboards(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	id := r.PathValue("challenge")
+
+	query := r.URL.Query()
+	response := LeaderboardResponse{
+		Order:  leaderboard.Ranking(cmp.Or(query.Get("order"), string(leaderboard.ByClicks))),
+		Limit:  defaultLeaderboardLimit,
+		Scores: []RankedScore{},
+	}
+	if response.Order != leaderboard.ByClicks && response.Order != leaderboard.ByTime {
+		s.handleError(w, "leaderboards", fmt.Errorf("unknown order '%s'", response.Order), api.CodeInvalidRequest, r.URL.RawQuery)
+		return
+	}
+	for _, param := range []struct {
+		name  string
+		value *int
+		most  int
+	}{
+		{"offset", &response.Offset, math.MaxInt},
+		{"limit", &response.Limit, maxLeaderboardLimit},
+	} {
+		if text := query.Get(param.name); text != "" {
+			n, err := strconv.Atoi(text)
+			if err != nil || n < 0 || n > param.most {
+				s.handleError(w, "leaderboards", fmt.Errorf("invalid %s '%s'", param.name, text), api.CodeInvalidRequest, r.URL.RawQuery)
+				return
+			}
+			*param.value = n
+		}
+	}
+
+	var err error
+	response.Challenge, err = s.challenge(r.Context(), id)
+	if err != nil {
+		s.gameError(w, "leaderboards", err, id)
+		return
+	}
+	scores, total, err := s.store.Leaderboard(r.Context(), id, response.Order, response.Offset, response.Limit)
+	switch {
+	case errors.Is(err, ErrChallengeNotFound):
+		// A daily which nobody has finished yet
+	case err != nil:
+		s.handleError(w, "leaderboards", err, api.CodeInternal, id)
+		return
+	}
+	response.Total = total
+	for i, score := range scores {
+		response.Scores = append(response.Scores, RankedScore{Rank: response.Offset + i + 1, Score: score})
+	}
+	jason, err := json.Marshal(response)
+	if err != nil {
+		s.handleError(w, "leaderboards", err, api.CodeInternal, response)
+		return
+	}
+	w.Write(jason)
+}
+
+// OpenAPI is the handler for the /api/v1/openapi.json REST endpoint, which
+// describes the REST API as an OpenAPI 3 document
+func (s *Server) OpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	jason, err := json.Marshal(s.spec)
+	if err != nil {
+		s.handleError(w, "openapi", err, api.CodeInternal, nil)
+		return
+	}
+	w.Write(jason)
+}
+
+// Rooms is the handler for the /api/rooms REST endpoints:
+//
+//	POST /api/rooms                create a race room
+//	GET  /api/rooms/{code}         describe a room
+//
+// Players join a room, and race in it, over the WebSocket at /rooms/{code}.
+func (s *Server) Rooms(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	code := strings.ToUpper(r.PathValue("code"))
+
+	var (
+		response RoomResponse
+		err      error
+	)
+	if code == "" {
+		var request CreateRoomRequest
+		if err := s.readRequest(w, r, "rooms", &request); err != nil {
+			return
+		}
+		request.End = cmp.Or(request.End, RoomEndFirst)
+		if request.End != RoomEndFirst && request.End != RoomEndAll {
+			s.handleError(w, "rooms", fmt.Errorf("unknown end '%s'", request.End), api.CodeInvalidRequest, request)
+			return
+		}
+		game := CreateGameRequest{Start: request.Start, Goal: request.Goal, Wiki: request.Wiki, Challenge: request.Challenge, Profile: request.Profile}
+		var (
+			client    ClientInterface
+			challenge leaderboard.Challenge
+		)
+		client, challenge, err = s.checkGame(r.Context(), &game)
+		if err == nil {
+			var start, goal page
+			start, err = s.gamePage(r.Context(), client, game.Wiki, game.Profile, game.Start)
+			if err != nil {
+				s.upstreamError(w, client, "rooms", err, game.Start)
+				return
+			}
+			goal, err = s.gamePage(r.Context(), client, game.Wiki, game.Profile, game.Goal)
+			if err != nil {
+				s.upstreamError(w, client, "rooms", err, game.Goal)
+				return
+			}
+			response, err = s.rooms.Create(s.ctx, challenge, request.End, game.Profile, start, goal.canonical)
+		}
+		if err == nil {
+			w.Header().Set("Location", api.Prefix+string(Rooms)+"/"+response.Code)
+			w.WriteHeader(http.StatusCreated)
+		}
+	} else {
+		var room *room
+		room, err = s.rooms.Get(code)
+		if err == nil {
+			response = *room.snapshot.Load()
+		}
+	}
+	if err != nil {
+		s.gameError(w, "rooms", err, r.URL.Path)
+		return
+	}
+	jason, err := json.Marshal(response)
+	if err != nil {
+		s.handleError(w, "rooms", err, api.CodeInternal, response)
+		return
+	}
+	w.Write(jason)
+}
+
+// RoomSocket is the handler for the WebSocket of a race room:
+//
+//	GET /rooms/{code}?player={name}[&token={token}]
+//
+// The player presenting the token issued when the room was created is its
+// host. Each message from a player is a RoomRequest, and each message to
+// them a RoomEvent.
+func (s *Server) RoomSocket(w http.ResponseWriter, r *http.Request) {
+	code := strings.ToUpper(strings.Trim(strings.TrimPrefix(r.URL.Path, "/rooms"), "/"))
+	room, err := s.rooms.Get(code)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		s.gameError(w, "rooms", err, r.URL.Path)
+		return
+	}
+	name := playerName(r.URL.Query().Get("player"))
+	if name == "" {
+		w.Header().Set("Content-Type", "application/json")
+		s.handleError(w, "rooms", errors.New("a player name is needed to join a room"), api.CodeInvalidRequest, r.URL.Path)
+		return
+	}
+	s.rooms.wg.Add(1)
+	defer s.rooms.wg.Done()
+	websocket.Server{
+		Handshake: sameOrigin,
+		Handler: func(ws *websocket.Conn) {
+			s.race(ws, room, name, r.URL.Query().Get("token"))
+		},
+	}.ServeHTTP(w, r)
+}
+
+// sameOrigin refuses a WebSocket opened by a page served by another site.
+// A client which is not a browser sends no Origin, and is accepted.
+func sameOrigin(config *websocket.Config, r *http.Request) error {
+	origin, err := websocket.Origin(config, r)
+	if err != nil {
+		return err
+	}
+	if origin != nil && origin.Host != r.Host {
+		return fmt.Errorf("origin %s not allowed", origin.Host)
+	}
+	return nil
+}
+
+// readRequest reads the JSON body of a request into v, reporting any
+// failure to the SPA
+func (s *Server) readRequest(w http.ResponseWriter, r *http.Request, function string, v any) error {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		s.handleError(w, function, err, api.CodeInternal, string(body))
+		return err
+	}
+	err = json.Unmarshal(body, v)
+	if err != nil {
+		s.handleError(w, function, err, api.CodeInvalidRequest, string(body))
+	}
+	return err
+}
+
 // Settings is the handler for the /api/settings REST endpoint
 func (s *Server) Settings(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
@@ -128,10 +898,93 @@ func (s *Server) Settings(w http.ResponseWriter, r *http.Request) {
 	response := SettingsResponse{
 		LogLevel: logger.Level(),
 		TraceIDs: logger.TraceIDs(),
+		Wiki:     s.options.Wiki,
+		Wikis:    slices.Sorted(maps.Keys(s.wikis)),
+	}
+	if s.options.Wiki != "" {
+		response.Wikis = append([]string{s.options.Wiki}, response.Wikis...)
 	}
 	jason, err := json.Marshal(response)
 	if err != nil {
-		s.handleError(w, "settings", err, http.StatusInternalServerError, response)
+		s.handleError(w, "settings", err, api.CodeInternal, response)
+		return
+	}
+	w.Write(jason)
+}
+
+// Solve is the handler for the /api/solve REST endpoint, which finds the
+// shortest paths between the start and goal query parameters. With
+// stream=true the response is newline-delimited JSON: a SolveEvent for each
+// level of the search and a last one with the result or the error.
+func (s *Server) Solve(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	query := r.URL.Query()
+	response := SolveResponse{
+		Wiki:  query.Get("wiki"),
+		Start: query.Get("start"),
+		Goal:  query.Get("goal"),
+	}
+	if !strings.HasPrefix(response.Start, "/wiki/") || !strings.HasPrefix(response.Goal, "/wiki/") {
+		err := fmt.Errorf("%w: start %s or goal %s", ErrInvalidSubject, response.Start, response.Goal)
+		s.handleError(w, "solve", err, api.CodeInvalidSubject, response)
+		return
+	}
+	client, err := s.wiki(response.Wiki)
+	if err != nil {
+		s.handleError(w, "solve", err, api.CodeInvalidRequest, response.Wiki)
+		return
+	}
+	if response.Wiki == "" {
+		response.Wiki = s.options.Wiki
+	}
+	response.Start, response.Goal = normaliseSubject(response.Start), normaliseSubject(response.Goal)
+
+	options := s.options.Solver
+	stream := query.Get("stream") == "true"
+	encoder := json.NewEncoder(w)
+	flusher, _ := w.(http.Flusher)
+	if stream {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		options.Progress = func(p solver.Progress) {
+			encoder.Encode(SolveEvent{Progress: &SolveProgress{
+				Direction: string(p.Direction),
+				Depth:     p.Depth,
+				Expanded:  p.Expanded,
+				Forward:   p.Forward,
+				Backward:  p.Backward,
+				ElapsedMS: p.Elapsed.Milliseconds(),
+			}})
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+	}
+
+	result, err := solver.Solve(r.Context(), wikiGraph{client: client, namespaces: s.namespaces(response.Wiki)}, response.Start, response.Goal, options)
+	response.Expanded, response.ElapsedMS = result.Expanded, result.Elapsed.Milliseconds()
+	if err != nil {
+		logger.TraceID("solve", "failed", "start", response.Start, "goal", response.Goal, "expanded", result.Expanded, "error", err.Error())
+		switch {
+		case stream:
+			encoder.Encode(SolveEvent{Error: err.Error()})
+		case errors.Is(err, solver.ErrNoPath):
+			s.handleError(w, "solve", err, api.CodeNoPath, response)
+		case errors.Is(err, solver.ErrBudgetExhausted):
+			s.handleError(w, "solve", err, api.CodeBudgetExhausted, response)
+		default:
+			s.upstreamError(w, client, "solve", err, response)
+		}
+		return
+	}
+	response.Paths, response.Length = result.Paths, result.Length
+	logger.TraceID("solve", "solved", "start", response.Start, "goal", response.Goal, "length", result.Length, "expanded", result.Expanded)
+	if stream {
+		encoder.Encode(SolveEvent{Result: &response})
+		return
+	}
+	jason, err := json.Marshal(response)
+	if err != nil {
+		s.handleError(w, "solve", err, api.CodeInternal, response)
 		return
 	}
 	w.Write(jason)
@@ -153,12 +1006,47 @@ func (s *Server) SPAFile(w http.ResponseWriter, r *http.Request) {
 func (s *Server) SpecialRandom(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	response := SpecialRandomResponse{
-		Start: s.client.GetRandom(),
-		Goal:  s.client.GetRandom(),
+		Wiki: r.URL.Query().Get("wiki"),
+	}
+	client, err := s.wiki(response.Wiki)
+	if err != nil {
+		s.handleError(w, "specialrandom", err, api.CodeInvalidRequest, response.Wiki)
+		return
+	}
+	if response.Wiki == "" {
+		response.Wiki = s.options.Wiki
+	}
+	response.Start, err = client.GetRandom(r.Context())
+	if err == nil {
+		response.Goal, err = client.GetRandom(r.Context())
+	}
+	if err != nil {
+		s.upstreamError(w, client, "specialrandom", err, response)
+		return
+	}
+	jason, err := json.Marshal(response)
+	if err != nil {
+		s.handleError(w, "specialrandom", err, api.CodeInternal, response)
+		return
+	}
+	w.Write(jason)
+}
+
+// Status is the handler for the /api/status REST endpoint
+func (s *Server) Status(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	response := StatusResponse{
+		Upstream: clientStatus(s.client),
+	}
+	if len(s.wikis) > 0 {
+		response.Wikis = make(map[string]ClientStatus, len(s.wikis))
+		for name, client := range s.wikis {
+			response.Wikis[name] = clientStatus(client)
+		}
 	}
 	jason, err := json.Marshal(response)
 	if err != nil {
-		s.handleError(w, "specialrandom", err, http.StatusInternalServerError, response)
+		s.handleError(w, "status", err, api.CodeInternal, response)
 		return
 	}
 	w.Write(jason)
@@ -169,51 +1057,105 @@ func (s *Server) WikiPage(w http.ResponseWriter, r *http.Request) {
 	// Extract the subject from the POST requst
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
-		s.handleError(w, "wikipage", err, http.StatusInternalServerError, string(body))
+		s.handleError(w, "wikipage", err, api.CodeInternal, string(body))
 		return
 	}
 	var request WikiPageRequest
 	err = json.Unmarshal(body, &request)
 	if err != nil {
-		s.handleError(w, "wikipage", err, http.StatusBadRequest, string(body))
+		s.handleError(w, "wikipage", err, api.CodeInvalidRequest, string(body))
 		return
 	}
 	// All wiki page subjects must begin with "/wiki/"
 	if !strings.HasPrefix(request.Subject, "/wiki/") {
-		err := fmt.Errorf("invalid subject: %s", request.Subject)
-		s.handleError(w, "wikipage", err, http.StatusBadRequest, request.Subject)
+		err := fmt.Errorf("%w: %s", ErrInvalidSubject, request.Subject)
+		s.handleError(w, "wikipage", err, api.CodeInvalidSubject, request.Subject)
+		return
+	}
+
+	if request.Event != "" {
+		request.Event, err = eventCode(request.Event)
+		if err != nil {
+			s.handleError(w, "wikipage", err, api.CodeInvalidRequest, request.Event)
+			return
+		}
+	}
+
+	// A player in a game may only be served its current page, with the
+	// game's profile
+	if request.Game != "" {
+		wiki, current, profile, err := s.games.Current(strings.ToLower(request.Game), request.Token)
+		if err == nil && normaliseSubject(request.Subject) != normaliseSubject(current) {
+			err = &MoveError{From: current, To: request.Subject, Reason: "not the current page"}
+		}
+		if err != nil {
+			s.gameError(w, "wikipage", err, request.Subject)
+			return
+		}
+		request.Wiki, request.Profile = wiki, profile
+	}
+	_, profile, err := s.profile(request.Profile)
+	if err != nil {
+		s.handleError(w, "wikipage", err, api.CodeInvalidRequest, request.Profile)
+		return
+	}
+
+	client, err := s.wiki(request.Wiki)
+	if err != nil {
+		s.handleError(w, "wikipage", err, api.CodeInvalidRequest, request.Wiki)
 		return
 	}
 
 	// Fetch the wiki page for the requested aubject
-	pg, _, err := s.client.Get(request.Subject)
+	pg, _, err := client.Get(r.Context(), request.Subject)
 	if err != nil {
-		s.handleError(w, "wikipage", err, http.StatusNotFound, request.Subject)
+		s.upstreamError(w, client, "wikipage", err, request.Subject)
 		return
 	}
 
 	// Extract the page body
-	page, err := s.extractBody(pg)
+	page, err := s.extractBody(pg, request.Wiki, profile)
 	if err != nil {
-		s.handleError(w, "wikipage", err, http.StatusInternalServerError, request.Subject)
+		s.handleError(w, "wikipage", err, api.CodeInternal, request.Subject)
 		return
 	}
+	page.Title = cmp.Or(page.Title, s.namespaces(request.Wiki).Normalise(request.Subject))
+	page.DisplayTitle = cmp.Or(page.DisplayTitle, strings.ReplaceAll(page.Title, "_", " "))
+	s.spectatePage(request)
 
-	w.Header().Set("Content-Type", "text/html")
-	w.Write(page)
+	// The page's canonical title, which follows any redirect, is given as
+	// its location so that a frontend can compare it with the goal. A
+	// client which prefers JSON is sent the page with its metadata.
+	w.Header().Set("Content-Location", (&url.URL{Path: title.Path(page.Title)}).EscapedPath())
+	w.Header().Set("Vary", "Accept")
+	if !api.PrefersJSON(r.Header.Get("Accept")) {
+		w.Header().Set("Content-Type", api.MediaTypeHTML)
+		w.Write([]byte(page.HTML))
+		return
+	}
+	jason, err := json.Marshal(page)
+	if err != nil {
+		s.handleError(w, "wikipage", err, api.CodeInternal, request.Subject)
+		return
+	}
+	w.Header().Set("Content-Type", api.MediaTypeJSON)
+	w.Write(jason)
 }
 
-// extractBody extracts the HTML from the <body> of a page
-func (s *Server) extractBody(page []byte) ([]byte, error) {
+// extractBody extracts the HTML from the <body> of a page of a wiki, cleaned
+// up by the cleaner of a profile unless that is nil, with what the page
+// gives of its metadata. The canonical and display titles are empty if the
+// page does not give them.
+func (s *Server) extractBody(page []byte, wiki string, profile *cleaner) (api.Page, error) {
 	// Quick check for the presence of a body tag. This is not foolproof but
 	// catches simple cases where a page is not a full HTML document.
 	if !bytes.Contains(bytes.ToLower(page), []byte("<body")) {
-		return nil, fmt.Errorf("no <body> tag found in html")
+		return api.Page{}, fmt.Errorf("no <body> tag found in html")
 	}
 
 	doc, err := html.Parse(bytes.NewReader(page))
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse html: %w", err)
+		return api.Page{}, fmt.Errorf("failed to parse html: %w", err)
 	}
 
 	var body *html.Node
@@ -235,24 +1177,84 @@ func (s *Server) extractBody(page []byte) ([]byte, error) {
 	if body == nil {
 		// This is unlikely to be reached because html.Parse adds a body tag,
 		// but we'll keep it for safety.
-		return nil, fmt.Errorf("no <body> tag found in html (after parsing)")
+		return api.Page{}, fmt.Errorf("no <body> tag found in html (after parsing)")
 	}
 
+	ns := s.namespaces(wiki)
+	extracted := api.Page{
+		Version:      api.PageVersion,
+		Title:        strings.TrimPrefix(links.Canonical(doc, ns), title.Prefix),
+		Revision:     metadata.Revision(doc, page),
+		DisplayTitle: metadata.DisplayTitle(doc),
+		Links:        []string{},
+	}
+
+	if s.sanitizer != nil {
+		s.sanitizer.Clean(body)
+	}
+	profile.clean(body)
+	// The moves are the links which the profile leaves on the page
+	for link := range links.Outbound(body, ns) {
+		extracted.Links = append(extracted.Links, strings.TrimPrefix(link, title.Prefix))
+	}
+	slices.Sort(extracted.Links)
+	uploadHost := ""
+	if s.upload != nil {
+		uploadHost = s.options.UploadHost
+	}
+	links.Annotate(body, ns, uploadHost, s.assets(wiki))
+	extracted.Sections = metadata.Sections(body)
+
 	var buf bytes.Buffer
 	for c := body.FirstChild; c != nil; c = c.NextSibling {
 		err := html.Render(&buf, c)
 		if err != nil {
-			return nil, fmt.Errorf("failed to render html: %w", err)
+			return api.Page{}, fmt.Errorf("failed to render html: %w", err)
 		}
 	}
-	return buf.Bytes(), nil
+	extracted.HTML = buf.String()
+	return extracted, nil
 }
 
-// WikipediaFile serves static files from Wikipedia
+// UploadFile serves images from the media host, so that a page's images
+// are fetched from the same origin as the page
+func (s *Server) UploadFile(w http.ResponseWriter, r *http.Request) {
+	if s.upload == nil {
+		s.handleError(w, "upload", fmt.Errorf("no such resource: %s", r.URL.Path), api.CodeNotFound, r.URL.Path)
+		return
+	}
+	path := strings.TrimPrefix(r.URL.RequestURI(), "/upload")
+	body, contentType, err := s.upload.Get(r.Context(), path)
+	if err != nil {
+		s.upstreamError(w, s.upload, "upload", err, path)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Write(body)
+}
+
+// WikipediaFile serves static files from Wikipedia. Those of the default
+// wiki are served at their own paths, and those of any other below the
+// prefix which assets gives it, so that each is fetched from, and cached
+// by, the client of its own wiki.
 func (s *Server) WikipediaFile(w http.ResponseWriter, r *http.Request) {
-	body, contentType, err := s.client.Get(r.URL.Path)
+	client, path := s.client, r.URL.Path
+	if rest, found := strings.CutPrefix(path, "/wikis/"); found {
+		name, file, _ := strings.Cut(rest, "/")
+		path = "/" + file
+		var err error
+		client, err = s.wiki(name)
+		if err == nil && !strings.HasPrefix(path, "/w/") && !strings.HasPrefix(path, "/static/") {
+			err = fmt.Errorf("no such resource: %s", r.URL.Path)
+		}
+		if err != nil {
+			s.handleError(w, "static", err, api.CodeNotFound, r.URL.Path)
+			return
+		}
+	}
+	body, contentType, err := client.Get(r.Context(), path)
 	if err != nil {
-		s.handleError(w, "static", err, http.StatusNotFound, r.URL.Path)
+		s.upstreamError(w, client, "static", err, path)
 		return
 	}
 	w.Header().Set("Content-Type", contentType)
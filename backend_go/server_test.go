@@ -2,17 +2,25 @@ package wrserver
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/bruceesmith/terminator"
+	"github.com/bruceesmith/wrspa/backend/wrserver/api"
 	"github.com/bruceesmith/wrspa/backend/wrserver/mocks"
+	"github.com/bruceesmith/wrspa/backend/wrserver/sanitize"
 	"go.uber.org/mock/gomock"
 )
 
@@ -83,7 +91,9 @@ func TestAPI(t *testing.T) {
 		method         string
 		function       string
 		body           any
+		accept         string
 		statusCode     int
+		code           api.ErrorCode
 		expectedHeader map[string]string
 		mockSetup      func()
 	}{
@@ -101,10 +111,27 @@ func TestAPI(t *testing.T) {
 			statusCode:     http.StatusOK,
 			expectedHeader: map[string]string{"Content-Type": "application/json"},
 			mockSetup: func() {
-				mockClient.EXPECT().GetRandom().Return("start")
-				mockClient.EXPECT().GetRandom().Return("goal")
+				mockClient.EXPECT().GetRandom(gomock.Any()).Return("start", nil)
+				mockClient.EXPECT().GetRandom(gomock.Any()).Return("goal", nil)
 			},
 		},
+		{
+			name:       "specialrandom circuit open",
+			method:     http.MethodGet,
+			function:   "specialrandom",
+			statusCode: http.StatusServiceUnavailable,
+			code:       api.CodeUpstreamUnavailable,
+			mockSetup: func() {
+				mockClient.EXPECT().GetRandom(gomock.Any()).Return("", ErrCircuitOpen)
+			},
+		},
+		{
+			name:           "status",
+			method:         http.MethodGet,
+			function:       "status",
+			statusCode:     http.StatusOK,
+			expectedHeader: map[string]string{"Content-Type": "application/json"},
+		},
 		{
 			name:           "wikipage",
 			method:         http.MethodPost,
@@ -113,7 +140,19 @@ func TestAPI(t *testing.T) {
 			statusCode:     http.StatusOK,
 			expectedHeader: map[string]string{"Content-Type": "text/html"},
 			mockSetup: func() {
-				mockClient.EXPECT().Get("/wiki/test").Return([]byte("<html><body><p>test</p></body></html>"), "text/html", nil)
+				mockClient.EXPECT().Get(gomock.Any(), "/wiki/test").Return([]byte("<html><body><p>test</p></body></html>"), "text/html", nil)
+			},
+		},
+		{
+			name:           "wikipage json",
+			method:         http.MethodPost,
+			function:       "wikipage",
+			body:           WikiPageRequest{Subject: "/wiki/test"},
+			accept:         "application/json",
+			statusCode:     http.StatusOK,
+			expectedHeader: map[string]string{"Content-Type": "application/json", "Vary": "Accept", "Content-Location": "/wiki/Test"},
+			mockSetup: func() {
+				mockClient.EXPECT().Get(gomock.Any(), "/wiki/test").Return([]byte("<html><body><p>test</p></body></html>"), "text/html", nil)
 			},
 		},
 		{
@@ -122,6 +161,7 @@ func TestAPI(t *testing.T) {
 			function:   "wikipage",
 			body:       WikiPageRequest{Subject: "test"},
 			statusCode: http.StatusBadRequest,
+			code:       api.CodeInvalidSubject,
 		},
 		{
 			name:       "wikipage read body error",
@@ -136,6 +176,7 @@ func TestAPI(t *testing.T) {
 			function:   "wikipage",
 			body:       "not json",
 			statusCode: http.StatusBadRequest,
+			code:       api.CodeInvalidRequest,
 		},
 		{
 			name:       "wikipage client get error",
@@ -143,8 +184,32 @@ func TestAPI(t *testing.T) {
 			function:   "wikipage",
 			body:       WikiPageRequest{Subject: "/wiki/test"},
 			statusCode: http.StatusNotFound,
+			code:       api.CodeUpstreamNotFound,
+			mockSetup: func() {
+				mockClient.EXPECT().Get(gomock.Any(), "/wiki/test").Return(nil, "", &UpstreamError{StatusCode: http.StatusNotFound, Status: "404 Not Found"})
+			},
+		},
+		{
+			name:       "wikipage upstream failure",
+			method:     http.MethodPost,
+			function:   "wikipage",
+			body:       WikiPageRequest{Subject: "/wiki/test"},
+			statusCode: http.StatusBadGateway,
+			code:       api.CodeUpstreamError,
 			mockSetup: func() {
-				mockClient.EXPECT().Get("/wiki/test").Return(nil, "", errors.New("not found"))
+				mockClient.EXPECT().Get(gomock.Any(), "/wiki/test").Return(nil, "", &UpstreamError{StatusCode: http.StatusInternalServerError, Status: "500 Internal Server Error"})
+			},
+		},
+		{
+			name:           "wikipage rate limited",
+			method:         http.MethodPost,
+			function:       "wikipage",
+			body:           WikiPageRequest{Subject: "/wiki/test"},
+			statusCode:     http.StatusServiceUnavailable,
+			code:           api.CodeRateLimited,
+			expectedHeader: map[string]string{"Retry-After": "3"},
+			mockSetup: func() {
+				mockClient.EXPECT().Get(gomock.Any(), "/wiki/test").Return(nil, "", &RateLimitError{Budget: "pages", RetryAfter: 2500 * time.Millisecond})
 			},
 		},
 		{
@@ -154,14 +219,56 @@ func TestAPI(t *testing.T) {
 			body:       WikiPageRequest{Subject: "/wiki/test"},
 			statusCode: http.StatusInternalServerError,
 			mockSetup: func() {
-				mockClient.EXPECT().Get("/wiki/test").Return([]byte("<html></html>"), "text/html", nil)
+				mockClient.EXPECT().Get(gomock.Any(), "/wiki/test").Return([]byte("<html></html>"), "text/html", nil)
 			},
 		},
 		{
-			name:       "bad method",
-			method:     http.MethodDelete,
-			function:   "settings",
-			statusCode: http.StatusOK, // This will be the default status code from the recorder
+			name:           "bad method",
+			method:         http.MethodDelete,
+			function:       "settings",
+			statusCode:     http.StatusMethodNotAllowed,
+			code:           api.CodeMethodNotAllowed,
+			expectedHeader: map[string]string{"Allow": "GET, HEAD, OPTIONS"},
+		},
+		{
+			name:           "get wikipage",
+			method:         http.MethodGet,
+			function:       "wikipage",
+			statusCode:     http.StatusMethodNotAllowed,
+			code:           api.CodeMethodNotAllowed,
+			expectedHeader: map[string]string{"Allow": "POST, OPTIONS"},
+		},
+		{
+			name:       "unknown endpoint",
+			method:     http.MethodGet,
+			function:   "wikipages",
+			statusCode: http.StatusNotFound,
+			code:       api.CodeNotFound,
+		},
+		{
+			name:       "unknown subresource",
+			method:     http.MethodGet,
+			function:   "settings/level",
+			statusCode: http.StatusNotFound,
+			code:       api.CodeNotFound,
+		},
+		{
+			name:           "options",
+			method:         http.MethodOptions,
+			function:       "games/abc",
+			statusCode:     http.StatusNoContent,
+			expectedHeader: map[string]string{"Allow": "GET, HEAD, OPTIONS"},
+		},
+		{
+			name:           "mixed case",
+			method:         http.MethodGet,
+			function:       "SpecialRandom",
+			statusCode:     http.StatusOK,
+			expectedHeader: map[string]string{"Content-Type": "application/json"},
+			mockSetup: func() {
+				mockClient.EXPECT().GetRandom(gomock.Any()).Return("start", nil)
+				mockClient.EXPECT().GetRandom(gomock.Any()).Return("goal", nil)
+			},
 		},
 	}
 
@@ -182,6 +289,9 @@ func TestAPI(t *testing.T) {
 			}
 
 			req := httptest.NewRequest(tt.method, "/api/"+tt.function, body)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
 			w := httptest.NewRecorder()
 
 			s.API(w, req)
@@ -195,18 +305,25 @@ func TestAPI(t *testing.T) {
 					t.Errorf("got header %s: %s, want %s", key, w.Header().Get(key), value)
 				}
 			}
+
+			if tt.code != "" {
+				var failure api.ErrorResponse
+				if err := json.Unmarshal(w.Body.Bytes(), &failure); err != nil || failure.Error.Code != tt.code {
+					t.Errorf("got failure %s, want code %s", w.Body.String(), tt.code)
+				}
+			}
 		})
 	}
 }
 
 func TestExtractBody(t *testing.T) {
-	s := &Server{}
-
 	tests := []struct {
-		name    string
-		html    string
-		expect  string
-		wantErr bool
+		name      string
+		html      string
+		sanitize  bool
+		expect    string
+		canonical string
+		wantErr   bool
 	}{
 		{
 			name:   "simple body",
@@ -228,37 +345,170 @@ func TestExtractBody(t *testing.T) {
 			html:    "<html",
 			wantErr: true,
 		},
+		{
+			name:   "unsanitized",
+			html:   `<html><body><p onclick="go()">Hello</p><script>go()</script></body></html>`,
+			expect: `<p onclick="go()">Hello</p><script>go()</script>`,
+		},
+		{
+			name:     "sanitized",
+			html:     `<html><body><p onclick="go()" class="lead">Hello</p><script>go()</script></body></html>`,
+			sanitize: true,
+			expect:   `<p class="lead">Hello</p>`,
+		},
+		{
+			name:      "redirect",
+			html:      `<html><head><link rel="canonical" href="https://en.wikipedia.org/wiki/United_States"></head><body><p>Hello</p></body></html>`,
+			expect:    "<p>Hello</p>",
+			canonical: "United_States",
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			body, err := s.extractBody([]byte(tt.html))
+			s := &Server{}
+			if tt.sanitize {
+				s.sanitizer = sanitize.New(sanitize.DefaultOptions())
+			}
+			page, err := s.extractBody([]byte(tt.html), "", nil)
 
 			if (err != nil) != tt.wantErr {
 				t.Errorf("extractBody() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
 
-			if !tt.wantErr && string(body) != tt.expect {
-				t.Errorf("extractBody() = %v, want %v", string(body), tt.expect)
+			if !tt.wantErr && (page.HTML != tt.expect || page.Title != tt.canonical) {
+				t.Errorf("extractBody() = %v, %s, want %v, %s", page.HTML, page.Title, tt.expect, tt.canonical)
+			}
+		})
+	}
+}
+
+func TestWikiPageJSON(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	const usa = `<html><head>
+<link rel="canonical" href="https://en.wikipedia.org/wiki/United_States">
+<script>RLCONF={"wgTitle":"United States","wgCurRevisionId":1234568,"wgRevisionId":1234567};</script>
+</head><body>
+<h1 id="firstHeading"><span class="mw-page-title-main">United   States</span></h1>
+<p><a href="/wiki/Washington,_D.C.">Washington</a> <a href="/wiki/File:Flag.svg">flag</a> <a href="/wiki/Canada">Canada</a> <a href="/wiki/canada">Canada</a></p>
+<div class="mw-heading mw-heading2"><h2 id="History">History</h2><span class="mw-editsection">[edit]</span></div>
+<h3><span class="mw-headline" id="Colonial_era">Colonial era</span></h3>
+<h2 id="References">References</h2><p><a href="/wiki/Mexico">Mexico</a></p>
+</body></html>`
+	mockClient := mocks.NewMockClientInterface(ctrl)
+	mockClient.EXPECT().Get(gomock.Any(), gomock.Any()).Return([]byte(usa), "text/html", nil).AnyTimes()
+	s, err := NewServer("8080", "testdata", mockClient)
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		accept string
+		json   bool
+	}{
+		{name: "no Accept", json: false},
+		{name: "anything", accept: "*/*", json: false},
+		{name: "html", accept: "text/html, application/json;q=0.9", json: false},
+		{name: "json", accept: "application/json", json: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, _ := json.Marshal(WikiPageRequest{Subject: "/wiki/USA", Profile: ProfileClassic})
+			req := httptest.NewRequest(http.MethodPost, "/api/wikipage", bytes.NewReader(body))
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			w := httptest.NewRecorder()
+			s.API(w, req)
+			if w.Code != http.StatusOK {
+				t.Fatalf("got status code %d", w.Code)
+			}
+			if got := w.Header().Get("Content-Location"); got != "/wiki/United_States" {
+				t.Errorf("got Content-Location %s", got)
+			}
+			if !tt.json {
+				if got := w.Header().Get("Content-Type"); got != "text/html" || !strings.Contains(w.Body.String(), "<h3>") {
+					t.Errorf("got %s: %s", got, w.Body.String())
+				}
+				return
+			}
+
+			var page api.Page
+			if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			html := page.HTML
+			page.HTML = ""
+			want := api.Page{
+				Version:      api.PageVersion,
+				Title:        "United_States",
+				Revision:     1234567,
+				DisplayTitle: "United States",
+				Links:        []string{"Canada", "Washington,_D.C."},
+				Sections: []api.Section{
+					{Level: 2, Title: "History", Anchor: "History"},
+					{Level: 3, Title: "Colonial era", Anchor: "Colonial_era"},
+				},
+			}
+			if !reflect.DeepEqual(page, want) {
+				t.Errorf("got %+v, want %+v", page, want)
+			}
+			if !strings.Contains(html, `data-wr-target="Canada"`) || strings.Contains(html, "Mexico") {
+				t.Errorf("got html %s", html)
 			}
 		})
 	}
 }
 
-func TestMarshalFailure(t *testing.T) {
-	s := &Server{}
-	json := s.MarshalFailure("test", errors.New("test error"), "test response")
-	if !strings.Contains(json, `"msg": "unable to marshal API response"`) ||
-		!strings.Contains(json, `"function": "test"`) ||
-		!strings.Contains(json, `"error": "test error"`) ||
-		!strings.Contains(json, `"response": "test response"`) {
-		t.Errorf("unexpected json: %s", json)
+func TestHandleError(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		code       api.ErrorCode
+		retryAfter string
+		status     int
+	}{
+		{name: "quotes", err: errors.New(`subject "/wiki/\"Go\"" not found`), code: api.CodeUpstreamNotFound, status: http.StatusNotFound},
+		{name: "control characters", err: errors.New("line\nbreak\t</script>"), code: api.CodeInvalidRequest, status: http.StatusBadRequest},
+		{name: "retry after", err: ErrCircuitOpen, code: api.CodeUpstreamUnavailable, retryAfter: "7", status: http.StatusServiceUnavailable},
+		{name: "unknown code", err: errors.New("boom"), code: "boom", status: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			w.Header().Set(api.HeaderRequestID, "abc-123")
+			if tt.retryAfter != "" {
+				w.Header().Set("Retry-After", tt.retryAfter)
+			}
+			(&Server{}).handleError(w, "test", tt.err, tt.code, `details "quoted"`)
+			if w.Code != tt.status || w.Header().Get("Content-Type") != "application/json" {
+				t.Errorf("got status %d and Content-Type %s", w.Code, w.Header().Get("Content-Type"))
+			}
+			var got api.ErrorResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatalf("invalid json %s: %v", w.Body.String(), err)
+			}
+			want := api.Error{Code: tt.code, Message: tt.err.Error(), Function: "test", RequestID: "abc-123"}
+			if tt.retryAfter != "" {
+				want.RetryAfter = 7
+			}
+			if got.Error != want {
+				t.Errorf("got %+v, want %+v", got.Error, want)
+			}
+		})
 	}
 }
 
 func TestServe(t *testing.T) {
-	s, err := NewServer("8081", "testdata", &Client{})
+	// The dailies are not prepared, since the client never reaches Wikipedia
+	options := DefaultServerOptions()
+	options.Daily.Prepare = false
+	s, err := NewServerWithOptions("8081", "testdata", &Client{}, options)
 	if err != nil {
 		t.Fatalf("failed to create server: %v", err)
 	}
@@ -331,15 +581,16 @@ func TestWikipediaFile(t *testing.T) {
 			statusCode:      http.StatusOK,
 			wantContentType: "image/png",
 			mockSetup: func() {
-				mockClient.EXPECT().Get("/w/test").Return([]byte("test"), "image/png", nil)
+				mockClient.EXPECT().Get(gomock.Any(), "/w/test").Return([]byte("test"), "image/png", nil)
 			},
 		},
 		{
-			name:       "not found",
-			path:       "/w/notfound",
-			statusCode: http.StatusNotFound,
+			name:            "not found",
+			path:            "/w/notfound",
+			statusCode:      http.StatusNotFound,
+			wantContentType: "application/json",
 			mockSetup: func() {
-				mockClient.EXPECT().Get("/w/notfound").Return(nil, "", errors.New("not found"))
+				mockClient.EXPECT().Get(gomock.Any(), "/w/notfound").Return(nil, "", &UpstreamError{StatusCode: http.StatusNotFound, Status: "404 Not Found"})
 			},
 		},
 	}
@@ -368,9 +619,965 @@ func TestWikipediaFile(t *testing.T) {
 	}
 }
 
+func TestUploadFile(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient := mocks.NewMockClientInterface(ctrl)
+	mockUpload := mocks.NewMockClientInterface(ctrl)
+
+	tests := []struct {
+		name            string
+		upload          bool
+		path            string
+		statusCode      int
+		wantContentType string
+		mockSetup       func()
+	}{
+		{
+			name:            "success",
+			upload:          true,
+			path:            "/upload/wikipedia/commons/a/ab/Go.png",
+			statusCode:      http.StatusOK,
+			wantContentType: "image/png",
+			mockSetup: func() {
+				mockUpload.EXPECT().Get(gomock.Any(), "/wikipedia/commons/a/ab/Go.png").Return([]byte("png"), "image/png", nil)
+			},
+		},
+		{
+			name:            "upstream not found",
+			upload:          true,
+			path:            "/upload/wikipedia/commons/missing.png",
+			statusCode:      http.StatusNotFound,
+			wantContentType: "application/json",
+			mockSetup: func() {
+				mockUpload.EXPECT().Get(gomock.Any(), "/wikipedia/commons/missing.png").
+					Return(nil, "", &UpstreamError{StatusCode: http.StatusNotFound, Status: "404 Not Found"})
+			},
+		},
+		{
+			name:            "not proxied",
+			path:            "/upload/wikipedia/commons/a/ab/Go.png",
+			statusCode:      http.StatusNotFound,
+			wantContentType: "application/json",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mockSetup != nil {
+				tt.mockSetup()
+			}
+
+			options := DefaultServerOptions()
+			if tt.upload {
+				options.Upload = mockUpload
+				options.UploadHost = "upload.wikimedia.org"
+			}
+			s, err := NewServerWithOptions("8080", "testdata", mockClient, options)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			w := httptest.NewRecorder()
+
+			s.UploadFile(w, req)
+
+			if w.Code != tt.statusCode {
+				t.Errorf("got status code %d, want %d", w.Code, tt.statusCode)
+			}
+			if w.Header().Get("Content-Type") != tt.wantContentType {
+				t.Errorf("got content type %s, want %s", w.Header().Get("Content-Type"), tt.wantContentType)
+			}
+		})
+	}
+}
+
 // errorReader is a helper type that implements io.Reader and always returns an error.
 type errorReader struct{}
 
 func (errorReader) Read(p []byte) (n int, err error) {
 	return 0, errors.New("forced read error")
 }
+
+func TestWikiPageCoalesced(t *testing.T) {
+	const players = 25
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	release := make(chan struct{})
+	mockClient := mocks.NewMockClientInterface(ctrl)
+	mockClient.EXPECT().Get(gomock.Any(), "/wiki/Start").DoAndReturn(
+		func(ctx context.Context, path string) ([]byte, string, error) {
+			<-release
+			return []byte("<html><body><p>start</p></body></html>"), "text/html", nil
+		},
+	).Times(1)
+
+	svr, err := NewServer("8080", "testdata", mockClient)
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+	s := svr.(*Server)
+
+	var wg sync.WaitGroup
+	for range players {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			body, _ := json.Marshal(WikiPageRequest{Subject: "/wiki/Start"})
+			req := httptest.NewRequest(http.MethodPost, "/api/wikipage", bytes.NewReader(body))
+			w := httptest.NewRecorder()
+			s.WikiPage(w, req)
+			if w.Code != http.StatusOK || w.Body.String() != "<p>start</p>" {
+				t.Errorf("got (%d, %s)", w.Code, w.Body.String())
+			}
+		}()
+	}
+	waitForWaiters(t, s.client.(*coalescer), "/wiki/Start", players)
+	close(release)
+	wg.Wait()
+}
+
+func TestWikis(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	en := mocks.NewMockClientInterface(ctrl)
+	de := mocks.NewMockClientInterface(ctrl)
+	options := DefaultServerOptions()
+	options.Wiki = "en"
+	options.Wikis = map[string]ClientInterface{"de": de}
+	s, err := NewServerWithOptions("8080", "testdata", en, options)
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		method     string
+		target     string
+		body       any
+		statusCode int
+		want       string
+		mockSetup  func()
+	}{
+		{
+			name:       "specialrandom default wiki",
+			method:     http.MethodGet,
+			target:     "/api/specialrandom",
+			statusCode: http.StatusOK,
+			want:       `{"start":"/wiki/A","goal":"/wiki/B","wiki":"en"}`,
+			mockSetup: func() {
+				en.EXPECT().GetRandom(gomock.Any()).Return("/wiki/A", nil)
+				en.EXPECT().GetRandom(gomock.Any()).Return("/wiki/B", nil)
+			},
+		},
+		{
+			name:       "specialrandom selected wiki",
+			method:     http.MethodGet,
+			target:     "/api/specialrandom?wiki=de",
+			statusCode: http.StatusOK,
+			want:       `{"start":"/wiki/Anfang","goal":"/wiki/Ziel","wiki":"de"}`,
+			mockSetup: func() {
+				de.EXPECT().GetRandom(gomock.Any()).Return("/wiki/Anfang", nil)
+				de.EXPECT().GetRandom(gomock.Any()).Return("/wiki/Ziel", nil)
+			},
+		},
+		{
+			name:       "specialrandom wiki not allowed",
+			method:     http.MethodGet,
+			target:     "/api/specialrandom?wiki=fr",
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "wikipage selected wiki",
+			method:     http.MethodPost,
+			target:     "/api/wikipage",
+			body:       WikiPageRequest{Subject: "/wiki/Berlin", Wiki: "de"},
+			statusCode: http.StatusOK,
+			want:       "<p>Berlin</p>",
+			mockSetup: func() {
+				de.EXPECT().Get(gomock.Any(), "/wiki/Berlin").Return([]byte("<html><body><p>Berlin</p></body></html>"), "text/html", nil)
+			},
+		},
+		{
+			name:       "wikipage default wiki by name",
+			method:     http.MethodPost,
+			target:     "/api/wikipage",
+			body:       WikiPageRequest{Subject: "/wiki/Berlin", Wiki: "en"},
+			statusCode: http.StatusOK,
+			want:       "<p>Berlin</p>",
+			mockSetup: func() {
+				en.EXPECT().Get(gomock.Any(), "/wiki/Berlin").Return([]byte("<html><body><p>Berlin</p></body></html>"), "text/html", nil)
+			},
+		},
+		{
+			name:       "wikipage wiki not allowed",
+			method:     http.MethodPost,
+			target:     "/api/wikipage",
+			body:       WikiPageRequest{Subject: "/wiki/Berlin", Wiki: "ja"},
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "settings lists the wikis",
+			method:     http.MethodGet,
+			target:     "/api/settings",
+			statusCode: http.StatusOK,
+			want:       `"wiki":"en","wikis":["en","de"]`,
+		},
+		{
+			name:       "status of each wiki",
+			method:     http.MethodGet,
+			target:     "/api/status",
+			statusCode: http.StatusOK,
+			want:       `"wikis":{"de":{"breaker":`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mockSetup != nil {
+				tt.mockSetup()
+			}
+			var body io.Reader
+			if tt.body != nil {
+				bodyBytes, _ := json.Marshal(tt.body)
+				body = bytes.NewReader(bodyBytes)
+			}
+			req := httptest.NewRequest(tt.method, tt.target, body)
+			w := httptest.NewRecorder()
+
+			s.API(w, req)
+
+			if w.Code != tt.statusCode {
+				t.Errorf("got status code %d, want %d", w.Code, tt.statusCode)
+			}
+			if !strings.Contains(w.Body.String(), tt.want) {
+				t.Errorf("got body %s, want it to contain %s", w.Body.String(), tt.want)
+			}
+		})
+	}
+}
+
+// TestWikisAssets checks that the files of a page of a wiki other than the
+// default are fetched from that wiki
+func TestWikisAssets(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	en := mocks.NewMockClientInterface(ctrl)
+	de := mocks.NewMockClientInterface(ctrl)
+	options := DefaultServerOptions()
+	options.Wiki = "en"
+	options.Wikis = map[string]ClientInterface{"de": de}
+	svr, err := NewServerWithOptions("8080", "testdata", en, options)
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+	handler := svr.(*Server).server.Handler
+	page := []byte(`<html><body><img src="/static/images/logo.png"><a href="/w/index.php?action=edit">edit</a></body></html>`)
+
+	tests := []struct {
+		name       string
+		method     string
+		target     string
+		body       any
+		statusCode int
+		want       string
+		mockSetup  func()
+	}{
+		{
+			name:       "page of the default wiki",
+			method:     http.MethodPost,
+			target:     "/api/wikipage",
+			body:       WikiPageRequest{Subject: "/wiki/Berlin"},
+			statusCode: http.StatusOK,
+			want:       `<img src="/static/images/logo.png"/>`,
+			mockSetup: func() {
+				en.EXPECT().Get(gomock.Any(), "/wiki/Berlin").Return(page, "text/html", nil)
+			},
+		},
+		{
+			name:       "page of another wiki",
+			method:     http.MethodPost,
+			target:     "/api/wikipage",
+			body:       WikiPageRequest{Subject: "/wiki/Berlin", Wiki: "de"},
+			statusCode: http.StatusOK,
+			want:       `<img src="/wikis/de/static/images/logo.png"/><a href="/w/index.php?action=edit"`,
+			mockSetup: func() {
+				de.EXPECT().Get(gomock.Any(), "/wiki/Berlin").Return(page, "text/html", nil)
+			},
+		},
+		{
+			name:       "file of the default wiki",
+			method:     http.MethodGet,
+			target:     "/static/images/logo.png",
+			statusCode: http.StatusOK,
+			want:       "en logo",
+			mockSetup: func() {
+				en.EXPECT().Get(gomock.Any(), "/static/images/logo.png").Return([]byte("en logo"), "image/png", nil)
+			},
+		},
+		{
+			name:       "file of another wiki",
+			method:     http.MethodGet,
+			target:     "/wikis/de/w/load.php",
+			statusCode: http.StatusOK,
+			want:       "de styles",
+			mockSetup: func() {
+				de.EXPECT().Get(gomock.Any(), "/w/load.php").Return([]byte("de styles"), "text/css", nil)
+			},
+		},
+		{
+			name:       "file of a wiki not allowed",
+			method:     http.MethodGet,
+			target:     "/wikis/fr/static/images/logo.png",
+			statusCode: http.StatusNotFound,
+			want:       string(api.CodeNotFound),
+		},
+		{
+			name:       "page below the files of a wiki",
+			method:     http.MethodGet,
+			target:     "/wikis/de/wiki/Berlin",
+			statusCode: http.StatusNotFound,
+			want:       string(api.CodeNotFound),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mockSetup != nil {
+				tt.mockSetup()
+			}
+			var body io.Reader
+			if tt.body != nil {
+				bodyBytes, _ := json.Marshal(tt.body)
+				body = bytes.NewReader(bodyBytes)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(tt.method, tt.target, body))
+			if w.Code != tt.statusCode {
+				t.Errorf("got status code %d, want %d", w.Code, tt.statusCode)
+			}
+			if !strings.Contains(w.Body.String(), tt.want) {
+				t.Errorf("got body %s, want it to contain %s", w.Body.String(), tt.want)
+			}
+		})
+	}
+}
+
+// TestWikisRetryAfter checks that the retry time of a failure comes from the
+// breaker of the wiki which failed, not that of the default wiki
+func TestWikisRetryAfter(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer upstream.Close()
+	clientOptions := DefaultClientOptions()
+	clientOptions.Retries = 0
+	clientOptions.Breaker = BreakerOptions{FailureThreshold: 1, OpenTimeout: time.Minute}
+	de := NewClientWithOptions(upstream.URL, clientOptions)
+	de.Get(context.Background(), "/wiki/Berlin")
+
+	options := DefaultServerOptions()
+	options.Wiki = "en"
+	options.Wikis = map[string]ClientInterface{"de": de}
+	s, err := NewServerWithOptions("8080", "testdata", mocks.NewMockClientInterface(ctrl), options)
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	bodyBytes, _ := json.Marshal(WikiPageRequest{Subject: "/wiki/Berlin", Wiki: "de"})
+	w := httptest.NewRecorder()
+	s.API(w, httptest.NewRequest(http.MethodPost, "/api/wikipage", bytes.NewReader(bodyBytes)))
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("got status code %d, want %d", w.Code, http.StatusServiceUnavailable)
+	}
+	if retryAfter, _ := strconv.Atoi(w.Header().Get("Retry-After")); retryAfter < 1 || retryAfter > 60 {
+		t.Errorf("got Retry-After %s, want the open timeout of the breaker of de", w.Header().Get("Retry-After"))
+	}
+}
+
+func TestGamesAPI(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	pages := map[string]string{
+		"/wiki/Start": `<html><body><a href="/wiki/A">A</a><a href="/wiki/Goal">Goal</a></body></html>`,
+		"/wiki/A":     `<html><body><a href="/wiki/Start">Start</a></body></html>`,
+		"/wiki/Goal":  `<html><body><p>goal</p></body></html>`,
+	}
+	mockClient := mocks.NewMockClientInterface(ctrl)
+	mockClient.EXPECT().Get(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, path string) ([]byte, string, error) {
+			if page, found := pages[path]; found {
+				return []byte(page), "text/html", nil
+			}
+			return nil, "", &UpstreamError{StatusCode: http.StatusNotFound, Status: "404 Not Found"}
+		},
+	).AnyTimes()
+
+	svr, err := NewServer("8080", "testdata", mockClient)
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+	s := svr.(*Server)
+
+	call := func(method, target string, body any) *httptest.ResponseRecorder {
+		var reader io.Reader
+		if body != nil {
+			bodyBytes, _ := json.Marshal(body)
+			reader = bytes.NewReader(bodyBytes)
+		}
+		w := httptest.NewRecorder()
+		s.API(w, httptest.NewRequest(method, target, reader))
+		return w
+	}
+
+	w := call(http.MethodPost, "/api/v1/games", CreateGameRequest{Start: "/wiki/Start", Goal: "/wiki/Goal"})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("got status code %d creating a game: %s", w.Code, w.Body.String())
+	}
+	var game GameResponse
+	json.Unmarshal(w.Body.Bytes(), &game)
+	if game.ID == "" || game.Token == "" || game.State != GameReady || w.Header().Get("Location") != "/api/v1/games/"+game.ID {
+		t.Fatalf("unexpected game %+v at %s", game, w.Header().Get("Location"))
+	}
+	moves := "/api/v1/games/" + game.ID + "/moves"
+	token := game.Token
+
+	tests := []struct {
+		name       string
+		method     string
+		target     string
+		body       any
+		statusCode int
+		state      GameState
+	}{
+		{
+			name:       "create with a bad goal",
+			method:     http.MethodPost,
+			target:     "/api/games",
+			body:       CreateGameRequest{Start: "/wiki/Start", Goal: "Goal"},
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "create with the same start and goal",
+			method:     http.MethodPost,
+			target:     "/api/games",
+			body:       CreateGameRequest{Start: "/wiki/Start", Goal: "/wiki/Start"},
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "create on a wiki which is not allowed",
+			method:     http.MethodPost,
+			target:     "/api/games",
+			body:       CreateGameRequest{Start: "/wiki/Start", Goal: "/wiki/Goal", Wiki: "de"},
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "create starting from a missing page",
+			method:     http.MethodPost,
+			target:     "/api/games",
+			body:       CreateGameRequest{Start: "/wiki/Missing", Goal: "/wiki/Goal"},
+			statusCode: http.StatusNotFound,
+		},
+		{
+			name:       "get",
+			method:     http.MethodGet,
+			target:     "/api/games/" + game.ID,
+			statusCode: http.StatusOK,
+			state:      GameReady,
+		},
+		{
+			name:       "navigate before starting",
+			method:     http.MethodPost,
+			target:     moves,
+			body:       MoveRequest{Token: token, Action: MoveNavigate, Subject: "/wiki/A"},
+			statusCode: http.StatusConflict,
+		},
+		{
+			name:       "start without the token",
+			method:     http.MethodPost,
+			target:     moves,
+			body:       MoveRequest{Action: MoveStart},
+			statusCode: http.StatusForbidden,
+		},
+		{
+			name:       "start",
+			method:     http.MethodPost,
+			target:     moves,
+			body:       MoveRequest{Token: token, Action: MoveStart},
+			statusCode: http.StatusOK,
+			state:      GamePlaying,
+		},
+		{
+			name:       "navigate to a bad subject",
+			method:     http.MethodPost,
+			target:     moves,
+			body:       MoveRequest{Token: token, Action: MoveNavigate, Subject: "A"},
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "navigate to a page which is not linked",
+			method:     http.MethodPost,
+			target:     moves,
+			body:       MoveRequest{Token: token, Action: MoveNavigate, Subject: "/wiki/B"},
+			statusCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "serve the current page",
+			method:     http.MethodPost,
+			target:     "/api/wikipage",
+			body:       WikiPageRequest{Subject: "/wiki/Start", Game: game.ID, Token: token},
+			statusCode: http.StatusOK,
+		},
+		{
+			name:       "serve another page",
+			method:     http.MethodPost,
+			target:     "/api/wikipage",
+			body:       WikiPageRequest{Subject: "/wiki/Goal", Game: game.ID, Token: token},
+			statusCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "serve the current page without the token",
+			method:     http.MethodPost,
+			target:     "/api/wikipage",
+			body:       WikiPageRequest{Subject: "/wiki/Start", Game: game.ID},
+			statusCode: http.StatusForbidden,
+		},
+		{
+			name:       "navigate to the goal",
+			method:     http.MethodPost,
+			target:     "/api/Games/" + strings.ToUpper(game.ID) + "/Moves",
+			body:       MoveRequest{Token: token, Action: MoveNavigate, Subject: "/wiki/Goal"},
+			statusCode: http.StatusOK,
+			state:      GameFinished,
+		},
+		{
+			name:       "unknown game",
+			method:     http.MethodGet,
+			target:     "/api/games/unknown",
+			statusCode: http.StatusNotFound,
+		},
+		{
+			name:       "unknown resource",
+			method:     http.MethodGet,
+			target:     "/api/games/" + game.ID + "/players",
+			statusCode: http.StatusNotFound,
+		},
+		{
+			name:       "wrong method",
+			method:     http.MethodGet,
+			target:     moves,
+			statusCode: http.StatusMethodNotAllowed,
+		},
+		{
+			name:       "bad move body",
+			method:     http.MethodPost,
+			target:     moves,
+			body:       "not json",
+			statusCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := call(tt.method, tt.target, tt.body)
+			if w.Code != tt.statusCode {
+				t.Errorf("got status code %d, want %d: %s", w.Code, tt.statusCode, w.Body.String())
+			}
+			if tt.state != "" {
+				var got GameResponse
+				json.Unmarshal(w.Body.Bytes(), &got)
+				if got.State != tt.state {
+					t.Errorf("got state %s, want %s", got.State, tt.state)
+				}
+			}
+		})
+	}
+}
+
+func TestSolveAPI(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	pages := map[string]string{
+		"/wiki/Start": `<html><body><a href="/wiki/A">A</a><a href="/wiki/B">B</a></body></html>`,
+		"/wiki/A":     `<html><body><a href="/wiki/Goal">Goal</a></body></html>`,
+		"/wiki/B":     `<html><body><a href="/wiki/Goal">Goal</a></body></html>`,
+	}
+	backlinks := map[string]string{
+		"Goal|": `{"query":{"backlinks":[{"title":"A"},{"title":"B"}]}}`,
+	}
+	client := testWiki(ctrl, pages, backlinks)
+	options := DefaultServerOptions()
+	options.Wiki = "en"
+	svr, err := NewServerWithOptions("8080", "testdata", client, options)
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+	options.Solver.MaxDepth = 1
+	shallow, err := NewServerWithOptions("8080", "testdata", client, options)
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		server     ServerInterface
+		query      string
+		statusCode int
+		paths      [][]string
+	}{
+		{
+			name:       "solved",
+			query:      "start=/wiki/Start&goal=/wiki/Goal",
+			statusCode: http.StatusOK,
+			paths:      [][]string{{"/wiki/Start", "/wiki/A", "/wiki/Goal"}, {"/wiki/Start", "/wiki/B", "/wiki/Goal"}},
+		},
+		{
+			name:       "no path",
+			query:      "start=/wiki/Goal&goal=/wiki/Start",
+			statusCode: http.StatusNotFound,
+		},
+		{
+			name:       "depth budget exhausted",
+			server:     shallow,
+			query:      "start=/wiki/Start&goal=/wiki/Goal",
+			statusCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "invalid start",
+			query:      "start=Start&goal=/wiki/Goal",
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "wiki not allowed",
+			query:      "start=/wiki/Start&goal=/wiki/Goal&wiki=de",
+			statusCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := tt.server
+			if server == nil {
+				server = svr
+			}
+			w := httptest.NewRecorder()
+			server.API(w, httptest.NewRequest(http.MethodGet, "/api/solve?"+tt.query, nil))
+			if w.Code != tt.statusCode {
+				t.Fatalf("got status code %d, want %d: %s", w.Code, tt.statusCode, w.Body.String())
+			}
+			if tt.paths != nil {
+				var got SolveResponse
+				json.Unmarshal(w.Body.Bytes(), &got)
+				if !reflect.DeepEqual(got.Paths, tt.paths) || got.Length != 2 || got.Wiki != "en" {
+					t.Errorf("got %+v, want paths %v", got, tt.paths)
+				}
+			}
+		})
+	}
+
+	t.Run("streamed", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		svr.API(w, httptest.NewRequest(http.MethodGet, "/api/solve?start=/wiki/Start&goal=/wiki/Goal&stream=true", nil))
+		if w.Header().Get("Content-Type") != "application/x-ndjson" {
+			t.Errorf("got content type %s", w.Header().Get("Content-Type"))
+		}
+		lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+		var events []SolveEvent
+		for _, line := range lines {
+			var event SolveEvent
+			if err := json.Unmarshal([]byte(line), &event); err != nil {
+				t.Fatalf("line %q is not JSON: %v", line, err)
+			}
+			events = append(events, event)
+		}
+		last := events[len(events)-1]
+		if len(events) < 2 || events[0].Progress == nil || last.Result == nil || len(last.Result.Paths) != 2 {
+			t.Errorf("got events %s", w.Body.String())
+		}
+	})
+}
+
+func TestDailyAPI(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	pages := map[string]string{
+		"/wiki/Start": `<html><body><a href="/wiki/Goal">Goal</a></body></html>`,
+	}
+	backlinks := map[string]string{
+		"Goal|": `{"query":{"backlinks":[{"title":"Start"}]}}`,
+	}
+	pool := filepath.Join(t.TempDir(), "pool.yml")
+	os.WriteFile(pool, []byte("pairs:\n  - start: /wiki/Start\n    goal: /wiki/Goal\n"), 0o644)
+	options := DefaultServerOptions()
+	options.Wiki = "en"
+	options.Daily.Pool = pool
+	svr, err := NewServerWithOptions("8080", "testdata", testWiki(ctrl, pages, backlinks), options)
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+	svr.(*Server).daily.now = func() time.Time { return time.Date(2026, 10, 17, 9, 0, 0, 0, time.UTC) }
+	today := DailyResponse{Date: "2026-10-17", Challenge: "daily-2026-10-17", Wiki: "en", Start: "/wiki/Start", Goal: "/wiki/Goal", Length: 1}
+
+	tests := []struct {
+		name       string
+		path       string
+		statusCode int
+		want       any
+	}{
+		{
+			name:       "today",
+			path:       "/api/daily",
+			statusCode: http.StatusOK,
+			want:       today,
+		},
+		{
+			name:       "today by date",
+			path:       "/api/daily?date=2026-10-17",
+			statusCode: http.StatusOK,
+			want:       today,
+		},
+		{
+			name:       "history",
+			path:       "/api/daily/history",
+			statusCode: http.StatusOK,
+			want:       DailyHistoryResponse{Dailies: []DailyResponse{today}},
+		},
+		{
+			name:       "tomorrow",
+			path:       "/api/daily?date=2026-10-18",
+			statusCode: http.StatusNotFound,
+		},
+		{
+			name:       "forgotten date",
+			path:       "/api/daily?date=2026-10-16",
+			statusCode: http.StatusNotFound,
+		},
+		{
+			name:       "invalid date",
+			path:       "/api/daily?date=yesterday",
+			statusCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			svr.API(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if w.Code != tt.statusCode {
+				t.Fatalf("got status code %d, want %d: %s", w.Code, tt.statusCode, w.Body.String())
+			}
+			if tt.want != nil {
+				got := reflect.New(reflect.TypeOf(tt.want))
+				json.Unmarshal(w.Body.Bytes(), got.Interface())
+				if !reflect.DeepEqual(got.Elem().Interface(), tt.want) {
+					t.Errorf("got %+v, want %+v", got.Elem().Interface(), tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestLeaderboardsAPI(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	pages := map[string]string{
+		"/wiki/Start": `<html><body><a href="/wiki/A">A</a><a href="/wiki/Goal">Goal</a></body></html>`,
+		"/wiki/A":     `<html><body><a href="/wiki/Start">Start</a></body></html>`,
+		"/wiki/Goal":  `<html><body><p>goal</p></body></html>`,
+	}
+	backlinks := map[string]string{
+		"Goal|": `{"query":{"backlinks":[{"title":"Start"}]}}`,
+	}
+	pool := filepath.Join(t.TempDir(), "pool.yml")
+	os.WriteFile(pool, []byte("pairs:\n  - start: /wiki/Start\n    goal: /wiki/Goal\n"), 0o644)
+	options := DefaultServerOptions()
+	options.Wiki = "en"
+	options.Daily.Pool = pool
+	svr, err := NewServerWithOptions("8080", "testdata", testWiki(ctrl, pages, backlinks), options)
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+	s := svr.(*Server)
+	now := time.Date(2026, 10, 17, 9, 0, 0, 0, time.UTC)
+	s.daily.now = func() time.Time { return now }
+	s.games.now = func() time.Time { return now }
+
+	call := func(method, target string, body any) *httptest.ResponseRecorder {
+		var reader io.Reader
+		if body != nil {
+			bodyBytes, _ := json.Marshal(body)
+			reader = bytes.NewReader(bodyBytes)
+		}
+		w := httptest.NewRecorder()
+		s.API(w, httptest.NewRequest(method, target, reader))
+		return w
+	}
+	// play finishes a game, taking seconds over each move of the path
+	play := func(request CreateGameRequest, seconds int, path ...string) GameResponse {
+		t.Helper()
+		var game GameResponse
+		json.Unmarshal(call(http.MethodPost, "/api/games", request).Body.Bytes(), &game)
+		moves := "/api/games/" + game.ID + "/moves"
+		call(http.MethodPost, moves, MoveRequest{Token: game.Token, Action: MoveStart})
+		for _, subject := range path {
+			now = now.Add(time.Duration(seconds) * time.Second)
+			json.Unmarshal(call(http.MethodPost, moves, MoveRequest{Token: game.Token, Action: MoveNavigate, Subject: subject}).Body.Bytes(), &game)
+		}
+		if game.State != GameFinished {
+			t.Fatalf("game %+v not finished", game)
+		}
+		return game
+	}
+
+	// Nobody has finished today's daily yet
+	w := call(http.MethodGet, "/api/leaderboards/daily-2026-10-17", nil)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"total":0,"scores":[]`) {
+		t.Errorf("got %d: %s for an unplayed daily", w.Code, w.Body.String())
+	}
+
+	custom := CreateGameRequest{Start: "/wiki/Start", Goal: "/wiki/Goal", Player: "ann"}
+	game := play(custom, 60, "/wiki/Goal")
+	if want := customChallenge("en", "/wiki/Start", "/wiki/Goal").ID; game.Challenge != want || game.Player != "ann" {
+		t.Errorf("got challenge %s for %s, want %s for ann", game.Challenge, game.Player, want)
+	}
+	custom.Player = "  bob with a name far too long for the leaderboard  "
+	play(custom, 1, "/wiki/A", "/wiki/Start", "/wiki/Goal")
+	game = play(CreateGameRequest{Challenge: "Daily-2026-10-17", Start: "/wiki/A", Goal: "/wiki/B"}, 5, "/wiki/Goal")
+	if game.Challenge != "daily-2026-10-17" || game.Player != "anonymous" {
+		t.Errorf("got challenge %s for %s, want the daily for anonymous", game.Challenge, game.Player)
+	}
+	bob := "bob with a name far too long for"
+
+	leaderboards := "/api/leaderboards/" + customChallenge("en", "/wiki/Start", "/wiki/Goal").ID
+	tests := []struct {
+		name       string
+		method     string
+		target     string
+		statusCode int
+		total      int
+		ranks      []int
+		players    []string
+	}{
+		{
+			name:       "by clicks",
+			method:     http.MethodGet,
+			target:     leaderboards,
+			statusCode: http.StatusOK,
+			total:      2,
+			ranks:      []int{1, 2},
+			players:    []string{"ann", bob},
+		},
+		{
+			name:       "by time",
+			method:     http.MethodGet,
+			target:     leaderboards + "?order=time",
+			statusCode: http.StatusOK,
+			total:      2,
+			ranks:      []int{1, 2},
+			players:    []string{bob, "ann"},
+		},
+		{
+			name:       "second page",
+			method:     http.MethodGet,
+			target:     leaderboards + "?offset=1&limit=1",
+			statusCode: http.StatusOK,
+			total:      2,
+			ranks:      []int{2},
+			players:    []string{bob},
+		},
+		{
+			name:       "daily",
+			method:     http.MethodGet,
+			target:     "/api/leaderboards/DAILY-2026-10-17",
+			statusCode: http.StatusOK,
+			total:      1,
+			ranks:      []int{1},
+			players:    []string{"anonymous"},
+		},
+		{
+			name:       "unknown order",
+			method:     http.MethodGet,
+			target:     leaderboards + "?order=fastest",
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "limit too large",
+			method:     http.MethodGet,
+			target:     leaderboards + "?limit=1000",
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "negative offset",
+			method:     http.MethodGet,
+			target:     leaderboards + "?offset=-1",
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "unknown challenge",
+			method:     http.MethodGet,
+			target:     "/api/leaderboards/custom-0123456789abcdef",
+			statusCode: http.StatusNotFound,
+		},
+		{
+			name:       "future daily",
+			method:     http.MethodGet,
+			target:     "/api/leaderboards/daily-2026-10-18",
+			statusCode: http.StatusNotFound,
+		},
+		{
+			name:       "no challenge",
+			method:     http.MethodGet,
+			target:     "/api/leaderboards",
+			statusCode: http.StatusNotFound,
+		},
+		{
+			name:       "wrong method",
+			method:     http.MethodPost,
+			target:     leaderboards,
+			statusCode: http.StatusMethodNotAllowed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := call(tt.method, tt.target, nil)
+			if w.Code != tt.statusCode {
+				t.Fatalf("got status code %d, want %d: %s", w.Code, tt.statusCode, w.Body.String())
+			}
+			if tt.statusCode != http.StatusOK {
+				return
+			}
+			var got LeaderboardResponse
+			json.Unmarshal(w.Body.Bytes(), &got)
+			var ranks []int
+			var players []string
+			for _, score := range got.Scores {
+				ranks = append(ranks, score.Rank)
+				players = append(players, score.Player)
+			}
+			if got.Total != tt.total || !reflect.DeepEqual(ranks, tt.ranks) || !reflect.DeepEqual(players, tt.players) {
+				t.Errorf("got %d scores ranked %v for %v, want %d ranked %v for %v", got.Total, ranks, players, tt.total, tt.ranks, tt.players)
+			}
+		})
+	}
+
+	// A game which cannot be recorded is still finished
+	store := mocks.NewMockStore(ctrl)
+	store.EXPECT().Record(gomock.Any(), customChallenge("en", "/wiki/Start", "/wiki/Goal"), gomock.Any()).Return(errors.New("disk full"))
+	s.store = store
+	play(CreateGameRequest{Start: "/wiki/Start", Goal: "/wiki/Goal"}, 1, "/wiki/Goal")
+}
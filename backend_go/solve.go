@@ -0,0 +1,168 @@
+package wrserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bruceesmith/wrspa/backend/wrserver/solver"
+	"github.com/bruceesmith/wrspa/backend/wrserver/title"
+	"github.com/urfave/cli/v3"
+)
+
+// backlinkBatches bounds the backlinks fetched for one article, each batch
+// holding up to 500. A search through an article with more backlinks may
+// miss a path through the rest.
+const backlinkBatches = 10
+
+// wikiGraph is the solver.Graph of a wiki. Its pages are fetched through the
+// wiki's client, so they are cached and rate limited like those served to
+// players.
+type wikiGraph struct {
+	client     ClientInterface
+	namespaces title.Namespaces
+}
+
+// backlinksResponse is the part of a MediaWiki list=backlinks query used by
+// wikiGraph. A redirect to the article is listed with the pages linking to
+// the redirect.
+type backlinksResponse struct {
+	Continue map[string]string `json:"continue"`
+	Query    struct {
+		Backlinks []struct {
+			Title      string `json:"title"`
+			Redirect   bool   `json:"redirect"`
+			RedirLinks []struct {
+				Title string `json:"title"`
+			} `json:"redirlinks"`
+		} `json:"backlinks"`
+	} `json:"query"`
+	Error *struct {
+		Code string `json:"code"`
+		Info string `json:"info"`
+	} `json:"error"`
+}
+
+// Links fetches an article's page; an article which does not exist has no
+// links
+func (g wikiGraph) Links(ctx context.Context, article string) (string, []string, error) {
+	p, err := pageLinks(ctx, g.client, g.namespaces, (&url.URL{Path: article}).EscapedPath())
+	var ue *UpstreamError
+	if errors.As(err, &ue) && ue.StatusCode == http.StatusNotFound {
+		return article, nil, nil
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	return p.canonical, slices.Sorted(maps.Keys(p.links)), nil
+}
+
+// Backlinks queries the MediaWiki API for the articles linking to an article
+func (g wikiGraph) Backlinks(ctx context.Context, article string) ([]string, error) {
+	query := url.Values{
+		"action":        {"query"},
+		"format":        {"json"},
+		"formatversion": {"2"},
+		"list":          {"backlinks"},
+		"bltitle":       {strings.ReplaceAll(strings.TrimPrefix(article, "/wiki/"), "_", " ")},
+		"blnamespace":   {"0"},
+		"bllimit":       {"max"},
+		"blredirect":    {"1"},
+	}
+	var sources []string
+	add := func(title string) {
+		if subject := "/wiki/" + strings.ReplaceAll(title, " ", "_"); g.namespaces.IsArticle(subject) {
+			sources = append(sources, subject)
+		}
+	}
+	for range backlinkBatches {
+		body, _, err := g.client.Get(ctx, "/w/api.php?"+query.Encode())
+		if err != nil {
+			return nil, err
+		}
+		var response backlinksResponse
+		if err := json.Unmarshal(body, &response); err != nil {
+			return nil, fmt.Errorf("unable to parse backlinks of %s: %w", article, err)
+		}
+		if response.Error != nil {
+			return nil, fmt.Errorf("unable to query backlinks of %s: %s: %s", article, response.Error.Code, response.Error.Info)
+		}
+		for _, link := range response.Query.Backlinks {
+			if !link.Redirect {
+				add(link.Title)
+			}
+			for _, redirLink := range link.RedirLinks {
+				add(redirLink.Title)
+			}
+		}
+		if len(response.Continue) == 0 {
+			break
+		}
+		for key, value := range response.Continue {
+			query.Set(key, value)
+		}
+	}
+	return sources, nil
+}
+
+// solveSubject turns an article given on the command line, either as a title
+// such as "Go (programming language)" or as a subject such as /wiki/Go, into
+// a subject normalised by the namespaces of its wiki
+func solveSubject(ns title.Namespaces, article string) string {
+	if !strings.HasPrefix(article, "/wiki/") {
+		article = "/wiki/" + article
+	}
+	return ns.Path(article)
+}
+
+// PrintSolution is the action for the "solve" subcommand. It prints the
+// shortest paths between the two articles given as arguments, reporting the
+// progress of the search on standard error.
+func PrintSolution(ctx context.Context, cmd *cli.Command) error {
+	if cmd.Args().Len() != 2 {
+		return fmt.Errorf("expected a start and a goal article, got %d arguments", cmd.Args().Len())
+	}
+	cfg, err := mergeConfig(cmd)
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+	if err = cfg.validate(false); err != nil {
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
+	cfg.configureLogging()
+
+	wiki := cfg.wikis()[0]
+	client, closer, err := cfg.client(wiki)
+	if err != nil {
+		return err
+	}
+	defer closer()
+
+	ns := wikiNamespaces(ctx, client, wiki.Name)
+	start, goal := solveSubject(ns, cmd.Args().Get(0)), solveSubject(ns, cmd.Args().Get(1))
+	options := cfg.solverOptions()
+	options.Progress = func(p solver.Progress) {
+		fmt.Fprintf(cmd.Root().ErrWriter, "%s search to depth %d: %d articles fetched, %d reached from the start and %d from the goal in %s\n",
+			p.Direction, p.Depth, p.Expanded, p.Forward, p.Backward, p.Elapsed.Round(time.Millisecond))
+	}
+	result, err := solver.Solve(ctx, wikiGraph{client: client, namespaces: ns}, start, goal, options)
+	if err != nil {
+		return fmt.Errorf("unable to solve %s to %s on %s after fetching %d articles: %w", start, goal, wiki.Name, result.Expanded, err)
+	}
+	fmt.Fprintf(cmd.Root().Writer, "%d optimal paths of %d links from %s to %s on %s\n", len(result.Paths), result.Length, start, goal, wiki.Name)
+	for _, path := range result.Paths {
+		titles := make([]string, len(path))
+		for i, subject := range path {
+			titles[i] = strings.ReplaceAll(strings.TrimPrefix(subject, "/wiki/"), "_", " ")
+		}
+		fmt.Fprintln(cmd.Root().Writer, strings.Join(titles, " → "))
+	}
+	return nil
+}
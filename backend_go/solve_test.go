@@ -0,0 +1,114 @@
+package wrserver
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bruceesmith/wrspa/backend/wrserver/mocks"
+	"go.uber.org/mock/gomock"
+)
+
+// testWiki returns a mock client serving pages, and backlinks in batches
+// keyed by the title and continuation of the backlinks query
+func testWiki(ctrl *gomock.Controller, pages map[string]string, backlinks map[string]string) *mocks.MockClientInterface {
+	client := mocks.NewMockClientInterface(ctrl)
+	client.EXPECT().Get(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, path string) ([]byte, string, error) {
+			if query, found := strings.CutPrefix(path, "/w/api.php?"); found {
+				values, _ := url.ParseQuery(query)
+				if batch, found := backlinks[values.Get("bltitle")+"|"+values.Get("blcontinue")]; found {
+					return []byte(batch), "application/json", nil
+				}
+				return []byte(`{"query":{"backlinks":[]}}`), "application/json", nil
+			}
+			if page, found := pages[path]; found {
+				return []byte(page), "text/html", nil
+			}
+			return nil, "", &UpstreamError{StatusCode: http.StatusNotFound, Status: "404 Not Found"}
+		},
+	).AnyTimes()
+	return client
+}
+
+func TestWikiGraph(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	pages := map[string]string{
+		"/wiki/Go":          `<html><body><a href="/wiki/Robert_Griesemer">R</a><a href="/wiki/Ken_Thompson">K</a></body></html>`,
+		"/wiki/Golang":      `<html><head><link rel="canonical" href="https://en.wikipedia.org/wiki/Go"></head><body><a href="/wiki/Ken_Thompson">K</a></body></html>`,
+		"/wiki/Caf%C3%A9":   `<html><body><a href="/wiki/Coffee">C</a></body></html>`,
+		"/wiki/What%3F_Now": `<html><body></body></html>`,
+	}
+	backlinks := map[string]string{
+		"Go|": `{"continue":{"blcontinue":"0|2","continue":"-||"},"query":{"backlinks":[` +
+			`{"pageid":1,"ns":0,"title":"Gopher"},` +
+			`{"pageid":2,"ns":0,"title":"Golang","redirect":true,"redirlinks":[{"pageid":3,"ns":0,"title":"Rob Pike"}]}]}}`,
+		"Go|0|2":   `{"query":{"backlinks":[{"pageid":4,"ns":0,"title":"Unix shell"}]}}`,
+		"Broken|":  `{"error":{"code":"invalidtitle","info":"Bad title"}}`,
+		"Garbage|": `not json`,
+	}
+	g := wikiGraph{client: testWiki(ctrl, pages, backlinks)}
+	ctx := context.Background()
+
+	links := []struct {
+		article   string
+		canonical string
+		links     []string
+	}{
+		{"/wiki/Go", "/wiki/Go", []string{"/wiki/Ken_Thompson", "/wiki/Robert_Griesemer"}},
+		{"/wiki/Golang", "/wiki/Go", []string{"/wiki/Ken_Thompson"}},
+		{"/wiki/Café", "/wiki/Café", []string{"/wiki/Coffee"}},
+		{"/wiki/What?_Now", "/wiki/What?_Now", nil},
+		{"/wiki/Missing", "/wiki/Missing", nil},
+	}
+	for _, tt := range links {
+		canonical, got, err := g.Links(ctx, tt.article)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.article, err)
+		}
+		if canonical != tt.canonical || !reflect.DeepEqual(got, tt.links) {
+			t.Errorf("%s: got %s linking to %v, want %s linking to %v", tt.article, canonical, got, tt.canonical, tt.links)
+		}
+	}
+
+	got, err := g.Backlinks(ctx, "/wiki/Go")
+	if want := []string{"/wiki/Gopher", "/wiki/Rob_Pike", "/wiki/Unix_shell"}; err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("got backlinks %v and error %v, want %v", got, err, want)
+	}
+	for _, article := range []string{"/wiki/Broken", "/wiki/Garbage"} {
+		if _, err := g.Backlinks(ctx, article); err == nil {
+			t.Errorf("%s: expected an error, got nil", article)
+		}
+	}
+
+	failing := mocks.NewMockClientInterface(ctrl)
+	failing.EXPECT().Get(gomock.Any(), gomock.Any()).Return(nil, "", ErrCircuitOpen).Times(2)
+	g = wikiGraph{client: failing}
+	if _, _, err := g.Links(ctx, "/wiki/Go"); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("got %v, want ErrCircuitOpen", err)
+	}
+	if _, err := g.Backlinks(ctx, "/wiki/Go"); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("got %v, want ErrCircuitOpen", err)
+	}
+}
+
+func TestSolveSubject(t *testing.T) {
+	tests := map[string]string{
+		"Go":                        "/wiki/Go",
+		"Go (programming language)": "/wiki/Go_(programming_language)",
+		"/wiki/Caf%C3%A9":           "/wiki/Café",
+		"/wiki/Go#History":          "/wiki/Go",
+		"Robert_Griesemer":          "/wiki/Robert_Griesemer",
+	}
+	for article, want := range tests {
+		if got := solveSubject(nil, article); got != want {
+			t.Errorf("%s: got %s, want %s", article, got, want)
+		}
+	}
+}
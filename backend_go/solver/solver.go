@@ -0,0 +1,356 @@
+/*
+Package solver finds the shortest paths between two articles of a wiki by a
+bidirectional breadth-first search: forwards from the start over the links
+on each page, and backwards from the goal over the pages linking to it.
+
+The search is bounded by the length of the paths it looks for, by the number
+of articles whose links it fetches and by time, so that a request for an
+unsolvable or very distant pair of articles cannot run away with the
+upstream budget.
+*/
+package solver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrNoPath is returned when the search has reached every article
+	// connected to the start or the goal without finding a path
+	ErrNoPath = errors.New("no path exists")
+	// ErrBudgetExhausted matches any *BudgetError
+	ErrBudgetExhausted = errors.New("search budget exhausted")
+)
+
+// BudgetError is returned when the search gives up before finding a path
+type BudgetError struct {
+	Budget string // One of "depth", "nodes" or "time"
+	Limit  any
+}
+
+func (e *BudgetError) Error() string {
+	return fmt.Sprintf("%s: %s limit of %v reached", ErrBudgetExhausted.Error(), e.Budget, e.Limit)
+}
+
+func (e *BudgetError) Is(target error) bool {
+	return target == ErrBudgetExhausted
+}
+
+// Graph gives the links between the articles of a wiki
+type Graph interface {
+	// Links returns the canonical name of an article, which differs from
+	// article if it is a redirect, and the articles it links to
+	Links(ctx context.Context, article string) (canonical string, links []string, err error)
+	// Backlinks returns the articles which link to an article, directly or
+	// through a redirect
+	Backlinks(ctx context.Context, article string) ([]string, error)
+}
+
+// Direction is the side of the search which was expanded
+type Direction string
+
+const (
+	Forward  Direction = "forward"  // From the start over outgoing links
+	Backward Direction = "backward" // From the goal over incoming links
+)
+
+// Progress describes the search after one side has been expanded by a level
+type Progress struct {
+	Direction Direction
+	Depth     int           // Length of the paths explored so far, over both sides
+	Expanded  int           // Articles whose links have been fetched
+	Forward   int           // Articles reached from the start
+	Backward  int           // Articles reached backwards from the goal
+	Elapsed   time.Duration // Time since the search started
+}
+
+// Options bounds a search
+type Options struct {
+	MaxDepth    int            // Longest path searched for, in links followed
+	MaxNodes    int            // Articles whose links may be fetched
+	Timeout     time.Duration  // Time allowed for the search; zero is unlimited
+	MaxPaths    int            // Optimal paths returned, at most
+	Concurrency int            // Articles whose links are fetched at once
+	Progress    func(Progress) // Called after each level of the search, if set
+}
+
+// DefaultOptions returns the Options used when none are given
+func DefaultOptions() Options {
+	return Options{
+		MaxDepth:    6,
+		MaxNodes:    2000,
+		Timeout:     time.Minute,
+		MaxPaths:    10,
+		Concurrency: 4,
+	}
+}
+
+// Result is the outcome of a search
+type Result struct {
+	Paths    [][]string    // Optimal paths, each from the start to the goal
+	Length   int           // Links followed by each path
+	Expanded int           // Articles whose links were fetched
+	Elapsed  time.Duration // Time taken by the search
+}
+
+// side is one half of the search. next holds, for each article reached,
+// the neighbours one step closer to the side's root: its parents for the
+// forward side and the articles it links towards the goal for the backward
+// side.
+type side struct {
+	direction Direction
+	dist      map[string]int
+	next      map[string][]string
+	frontier  []string
+	depth     int
+}
+
+// newSide returns a side which has reached only its root
+func newSide(direction Direction, root string) *side {
+	return &side{
+		direction: direction,
+		dist:      map[string]int{root: 0},
+		next:      map[string][]string{root: nil},
+		frontier:  []string{root},
+	}
+}
+
+// reach records that article is dist steps from the side's root through
+// neighbour, reporting whether it had not been reached before
+func (sd *side) reach(article string, dist int, neighbour string) bool {
+	d, found := sd.dist[article]
+	switch {
+	case !found:
+		sd.dist[article] = dist
+		sd.next[article] = []string{neighbour}
+		return true
+	case dist < d:
+		// A redirect's target found nearer than it was first reached
+		sd.dist[article] = dist
+		sd.next[article] = []string{neighbour}
+	case d == dist && !slices.Contains(sd.next[article], neighbour):
+		sd.next[article] = append(sd.next[article], neighbour)
+	}
+	return false
+}
+
+// search is the state of one call to Solve
+type search struct {
+	graph    Graph
+	options  Options
+	forward  *side
+	backward *side
+	aliases  map[string]string // Redirects met by the forward side, to their targets
+	expanded int
+	started  time.Time
+}
+
+// Solve searches for the shortest paths from start to goal. The paths are
+// optimal over the links which Graph reports; a link to a redirect is
+// counted as a link to its target once the redirect has been fetched. On
+// failure the Result still reports the effort spent.
+func Solve(ctx context.Context, graph Graph, start, goal string, options Options) (Result, error) {
+	s := &search{
+		graph:    graph,
+		options:  options,
+		forward:  newSide(Forward, start),
+		backward: newSide(Backward, goal),
+		aliases:  make(map[string]string),
+		started:  time.Now(),
+	}
+	if start == goal {
+		return s.result([][]string{{start}}, 0), nil
+	}
+	if options.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, options.Timeout, &BudgetError{Budget: "time", Limit: options.Timeout})
+		defer cancel()
+	}
+
+	for {
+		if len(s.forward.frontier) == 0 || len(s.backward.frontier) == 0 {
+			return s.result(nil, 0), ErrNoPath
+		}
+		if s.forward.depth+s.backward.depth >= options.MaxDepth {
+			return s.result(nil, 0), &BudgetError{Budget: "depth", Limit: options.MaxDepth}
+		}
+		sd := s.forward
+		if len(s.backward.frontier) < len(s.forward.frontier) {
+			sd = s.backward
+		}
+		if s.expanded+len(sd.frontier) > options.MaxNodes {
+			return s.result(nil, 0), &BudgetError{Budget: "nodes", Limit: options.MaxNodes}
+		}
+
+		err := s.expand(ctx, sd)
+		if err != nil {
+			if cause := context.Cause(ctx); errors.Is(cause, ErrBudgetExhausted) {
+				err = cause
+			}
+			return s.result(nil, 0), err
+		}
+		if options.Progress != nil {
+			options.Progress(Progress{
+				Direction: sd.direction,
+				Depth:     s.forward.depth + s.backward.depth,
+				Expanded:  s.expanded,
+				Forward:   len(s.forward.dist),
+				Backward:  len(s.backward.dist),
+				Elapsed:   time.Since(s.started),
+			})
+		}
+		if paths, length := s.paths(); len(paths) > 0 {
+			return s.result(paths, length), nil
+		}
+	}
+}
+
+// expand fetches the neighbours of every article in a side's frontier,
+// making the articles newly reached its next frontier
+func (s *search) expand(ctx context.Context, sd *side) error {
+	frontier := sd.frontier
+	canonicals := make([]string, len(frontier))
+	neighbours := make([][]string, len(frontier))
+	err := parallel(ctx, len(frontier), s.options.Concurrency, func(ctx context.Context, i int) (err error) {
+		if sd.direction == Forward {
+			canonicals[i], neighbours[i], err = s.graph.Links(ctx, frontier[i])
+		} else {
+			neighbours[i], err = s.graph.Backlinks(ctx, frontier[i])
+		}
+		return
+	})
+	if err != nil {
+		return err
+	}
+	s.expanded += len(frontier)
+
+	// Merge in frontier order so that the result does not depend on the
+	// order in which the fetches completed
+	depth := sd.depth + 1
+	var next []string
+	for i, article := range frontier {
+		if canonical := canonicals[i]; canonical != "" && canonical != article {
+			// The target of a redirect is reached wherever the redirect is,
+			// but need not be expanded since its links are the redirect's
+			s.aliases[article] = canonical
+			for _, parent := range sd.next[article] {
+				sd.reach(canonical, sd.dist[article], parent)
+			}
+			if _, found := sd.dist[canonical]; !found {
+				sd.dist[canonical], sd.next[canonical] = sd.dist[article], nil
+			}
+		}
+		for _, neighbour := range neighbours[i] {
+			if sd.reach(neighbour, depth, article) {
+				next = append(next, neighbour)
+			}
+		}
+	}
+	sd.frontier, sd.depth = next, depth
+	return nil
+}
+
+// paths returns the shortest paths through the articles reached by both
+// sides, if there are any
+func (s *search) paths() ([][]string, int) {
+	length := -1
+	var meets []string
+	for article, df := range s.forward.dist {
+		db, found := s.backward.dist[article]
+		switch {
+		case !found:
+		case length < 0 || df+db < length:
+			length, meets = df+db, []string{article}
+		case df+db == length:
+			meets = append(meets, article)
+		}
+	}
+	slices.Sort(meets)
+
+	var paths [][]string
+	seen := make(map[string]bool)
+	for _, meet := range meets {
+		for _, head := range s.walk(s.forward, meet) {
+			for _, tail := range s.walk(s.backward, meet) {
+				if len(paths) >= s.options.MaxPaths {
+					return paths, length
+				}
+				slices.Reverse(head)
+				path := append(slices.Clone(head), tail[1:]...)
+				slices.Reverse(head)
+				for i, article := range path {
+					if canonical, found := s.aliases[article]; found {
+						path[i] = canonical
+					}
+				}
+				key := fmt.Sprint(path)
+				if !seen[key] {
+					seen[key] = true
+					paths = append(paths, path)
+				}
+			}
+		}
+	}
+	return paths, length
+}
+
+// walk returns every path from article back to a side's root, beginning
+// with article, stopping once there are enough for MaxPaths
+func (s *search) walk(sd *side, article string) [][]string {
+	next := sd.next[article]
+	if len(next) == 0 {
+		return [][]string{{article}}
+	}
+	var walks [][]string
+	for _, neighbour := range slices.Sorted(slices.Values(next)) {
+		for _, w := range s.walk(sd, neighbour) {
+			walks = append(walks, append([]string{article}, w...))
+			if len(walks) >= s.options.MaxPaths {
+				return walks
+			}
+		}
+	}
+	return walks
+}
+
+// result returns the Result of the search so far
+func (s *search) result(paths [][]string, length int) Result {
+	return Result{
+		Paths:    paths,
+		Length:   length,
+		Expanded: s.expanded,
+		Elapsed:  time.Since(s.started),
+	}
+}
+
+// parallel calls f for each of n items, at most concurrency at once,
+// returning the first error after cancelling the remaining calls
+func parallel(ctx context.Context, n, concurrency int, f func(ctx context.Context, i int) error) error {
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, max(concurrency, 1))
+	for i := range n {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Go(func() {
+			defer func() { <-slots }()
+			if err := f(ctx, i); err != nil {
+				cancel(err)
+			}
+		})
+	}
+	wg.Wait()
+	return context.Cause(ctx)
+}
@@ -0,0 +1,214 @@
+package solver
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// graph is a Graph given by the links on each article. Articles absent from
+// links have no links, and redirects maps a redirect to its target.
+type graph struct {
+	links     map[string][]string
+	redirects map[string]string
+	delay     time.Duration
+	err       error
+
+	mu      sync.Mutex
+	fetched []string
+}
+
+func (g *graph) Links(ctx context.Context, article string) (string, []string, error) {
+	if err := g.fetch(ctx, article); err != nil {
+		return "", nil, err
+	}
+	if target, found := g.redirects[article]; found {
+		return target, g.links[target], nil
+	}
+	return article, g.links[article], nil
+}
+
+func (g *graph) Backlinks(ctx context.Context, article string) ([]string, error) {
+	if err := g.fetch(ctx, article); err != nil {
+		return nil, err
+	}
+	var sources []string
+	for source, links := range g.links {
+		for _, link := range links {
+			if link == article || g.redirects[link] == article {
+				sources = append(sources, source)
+				break
+			}
+		}
+	}
+	return sources, nil
+}
+
+func (g *graph) fetch(ctx context.Context, article string) error {
+	g.mu.Lock()
+	g.fetched = append(g.fetched, article)
+	g.mu.Unlock()
+	if g.delay > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(g.delay):
+		}
+	}
+	return g.err
+}
+
+func TestSolve(t *testing.T) {
+	// A diamond from A to E through B and C, a longer way round through F
+	// and G, and a redirect R to D
+	links := map[string][]string{
+		"A": {"B", "C", "F"},
+		"B": {"D"},
+		"C": {"R"},
+		"D": {"E"},
+		"F": {"G"},
+		"G": {"H"},
+		"H": {"E"},
+		"X": {"A"},
+	}
+	redirects := map[string]string{"R": "D"}
+
+	tests := []struct {
+		name    string
+		start   string
+		goal    string
+		options func(*Options)
+		paths   [][]string
+		length  int
+		err     error
+	}{
+		{
+			name:   "every optimal path, through a redirect",
+			start:  "A",
+			goal:   "E",
+			paths:  [][]string{{"A", "B", "D", "E"}, {"A", "C", "D", "E"}},
+			length: 3,
+		},
+		{
+			name:   "direct link",
+			start:  "D",
+			goal:   "E",
+			paths:  [][]string{{"D", "E"}},
+			length: 1,
+		},
+		{
+			name:   "link to a redirect to the goal",
+			start:  "C",
+			goal:   "D",
+			paths:  [][]string{{"C", "D"}},
+			length: 1,
+		},
+		{
+			name:   "start is the goal",
+			start:  "A",
+			goal:   "A",
+			paths:  [][]string{{"A"}},
+			length: 0,
+		},
+		{
+			name:    "limited number of paths",
+			start:   "A",
+			goal:    "E",
+			options: func(o *Options) { o.MaxPaths = 1 },
+			paths:   [][]string{{"A", "B", "D", "E"}},
+			length:  3,
+		},
+		{
+			name:  "no path",
+			start: "E",
+			goal:  "A",
+			err:   ErrNoPath,
+		},
+		{
+			name:    "depth budget",
+			start:   "A",
+			goal:    "E",
+			options: func(o *Options) { o.MaxDepth = 2 },
+			err:     &BudgetError{Budget: "depth", Limit: 2},
+		},
+		{
+			name:    "node budget",
+			start:   "X",
+			goal:    "E",
+			options: func(o *Options) { o.MaxNodes = 3 },
+			err:     &BudgetError{Budget: "nodes", Limit: 3},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := DefaultOptions()
+			if tt.options != nil {
+				tt.options(&options)
+			}
+			result, err := Solve(context.Background(), &graph{links: links, redirects: redirects}, tt.start, tt.goal, options)
+			if !reflect.DeepEqual(err, tt.err) {
+				t.Fatalf("got error %v, want %v", err, tt.err)
+			}
+			if !reflect.DeepEqual(result.Paths, tt.paths) || result.Length != tt.length && tt.err == nil {
+				t.Errorf("got paths %v of length %d, want %v of length %d", result.Paths, result.Length, tt.paths, tt.length)
+			}
+			if tt.err != nil && result.Expanded > options.MaxNodes {
+				t.Errorf("expanded %d articles, more than the budget of %d", result.Expanded, options.MaxNodes)
+			}
+		})
+	}
+}
+
+func TestSolve_Progress(t *testing.T) {
+	g := &graph{links: map[string][]string{"A": {"B"}, "B": {"C"}, "C": {"D"}}}
+	var progress []Progress
+	options := DefaultOptions()
+	options.Progress = func(p Progress) { progress = append(progress, p) }
+
+	result, err := Solve(context.Background(), g, "A", "D", options)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(progress) != result.Length {
+		t.Fatalf("got %d progress reports for a path of length %d", len(progress), result.Length)
+	}
+	for i, p := range progress {
+		if p.Depth != i+1 {
+			t.Errorf("report %d: got depth %d, want %d", i, p.Depth, i+1)
+		}
+	}
+	if last := progress[len(progress)-1]; last.Expanded != result.Expanded || last.Expanded != len(g.fetched) {
+		t.Errorf("got %d expanded, want %d", last.Expanded, len(g.fetched))
+	}
+}
+
+func TestSolve_Errors(t *testing.T) {
+	links := map[string][]string{"A": {"B"}, "B": {"C"}}
+
+	options := DefaultOptions()
+	options.Timeout = 20 * time.Millisecond
+	_, err := Solve(context.Background(), &graph{links: links, delay: time.Second}, "A", "C", options)
+	if want := (&BudgetError{Budget: "time", Limit: options.Timeout}); !reflect.DeepEqual(err, want) {
+		t.Errorf("got %v, want %v", err, want)
+	}
+	if !errors.Is(err, ErrBudgetExhausted) {
+		t.Errorf("got %v, want ErrBudgetExhausted", err)
+	}
+
+	fetchErr := errors.New("upstream failure")
+	_, err = Solve(context.Background(), &graph{links: links, err: fetchErr}, "A", "C", DefaultOptions())
+	if !errors.Is(err, fetchErr) {
+		t.Errorf("got %v, want %v", err, fetchErr)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = Solve(ctx, &graph{links: links}, "A", "C", DefaultOptions())
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v, want context.Canceled", err)
+	}
+}
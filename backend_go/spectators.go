@@ -0,0 +1,256 @@
+package wrserver
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bruceesmith/logger"
+)
+
+// SpectatorEventType is the kind of an event shown to spectators
+type SpectatorEventType string
+
+const (
+	SpectatorStart  SpectatorEventType = "start"  // A player's clock has started
+	SpectatorPage   SpectatorEventType = "page"   // A player has loaded a page
+	SpectatorPause  SpectatorEventType = "pause"  // A player has paused
+	SpectatorResume SpectatorEventType = "resume" // A player has resumed
+	SpectatorGoal   SpectatorEventType = "goal"   // A player has reached the goal
+)
+
+const (
+	spectatorHeartbeat = 15 * time.Second // Time between comments which keep an idle stream open
+	spectatorRetry     = 3 * time.Second  // Time a disconnected spectator waits before reconnecting
+)
+
+var (
+	// ErrEventCode is returned for an event code which is not 1 to 32
+	// letters, digits or hyphens
+	ErrEventCode = errors.New("invalid event code")
+	// ErrTooManyEvents is returned when a code cannot be followed because
+	// the limit on codes has been reached
+	ErrTooManyEvents = errors.New("too many event codes in use")
+)
+
+// eventCodeRe matches an event code, once lowercased
+var eventCodeRe = regexp.MustCompile(`^[a-z0-9-]{1,32}$`)
+
+// SpectatorOptions configures the logs of events shown to spectators
+type SpectatorOptions struct {
+	Log    int           // Events kept for each code, replayed to a spectator who reconnects
+	Codes  int           // Number of codes which may be in use at once
+	Expiry time.Duration // A code with no spectators and no events for this long is discarded
+}
+
+// DefaultSpectatorOptions returns the SpectatorOptions used by NewServer
+func DefaultSpectatorOptions() SpectatorOptions {
+	return SpectatorOptions{
+		Log:    500,
+		Codes:  1000,
+		Expiry: 12 * time.Hour,
+	}
+}
+
+// spectators holds a log of events for each event code. Each event is
+// numbered, so that a spectator who reconnects with the number of the last
+// event they saw is sent only those which followed it.
+type spectators struct {
+	options SpectatorOptions
+	now     func() time.Time
+
+	mu   sync.Mutex
+	logs map[string]*eventLog
+}
+
+// eventLog is the events of one code, and the spectators waiting for more
+type eventLog struct {
+	events   []SpectatorEvent // Oldest first, and at most options.Log of them
+	last     uint64           // ID of the newest event
+	touched  time.Time
+	watchers map[chan struct{}]bool
+}
+
+// newSpectators returns an empty set of event logs
+func newSpectators(options SpectatorOptions) *spectators {
+	return &spectators{
+		options: options,
+		now:     time.Now,
+		logs:    make(map[string]*eventLog),
+	}
+}
+
+// eventCode returns an event code in its canonical form, lowercased
+func eventCode(code string) (string, error) {
+	lower := strings.ToLower(code)
+	if !eventCodeRe.MatchString(lower) {
+		return "", fmt.Errorf("%w: '%s'", ErrEventCode, code)
+	}
+	return lower, nil
+}
+
+// Publish numbers an event, adds it to the log of a code and wakes the
+// code's spectators
+func (sp *spectators) Publish(code string, event SpectatorEvent) error {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	log, err := sp.log(code)
+	if err != nil {
+		return err
+	}
+	log.last++
+	event.ID = log.last
+	event.Time = log.touched
+	log.events = append(log.events, event)
+	if excess := len(log.events) - sp.options.Log; excess > 0 {
+		log.events = append(log.events[:0], log.events[excess:]...)
+	}
+	for wake := range log.watchers {
+		select {
+		case wake <- struct{}{}:
+		default:
+		}
+	}
+	logger.TraceID("spectators", "publish", "code", code, "id", event.ID, "type", event.Type, "player", event.Player)
+	return nil
+}
+
+// Watch returns a channel which receives a value whenever an event is added
+// to the log of a code, and a function which stops the watch
+func (sp *spectators) Watch(code string) (<-chan struct{}, func(), error) {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	log, err := sp.log(code)
+	if err != nil {
+		return nil, nil, err
+	}
+	wake := make(chan struct{}, 1)
+	log.watchers[wake] = true
+	stop := func() {
+		sp.mu.Lock()
+		defer sp.mu.Unlock()
+		delete(log.watchers, wake)
+		log.touched = sp.now()
+	}
+	return wake, stop, nil
+}
+
+// Since returns the events of a code which followed the event numbered id,
+// and the number of those which have been dropped from the log. An id
+// beyond the newest event, such as one from before the server restarted,
+// is treated as zero.
+func (sp *spectators) Since(code string, id uint64) (events []SpectatorEvent, missed uint64) {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	log, found := sp.logs[code]
+	if !found || len(log.events) == 0 {
+		return nil, 0
+	}
+	if id > log.last {
+		id = 0
+	}
+	if first := log.events[0].ID; id > 0 && id+1 < first {
+		missed = first - id - 1
+	}
+	for i, event := range log.events {
+		if event.ID > id {
+			return append([]SpectatorEvent(nil), log.events[i:]...), missed
+		}
+	}
+	return nil, missed
+}
+
+// log returns the log of a code, creating it if need be; the caller must
+// hold sp.mu
+func (sp *spectators) log(code string) (*eventLog, error) {
+	now := sp.now()
+	log, found := sp.logs[code]
+	if !found {
+		sp.expire(now)
+		if len(sp.logs) >= sp.options.Codes {
+			return nil, ErrTooManyEvents
+		}
+		log = &eventLog{watchers: make(map[chan struct{}]bool)}
+		sp.logs[code] = log
+	}
+	log.touched = now
+	return log, nil
+}
+
+// expire discards the log of every code with no spectators which has been
+// untouched for too long; the caller must hold sp.mu
+func (sp *spectators) expire(now time.Time) {
+	for code, log := range sp.logs {
+		if len(log.watchers) == 0 && now.Sub(log.touched) >= sp.options.Expiry {
+			logger.TraceID("spectators", "expired", "code", code)
+			delete(sp.logs, code)
+		}
+	}
+}
+
+// spectatePage shows the page load of a request to /api/wikipage to the
+// spectators of its event. A page of a game goes to the event the game was
+// tagged with, the first time or since, and is shown with the player's
+// progress.
+func (s *Server) spectatePage(request WikiPageRequest) {
+	event := SpectatorEvent{
+		Type:    SpectatorPage,
+		Player:  cmp.Or(playerName(request.Player), "anonymous"),
+		Wiki:    cmp.Or(request.Wiki, s.options.Wiki),
+		Subject: normaliseSubject(request.Subject),
+	}
+	code := request.Event
+	if request.Game != "" {
+		game, err := s.games.Spectate(strings.ToLower(request.Game), request.Token, code)
+		if err != nil {
+			logger.Warn("page not shown to spectators", "game", request.Game, "error", err.Error())
+			return
+		}
+		code = game.Event
+		event.Player, event.Steps, event.ElapsedMS = game.Player, game.Steps, game.ElapsedMS
+	}
+	if code != "" {
+		s.publish(code, event)
+	}
+}
+
+// spectate shows a move in a game tagged with an event to its spectators.
+// A navigation is shown only if it reaches the goal, since the player's
+// page load is shown when the page is fetched.
+func (s *Server) spectate(game GameResponse, action MoveAction) {
+	if game.Event == "" {
+		return
+	}
+	event := SpectatorEvent{
+		Player:    game.Player,
+		Wiki:      game.Wiki,
+		Subject:   game.Path[len(game.Path)-1],
+		Steps:     game.Steps,
+		ElapsedMS: game.ElapsedMS,
+	}
+	switch {
+	case action == MoveStart:
+		event.Type = SpectatorStart
+	case action == MovePause:
+		event.Type = SpectatorPause
+	case action == MoveResume:
+		event.Type = SpectatorResume
+	case action == MoveNavigate && game.State == GameFinished:
+		event.Type = SpectatorGoal
+	default:
+		return
+	}
+	s.publish(game.Event, event)
+}
+
+// publish adds an event to the log of a code. Spectating is incidental to
+// playing, so a failure is only logged.
+func (s *Server) publish(code string, event SpectatorEvent) {
+	if err := s.spectators.Publish(code, event); err != nil {
+		logger.Warn("event not shown to spectators", "code", code, "type", event.Type, "error", err.Error())
+	}
+}
@@ -0,0 +1,258 @@
+package wrserver
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSpectators_Since(t *testing.T) {
+	sp := newSpectators(SpectatorOptions{Log: 3, Codes: 10, Expiry: time.Hour})
+	for _, subject := range []string{"/wiki/A", "/wiki/B", "/wiki/C", "/wiki/D", "/wiki/E"} {
+		if err := sp.Publish("party", SpectatorEvent{Type: SpectatorPage, Subject: subject}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	tests := []struct {
+		name   string
+		id     uint64
+		ids    []uint64
+		missed uint64
+	}{
+		{name: "new spectator", id: 0, ids: []uint64{3, 4, 5}},
+		{name: "some dropped", id: 1, ids: []uint64{3, 4, 5}, missed: 1},
+		{name: "none dropped", id: 3, ids: []uint64{4, 5}},
+		{name: "up to date", id: 5},
+		{name: "from before a restart", id: 9, ids: []uint64{3, 4, 5}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events, missed := sp.Since("party", tt.id)
+			var ids []uint64
+			for _, event := range events {
+				ids = append(ids, event.ID)
+			}
+			if !reflect.DeepEqual(ids, tt.ids) || missed != tt.missed {
+				t.Errorf("got events %v and %d missed, want %v and %d", ids, missed, tt.ids, tt.missed)
+			}
+		})
+	}
+	if events, missed := sp.Since("unknown", 0); events != nil || missed != 0 {
+		t.Errorf("got %+v and %d missed for an unknown code", events, missed)
+	}
+}
+
+func TestSpectators_Codes(t *testing.T) {
+	now := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+	sp := newSpectators(SpectatorOptions{Log: 10, Codes: 2, Expiry: time.Hour})
+	sp.now = func() time.Time { return now }
+
+	sp.Publish("a", SpectatorEvent{Type: SpectatorStart})
+	_, stop, err := sp.Watch("b")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := sp.Publish("c", SpectatorEvent{Type: SpectatorStart}); !errors.Is(err, ErrTooManyEvents) {
+		t.Errorf("got error %v for a third code", err)
+	}
+
+	// Only a code with no spectators expires
+	now = now.Add(2 * time.Hour)
+	if err := sp.Publish("c", SpectatorEvent{Type: SpectatorStart}); err != nil {
+		t.Errorf("got error %v once a code had expired", err)
+	}
+	if events, _ := sp.Since("a", 0); events != nil {
+		t.Errorf("got %+v for an expired code", events)
+	}
+	stop()
+	now = now.Add(2 * time.Hour)
+	if err := sp.Publish("d", SpectatorEvent{Type: SpectatorStart}); err != nil {
+		t.Errorf("got error %v once the spectators had gone", err)
+	}
+}
+
+func TestEventCode(t *testing.T) {
+	tests := []struct {
+		code string
+		want string
+		err  bool
+	}{
+		{code: "party", want: "party"},
+		{code: "Office-Party-2026", want: "office-party-2026"},
+		{code: "", err: true},
+		{code: "no spaces", err: true},
+		{code: "../etc", err: true},
+		{code: strings.Repeat("x", 33), err: true},
+	}
+	for _, tt := range tests {
+		got, err := eventCode(tt.code)
+		if got != tt.want || (err != nil) != tt.err {
+			t.Errorf("eventCode(%q) = %q, %v", tt.code, got, err)
+		}
+	}
+}
+
+// sseEvent is one event read from a Server-Sent Events stream
+type sseEvent struct {
+	id    string
+	event string
+	data  string
+}
+
+// nextSSE reads a stream until its next event, skipping comments and
+// fields which are not part of an event
+func nextSSE(t *testing.T, stream *bufio.Reader) sseEvent {
+	t.Helper()
+	var event sseEvent
+	for {
+		line, err := stream.ReadString('\n')
+		if err != nil {
+			t.Fatalf("no event: %v", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			if event.event != "" {
+				return event
+			}
+			continue
+		}
+		field, value, _ := strings.Cut(line, ": ")
+		switch field {
+		case "id":
+			event.id = value
+		case "event":
+			event.event = value
+		case "data":
+			event.data = value
+		}
+	}
+}
+
+// watch opens the stream of an event code
+func watch(t *testing.T, ts *httptest.Server, code, last string) *bufio.Reader {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+"/api/events/"+code+"/stream", nil)
+	if last != "" {
+		req.Header.Set("Last-Event-ID", last)
+	}
+	resp, err := (&http.Client{Timeout: 5 * time.Second}).Do(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("got status code %d and content type %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	return bufio.NewReader(resp.Body)
+}
+
+// post sends a JSON request, failing the test if it is not answered with
+// the status code wanted, and decodes the response into v if it is not nil
+func post(t *testing.T, ts *httptest.Server, path string, request any, want int, v any) {
+	t.Helper()
+	body, _ := json.Marshal(request)
+	resp, err := http.Post(ts.URL+path, "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != want {
+		t.Fatalf("got status code %d from %s, want %d", resp.StatusCode, path, want)
+	}
+	if v != nil {
+		json.NewDecoder(resp.Body).Decode(v)
+	}
+}
+
+func TestEventsAPI(t *testing.T) {
+	s, ts := testRooms(t, DefaultRoomOptions())
+	stream := watch(t, ts, "Party", "")
+
+	var game GameResponse
+	post(t, ts, "/api/games", CreateGameRequest{Start: "/wiki/Start", Goal: "/wiki/Goal", Player: "ann"}, http.StatusCreated, &game)
+	moves := "/api/games/" + game.ID + "/moves"
+	// Moves before the game is tagged are not shown
+	post(t, ts, moves, MoveRequest{Token: game.Token, Action: MoveStart}, http.StatusOK, nil)
+	post(t, ts, "/api/wikipage", WikiPageRequest{Subject: "/wiki/Start", Game: game.ID, Token: game.Token, Event: "PARTY"}, http.StatusOK, nil)
+	post(t, ts, moves, MoveRequest{Token: game.Token, Action: MovePause}, http.StatusOK, nil)
+	post(t, ts, moves, MoveRequest{Token: game.Token, Action: MoveResume}, http.StatusOK, nil)
+	post(t, ts, moves, MoveRequest{Token: game.Token, Action: MoveNavigate, Subject: "/wiki/A"}, http.StatusOK, nil)
+	// A page of a tagged game is shown without the code
+	post(t, ts, "/api/wikipage", WikiPageRequest{Subject: "/wiki/A", Game: game.ID, Token: game.Token}, http.StatusOK, nil)
+	post(t, ts, moves, MoveRequest{Token: game.Token, Action: MoveNavigate, Subject: "/wiki/Goal"}, http.StatusOK, nil)
+	post(t, ts, "/api/wikipage", WikiPageRequest{Subject: "/wiki/A", Event: "party", Player: " bob "}, http.StatusOK, nil)
+	post(t, ts, "/api/wikipage", WikiPageRequest{Subject: "/wiki/A", Event: "no spaces"}, http.StatusBadRequest, nil)
+
+	want := []struct {
+		typ     SpectatorEventType
+		player  string
+		subject string
+		steps   int
+	}{
+		{SpectatorPage, "ann", "/wiki/Start", 0},
+		{SpectatorPause, "ann", "/wiki/Start", 0},
+		{SpectatorResume, "ann", "/wiki/Start", 0},
+		{SpectatorPage, "ann", "/wiki/A", 1},
+		{SpectatorGoal, "ann", "/wiki/Goal", 2},
+		{SpectatorPage, "bob", "/wiki/A", 0},
+	}
+	for i, w := range want {
+		got := nextSSE(t, stream)
+		var event SpectatorEvent
+		if err := json.Unmarshal([]byte(got.data), &event); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got.event != string(w.typ) || got.id != strconv.FormatUint(event.ID, 10) || event.Type != w.typ || event.Player != w.player ||
+			event.Subject != w.subject || event.Steps != w.steps || event.Wiki != "en" {
+			t.Errorf("event %d: got %+v %+v, want %+v", i+1, got, event, w)
+		}
+	}
+
+	// A spectator who reconnects is sent only the events they missed
+	if got := nextSSE(t, watch(t, ts, "party", "4")); got.id != "5" || got.event != string(SpectatorGoal) {
+		t.Errorf("got %+v after reconnecting", got)
+	}
+
+	for _, tt := range []struct {
+		name   string
+		method string
+		path   string
+		last   string
+		want   int
+	}{
+		{name: "no stream", method: http.MethodGet, path: "/api/events/party", want: http.StatusNotFound},
+		{name: "no code", method: http.MethodGet, path: "/api/events//stream", want: http.StatusNotFound},
+		{name: "invalid code", method: http.MethodGet, path: "/api/events/a%20b/stream", want: http.StatusBadRequest},
+		{name: "invalid last event", method: http.MethodGet, path: "/api/events/party/stream", last: "x", want: http.StatusBadRequest},
+		{name: "post", method: http.MethodPost, path: "/api/events/party/stream", want: http.StatusMethodNotAllowed},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(tt.method, ts.URL+tt.path, nil)
+			if tt.last != "" {
+				req.Header.Set("Last-Event-ID", tt.last)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.want {
+				t.Errorf("got status code %d, want %d", resp.StatusCode, tt.want)
+			}
+		})
+	}
+
+	// Every stream ends when the server shuts down
+	s.cancel()
+	if got := nextSSE(t, stream); got.event != "shutdown" {
+		t.Errorf("got %+v at shutdown", got)
+	}
+}
@@ -0,0 +1,226 @@
+package wrserver
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+
+	"github.com/bruceesmith/logger"
+	"github.com/bruceesmith/wrspa/backend/wrserver/leaderboard"
+)
+
+const (
+	defaultLeaderboardLimit = 20  // Scores in a page of a leaderboard unless the request says otherwise
+	maxLeaderboardLimit     = 100 // Most scores in a page of a leaderboard
+	maxPlayerName           = 32  // Runes of a player's name kept for the leaderboard
+)
+
+// ErrChallengeNotFound is returned for a challenge with no finished games,
+// or whose ID is unknown
+var ErrChallengeNotFound = errors.New("challenge not found")
+
+// dailyChallenge returns the challenge of a daily
+func dailyChallenge(daily DailyResponse) leaderboard.Challenge {
+	return leaderboard.Challenge{
+		ID:    daily.Challenge,
+		Kind:  leaderboard.Daily,
+		Wiki:  daily.Wiki,
+		Start: daily.Start,
+		Goal:  daily.Goal,
+		Date:  daily.Date,
+	}
+}
+
+// dailyChallengeID returns the ID of the challenge of a date's daily
+func dailyChallengeID(date string) string {
+	return string(leaderboard.Daily) + "-" + date
+}
+
+// customChallenge returns the challenge of a pair chosen by a player. Its
+// ID is derived from the wiki and the normalised subjects, so that every
+// game on the pair is ranked together.
+func customChallenge(wiki, start, goal string) leaderboard.Challenge {
+	sum := sha256.Sum256([]byte(wiki + "\x00" + normaliseSubject(start) + "\x00" + normaliseSubject(goal)))
+	return leaderboard.Challenge{
+		ID:    string(leaderboard.Custom) + "-" + hex.EncodeToString(sum[:8]),
+		Kind:  leaderboard.Custom,
+		Wiki:  wiki,
+		Start: start,
+		Goal:  goal,
+	}
+}
+
+// MemoryStore is a Store which is lost when the server stops
+type MemoryStore struct {
+	mu     sync.RWMutex
+	boards map[string]*board
+}
+
+// board is the leaderboard of one challenge
+type board struct {
+	challenge leaderboard.Challenge
+	scores    []leaderboard.Score
+}
+
+// NewMemoryStore returns an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		boards: make(map[string]*board),
+	}
+}
+
+// Record adds a finished game to the leaderboard of its challenge
+func (m *MemoryStore) Record(ctx context.Context, challenge leaderboard.Challenge, score leaderboard.Score) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.add(challenge, score)
+	return nil
+}
+
+// add adds a score to a leaderboard; the caller must hold m.mu
+func (m *MemoryStore) add(challenge leaderboard.Challenge, score leaderboard.Score) {
+	b, found := m.boards[challenge.ID]
+	if !found {
+		b = &board{challenge: challenge}
+		m.boards[challenge.ID] = b
+	}
+	b.scores = append(b.scores, score)
+}
+
+// Challenge returns a challenge with at least one finished game
+func (m *MemoryStore) Challenge(ctx context.Context, id string) (leaderboard.Challenge, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	b, found := m.boards[id]
+	if !found {
+		return leaderboard.Challenge{}, fmt.Errorf("%w: %s", ErrChallengeNotFound, id)
+	}
+	return b.challenge, nil
+}
+
+// Leaderboard returns up to limit scores of a challenge, after skipping
+// offset of them, and the number of scores in all
+func (m *MemoryStore) Leaderboard(ctx context.Context, id string, ranking leaderboard.Ranking, offset, limit int) ([]leaderboard.Score, int, error) {
+	m.mu.RLock()
+	b, found := m.boards[id]
+	var scores []leaderboard.Score
+	if found {
+		scores = slices.Clone(b.scores)
+	}
+	m.mu.RUnlock()
+	if !found {
+		return nil, 0, fmt.Errorf("%w: %s", ErrChallengeNotFound, id)
+	}
+	slices.SortFunc(scores, ranking.Compare)
+	total := len(scores)
+	offset = min(max(offset, 0), total)
+	end := min(offset+max(limit, 0), total)
+	return scores[offset:end], total, nil
+}
+
+// Close does nothing, since there is nothing to release
+func (m *MemoryStore) Close() error {
+	return nil
+}
+
+// FileStore is a Store kept in a single file, with no database needed. Each
+// finished game is appended to the file as a line of JSON, and the whole
+// file is read into memory when the store is opened.
+type FileStore struct {
+	memory *MemoryStore
+	path   string
+
+	mu   sync.Mutex
+	file *os.File
+}
+
+// fileRecord is one line of a FileStore
+type fileRecord struct {
+	Challenge leaderboard.Challenge `json:"challenge"`
+	Score     leaderboard.Score     `json:"score"`
+}
+
+// NewFileStore opens a FileStore, creating its file if need be. A line
+// which cannot be read, such as one left half written by a crash, is
+// skipped.
+func NewFileStore(path string) (*FileStore, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open store '%s': %w", path, err)
+	}
+	fs := &FileStore{
+		memory: NewMemoryStore(),
+		path:   path,
+		file:   file,
+	}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 1<<20)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var record fileRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil || record.Challenge.ID == "" {
+			logger.Warn("store record skipped", "file", path, "line", line)
+			continue
+		}
+		fs.memory.add(record.Challenge, record.Score)
+	}
+	if err := scanner.Err(); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("unable to read store '%s': %w", path, err)
+	}
+	return fs, nil
+}
+
+// Record appends a finished game to the file, and adds it to the
+// leaderboard of its challenge once it is safely written
+func (fs *FileStore) Record(ctx context.Context, challenge leaderboard.Challenge, score leaderboard.Score) error {
+	line, err := json.Marshal(fileRecord{Challenge: challenge, Score: score})
+	if err != nil {
+		return err
+	}
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if fs.file == nil {
+		return fmt.Errorf("store '%s' is closed", fs.path)
+	}
+	if _, err := fs.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("unable to write store '%s': %w", fs.path, err)
+	}
+	if err := fs.file.Sync(); err != nil {
+		return fmt.Errorf("unable to write store '%s': %w", fs.path, err)
+	}
+	return fs.memory.Record(ctx, challenge, score)
+}
+
+// Challenge returns a challenge with at least one finished game
+func (fs *FileStore) Challenge(ctx context.Context, id string) (leaderboard.Challenge, error) {
+	return fs.memory.Challenge(ctx, id)
+}
+
+// Leaderboard returns up to limit scores of a challenge, after skipping
+// offset of them, and the number of scores in all
+func (fs *FileStore) Leaderboard(ctx context.Context, id string, ranking leaderboard.Ranking, offset, limit int) ([]leaderboard.Score, int, error) {
+	return fs.memory.Leaderboard(ctx, id, ranking, offset, limit)
+}
+
+// Close closes the file
+func (fs *FileStore) Close() error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if fs.file == nil {
+		return nil
+	}
+	err := fs.file.Close()
+	fs.file = nil
+	return err
+}
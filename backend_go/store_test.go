@@ -0,0 +1,140 @@
+package wrserver
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/bruceesmith/wrspa/backend/wrserver/leaderboard"
+)
+
+// testScores are finished games of one challenge, in the order they finished
+func testScores() []leaderboard.Score {
+	finished := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+	return []leaderboard.Score{
+		{Game: "a", Player: "ann", Steps: 4, ElapsedMS: 20000, Finished: finished},
+		{Game: "b", Player: "bob", Steps: 2, ElapsedMS: 90000, Finished: finished.Add(time.Minute)},
+		{Game: "c", Player: "cat", Steps: 4, ElapsedMS: 10000, Finished: finished.Add(2 * time.Minute)},
+		{Game: "d", Player: "dan", Steps: 2, ElapsedMS: 90000, Finished: finished.Add(3 * time.Minute)},
+	}
+}
+
+// gameIDs returns the IDs of the games of scores
+func gameIDs(scores []leaderboard.Score) []string {
+	ids := make([]string, 0, len(scores))
+	for _, score := range scores {
+		ids = append(ids, score.Game)
+	}
+	return ids
+}
+
+// testStore checks the ranking and paging of a store, and returns the
+// challenge recorded in it
+func testStore(t *testing.T, store Store) leaderboard.Challenge {
+	t.Helper()
+	ctx := context.Background()
+	challenge := customChallenge("en", "/wiki/Start", "/wiki/Goal")
+	other := customChallenge("en", "/wiki/Goal", "/wiki/Start")
+	for _, score := range testScores() {
+		if err := store.Record(ctx, challenge, score); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if err := store.Record(ctx, other, leaderboard.Score{Game: "e", Steps: 1}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		ranking leaderboard.Ranking
+		offset  int
+		limit   int
+		games   []string
+	}{
+		{name: "by clicks", ranking: leaderboard.ByClicks, limit: 10, games: []string{"b", "d", "c", "a"}},
+		{name: "by time", ranking: leaderboard.ByTime, limit: 10, games: []string{"c", "a", "b", "d"}},
+		{name: "first page", ranking: leaderboard.ByClicks, limit: 2, games: []string{"b", "d"}},
+		{name: "second page", ranking: leaderboard.ByClicks, offset: 2, limit: 2, games: []string{"c", "a"}},
+		{name: "past the end", ranking: leaderboard.ByClicks, offset: 9, limit: 2, games: []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scores, total, err := store.Leaderboard(ctx, challenge.ID, tt.ranking, tt.offset, tt.limit)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := gameIDs(scores); total != 4 || !reflect.DeepEqual(got, tt.games) {
+				t.Errorf("got %v of %d, want %v of 4", got, total, tt.games)
+			}
+		})
+	}
+
+	if got, err := store.Challenge(ctx, challenge.ID); err != nil || got != challenge {
+		t.Errorf("got %+v and error %v, want %+v", got, err, challenge)
+	}
+	if _, err := store.Challenge(ctx, "custom-unknown"); !errors.Is(err, ErrChallengeNotFound) {
+		t.Errorf("got %v, want ErrChallengeNotFound", err)
+	}
+	if _, _, err := store.Leaderboard(ctx, "custom-unknown", leaderboard.ByClicks, 0, 10); !errors.Is(err, ErrChallengeNotFound) {
+		t.Errorf("got %v, want ErrChallengeNotFound", err)
+	}
+	return challenge
+}
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, NewMemoryStore())
+}
+
+func TestFileStore(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "scores.jsonl")
+	store, err := NewFileStore(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	challenge := testStore(t, store)
+	if err := store.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := store.Record(ctx, challenge, leaderboard.Score{Game: "f"}); err == nil {
+		t.Errorf("expected an error recording in a closed store, got nil")
+	}
+
+	// A line left half written by a crash is skipped when reopened
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString(`{"challenge":{"id":"custom-`)
+	file.Close()
+
+	store, err = NewFileStore(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer store.Close()
+	scores, total, err := store.Leaderboard(ctx, challenge.ID, leaderboard.ByClicks, 0, 10)
+	if err != nil || total != 4 || !reflect.DeepEqual(scores, rankedScores(testScores(), 1, 3, 2, 0)) {
+		t.Errorf("got %+v of %d and error %v after reopening", scores, total, err)
+	}
+	if got, err := store.Challenge(ctx, challenge.ID); err != nil || got != challenge {
+		t.Errorf("got %+v and error %v, want %+v", got, err, challenge)
+	}
+
+	if _, err := NewFileStore(t.TempDir()); err == nil {
+		t.Errorf("expected an error for a folder, got nil")
+	}
+}
+
+// rankedScores returns the scores at the given indexes
+func rankedScores(scores []leaderboard.Score, order ...int) []leaderboard.Score {
+	ranked := make([]leaderboard.Score, 0, len(order))
+	for _, i := range order {
+		ranked = append(ranked, scores[i])
+	}
+	return ranked
+}
@@ -0,0 +1,153 @@
+/*
+Package title puts the titles of wiki pages into the form MediaWiki itself
+uses, so that two links to the same page compare equal however they are
+written.
+
+A title may be given bare ("united states"), as a path on the wiki
+("/wiki/United%20states#History") or as a URL such as
+"//en.wikipedia.org/wiki/United_states". Its normal form has underscores for spaces, with no
+runs of them and none at either end, no fragment and no percent-encoding.
+The first letter of the page name is a capital, as MediaWiki makes it on
+Wikipedia, and so is that of a namespace such as Category:, whose alias is
+replaced by its canonical name.
+
+The names of the namespaces differ from wiki to wiki, so that Datei:Go.svg
+is a file on the German Wikipedia but would be an article on the English
+one. The functions of the package use the namespaces of the English
+Wikipedia, and the methods of Namespaces those of any other wiki.
+
+A redirect such as USA cannot be recognised from its title alone: the
+canonical title of a fetched page is the one in its <link rel="canonical">,
+which should then be normalised in turn.
+*/
+package title
+
+import (
+	"net/url"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Prefix is the path on a wiki below which its pages are served
+const Prefix = "/wiki/"
+
+// Namespaces are the canonical names of the namespaces of a wiki whose pages
+// are not articles, by their lowercased names and aliases, with underscores
+// for spaces. The talk namespace of each may also be given as the name
+// followed by _talk. Nil Namespaces are those of English.
+type Namespaces map[string]string
+
+// English are the namespaces of the English Wikipedia
+var English = Namespaces{
+	"book": "Book", "category": "Category", "draft": "Draft", "file": "File", "help": "Help",
+	"image": "File", "media": "Media", "mediawiki": "MediaWiki", "module": "Module", "portal": "Portal",
+	"project": "Wikipedia", "special": "Special", "talk": "Talk", "template": "Template",
+	"timedtext": "TimedText", "user": "User", "wikipedia": "Wikipedia", "wp": "Wikipedia",
+}
+
+// Add adds a name or alias of a namespace, given as MediaWiki does with
+// spaces, and its canonical name
+func (ns Namespaces) Add(name, canonical string) {
+	ns[strings.ToLower(strings.ReplaceAll(name, " ", "_"))] = strings.ReplaceAll(canonical, " ", "_")
+}
+
+// Normalise returns the normal form of a title on the English Wikipedia
+func Normalise(title string) string {
+	return English.Normalise(title)
+}
+
+// Path returns the path on the English Wikipedia of a title
+func Path(title string) string {
+	return English.Path(title)
+}
+
+// Equal reports whether two titles name the same page of the English
+// Wikipedia
+func Equal(a, b string) bool {
+	return English.Equal(a, b)
+}
+
+// IsArticle reports whether a title names an article of the English
+// Wikipedia
+func IsArticle(title string) bool {
+	return English.IsArticle(title)
+}
+
+// Normalise returns the normal form of a title, without the path prefix.
+// The empty string is returned for a link to no page, such as a fragment of
+// the current page.
+func (ns Namespaces) Normalise(title string) string {
+	if strings.Contains(title, "://") || strings.HasPrefix(title, "//") {
+		if u, err := url.Parse(title); err == nil {
+			title = u.EscapedPath()
+		}
+	}
+	title = strings.TrimPrefix(title, Prefix)
+	title, _, _ = strings.Cut(title, "#")
+	if unescaped, err := url.PathUnescape(title); err == nil {
+		title = unescaped
+	}
+	title = strings.Join(strings.FieldsFunc(title, func(r rune) bool { return r == '_' || r == ' ' }), "_")
+
+	prefix, name, found := strings.Cut(title, ":")
+	if found {
+		if canonical, ok := ns.namespace(strings.TrimSuffix(prefix, "_")); ok {
+			return canonical + ":" + upperFirst(strings.TrimPrefix(name, "_"))
+		}
+	}
+	return upperFirst(title)
+}
+
+// Path returns the path on the wiki of a title, in normal form but not
+// percent-encoded
+func (ns Namespaces) Path(title string) string {
+	return Prefix + ns.Normalise(title)
+}
+
+// Equal reports whether two titles name the same page
+func (ns Namespaces) Equal(a, b string) bool {
+	return ns.Normalise(a) == ns.Normalise(b)
+}
+
+// IsArticle reports whether a title names an article rather than a page in
+// another namespace, such as File:Go.svg or Talk:Go
+func (ns Namespaces) IsArticle(title string) bool {
+	title = ns.Normalise(title)
+	if title == "" {
+		return false
+	}
+	prefix, _, found := strings.Cut(title, ":")
+	if !found {
+		return true
+	}
+	_, ok := ns.namespace(prefix)
+	return !ok && !strings.HasSuffix(strings.ToLower(prefix), "_talk")
+}
+
+// namespace returns the canonical name of a namespace, or of its talk
+// namespace
+func (ns Namespaces) namespace(name string) (string, bool) {
+	if ns == nil {
+		ns = English
+	}
+	lower := strings.ToLower(name)
+	if canonical, found := ns[lower]; found {
+		return canonical, true
+	}
+	if base, talk := strings.CutSuffix(lower, "_talk"); talk {
+		if canonical, found := ns[base]; found && base != "talk" {
+			return canonical + "_talk", true
+		}
+	}
+	return "", false
+}
+
+// upperFirst returns s with its first letter in upper case
+func upperFirst(s string) string {
+	r, size := utf8.DecodeRuneInString(s)
+	if r == utf8.RuneError || unicode.IsUpper(r) {
+		return s
+	}
+	return string(unicode.ToUpper(r)) + s[size:]
+}
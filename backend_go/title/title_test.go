@@ -0,0 +1,105 @@
+package title
+
+import "testing"
+
+func TestNormalise(t *testing.T) {
+	tests := []struct {
+		title string
+		want  string
+	}{
+		{title: "United_States", want: "United_States"},
+		{title: "united states", want: "United_states"},
+		{title: "/wiki/United%20States#History", want: "United_States"},
+		{title: "https://en.wikipedia.org/wiki/United_States?action=view", want: "United_States"},
+		{title: "//en.wikipedia.org/wiki/Caf%C3%A9", want: "Café"},
+		{title: "/wiki/%C3%A9cole", want: "École"},
+		{title: "  New__York _City_ ", want: "New_York_City"},
+		{title: "iPhone", want: "IPhone"},
+		{title: "category:coffee", want: "Category:Coffee"},
+		{title: "Image:Go.svg", want: "File:Go.svg"},
+		{title: "user talk:gopher", want: "User_talk:Gopher"},
+		{title: "WP : Manual of Style", want: "Wikipedia:Manual_of_Style"},
+		{title: "Go: the game", want: "Go:_the_game"},
+		{title: "#History", want: ""},
+		{title: "/wiki/", want: ""},
+	}
+	for _, tt := range tests {
+		if got := Normalise(tt.title); got != tt.want {
+			t.Errorf("Normalise(%q) = %q, want %q", tt.title, got, tt.want)
+		}
+	}
+}
+
+func TestEqual(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{a: "/wiki/United_States", b: "united States", want: true},
+		{a: "/wiki/Caf%C3%A9#Menu", b: "Café", want: true},
+		{a: "USA", b: "United States", want: false},
+		{a: "Coffee", b: "Coffee_bean", want: false},
+	}
+	for _, tt := range tests {
+		if got := Equal(tt.a, tt.b); got != tt.want {
+			t.Errorf("Equal(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestIsArticle(t *testing.T) {
+	tests := []struct {
+		title string
+		want  bool
+	}{
+		{title: "/wiki/Go", want: true},
+		{title: "Go:_The_Game", want: true},
+		{title: "Ratio: of things", want: true},
+		{title: "File:Go.svg", want: false},
+		{title: "image:Go.svg", want: false},
+		{title: "Special:Random", want: false},
+		{title: "Talk:Go", want: false},
+		{title: "User_talk:Gopher", want: false},
+		{title: "Portal talk:Coffee", want: false},
+		{title: "", want: false},
+	}
+	for _, tt := range tests {
+		if got := IsArticle(tt.title); got != tt.want {
+			t.Errorf("IsArticle(%q) = %v, want %v", tt.title, got, tt.want)
+		}
+	}
+}
+
+func TestNamespaces(t *testing.T) {
+	de := Namespaces{}
+	for name, canonical := range map[string]string{
+		"Datei": "Datei", "File": "Datei", "Bild": "Datei", "Kategorie": "Kategorie", "Category": "Kategorie",
+		"Spezial": "Spezial", "Special": "Spezial", "Diskussion": "Diskussion", "Benutzer Diskussion": "Benutzer Diskussion",
+	} {
+		de.Add(name, canonical)
+	}
+
+	tests := []struct {
+		ns        Namespaces
+		title     string
+		normal    string
+		isArticle bool
+	}{
+		{ns: de, title: "datei:Go.svg", normal: "Datei:Go.svg"},
+		{ns: de, title: "File:Go.svg", normal: "Datei:Go.svg"},
+		{ns: de, title: "/wiki/Kategorie:Kaffee", normal: "Kategorie:Kaffee"},
+		{ns: de, title: "Spezial:Zufällige_Seite", normal: "Spezial:Zufällige_Seite"},
+		{ns: de, title: "benutzer diskussion:gopher", normal: "Benutzer_Diskussion:Gopher"},
+		{ns: de, title: "Berlin", normal: "Berlin", isArticle: true},
+		{ns: English, title: "Datei:Go.svg", normal: "Datei:Go.svg", isArticle: true},
+		{title: "category:coffee", normal: "Category:Coffee"},
+	}
+	for _, tt := range tests {
+		if got := tt.ns.Normalise(tt.title); got != tt.normal {
+			t.Errorf("Normalise(%q) = %q, want %q", tt.title, got, tt.normal)
+		}
+		if got := tt.ns.IsArticle(tt.title); got != tt.isArticle {
+			t.Errorf("IsArticle(%q) = %v, want %v", tt.title, got, tt.isArticle)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package wrserver
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bruceesmith/logger"
+)
+
+// certReloadInterval is how often the certificate files are checked for
+// changes
+const certReloadInterval = 10 * time.Second
+
+// certReloader serves a certificate loaded from files, reloading it when
+// either file changes so that a renewed certificate is picked up without a
+// restart. A replacement which fails to load is logged and the previous
+// certificate kept.
+type certReloader struct {
+	certFile string
+	keyFile  string
+	now      func() time.Time
+
+	mu       sync.Mutex
+	cert     *tls.Certificate
+	modTimes [2]time.Time
+	checked  time.Time
+}
+
+// newCertReloader loads the certificate in certFile and keyFile
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	cr := &certReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+		now:      time.Now,
+	}
+	modTimes, err := cr.stat()
+	if err != nil {
+		return nil, err
+	}
+	if err := cr.load(modTimes); err != nil {
+		return nil, err
+	}
+	cr.checked = cr.now()
+	return cr, nil
+}
+
+// GetCertificate is used as tls.Config.GetCertificate
+func (cr *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	now := cr.now()
+	if now.Sub(cr.checked) >= certReloadInterval {
+		cr.checked = now
+		modTimes, err := cr.stat()
+		if err != nil {
+			logger.Error("unable to check TLS certificate", "error", err.Error())
+		} else if modTimes != cr.modTimes {
+			if err := cr.load(modTimes); err != nil {
+				logger.Error("unable to reload TLS certificate, keeping the previous one", "error", err.Error())
+			} else {
+				logger.Info("TLS certificate reloaded", "cert", cr.certFile)
+			}
+		}
+	}
+	return cr.cert, nil
+}
+
+// stat returns the modification times of the certificate and key files
+func (cr *certReloader) stat() (modTimes [2]time.Time, err error) {
+	for i, file := range []string{cr.certFile, cr.keyFile} {
+		info, err := os.Stat(file)
+		if err != nil {
+			return modTimes, fmt.Errorf("unable to access '%s': %w", file, err)
+		}
+		modTimes[i] = info.ModTime()
+	}
+	return
+}
+
+// load reads the certificate and key; the caller must hold cr.mu or be the
+// constructor
+func (cr *certReloader) load(modTimes [2]time.Time) error {
+	cert, err := tls.LoadX509KeyPair(cr.certFile, cr.keyFile)
+	if err != nil {
+		// Remember the failed attempt so that it is not retried until the
+		// files change again
+		cr.modTimes = modTimes
+		return fmt.Errorf("unable to load TLS certificate '%s' and key '%s': %w", cr.certFile, cr.keyFile, err)
+	}
+	cr.cert = &cert
+	cr.modTimes = modTimes
+	return nil
+}
+
+// selfSignedCertificate generates an in-memory certificate for localhost,
+// for local testing only
+func selfSignedCertificate() (*tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("unable to generate key: %w", err)
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("unable to generate serial number: %w", err)
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{"wrspa self-signed"}},
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(365 * 24 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create certificate: %w", err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse certificate: %w", err)
+	}
+	return &tls.Certificate{
+		Certificate: [][]byte{der},
+		PrivateKey:  key,
+		Leaf:        leaf,
+	}, nil
+}
+
+// tlsConfig returns the TLS configuration for options, or nil if HTTPS is
+// not to be served
+func tlsConfig(options ServerOptions) (*tls.Config, error) {
+	switch {
+	case options.TLSSelfSigned:
+		cert, err := selfSignedCertificate()
+		if err != nil {
+			return nil, fmt.Errorf("unable to create self-signed certificate: %w", err)
+		}
+		logger.Warn("serving HTTPS with a self-signed certificate, which is for local testing only")
+		return &tls.Config{
+			MinVersion:   tls.VersionTLS12,
+			Certificates: []tls.Certificate{*cert},
+		}, nil
+	case options.TLSCert != "":
+		cr, err := newCertReloader(options.TLSCert, options.TLSKey)
+		if err != nil {
+			return nil, err
+		}
+		return &tls.Config{
+			MinVersion:     tls.VersionTLS12,
+			GetCertificate: cr.GetCertificate,
+		}, nil
+	}
+	return nil, nil
+}
+
+// httpsRedirect returns a handler which permanently redirects every request
+// to the same URL on the HTTPS port
+func httpsRedirect(httpsPort string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if httpsPort != "443" {
+			host = net.JoinHostPort(strings.Trim(host, "[]"), httpsPort)
+		} else if strings.Contains(host, ":") && !strings.HasPrefix(host, "[") {
+			host = "[" + host + "]"
+		}
+		target := "https://" + host + r.URL.RequestURI()
+		logger.TraceID("server", "redirect", "from", r.URL.String(), "to", target)
+		http.Redirect(w, r, target, http.StatusPermanentRedirect)
+	})
+}
@@ -0,0 +1,259 @@
+package wrserver
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/bruceesmith/terminator"
+)
+
+// writeCertificate writes a new self-signed certificate and its key as PEM
+// files, returning the certificate's serial number
+func writeCertificate(t *testing.T, certFile, keyFile string) string {
+	t.Helper()
+	cert, err := selfSignedCertificate()
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+	key, err := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+	if err != nil {
+		t.Fatalf("failed to marshal key: %v", err)
+	}
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]}), 0o644)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: key}), 0o600)
+	return cert.Leaf.SerialNumber.String()
+}
+
+// serial returns the serial number of the certificate served by cr
+func serial(t *testing.T, cr *certReloader) string {
+	t.Helper()
+	cert, err := cr.GetCertificate(nil)
+	if err != nil {
+		t.Fatalf("GetCertificate failed: %v", err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatalf("failed to parse certificate: %v", err)
+	}
+	return leaf.SerialNumber.String()
+}
+
+func TestSelfSignedCertificate(t *testing.T) {
+	cert, err := selfSignedCertificate()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, host := range []string{"localhost", "127.0.0.1", "::1"} {
+		if err := cert.Leaf.VerifyHostname(host); err != nil {
+			t.Errorf("certificate not valid for %s: %v", host, err)
+		}
+	}
+}
+
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+
+	if _, err := newCertReloader(certFile, keyFile); err == nil {
+		t.Fatal("expected an error for missing files, got nil")
+	}
+
+	first := writeCertificate(t, certFile, keyFile)
+	cr, err := newCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	now := time.Now()
+	cr.now = func() time.Time { return now }
+	if got := serial(t, cr); got != first {
+		t.Fatalf("got serial %s, want %s", got, first)
+	}
+
+	// A renewed certificate is only noticed once the interval has passed
+	second := writeCertificate(t, certFile, keyFile)
+	later := now.Add(time.Minute)
+	os.Chtimes(certFile, later, later)
+	os.Chtimes(keyFile, later, later)
+	if got := serial(t, cr); got != first {
+		t.Errorf("certificate reloaded before the interval, got serial %s", got)
+	}
+	now = now.Add(certReloadInterval)
+	if got := serial(t, cr); got != second {
+		t.Errorf("certificate not reloaded, got serial %s, want %s", got, second)
+	}
+
+	// A broken replacement keeps the previous certificate
+	os.WriteFile(certFile, []byte("not a certificate"), 0o644)
+	later = later.Add(time.Minute)
+	os.Chtimes(certFile, later, later)
+	now = now.Add(certReloadInterval)
+	if got := serial(t, cr); got != second {
+		t.Errorf("broken certificate replaced a good one, got serial %s", got)
+	}
+}
+
+func TestHTTPSRedirect(t *testing.T) {
+	tests := []struct {
+		name      string
+		httpsPort string
+		host      string
+		target    string
+		location  string
+	}{
+		{
+			name:      "host with port",
+			httpsPort: "8443",
+			host:      "example.org:8080",
+			target:    "/api/status?x=1",
+			location:  "https://example.org:8443/api/status?x=1",
+		},
+		{
+			name:      "host without port",
+			httpsPort: "8443",
+			host:      "example.org",
+			target:    "/",
+			location:  "https://example.org:8443/",
+		},
+		{
+			name:      "default HTTPS port",
+			httpsPort: "443",
+			host:      "example.org:80",
+			target:    "/wiki/Go",
+			location:  "https://example.org/wiki/Go",
+		},
+		{
+			name:      "IPv6 host",
+			httpsPort: "8443",
+			host:      "[::1]:8080",
+			target:    "/",
+			location:  "https://[::1]:8443/",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			req.Host = tt.host
+			w := httptest.NewRecorder()
+			httpsRedirect(tt.httpsPort).ServeHTTP(w, req)
+			if w.Code != http.StatusPermanentRedirect {
+				t.Errorf("got status %d, want %d", w.Code, http.StatusPermanentRedirect)
+			}
+			if got := w.Header().Get("Location"); got != tt.location {
+				t.Errorf("got Location %s, want %s", got, tt.location)
+			}
+		})
+	}
+}
+
+// freePort returns a port which is not in use
+func freePort(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to find a free port: %v", err)
+	}
+	defer l.Close()
+	return strconv.Itoa(l.Addr().(*net.TCPAddr).Port)
+}
+
+func TestServeTLS(t *testing.T) {
+	port, redirectPort := freePort(t), freePort(t)
+	options := DefaultServerOptions()
+	options.TLSSelfSigned = true
+	options.RedirectPort = redirectPort
+	options.Daily.Prepare = false
+	s, err := NewServerWithOptions(port, "testdata", &Client{}, options)
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	term := terminator.New()
+	go s.Serve(term)
+	defer term.Stop()
+
+	client := &http.Client{
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	get := func(url string) *http.Response {
+		for range 50 {
+			resp, err := client.Get(url)
+			if err == nil {
+				return resp
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+		t.Fatalf("no answer from %s", url)
+		return nil
+	}
+
+	resp := get("https://localhost:" + port + "/test.txt")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.TLS == nil {
+		t.Errorf("got status %d over TLS %v", resp.StatusCode, resp.TLS != nil)
+	}
+
+	resp = get("http://localhost:" + redirectPort + "/test.txt")
+	resp.Body.Close()
+	if want := "https://localhost:" + port + "/test.txt"; resp.StatusCode != http.StatusPermanentRedirect || resp.Header.Get("Location") != want {
+		t.Errorf("got status %d and Location %s, want a redirect to %s", resp.StatusCode, resp.Header.Get("Location"), want)
+	}
+}
+
+func TestNewServerWithOptions_TLS(t *testing.T) {
+	tests := []struct {
+		name    string
+		options func(ServerOptions) ServerOptions
+	}{
+		{
+			name: "missing certificate",
+			options: func(o ServerOptions) ServerOptions {
+				o.TLSCert, o.TLSKey = "missing.pem", "missing.key"
+				return o
+			},
+		},
+		{
+			name: "redirect without TLS",
+			options: func(o ServerOptions) ServerOptions {
+				o.RedirectPort = "8081"
+				return o
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewServerWithOptions("8080", "testdata", &Client{}, tt.options(DefaultServerOptions()))
+			if err == nil {
+				t.Error("expected an error, got nil")
+			}
+		})
+	}
+}
+
+func TestNewServerWithOptions_PrivilegedPort(t *testing.T) {
+	options := DefaultServerOptions()
+	options.TLSSelfSigned = true
+	options.RedirectPort = "80"
+	svr, err := NewServerWithOptions("443", "testdata", &Client{}, options)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	s := svr.(*Server)
+	if s.server.Addr != ":443" || s.server.TLSConfig == nil || s.redirect == nil || s.redirect.Addr != ":80" {
+		t.Errorf("got address %s, want HTTPS on :443 redirected from :80", s.server.Addr)
+	}
+}
@@ -0,0 +1,51 @@
+package wrserver
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// ErrWikiNotAllowed is returned when a request names a wiki which is not in
+// the allowlist
+var ErrWikiNotAllowed = errors.New("wiki not allowed")
+
+// wikiName matches Wikipedia language codes such as "de", "simple" or
+// "zh-yue", and the names given to other MediaWiki sites
+var wikiName = regexp.MustCompile(`^[a-z][a-z0-9-]*$`)
+
+// Wiki is a MediaWiki site which games may be played on
+type Wiki struct {
+	Name string // Name by which requests select the wiki, such as "de"
+	URL  string // Base URL of the site, such as https://de.wikipedia.org
+}
+
+// ParseWiki parses a wiki given as a Wikipedia language code such as "de",
+// as the base URL of a site, or as name=URL to give any MediaWiki site a
+// short name. The name of a site given only by URL is its Wikipedia language
+// code or, for other sites, its host name.
+func ParseWiki(spec string) (Wiki, error) {
+	name, base, named := strings.Cut(spec, "=")
+	if !named {
+		if !strings.Contains(spec, "://") {
+			if !wikiName.MatchString(spec) {
+				return Wiki{}, fmt.Errorf("'%s' is neither a language code nor a URL", spec)
+			}
+			return Wiki{Name: spec, URL: "https://" + spec + ".wikipedia.org"}, nil
+		}
+		name, base = "", spec
+	} else if !wikiName.MatchString(name) {
+		return Wiki{}, fmt.Errorf("'%s' is not a valid wiki name", name)
+	}
+
+	u, err := url.Parse(base)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return Wiki{}, fmt.Errorf("'%s' is not an absolute http or https URL", base)
+	}
+	if name == "" {
+		name = strings.TrimSuffix(u.Hostname(), ".wikipedia.org")
+	}
+	return Wiki{Name: name, URL: strings.TrimSuffix(base, "/")}, nil
+}
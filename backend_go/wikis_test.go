@@ -0,0 +1,83 @@
+package wrserver
+
+import (
+	"testing"
+)
+
+func TestParseWiki(t *testing.T) {
+	tests := []struct {
+		name       string
+		spec       string
+		want       Wiki
+		shouldFail bool
+	}{
+		{
+			name: "language code",
+			spec: "de",
+			want: Wiki{Name: "de", URL: "https://de.wikipedia.org"},
+		},
+		{
+			name: "hyphenated language code",
+			spec: "zh-yue",
+			want: Wiki{Name: "zh-yue", URL: "https://zh-yue.wikipedia.org"},
+		},
+		{
+			name: "Wikipedia URL",
+			spec: "https://ja.wikipedia.org/",
+			want: Wiki{Name: "ja", URL: "https://ja.wikipedia.org"},
+		},
+		{
+			name: "other MediaWiki URL",
+			spec: "https://wiki.example.org",
+			want: Wiki{Name: "wiki.example.org", URL: "https://wiki.example.org"},
+		},
+		{
+			name: "named site",
+			spec: "example=http://localhost:8888",
+			want: Wiki{Name: "example", URL: "http://localhost:8888"},
+		},
+		{
+			name:       "upper case code",
+			spec:       "DE",
+			shouldFail: true,
+		},
+		{
+			name:       "host without scheme",
+			spec:       "de.wikipedia.org",
+			shouldFail: true,
+		},
+		{
+			name:       "bad name",
+			spec:       "Example Wiki=https://wiki.example.org",
+			shouldFail: true,
+		},
+		{
+			name:       "named site without URL",
+			spec:       "example=",
+			shouldFail: true,
+		},
+		{
+			name:       "unsupported scheme",
+			spec:       "ftp://wiki.example.org",
+			shouldFail: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseWiki(tt.spec)
+			if tt.shouldFail {
+				if err == nil {
+					t.Errorf("expected error, got %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
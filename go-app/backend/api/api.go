@@ -1,8 +1,59 @@
 /*
 Package api defines the external REST API of the backend
+
+A request which fails is answered with the ErrorResponse of the wrserver
+api package, whose code decides the HTTP status, rather than with any of
+the responses here.
 */
 package api
 
+import wrapi "github.com/bruceesmith/wrspa/backend/wrserver/api"
+
+// AnalysedPage is one page of the path taken in a game
+// It contains the subject of the page, the time into the game at which it
+// was reached and the number of links from it to the goal
+type AnalysedPage struct {
+	Subject   string `json:"subject"`
+	ElapsedMS int64  `json:"elapsedms"`
+	Hops      int    `json:"hops"`
+	Bound     bool   `json:"bound"` // Hops is only an upper bound, the exploration having run out of budget
+}
+
+// AnalysisResponse is the response for the analysis endpoint
+// It compares the path taken in a finished game with the shortest paths
+// from the start to the goal
+type AnalysisResponse struct {
+	Path      []AnalysedPage `json:"path"`
+	Steps     int            `json:"steps"`     // Links followed by the player
+	Shortest  int            `json:"shortest"`  // Links on a shortest path, an upper bound if Path[0].Bound
+	Deviation int            `json:"deviation"` // Index in Path of the first page on no shortest path, or -1
+}
+
+// DailyResponse is the response for the daily endpoint
+// It contains the Wikipedia start and goal subjects shared by every player
+// on a UTC date, and the length of the shortest path found between them
+type DailyResponse struct {
+	Date   string `json:"date"`
+	Start  string `json:"start"`
+	Goal   string `json:"goal"`
+	Length int    `json:"length"`
+}
+
+// GameRequest is the request for the game endpoint
+// It contains the start and goal subjects of a game which is beginning
+type GameRequest struct {
+	Start string `json:"start"`
+	Goal  string `json:"goal"`
+}
+
+// GameResponse is the response for the game endpoint
+// It contains the ID under which the pages visited in the game are
+// recorded, and the canonical subject of the goal after any redirect
+type GameResponse struct {
+	ID   string `json:"id"`
+	Goal string `json:"goal"`
+}
+
 // SettingsResponse is the response for the settings endpoint
 // It contains the log level and the trace IDs that are used for tracing
 type SettingsResponse struct {
@@ -21,6 +72,10 @@ type SpecialRandomResponse struct {
 type EndPoint string
 
 const (
+	Analysis      EndPoint = "analysis"      // Analysis of a finished game endpoint
+	Daily         EndPoint = "daily"         // Daily challenge endpoint
+	Game          EndPoint = "game"          // Game recording endpoint
+	OpenAPI       EndPoint = "openapi.json"  // OpenAPI document endpoint
 	Settings      EndPoint = "settings"      // Settings endpoint
 	SpecialRandom EndPoint = "specialrandom" // Special random endpoint
 	WikiPage      EndPoint = "wikipage"      // Wikipedia page endpoint
@@ -28,15 +83,15 @@ const (
 
 // WikiPageRequest is the request for the wikipage endpoint
 // It contains the either the subject of the Wikipedia page to be retrieved
-// or the link to an asset on the Wikipedia website
+// or the link to an asset on the Wikipedia website, and the ID of the game,
+// if any, in which the page is being visited
 type WikiPageRequest struct {
 	Subject string `json:"subject"`
+	Game    string `json:"game,omitempty"`
 }
 
-// WikiPageResponse is the response for the wikipage endpoint
-// It contains either a (string) page HTML or a (binary) asset,
-// and an error message if the page or asset could not be retrieved
-type WikiPageResponse struct {
-	Page  string `json:"page"`
-	Error string `json:"error"`
-}
+// WikiPageResponse is the response for the wikipage endpoint to a client
+// which prefers JSON to HTML
+// It is the page, in the form shared with wrserver, with its canonical
+// title, revision, links and sections
+type WikiPageResponse = wrapi.Page
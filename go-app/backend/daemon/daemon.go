@@ -8,6 +8,7 @@ import (
 	"context"
 	"fmt"
 
+	"github.com/bruceesmith/wrspa/backend/wrserver/sanitize"
 	"github.com/bruceesmith/wrspa/go-app/backend/server"
 	"github.com/bruceesmith/wrspa/go-app/frontend/game"
 	"github.com/bruceesmith/logger"
@@ -22,7 +23,15 @@ func Daemon(ctx context.Context, cmd *cli.Command) error {
 		svr *server.Server
 	)
 	if app.IsServer {
-		svr, err = server.New(cmd.String("port"))
+		var sanitizer *sanitize.Options
+		if cmd.Bool("sanitize") {
+			sanitizer = &sanitize.Options{
+				Styles:     cmd.Bool("sanitize-styles"),
+				Elements:   cmd.StringSlice("sanitize-elements"),
+				Attributes: cmd.StringSlice("sanitize-attributes"),
+			}
+		}
+		svr, err = server.New(cmd.String("port"), sanitizer)
 		if err != nil {
 			logger.Error("initialisation error", "error", err.Error())
 			err = fmt.Errorf("initialisation error: [%w]", err)
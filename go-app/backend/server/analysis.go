@@ -0,0 +1,221 @@
+package server
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"maps"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bruceesmith/wrspa/backend/wrserver/links"
+	"github.com/bruceesmith/wrspa/backend/wrserver/title"
+	"github.com/bruceesmith/wrspa/go-app/backend/api"
+	"golang.org/x/net/html"
+)
+
+const (
+	analysisDepth   = 3                // Most links followed outward from a visited page
+	analysisPages   = 500              // Most pages fetched to analyse one game
+	analysisFetches = 4                // Most pages fetched at once to analyse one game
+	analysisTimeout = 30 * time.Second // Longest taken to analyse one game, after which the hops not yet known are bounds
+)
+
+// parsePage parses a page fetched for a subject, as wrserver does, returning
+// its canonical subject after any redirect, which defaults to the subject
+// requested, and the articles it links to, sorted
+func parsePage(subject, page string) (canonical string, articles []string, err error) {
+	doc, err := html.Parse(strings.NewReader(page))
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to parse html: %w", err)
+	}
+	return cmp.Or(links.Canonical(doc, title.English), title.Path(subject)), slices.Sorted(maps.Keys(links.Outbound(doc, title.English))), nil
+}
+
+// canonical returns the normalised subject of a page after any redirect,
+// which defaults to the subject requested
+func canonical(subject, page string) string {
+	c, _, err := parsePage(subject, page)
+	if err != nil {
+		return title.Path(subject)
+	}
+	return c
+}
+
+// explorer follows links outward from pages, fetching each page at most
+// once, no more than budget pages in all and no more than analysisFetches at
+// once. It stops fetching when its context is done.
+type explorer struct {
+	ctx   context.Context
+	slots chan struct{} // Holds a token for each fetch under way
+
+	mu     sync.Mutex
+	links  map[string][]string
+	budget int
+}
+
+// newExplorer returns an explorer which fetches pages until ctx is done
+func newExplorer(ctx context.Context) *explorer {
+	return &explorer{
+		ctx:    ctx,
+		slots:  make(chan struct{}, analysisFetches),
+		links:  make(map[string][]string),
+		budget: analysisPages,
+	}
+}
+
+// linksOf returns the articles linked from a page; ok is false if the page
+// could not be fetched within the budget, or before ctx was done
+func (e *explorer) linksOf(ctx context.Context, subject string) (articles []string, ok bool) {
+	e.mu.Lock()
+	if articles, found := e.links[subject]; found {
+		e.mu.Unlock()
+		return articles, true
+	}
+	if e.budget <= 0 {
+		e.mu.Unlock()
+		return nil, false
+	}
+	e.budget--
+	e.mu.Unlock()
+
+	page, err := getString(ctx, (&url.URL{Path: subject}).EscapedPath())
+	if err != nil {
+		return nil, false
+	}
+	_, articles, err = parsePage(subject, page)
+	if err != nil {
+		return nil, false
+	}
+	e.mu.Lock()
+	e.links[subject] = articles
+	e.mu.Unlock()
+	return articles, true
+}
+
+// expand returns the articles linked from each page of a frontier, fetching
+// the pages concurrently. It stops early, with found true, once a page links
+// to the goal, cancelling the fetches under way; ok is false if any page
+// could not be fetched.
+func (e *explorer) expand(frontier []string, goal string) (linked [][]string, found, ok bool) {
+	ctx, cancel := context.WithCancel(e.ctx)
+	defer cancel()
+	linked = make([][]string, len(frontier))
+	failed := make([]bool, len(frontier))
+	var (
+		wg      sync.WaitGroup
+		reached atomic.Bool
+	)
+	for i, subject := range frontier {
+		select {
+		case e.slots <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			failed[i] = true
+			continue
+		}
+		wg.Go(func() {
+			defer func() { <-e.slots }()
+			articles, ok := e.linksOf(ctx, subject)
+			linked[i], failed[i] = articles, !ok
+			if slices.Contains(articles, goal) {
+				reached.Store(true)
+				cancel()
+			}
+		})
+	}
+	wg.Wait()
+	return linked, reached.Load(), !slices.Contains(failed, true)
+}
+
+// distance searches breadth-first from a page for the goal, following no
+// more than limit links. It returns the links followed to reach the goal,
+// or zero if the goal was not found; complete is false if the budget or the
+// time ran out before the search did.
+func (e *explorer) distance(from, goal string, limit int) (hops int, complete bool) {
+	frontier := []string{from}
+	seen := map[string]bool{from: true}
+	for depth := 1; depth <= limit; depth++ {
+		linked, found, ok := e.expand(frontier, goal)
+		switch {
+		case found:
+			return depth, true
+		case !ok:
+			return 0, false
+		}
+		var next []string
+		for _, articles := range linked {
+			for _, link := range articles {
+				if !seen[link] {
+					seen[link] = true
+					next = append(next, link)
+				}
+			}
+		}
+		frontier = next
+	}
+	return 0, true
+}
+
+// analyse compares the path taken in a finished game with the shortest
+// paths. The pages are explored from the goal backwards along the path,
+// since a page is never further from the goal than one more link than the
+// page visited after it, and that bound limits each exploration. A game
+// which has not reached its goal is not analysed. Pages are fetched until
+// ctx is done, after which the hops not yet known are bounds.
+func analyse(ctx context.Context, g game) (response api.AnalysisResponse, err error) {
+	n := len(g.moves)
+	goal := title.Path(g.goal)
+	if n == 0 || title.Path(g.moves[n-1].subject) != goal {
+		err = errNotFinished
+		return
+	}
+
+	e := newExplorer(ctx)
+	exact := make(map[string]int)
+	response.Path = make([]api.AnalysedPage, n)
+	for i := n - 1; i >= 0; i-- {
+		subject := title.Path(g.moves[i].subject)
+		page := &response.Path[i]
+		page.Subject, page.ElapsedMS = g.moves[i].subject, g.moves[i].at.Milliseconds()
+		if subject == goal {
+			continue
+		}
+		if hops, found := exact[subject]; found {
+			page.Hops = hops
+			continue
+		}
+
+		upper := response.Path[i+1].Hops + 1
+		limit := min(upper-1, analysisDepth)
+		hops, complete := e.distance(subject, goal, limit)
+		switch {
+		case hops > 0:
+			page.Hops = hops
+		case complete && limit == upper-1:
+			// Not nearer than the path the player took from here
+			page.Hops = upper
+		default:
+			page.Hops, page.Bound = upper, true
+		}
+		if !page.Bound {
+			exact[subject] = page.Hops
+		}
+	}
+
+	response.Steps = n - 1
+	response.Shortest = response.Path[0].Hops
+	response.Deviation = -1
+	for i, page := range response.Path {
+		if !page.Bound && i+page.Hops > response.Shortest {
+			response.Deviation = i
+			break
+		}
+	}
+	return
+}
@@ -0,0 +1,213 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	wrapi "github.com/bruceesmith/wrspa/backend/wrserver/api"
+	"github.com/bruceesmith/wrspa/go-app/backend/api"
+)
+
+// testWiki serves each page of a wiki, given as the titles it links to, and
+// counts the pages fetched. Every other page is not found.
+func testWiki(t *testing.T, pages map[string][]string) *atomic.Int32 {
+	t.Helper()
+	var fetched atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		links, found := pages[strings.TrimPrefix(r.URL.Path, "/wiki/")]
+		if !found {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		fetched.Add(1)
+		var b strings.Builder
+		b.WriteString(`<html><head><link href="/wiki/Ignored" rel="stylesheet"></head><body>`)
+		for _, link := range links {
+			b.WriteString(`<a href='/wiki/` + link + `'>` + link + `</a>`)
+		}
+		b.WriteString(`<a href="/wiki/File:Goal.png">not a move</a></body></html>`)
+		w.Write([]byte(b.String()))
+	}))
+	t.Cleanup(server.Close)
+	previous := wikiURL
+	wikiURL = server.URL
+	t.Cleanup(func() { wikiURL = previous })
+	return &fetched
+}
+
+// testGame returns a game which visited pages in order
+func testGame(goal string, visited ...string) game {
+	g := game{start: "/wiki/" + visited[0], goal: "/wiki/" + goal}
+	for _, subject := range visited {
+		g.moves = append(g.moves, move{subject: "/wiki/" + subject})
+	}
+	return g
+}
+
+func TestAnalyse(t *testing.T) {
+	testWiki(t, map[string][]string{
+		"Start":   {"A", "B"},
+		"Begin":   {"Far"},
+		"A":       {"Goal"},
+		"B":       {"C"},
+		"C":       {"Goal"},
+		"Goal":    {},
+		"Far":     {"Farther"},
+		"Farther": {"Further"},
+		"Further": {"Distant"},
+		"Distant": {"Goal"},
+		"Lost":    {"Missing"},
+	})
+
+	tests := []struct {
+		name      string
+		game      game
+		ctx       func() context.Context
+		hops      []int
+		bound     []bool
+		shortest  int
+		deviation int
+		wantErr   error
+	}{
+		{
+			name:      "shortest",
+			game:      testGame("Goal", "Start", "A", "Goal"),
+			hops:      []int{2, 1, 0},
+			bound:     []bool{false, false, false},
+			shortest:  2,
+			deviation: -1,
+		},
+		{
+			name:      "deviation",
+			game:      testGame("Goal", "Start", "B", "C", "Goal"),
+			hops:      []int{2, 2, 1, 0},
+			bound:     []bool{false, false, false, false},
+			shortest:  2,
+			deviation: 1,
+		},
+		{
+			// Begin is explored no further than analysisDepth, which finds
+			// no path shorter than the one taken, so its hops are a bound
+			name:      "bound",
+			game:      testGame("Goal", "Begin", "Far", "Farther", "Further", "Distant", "Goal"),
+			hops:      []int{5, 4, 3, 2, 1, 0},
+			bound:     []bool{true, false, false, false, false, false},
+			shortest:  5,
+			deviation: -1,
+		},
+		{
+			name:      "page not found",
+			game:      testGame("Goal", "Lost", "Start", "A", "Goal"),
+			hops:      []int{3, 2, 1, 0},
+			bound:     []bool{true, false, false, false},
+			shortest:  3,
+			deviation: -1,
+		},
+		{
+			// A's hops are known without fetching it, but Start's are not
+			name: "no time",
+			game: testGame("Goal", "Start", "A", "Goal"),
+			ctx: func() context.Context {
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+				return ctx
+			},
+			hops:      []int{2, 1, 0},
+			bound:     []bool{true, false, false},
+			shortest:  2,
+			deviation: -1,
+		},
+		{
+			name:    "not finished",
+			game:    testGame("Goal", "Start", "A"),
+			wantErr: errNotFinished,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.ctx != nil {
+				ctx = tt.ctx()
+			}
+			got, err := analyse(ctx, tt.game)
+			if err != tt.wantErr {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			var hops []int
+			var bound []bool
+			for _, page := range got.Path {
+				hops, bound = append(hops, page.Hops), append(bound, page.Bound)
+			}
+			if !reflect.DeepEqual(hops, tt.hops) || !reflect.DeepEqual(bound, tt.bound) {
+				t.Errorf("got hops %v bound %v, want %v %v", hops, bound, tt.hops, tt.bound)
+			}
+			if got.Steps != len(tt.game.moves)-1 || got.Shortest != tt.shortest || got.Deviation != tt.deviation {
+				t.Errorf("got steps %d shortest %d deviation %d, want %d %d %d",
+					got.Steps, got.Shortest, got.Deviation, len(tt.game.moves)-1, tt.shortest, tt.deviation)
+			}
+		})
+	}
+}
+
+func TestAnalysisHandler(t *testing.T) {
+	fetched := testWiki(t, map[string][]string{
+		"Start": {"A"},
+		"A":     {"Goal"},
+		"Goal":  {},
+	})
+	a := apiHandler{games: newGames()}
+	finished, _ := a.games.create("/wiki/Start", "/wiki/Goal")
+	for _, subject := range []string{"/wiki/Start", "/wiki/A", "/wiki/Goal"} {
+		a.games.record(finished, subject)
+	}
+	unfinished, _ := a.games.create("/wiki/Start", "/wiki/Goal")
+	a.games.record(unfinished, "/wiki/Start")
+
+	tests := []struct {
+		name       string
+		game       string
+		statusCode int
+		code       wrapi.ErrorCode
+		shortest   int
+		fetched    int32
+	}{
+		{name: "finished", game: finished, statusCode: http.StatusOK, shortest: 2, fetched: 1},
+		{name: "cached", game: finished, statusCode: http.StatusOK, shortest: 2, fetched: 1},
+		{name: "unknown game", game: "unknown", statusCode: http.StatusNotFound, code: wrapi.CodeNotFound, fetched: 1},
+		{name: "not finished", game: unfinished, statusCode: http.StatusConflict, code: wrapi.CodeGameState, fetched: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			a.Analysis(w, httptest.NewRequest(http.MethodGet, "/api/v1/analysis?game="+tt.game, nil))
+			if w.Code != tt.statusCode {
+				t.Fatalf("got status code %d, want %d: %s", w.Code, tt.statusCode, w.Body.String())
+			}
+			if tt.code != "" {
+				var failure wrapi.ErrorResponse
+				if err := json.Unmarshal(w.Body.Bytes(), &failure); err != nil || failure.Error.Code != tt.code {
+					t.Errorf("got %s, want code %s", w.Body.String(), tt.code)
+				}
+			} else {
+				var analysis api.AnalysisResponse
+				if err := json.Unmarshal(w.Body.Bytes(), &analysis); err != nil || analysis.Shortest != tt.shortest {
+					t.Errorf("got %s, want shortest %d", w.Body.String(), tt.shortest)
+				}
+			}
+			if got := fetched.Load(); got != tt.fetched {
+				t.Errorf("got %d pages fetched, want %d", got, tt.fetched)
+			}
+		})
+	}
+}
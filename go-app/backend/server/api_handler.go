@@ -1,33 +1,185 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"io"
 	"net/http"
+	"net/url"
 	"strings"
 
+	wrapi "github.com/bruceesmith/wrspa/backend/wrserver/api"
+	"github.com/bruceesmith/wrspa/backend/wrserver/openapi"
+	"github.com/bruceesmith/wrspa/backend/wrserver/sanitize"
+	"github.com/bruceesmith/wrspa/backend/wrserver/title"
 	"github.com/bruceesmith/wrspa/go-app/backend/api"
 	"github.com/bruceesmith/logger"
 )
 
 // apiHandler handles REST requests to the various /api/ endpoints
 type apiHandler struct {
+	daily     *dailies
+	games     *games
+	router    *http.ServeMux
+	spec      *openapi.Document // describes router
+	sanitizer *sanitize.Policy  // nil if pages are passed through unchanged
 }
 
-// ServeHTTP is the request handler
+// routeMethods are the methods for which a path is tried when finding those
+// it allows. HEAD is allowed wherever GET is, and OPTIONS everywhere.
+var routeMethods = []string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+
+// routes returns the router of the endpoints, and the OpenAPI document
+// which describes it, as in wrserver. Each endpoint is registered with its
+// operation, whose schemas are generated from the types of package api. The
+// patterns are lowercase, and are matched against the lowercased path of a
+// request.
+func (a apiHandler) routes() (*http.ServeMux, *openapi.Document) {
+	mux := http.NewServeMux()
+	doc := openapi.New(openapi.Info{
+		Title:   "WikiRacing go-app",
+		Version: strings.Trim(strings.TrimPrefix(wrapi.Prefix, "/api/"), "/"),
+		Description: "The REST API of the backend of go-app. Every failure is an ErrorResponse, whose code decides its status. " +
+			"The same paths without " + wrapi.Prefix + " in place of /api/ are deprecated aliases.",
+	})
+	// The handlers are bound to copies of a, which must already hold the
+	// document that the OpenAPI endpoint serves
+	a.spec = doc
+	add := func(method string, endpoint api.EndPoint, handler http.HandlerFunc, operation openapi.Operation) {
+		path := wrapi.Prefix + string(endpoint)
+		mux.HandleFunc(method+" "+strings.ToLower(path), handler)
+		operation.Responses["default"] = openapi.Response{Description: "A failure", Content: doc.JSON(wrapi.ErrorResponse{})}
+		doc.Add(method, path, operation)
+	}
+	ok := func(description string, content map[string]openapi.MediaType) map[string]openapi.Response {
+		return map[string]openapi.Response{"200": {Description: description, Content: content}}
+	}
+	query := func(name, description string) []openapi.Parameter {
+		return []openapi.Parameter{{Name: name, In: "query", Description: description, Schema: &openapi.Schema{Type: "string"}}}
+	}
+
+	add(http.MethodGet, api.Analysis, a.Analysis, openapi.Operation{
+		OperationID: "getAnalysis",
+		Summary:     "Compare the path taken in a finished game with the shortest paths",
+		Parameters:  query("game", "ID of the game"),
+		Responses:   ok("The analysis", doc.JSON(api.AnalysisResponse{})),
+	})
+	add(http.MethodGet, api.Daily, a.Daily, openapi.Operation{
+		OperationID: "getDaily",
+		Summary:     "The daily challenge of today or of a date",
+		Parameters:  query("date", "UTC date as YYYY-MM-DD; today if not given"),
+		Responses:   ok("The daily challenge", doc.JSON(api.DailyResponse{})),
+	})
+	add(http.MethodPost, api.Game, a.Game, openapi.Operation{
+		OperationID: "createGame",
+		Summary:     "Begin the record of a game, so that it can be analysed when finished",
+		RequestBody: &openapi.RequestBody{Required: true, Content: doc.JSON(api.GameRequest{})},
+		Responses:   ok("The game", doc.JSON(api.GameResponse{})),
+	})
+	add(http.MethodGet, api.Settings, a.Settings, openapi.Operation{
+		OperationID: "getSettings",
+		Summary:     "The log level and trace IDs of the server",
+		Responses:   ok("The settings", doc.JSON(api.SettingsResponse{})),
+	})
+	add(http.MethodGet, api.SpecialRandom, a.SpecialRandom, openapi.Operation{
+		OperationID: "getSpecialRandom",
+		Summary:     "A random start and goal",
+		Responses:   ok("The start and goal", doc.JSON(api.SpecialRandomResponse{})),
+	})
+	add(http.MethodPost, api.WikiPage, a.WikiPage, openapi.Operation{
+		OperationID: "getWikiPage",
+		Summary:     "A page of Wikipedia, or an asset of its website",
+		Description: "A client which prefers JSON to HTML in its Accept header is sent the page with its metadata, and any other its HTML alone.",
+		RequestBody: &openapi.RequestBody{Required: true, Content: doc.JSON(api.WikiPageRequest{})},
+		Responses: ok("The page", map[string]openapi.MediaType{
+			wrapi.MediaTypeJSON: {Schema: doc.Schema(api.WikiPageResponse{})},
+			wrapi.MediaTypeHTML: {Schema: &openapi.Schema{Type: "string"}},
+		}),
+	})
+	add(http.MethodGet, api.OpenAPI, a.OpenAPI, openapi.Operation{
+		OperationID: "getOpenAPI",
+		Summary:     "This document",
+		Responses:   ok("The OpenAPI document", map[string]openapi.MediaType{wrapi.MediaTypeJSON: {}}),
+	})
+	return mux, doc
+}
+
+// ServeHTTP is the request handler. Every request is given an ID, as in
+// wrserver, which is returned in the X-Request-Id header and reported with
+// any failure. A request is passed to the handler of its endpoint whatever
+// the case of its path, such as /api/v1/SpecialRandom. A path without the
+// version of the prefix is a deprecated alias, whose response says so in
+// its Deprecation header and links to its successor. A request for no
+// endpoint fails with not_found, and one with a method which its endpoint
+// does not allow fails with method_not_allowed and the Allow header. A
+// request with OPTIONS is answered with the Allow header alone.
 func (a apiHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	function := api.EndPoint(strings.ToLower(strings.TrimPrefix(r.URL.Path, "/api/")))
-	switch {
-	case r.Method == http.MethodGet && function == api.Settings:
-		a.Settings(w, r)
-		return
-	case r.Method == http.MethodGet && function == api.SpecialRandom:
-		a.SpecialRandom(w, r)
+	w.Header().Set(wrapi.HeaderRequestID, requestID(r))
+	route := r.Clone(r.Context())
+	route.URL.Path = strings.ToLower(r.URL.Path)
+	route.URL.RawPath = ""
+	if rest, found := strings.CutPrefix(route.URL.Path, "/api/"); found && !strings.HasPrefix(route.URL.Path, wrapi.Prefix) {
+		w.Header().Set("Deprecation", "true")
+		w.Header().Set("Link", "<"+wrapi.Prefix+strings.TrimPrefix(r.URL.Path, "/api/")+`>; rel="successor-version"`)
+		route.URL.Path = wrapi.Prefix + rest
+	}
+	if _, pattern := a.router.Handler(route); pattern != "" && r.Method != http.MethodOptions {
+		a.router.ServeHTTP(w, route)
 		return
-	case r.Method == http.MethodPost && function == api.WikiPage:
-		a.WikiPage(w, r)
+	}
+	function := strings.TrimPrefix(route.URL.Path, wrapi.Prefix)
+	var methods []string
+	probe := *route
+	for _, method := range routeMethods {
+		probe.Method = method
+		if _, pattern := a.router.Handler(&probe); pattern != "" {
+			methods = append(methods, method)
+		}
+	}
+	switch {
+	case len(methods) == 0:
+		handleError(w, function, errors.New("no such endpoint: "+r.URL.Path), wrapi.CodeNotFound)
+	case r.Method == http.MethodOptions:
+		w.Header().Set("Allow", strings.Join(append(methods, http.MethodOptions), ", "))
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", strings.Join(append(methods, http.MethodOptions), ", "))
+		handleError(w, function, errors.New("method "+r.Method+" not allowed"), wrapi.CodeMethodNotAllowed)
+	}
+}
+
+// Daily is the handler for the /api/daily REST endpoint, which returns the
+// daily challenge of today or of the date query parameter
+func (a apiHandler) Daily(w http.ResponseWriter, r *http.Request) {
+	date := r.URL.Query().Get("date")
+	if date == "" {
+		date = today()
+	}
+	response, err := a.daily.get(r.Context(), date)
+	if err != nil {
+		handleError(w, "daily", err, errorCode(err))
 		return
 	}
+	jason, err := json.Marshal(response)
+	if err != nil {
+		handleError(w, "daily", err, wrapi.CodeInternal)
+	} else {
+		w.Header().Set("Content-Type", wrapi.MediaTypeJSON)
+		w.Write(jason)
+	}
+}
+
+// OpenAPI is the handler for the /api/v1/openapi.json REST endpoint, which
+// describes the REST API as an OpenAPI 3 document
+func (a apiHandler) OpenAPI(w http.ResponseWriter, r *http.Request) {
+	jason, err := json.Marshal(a.spec)
+	if err != nil {
+		handleError(w, "openapi", err, wrapi.CodeInternal)
+	} else {
+		w.Header().Set("Content-Type", wrapi.MediaTypeJSON)
+		w.Write(jason)
+	}
 }
 
 // Settings is the handler for the /api/settings REST endpoint
@@ -40,8 +192,9 @@ func (a apiHandler) Settings(w http.ResponseWriter, r *http.Request) {
 	}
 	jason, err := json.Marshal(response)
 	if err != nil {
-		w.Write([]byte(marshalFailure("settings", err, response)))
+		handleError(w, "settings", err, wrapi.CodeInternal)
 	} else {
+		w.Header().Set("Content-Type", wrapi.MediaTypeJSON)
 		w.Write(jason)
 	}
 }
@@ -54,8 +207,9 @@ func (a apiHandler) SpecialRandom(w http.ResponseWriter, r *http.Request) {
 	}
 	jason, err := json.Marshal(response)
 	if err != nil {
-		w.Write([]byte(marshalFailure("specialrandom", err, response)))
+		handleError(w, "specialrandom", err, wrapi.CodeInternal)
 	} else {
+		w.Header().Set("Content-Type", wrapi.MediaTypeJSON)
 		w.Write(jason)
 	}
 }
@@ -65,33 +219,124 @@ func (a apiHandler) WikiPage(w http.ResponseWriter, r *http.Request) {
 	// Extract the subject from the POST requst
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
-		logger.Error("wikipage request failure", "error", err.Error())
-		w.Write([]byte(marshalFailure("wikipage", err, body)))
+		handleError(w, "wikipage", err, wrapi.CodeInvalidRequest)
 		return
 	}
 	var request api.WikiPageRequest
 	err = json.Unmarshal(body, &request)
 	if err != nil {
-		logger.Error("wikipage request failure", "error", err.Error())
-		w.Write([]byte(marshalFailure("wikipage", err, body)))
+		handleError(w, "wikipage", err, wrapi.CodeInvalidRequest)
 		return
 	}
 	// Fetch the wiki page for the requested aubject
-	page, err := getString(request.Subject)
+	page, err := getString(r.Context(), request.Subject)
 	if err != nil {
-		logger.Error("wikipage fetch failure", "error", err.Error())
+		handleError(w, "wikipage", err, errorCode(err))
+		return
 	}
-	// Package up a JSON response
-	response := api.WikiPageResponse{
-		Page: page,
+	response, err := extractPage(a.sanitizer, request.Subject, page)
+	if err != nil {
+		handleError(w, "wikipage", err, wrapi.CodeInternal)
+		return
+	}
+	// Pages are recorded by their canonical subject, so that a redirect
+	// to the goal reaches it
+	if response.Title != "" {
+		w.Header().Set("Content-Location", (&url.URL{Path: title.Path(response.Title)}).EscapedPath())
+		if request.Game != "" {
+			a.games.record(request.Game, title.Path(response.Title))
+		}
+	}
+	// A client which prefers JSON is sent the page with its metadata, and
+	// any other just its HTML
+	w.Header().Set("Vary", "Accept")
+	if !wrapi.PrefersJSON(r.Header.Get("Accept")) {
+		w.Header().Set("Content-Type", wrapi.MediaTypeHTML)
+		w.Write([]byte(response.HTML))
+		return
+	}
+	jason, err := json.Marshal(response)
+	if err != nil {
+		handleError(w, "wikipage", err, wrapi.CodeInternal)
+	} else {
+		w.Header().Set("Content-Type", wrapi.MediaTypeJSON)
+		w.Write(jason)
+	}
+}
+
+// Game is the handler for the /api/game REST endpoint, which begins the
+// record of a game so that it can be analysed when finished
+func (a apiHandler) Game(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		handleError(w, "game", err, wrapi.CodeInvalidRequest)
+		return
+	}
+	var request api.GameRequest
+	err = json.Unmarshal(body, &request)
+	if err != nil {
+		handleError(w, "game", err, wrapi.CodeInvalidRequest)
+		return
+	}
+	// The goal is fetched to learn its canonical subject, which it keeps
+	// if it cannot be fetched
+	var response api.GameResponse
+	response.Goal = request.Goal
+	if strings.HasPrefix(request.Goal, "/wiki/") {
+		if page, err := getString(r.Context(), request.Goal); err == nil {
+			response.Goal = canonical(request.Goal, page)
+		}
 	}
+	response.ID, err = a.games.create(request.Start, response.Goal)
+	if err != nil {
+		handleError(w, "game", err, errorCode(err))
+		return
+	}
+	jason, err := json.Marshal(response)
 	if err != nil {
-		response.Error = err.Error()
+		handleError(w, "game", err, wrapi.CodeInternal)
+	} else {
+		w.Header().Set("Content-Type", wrapi.MediaTypeJSON)
+		w.Write(jason)
+	}
+}
+
+// Analysis is the handler for the /api/analysis REST endpoint, which
+// compares the path taken in a finished game with the shortest paths
+func (a apiHandler) Analysis(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("game")
+	g, found := a.games.get(id)
+	if !found {
+		handleError(w, "analysis", errGameNotFound, wrapi.CodeNotFound)
+		return
+	}
+	var response api.AnalysisResponse
+	if g.analysis != nil {
+		response = *g.analysis
+	} else {
+		// The exploration ends if the client goes away, and in any case
+		// after analysisTimeout, when the hops not yet known are bounds.
+		// Only an analysis finished in time is kept.
+		ctx, cancel := context.WithTimeout(r.Context(), analysisTimeout)
+		defer cancel()
+		var err error
+		response, err = analyse(ctx, g)
+		if err != nil {
+			handleError(w, "analysis", err, errorCode(err))
+			return
+		}
+		if r.Context().Err() != nil {
+			return
+		}
+		if ctx.Err() == nil {
+			a.games.analysed(id, len(g.moves), response)
+		}
 	}
 	jason, err := json.Marshal(response)
 	if err != nil {
-		w.Write([]byte(marshalFailure("wikipage", err, response)))
+		handleError(w, "analysis", err, wrapi.CodeInternal)
 	} else {
+		w.Header().Set("Content-Type", wrapi.MediaTypeJSON)
 		w.Write(jason)
 	}
 }
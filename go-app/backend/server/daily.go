@@ -0,0 +1,153 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/bruceesmith/logger"
+	"github.com/bruceesmith/wrspa/go-app/backend/api"
+)
+
+const (
+	dailyAttempts = 10          // Candidate pairs tried for a date before giving up
+	dailyDepth    = 4           // Most links followed when checking that a pair is solvable
+	dailyTimeout  = time.Minute // Longest taken to choose the daily of a date
+)
+
+// dailyArticles are the candidates for the daily challenge. They are broad
+// articles with many links, so that most pairs are solvable.
+var dailyArticles = []string{
+	"Albert_Einstein", "Ancient_Egypt", "Association_football", "Australia",
+	"Bicycle", "Black_hole", "Chess", "Chocolate", "Climate_change", "Coffee",
+	"Computer", "DNA", "Dinosaur", "Electricity", "French_Revolution",
+	"Honey_bee", "Internet", "Jazz", "Leonardo_da_Vinci", "Moon",
+	"Mount_Everest", "Olympic_Games", "Penguin", "Photosynthesis", "Pizza",
+	"Roman_Empire", "Shakespeare", "Silk_Road", "Tea", "The_Beatles",
+	"Volcano", "World_War_II",
+}
+
+// dailies chooses and remembers the daily challenge of each UTC date. The
+// candidates for a date are drawn by a generator seeded with the date, so
+// that every player is given the same pair, and the first candidate found
+// to be solvable is chosen.
+type dailies struct {
+	choosing sync.Mutex // Held while a daily is chosen, so that each is chosen once
+	mu       sync.Mutex
+	history  map[string]api.DailyResponse // By date
+}
+
+// newDailies returns an empty record of dailies
+func newDailies() *dailies {
+	return &dailies{
+		history: make(map[string]api.DailyResponse),
+	}
+}
+
+// today returns the current UTC date
+func today() string {
+	return time.Now().UTC().Format(time.DateOnly)
+}
+
+// get returns the daily challenge of a date, which is chosen if it is
+// today's; past dailies are only known if they were chosen by this server
+func (d *dailies) get(ctx context.Context, date string) (api.DailyResponse, error) {
+	if _, err := time.Parse(time.DateOnly, date); err != nil {
+		return api.DailyResponse{}, fmt.Errorf("%w '%s': must be YYYY-MM-DD", errInvalidDate, date)
+	}
+	now := today()
+	if date > now {
+		return api.DailyResponse{}, fmt.Errorf("%w for %s", errNoDaily, date)
+	}
+	d.mu.Lock()
+	daily, found := d.history[date]
+	d.mu.Unlock()
+	switch {
+	case found:
+		return daily, nil
+	case date < now:
+		return api.DailyResponse{}, fmt.Errorf("%w for %s", errNoDaily, date)
+	}
+	return d.choose(ctx, date)
+}
+
+// choose picks the daily challenge of a date from its candidates, and
+// remembers it. It gives up if ctx is done, or after dailyTimeout, without
+// remembering that no candidate was solvable.
+func (d *dailies) choose(ctx context.Context, date string) (api.DailyResponse, error) {
+	d.choosing.Lock()
+	defer d.choosing.Unlock()
+	d.mu.Lock()
+	daily, found := d.history[date]
+	d.mu.Unlock()
+	if found {
+		return daily, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, dailyTimeout)
+	defer cancel()
+	sum := sha256.Sum256([]byte(date))
+	rng := rand.New(rand.NewPCG(binary.BigEndian.Uint64(sum[:8]), binary.BigEndian.Uint64(sum[8:16])))
+	for range dailyAttempts {
+		i := rng.IntN(len(dailyArticles))
+		j := rng.IntN(len(dailyArticles) - 1)
+		if j >= i {
+			j++
+		}
+		start, goal := dailyArticles[i], dailyArticles[j]
+		hops, _ := newExplorer(ctx).distance("/wiki/"+start, "/wiki/"+goal, dailyDepth)
+		if hops == 0 && ctx.Err() != nil {
+			return api.DailyResponse{}, fmt.Errorf("daily for %s not chosen: %w", date, ctx.Err())
+		}
+		if hops == 0 {
+			logger.TraceID("daily", "unsolvable", "date", date, "start", start, "goal", goal)
+			continue
+		}
+		daily = api.DailyResponse{
+			Date:   date,
+			Start:  start,
+			Goal:   goal,
+			Length: hops,
+		}
+		logger.TraceID("daily", "chosen", "date", date, "start", start, "goal", goal, "length", hops)
+		d.mu.Lock()
+		d.history[date] = daily
+		d.mu.Unlock()
+		return daily, nil
+	}
+	return api.DailyResponse{}, fmt.Errorf("%w for %s", errUnsolvable, date)
+}
+
+// prepare chooses today's and tomorrow's dailies ahead of time, and again
+// after each UTC midnight, so that no player waits for them to be checked.
+// It returns once shutdown is closed, abandoning any daily being chosen.
+func (d *dailies) prepare(shutdown <-chan struct{}) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-shutdown:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	for {
+		now := time.Now().UTC()
+		for _, day := range []time.Time{now, now.AddDate(0, 0, 1)} {
+			if _, err := d.choose(ctx, day.Format(time.DateOnly)); err != nil {
+				logger.Error("daily challenge not prepared", "error", err.Error())
+			}
+		}
+		// Wake at least hourly, to retry a daily which could not be chosen
+		midnight := now.Truncate(24 * time.Hour).Add(24 * time.Hour)
+		select {
+		case <-shutdown:
+			return
+		case <-time.After(min(time.Until(midnight), time.Hour)):
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	wrapi "github.com/bruceesmith/wrspa/backend/wrserver/api"
+	"github.com/bruceesmith/wrspa/go-app/backend/api"
+)
+
+// hubWiki returns a wiki in which every candidate for the daily links to a
+// hub, which links to every candidate, so that every pair is two hops apart
+func hubWiki() map[string][]string {
+	pages := map[string][]string{"Hub": dailyArticles}
+	for _, article := range dailyArticles {
+		pages[article] = []string{"Hub"}
+	}
+	return pages
+}
+
+func TestDailies(t *testing.T) {
+	fetched := testWiki(t, hubWiki())
+	now := time.Now().UTC()
+	yesterday := now.AddDate(0, 0, -1).Format(time.DateOnly)
+	d := newDailies()
+	chosen, err := d.choose(context.Background(), yesterday)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		date    string
+		want    api.DailyResponse
+		wantErr error
+	}{
+		{name: "today", date: today()},
+		{name: "today again", date: today()},
+		{name: "chosen in the past", date: yesterday, want: chosen},
+		{name: "not chosen in the past", date: now.AddDate(0, 0, -2).Format(time.DateOnly), wantErr: errNoDaily},
+		{name: "future", date: now.AddDate(0, 0, 1).Format(time.DateOnly), wantErr: errNoDaily},
+		{name: "invalid", date: "yesterday", wantErr: errInvalidDate},
+	}
+
+	var first api.DailyResponse
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := fetched.Load()
+			got, err := d.get(context.Background(), tt.date)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got.Date != tt.date || got.Length != 2 || got.Start == got.Goal ||
+				!slices.Contains(dailyArticles, got.Start) || !slices.Contains(dailyArticles, got.Goal) {
+				t.Errorf("got %+v", got)
+			}
+			switch {
+			case tt.want != (api.DailyResponse{}) && got != tt.want:
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			case first == (api.DailyResponse{}):
+				first = got
+			case got.Date == first.Date && (got != first || fetched.Load() != before):
+				t.Errorf("got %+v after %d fetches, want %+v without fetching", got, fetched.Load()-before, first)
+			}
+		})
+	}
+
+	// Every server gives players the same daily
+	if again, err := newDailies().choose(context.Background(), yesterday); err != nil || again != chosen {
+		t.Errorf("got %+v, %v from another server, want %+v", again, err, chosen)
+	}
+}
+
+func TestDailiesUnsolvable(t *testing.T) {
+	pages := make(map[string][]string)
+	for _, article := range dailyArticles {
+		pages[article] = nil
+	}
+	testWiki(t, pages)
+	date := today()
+
+	tests := []struct {
+		name    string
+		ctx     func() context.Context
+		wantErr error
+	}{
+		{name: "cancelled", ctx: func() context.Context {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			return ctx
+		}, wantErr: context.Canceled},
+		{name: "no path", ctx: context.Background, wantErr: errUnsolvable},
+	}
+
+	d := newDailies()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := d.choose(tt.ctx(), date); !errors.Is(err, tt.wantErr) {
+				t.Errorf("got error %v, want %v", err, tt.wantErr)
+			}
+			if _, found := d.history[date]; found {
+				t.Errorf("daily for %s remembered", date)
+			}
+		})
+	}
+}
+
+func TestDailiesPrepare(t *testing.T) {
+	testWiki(t, hubWiki())
+	d := newDailies()
+	shutdown := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		d.prepare(shutdown)
+		close(stopped)
+	}()
+
+	now := time.Now().UTC()
+	dates := []string{now.Format(time.DateOnly), now.AddDate(0, 0, 1).Format(time.DateOnly)}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		d.mu.Lock()
+		_, today := d.history[dates[0]]
+		_, tomorrow := d.history[dates[1]]
+		d.mu.Unlock()
+		if today && tomorrow {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("dailies for %v not prepared", dates)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	close(shutdown)
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("prepare did not return after shutdown")
+	}
+}
+
+func TestDailyHandler(t *testing.T) {
+	testWiki(t, hubWiki())
+	a := apiHandler{daily: newDailies()}
+
+	tests := []struct {
+		name       string
+		query      string
+		statusCode int
+		code       wrapi.ErrorCode
+	}{
+		{name: "today", statusCode: http.StatusOK},
+		{name: "date", query: "?date=" + today(), statusCode: http.StatusOK},
+		{name: "not chosen", query: "?date=2001-01-01", statusCode: http.StatusNotFound, code: wrapi.CodeNotFound},
+		{name: "invalid date", query: "?date=today", statusCode: http.StatusBadRequest, code: wrapi.CodeInvalidRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			a.Daily(w, httptest.NewRequest(http.MethodGet, "/api/v1/daily"+tt.query, nil))
+			if w.Code != tt.statusCode {
+				t.Fatalf("got status code %d, want %d: %s", w.Code, tt.statusCode, w.Body.String())
+			}
+			if tt.code != "" {
+				var failure wrapi.ErrorResponse
+				if err := json.Unmarshal(w.Body.Bytes(), &failure); err != nil || failure.Error.Code != tt.code {
+					t.Errorf("got %s, want code %s", w.Body.String(), tt.code)
+				}
+				return
+			}
+			var daily api.DailyResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &daily); err != nil || daily.Date != today() || daily.Length != 2 {
+				t.Errorf("got %s, want today's daily", w.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+
+	"github.com/bruceesmith/logger"
+	wrapi "github.com/bruceesmith/wrspa/backend/wrserver/api"
+)
+
+var (
+	errInvalidSubject = errors.New("invalid subject")
+	errInvalidDate    = errors.New("invalid date")
+	errGameNotFound   = errors.New("unknown game")
+	errNotFinished    = errors.New("the game is not finished")
+	errNoDaily        = errors.New("no daily challenge")
+	errUnsolvable     = errors.New("no solvable daily challenge found")
+	errTooManyGames   = errors.New("too many games in progress")
+
+	// requestIDRe matches a request ID given by a client or a proxy, which
+	// is kept only if it is safe to log and to echo in a header
+	requestIDRe = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,64}$`)
+)
+
+// upstreamError is returned by get when Wikipedia answers with a status
+// other than 2xx
+type upstreamError struct {
+	status int
+	path   string
+}
+
+func (e *upstreamError) Error() string {
+	return "unexpected status " + strconv.Itoa(e.status) + " fetching " + e.path
+}
+
+// errorCode maps an error onto the code of the failure reported to the
+// frontend
+func errorCode(err error) wrapi.ErrorCode {
+	var (
+		ue *upstreamError
+		ne net.Error
+	)
+	switch {
+	case errors.Is(err, errInvalidSubject):
+		return wrapi.CodeInvalidSubject
+	case errors.Is(err, errInvalidDate):
+		return wrapi.CodeInvalidRequest
+	case errors.Is(err, errGameNotFound), errors.Is(err, errNoDaily):
+		return wrapi.CodeNotFound
+	case errors.Is(err, errNotFinished):
+		return wrapi.CodeGameState
+	case errors.Is(err, errUnsolvable), errors.Is(err, errTooManyGames):
+		return wrapi.CodeUnavailable
+	case errors.As(err, &ue) && ue.status == http.StatusNotFound:
+		return wrapi.CodeUpstreamNotFound
+	case errors.As(err, &ue) && ue.status == http.StatusTooManyRequests:
+		return wrapi.CodeRateLimited
+	case errors.As(err, &ue):
+		return wrapi.CodeUpstreamError
+	case errors.As(err, &ne) && ne.Timeout():
+		return wrapi.CodeUpstreamTimeout
+	case errors.As(err, &ne):
+		return wrapi.CodeUpstreamUnavailable
+	}
+	return wrapi.CodeInternal
+}
+
+// handleError reports a failure as the ErrorResponse shared with wrserver,
+// with the status of its code
+func handleError(w http.ResponseWriter, function string, err error, code wrapi.ErrorCode) {
+	id := w.Header().Get(wrapi.HeaderRequestID)
+	logger.Error(function+" failure", "error", err.Error(), "code", string(code), "request", id)
+	jason, _ := json.Marshal(wrapi.ErrorResponse{
+		Error: wrapi.Error{
+			Code:      code,
+			Message:   err.Error(),
+			Function:  function,
+			RequestID: id,
+		},
+	})
+	w.Header().Set("Content-Type", wrapi.MediaTypeJSON)
+	w.WriteHeader(code.Status())
+	w.Write(jason)
+}
+
+// requestID returns the ID given in a request if it is valid, and
+// otherwise a new random one
+func requestID(r *http.Request) string {
+	if id := r.Header.Get(wrapi.HeaderRequestID); requestIDRe.MatchString(id) {
+		return id
+	}
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
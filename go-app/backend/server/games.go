@@ -0,0 +1,117 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bruceesmith/logger"
+	"github.com/bruceesmith/wrspa/go-app/backend/api"
+)
+
+const (
+	gameExpiry = 2 * time.Hour // A game is forgotten this long after it began
+	maxGames   = 10000         // Games which may be recorded at once
+)
+
+// games records the pages visited in each game, so that a game can be
+// analysed once it is finished
+type games struct {
+	mu       sync.Mutex
+	sessions map[string]*game
+}
+
+// game is the record of one game
+type game struct {
+	start, goal string
+	created     time.Time
+	moves       []move
+	analysis    *api.AnalysisResponse // Once analysed, until another move is recorded
+}
+
+// move is a page visited in a game, and when it was reached
+type move struct {
+	subject string
+	at      time.Duration
+}
+
+// newGames returns an empty record of games
+func newGames() *games {
+	return &games{
+		sessions: make(map[string]*game),
+	}
+}
+
+// create begins the record of a game, returning its ID
+func (gs *games) create(start, goal string) (string, error) {
+	if !strings.HasPrefix(start, "/wiki/") || !strings.HasPrefix(goal, "/wiki/") {
+		return "", fmt.Errorf("%w: start %s or goal %s", errInvalidSubject, start, goal)
+	}
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("unable to generate game ID: %w", err)
+	}
+	id := hex.EncodeToString(b)
+
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	now := time.Now()
+	for id, g := range gs.sessions {
+		if now.Sub(g.created) >= gameExpiry {
+			delete(gs.sessions, id)
+		}
+	}
+	if len(gs.sessions) >= maxGames {
+		return "", errTooManyGames
+	}
+	gs.sessions[id] = &game{
+		start:   start,
+		goal:    goal,
+		created: now,
+	}
+	logger.TraceID("games", "create", "id", id, "start", start, "goal", goal)
+	return id, nil
+}
+
+// record adds a page visited in a game; other requests, such as those for
+// images, are not moves
+func (gs *games) record(id, subject string) {
+	if !strings.HasPrefix(subject, "/wiki/") {
+		return
+	}
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	g, found := gs.sessions[id]
+	if !found {
+		return
+	}
+	g.moves = append(g.moves, move{subject: subject, at: time.Since(g.created)})
+	g.analysis = nil
+	logger.TraceID("games", "move", "id", id, "subject", subject)
+}
+
+// get returns a copy of the record of a game
+func (gs *games) get(id string) (game, bool) {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	g, found := gs.sessions[id]
+	if !found {
+		return game{}, false
+	}
+	copied := *g
+	copied.moves = append([]move(nil), g.moves...)
+	return copied, true
+}
+
+// analysed caches the analysis of a game, unless a move has been recorded
+// since the record analysed was taken, which had so many moves
+func (gs *games) analysed(id string, moves int, analysis api.AnalysisResponse) {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	if g, found := gs.sessions[id]; found && len(g.moves) == moves {
+		g.analysis = &analysis
+	}
+}
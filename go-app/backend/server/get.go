@@ -1,6 +1,7 @@
 package server
 
 import (
+	"context"
 	"io"
 	"net/http"
 	"strings"
@@ -8,6 +9,9 @@ import (
 	"github.com/bruceesmith/logger"
 )
 
+// wikiURL is the wiki from which pages are fetched
+var wikiURL = "https://en.wikipedia.org"
+
 func getRandom() (path string) {
 	client := &http.Client{
 		CheckRedirect: func(req *http.Request, via []*http.Request) error {
@@ -15,7 +19,7 @@ func getRandom() (path string) {
 			return http.ErrUseLastResponse
 		},
 	}
-	r, err := client.Get("https://en.wikipedia.org/wiki/Special:Random")
+	r, err := client.Get(wikiURL + "/wiki/Special:Random")
 	if err != nil {
 		logger.Error("error fetching Special:Random", "error", err.Error())
 		return
@@ -24,15 +28,27 @@ func getRandom() (path string) {
 	return
 }
 
-func get(path string) (body []byte, err error) {
-	var resp *http.Response
-	logger.TraceID("server", "get", "URL", "https://en.wikipedia.org"+path)
-	resp, err = http.Get("https://en.wikipedia.org" + path)
+// get fetches a path from the wiki, giving up when ctx is done
+func get(ctx context.Context, path string) (body []byte, err error) {
+	var (
+		req  *http.Request
+		resp *http.Response
+	)
+	logger.TraceID("server", "get", "URL", wikiURL+path)
+	req, err = http.NewRequestWithContext(ctx, http.MethodGet, wikiURL+path, nil)
+	if err == nil {
+		resp, err = http.DefaultClient.Do(req)
+	}
 	if err != nil {
 		logger.Error("error fetching "+path, "error", err.Error())
 		return
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		err = &upstreamError{status: resp.StatusCode, path: path}
+		logger.Error("error fetching "+path, "error", err.Error())
+		return
+	}
 	body, err = io.ReadAll(resp.Body)
 	if err != nil {
 		logger.Error("error reading response to GET("+path+")", "error", err.Error())
@@ -41,9 +57,9 @@ func get(path string) (body []byte, err error) {
 	return
 }
 
-func getString(path string) (body string, err error) {
+func getString(ctx context.Context, path string) (body string, err error) {
 	var b []byte
-	b, err = get(path)
+	b, err = get(ctx, path)
 	if err != nil {
 		return
 	}
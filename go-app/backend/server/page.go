@@ -0,0 +1,67 @@
+package server
+
+import (
+	"bytes"
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+
+	wrapi "github.com/bruceesmith/wrspa/backend/wrserver/api"
+	"github.com/bruceesmith/wrspa/backend/wrserver/links"
+	"github.com/bruceesmith/wrspa/backend/wrserver/metadata"
+	"github.com/bruceesmith/wrspa/backend/wrserver/sanitize"
+	"github.com/bruceesmith/wrspa/backend/wrserver/title"
+	"golang.org/x/net/html"
+)
+
+// extractPage puts a page fetched for a subject into the form shared with
+// wrserver. The HTML is that of the page's <body>, with its active content
+// removed by policy unless that is nil, and each of its links annotated
+// with its kind.
+func extractPage(policy *sanitize.Policy, subject, page string) (wrapi.Page, error) {
+	doc, err := html.Parse(strings.NewReader(page))
+	if err != nil {
+		return wrapi.Page{}, fmt.Errorf("failed to parse html: %w", err)
+	}
+	var body *html.Node
+	for n := range doc.Descendants() {
+		if n.Type == html.ElementNode && n.Data == "body" {
+			body = n
+			break
+		}
+	}
+	if body == nil {
+		return wrapi.Page{}, fmt.Errorf("no <body> tag found in html")
+	}
+
+	extracted := wrapi.Page{
+		Version:  wrapi.PageVersion,
+		Links:    []string{},
+		Sections: []wrapi.Section{},
+	}
+	if strings.HasPrefix(subject, title.Prefix) {
+		extracted.Title = strings.TrimPrefix(cmp.Or(links.Canonical(doc, title.English), title.Path(subject)), title.Prefix)
+		extracted.DisplayTitle = cmp.Or(metadata.DisplayTitle(doc), strings.ReplaceAll(extracted.Title, "_", " "))
+		extracted.Revision = metadata.Revision(doc, []byte(page))
+		for link := range links.Outbound(doc, title.English) {
+			extracted.Links = append(extracted.Links, strings.TrimPrefix(link, title.Prefix))
+		}
+		slices.Sort(extracted.Links)
+	}
+
+	if policy != nil {
+		policy.Clean(body)
+	}
+	links.Annotate(body, title.English, "", "")
+	extracted.Sections = metadata.Sections(body)
+
+	var buf bytes.Buffer
+	for c := body.FirstChild; c != nil; c = c.NextSibling {
+		if err := html.Render(&buf, c); err != nil {
+			return wrapi.Page{}, fmt.Errorf("failed to render html: %w", err)
+		}
+	}
+	extracted.HTML = buf.String()
+	return extracted, nil
+}
@@ -0,0 +1,94 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	wrapi "github.com/bruceesmith/wrspa/backend/wrserver/api"
+	"github.com/bruceesmith/wrspa/backend/wrserver/openapi"
+	"github.com/bruceesmith/wrspa/go-app/backend/api"
+)
+
+// TestOpenAPI checks every operation of the OpenAPI document against the
+// responses of its handler, as wrserver's does, so that it fails if they
+// drift apart
+func TestOpenAPI(t *testing.T) {
+	pages := hubWiki()
+	pages["Start"] = []string{"A"}
+	pages["A"] = []string{"Goal"}
+	pages["Goal"] = nil
+	testWiki(t, pages)
+	a := apiHandler{daily: newDailies(), games: newGames()}
+	a.router, a.spec = a.routes()
+
+	covered := make(map[string]bool)
+	call := func(method, target string, body any, accept string) *httptest.ResponseRecorder {
+		t.Helper()
+		var reader io.Reader
+		if body != nil {
+			bodyBytes, _ := json.Marshal(body)
+			reader = bytes.NewReader(bodyBytes)
+		}
+		req := httptest.NewRequest(method, target, reader)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		w := httptest.NewRecorder()
+		a.ServeHTTP(w, req)
+		if err := a.spec.CheckResponse(method, req.URL.Path, w.Code, w.Header(), w.Body.Bytes()); err != nil {
+			t.Errorf("response does not match the document: %v: %s", err, w.Body.String())
+		}
+		path, _ := a.spec.Match(method, req.URL.Path)
+		covered[method+" "+path] = true
+		return w
+	}
+	get := func(target string) *httptest.ResponseRecorder {
+		t.Helper()
+		return call(http.MethodGet, target, nil, "")
+	}
+	post := func(target string, body any) *httptest.ResponseRecorder {
+		t.Helper()
+		return call(http.MethodPost, target, body, "")
+	}
+
+	get(wrapi.Prefix + "daily")
+	get(wrapi.Prefix + "daily?date=yesterday")
+
+	var game api.GameResponse
+	json.Unmarshal(post(wrapi.Prefix+"game", api.GameRequest{Start: "/wiki/Start", Goal: "/wiki/Goal"}).Body.Bytes(), &game)
+	post(wrapi.Prefix+"game", "not a game")
+	get(wrapi.Prefix + "analysis?game=" + game.ID)
+	for _, subject := range []string{"/wiki/Start", "/wiki/A"} {
+		call(http.MethodPost, wrapi.Prefix+"wikipage", api.WikiPageRequest{Subject: subject, Game: game.ID}, wrapi.MediaTypeJSON)
+	}
+	call(http.MethodPost, wrapi.Prefix+"wikipage", api.WikiPageRequest{Subject: "/wiki/Goal", Game: game.ID}, "")
+	call(http.MethodPost, wrapi.Prefix+"wikipage", api.WikiPageRequest{Subject: "/wiki/Missing"}, wrapi.MediaTypeJSON)
+	get(wrapi.Prefix + "analysis?game=" + game.ID)
+	get(wrapi.Prefix + "analysis?game=unknown")
+
+	get(wrapi.Prefix + "settings")
+	get(wrapi.Prefix + "specialrandom")
+
+	// The document served is the one the router was built with
+	w := get(wrapi.Prefix + "openapi.json")
+	var served openapi.Document
+	if err := json.Unmarshal(w.Body.Bytes(), &served); err != nil {
+		t.Fatalf("invalid document: %v", err)
+	}
+	if served.OpenAPI != openapi.Version || len(served.Paths) != len(a.spec.Paths) || len(served.Components.Schemas) != len(a.spec.Components.Schemas) {
+		t.Errorf("got document %s", w.Body.String())
+	}
+
+	for path, operations := range a.spec.Paths {
+		for method := range operations {
+			if !covered[strings.ToUpper(method)+" "+path] {
+				t.Errorf("%s %s is not checked", strings.ToUpper(method), path)
+			}
+		}
+	}
+}
@@ -11,6 +11,7 @@ import (
 
 	"github.com/bruceesmith/logger"
 	"github.com/bruceesmith/terminator"
+	"github.com/bruceesmith/wrspa/backend/wrserver/sanitize"
 	"github.com/maxence-charriere/go-app/v10/pkg/app"
 )
 
@@ -36,20 +37,28 @@ const (
 
 // Server is the HTTP server for this program
 type Server struct {
+	daily  *dailies
 	server *http.Server
 	port   string
 }
 
-// New returns a Server
-func New(port string) (s *Server, err error) {
+// New returns a Server. The HTML of Wikipedia pages is cleaned by the
+// allowlist of sanitizer, or passed through unchanged if it is nil.
+func New(port string, sanitizer *sanitize.Options) (s *Server, err error) {
 	s = &Server{
+		daily: newDailies(),
 		server: &http.Server{
 			Addr: ":" + port,
 		},
 		port: port,
 	}
 	mux := http.NewServeMux()
-	mux.Handle("/api/", apiHandler{})
+	api := apiHandler{daily: s.daily, games: newGames()}
+	if sanitizer != nil {
+		api.sanitizer = sanitize.New(*sanitizer)
+	}
+	api.router, api.spec = api.routes()
+	mux.Handle("/api/", api)
 	mux.Handle("/static/", staticHandler{})
 	mux.Handle("/w/", staticHandler{})
 	s.server.Handler = s.multiHandler(mux)
@@ -82,6 +91,13 @@ func (s *Server) multiHandler(mux http.Handler) http.Handler {
 
 // Serve handles all HTTP(S) requests
 func (s *Server) Serve() {
+	// Choose the daily challenges in the background
+	terminator.Add(1)
+	go func() {
+		defer terminator.Done()
+		s.daily.prepare(terminator.ShutDown())
+	}()
+
 	terminator.Add(1)
 	go func() {
 		<-terminator.ShutDown()
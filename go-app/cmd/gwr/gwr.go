@@ -27,6 +27,24 @@ func main() {
 				},
 				Value: "8080",
 			},
+			&cli.BoolFlag{
+				Name:  "sanitize",
+				Usage: "remove scripts and other active content from Wikipedia pages before serving them",
+				Value: true,
+			},
+			&cli.StringSliceFlag{
+				Name:  "sanitize-attributes",
+				Usage: "comma-separated further attributes kept on any element of a page, other than event handlers",
+			},
+			&cli.StringSliceFlag{
+				Name:  "sanitize-elements",
+				Usage: "comma-separated further elements kept in a page, other than scripts and embedded documents",
+			},
+			&cli.BoolFlag{
+				Name:  "sanitize-styles",
+				Usage: "keep inline CSS in pages, unless it could load anything",
+				Value: true,
+			},
 		},
 		Usage:   "Server for Go Wiki Racing",
 		Version: "1.0",
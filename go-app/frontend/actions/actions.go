@@ -5,5 +5,6 @@ that are processed by handlers defined in Handle() and invoked by NewAction or N
 package actions
 
 const (
-	PageLoaded = "pageLoaded" // PageLoaded is invoked when the API server has returned an HTML page
+	AnalysisLoaded = "analysisLoaded" // AnalysisLoaded is invoked when the API server has returned the analysis of a finished game
+	PageLoaded     = "pageLoaded"     // PageLoaded is invoked when the API server has returned an HTML page
 )
@@ -77,7 +77,7 @@ func (g *Game) OnMount(ctx app.Context) {
 // the server.
 func (g *Game) settings() {
 	var err error
-	resp, err := http.Get("/api/settings")
+	resp, err := http.Get("/api/v1/settings")
 	if err != nil {
 		logger.Error("Game.OnMount error fetching server settings", "error", err.Error())
 		return
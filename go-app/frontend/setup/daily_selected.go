@@ -0,0 +1,63 @@
+package setup
+
+import (
+	"errors"
+
+	wrapi "github.com/bruceesmith/wrspa/backend/wrserver/api"
+	"github.com/bruceesmith/wrspa/go-app/frontend/observables"
+	"github.com/maxence-charriere/go-app/v10/pkg/app"
+)
+
+// ---------------------------------------------------------------------------
+//
+// Model
+//
+// ---------------------------------------------------------------------------
+
+type dailySelected struct{}
+
+// ---------------------------------------------------------------------------
+//
+// View
+//
+// ---------------------------------------------------------------------------
+
+func (d *dailySelected) view() []app.UI {
+	// A daily which could not yet be chosen may be chosen on a retry,
+	// while any other failure is final
+	var failure *wrapi.Error
+	if errors.As(dailyError, &failure) && failure.Code != wrapi.CodeUnavailable {
+		return []app.UI{
+			app.Text("There is no daily challenge today: " + failure.Message),
+		}
+	}
+	if dailyChallenge.Start == "" {
+		return []app.UI{
+			app.Text("The daily challenge is being chosen, please try again shortly"),
+		}
+	}
+	return []app.UI{
+		app.Text("The daily challenge for " + dailyChallenge.Date + " is:"),
+		app.Br(),
+		app.Text("Start: " + dailyChallenge.Start),
+		app.Br(),
+		app.Text("Goal: " + dailyChallenge.Goal),
+		app.Br(),
+		app.Button().Text("Next").
+			OnClick(d.next).
+			Class("gwr-custom-next-step"),
+	}
+}
+
+// ---------------------------------------------------------------------------
+//
+// Controller
+//
+// ---------------------------------------------------------------------------
+
+func (d *dailySelected) next(ctx app.Context, e app.Event) {
+	tags := app.Tags{}
+	tags.Set("start", dailyChallenge.Start)
+	tags.Set("goal", dailyChallenge.Goal)
+	ctx.SetState(observables.GameSelected, tags)
+}
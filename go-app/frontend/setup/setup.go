@@ -1,6 +1,6 @@
 /*
 Package setup is the page component for handling game initialisation, specifically
-the choice of game type (custom or random) and the selection of endpoints (start
+the choice of game type (custom, random or daily) and the selection of endpoints (start
 and goal)
 */
 package setup
@@ -10,6 +10,7 @@ import (
 	"io"
 	"net/http"
 
+	wrapi "github.com/bruceesmith/wrspa/backend/wrserver/api"
 	"github.com/bruceesmith/wrspa/go-app/backend/api"
 	"github.com/bruceesmith/logger"
 	"github.com/maxence-charriere/go-app/v10/pkg/app"
@@ -25,6 +26,7 @@ type gametype string
 
 const (
 	custom gametype = "custom"
+	daily  gametype = "daily"
 	random gametype = "random"
 	unset  gametype = "unset"
 )
@@ -38,11 +40,14 @@ type Setup struct {
 	Tipe           gametype
 	selector       typeSelector
 	customSelected customSelected
+	dailySelected  dailySelected
 	randomSelected randomSelected
 }
 
 var (
 	randomStart, randomGoal string
+	dailyChallenge          api.DailyResponse
+	dailyError              error // Why there is no daily challenge, once it is known
 	Default                 Setup
 )
 
@@ -78,6 +83,11 @@ func (s *Setup) Render() app.UI {
 			components,
 			s.randomSelected.view()...,
 		)
+	} else if s.Tipe == daily {
+		components = append(
+			components,
+			s.dailySelected.view()...,
+		)
 	}
 	return app.Div().
 		Body(components...).
@@ -94,7 +104,7 @@ func (s *Setup) OnMount(ctx app.Context) {
 	ctx.ObserveState("gameTypeSelected", &s.Tipe)
 	ctx.Async(
 		func() {
-			resp, err := http.Get("/api/SpecialRandom")
+			resp, err := http.Get("/api/v1/SpecialRandom")
 			if err != nil {
 				logger.Error("Setup.OnMount error fetching SpecialRandom", "error", err.Error())
 				return
@@ -116,4 +126,28 @@ func (s *Setup) OnMount(ctx app.Context) {
 			logger.Trace("setup.OnMount random points fetched")
 		},
 	)
+	ctx.Async(
+		func() {
+			resp, err := http.Get("/api/v1/daily")
+			if err != nil {
+				logger.Error("Setup.OnMount error fetching Daily", "error", err.Error())
+				return
+			}
+			defer resp.Body.Close()
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				logger.Error("Setup.OnMount error reading Daily response", "error", err.Error())
+				return
+			}
+			var response api.DailyResponse
+			err = wrapi.Decode(resp.StatusCode, body, &response)
+			if err != nil {
+				logger.Error("Setup.OnMount error in Daily response", "error", err.Error())
+				dailyError = err
+				return
+			}
+			dailyChallenge = response
+			logger.Trace("setup.OnMount daily challenge fetched")
+		},
+	)
 }
@@ -38,6 +38,11 @@ func (t *typeSelector) button(label string, value gametype) (u app.UI) {
 			Class("gwr-ts-text-2").
 			Value(value).
 			OnClick(t.selectType(value))
+	case daily:
+		u = app.Button().Text(label).
+			Class("gwr-ts-text-2").
+			Value(value).
+			OnClick(t.selectType(value))
 	}
 	return u
 }
@@ -46,6 +51,7 @@ func (t *typeSelector) selectors() app.UI {
 	return app.Div().Body(
 		t.button("Custom", custom), // Custom should be a Filled Button
 		t.button("Random", random), // Random should be an Outlined Button
+		t.button("Daily", daily),   // Daily should be an Outlined Button
 	).
 		Class("gwr-ts-selector")
 }
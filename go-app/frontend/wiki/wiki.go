@@ -5,14 +5,17 @@ package wiki
 
 import (
 	"bytes"
+	"cmp"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
-	"regexp"
 	"strings"
 
+	wrapi "github.com/bruceesmith/wrspa/backend/wrserver/api"
+	"github.com/bruceesmith/wrspa/backend/wrserver/title"
 	"github.com/bruceesmith/wrspa/go-app/backend/api"
 	"github.com/bruceesmith/wrspa/go-app/frontend/actions"
 	"github.com/bruceesmith/wrspa/go-app/frontend/observables"
@@ -30,16 +33,16 @@ import (
 type Wiki struct {
 	app.Compo
 	start, goal, current string
+	game                 string
 	Page                 string
 	State                state
+	Analysis             api.AnalysisResponse
+	AnalysisError        string // Why the game could not be analysed
 }
 
-var (
-	Default = Wiki{
-		State: ready,
-	}
-	pageRe = regexp.MustCompile(`(?ms).+<body .+?>(.+)</body>`)
-)
+var Default = Wiki{
+	State: ready,
+}
 
 // ---------------------------------------------------------------------------
 //
@@ -58,6 +61,7 @@ func (w *Wiki) Render() app.UI {
 			func() app.UI {
 				return app.Div().Body(
 					app.Text("Goal reached!"),
+					w.renderAnalysis(),
 				).
 					Class("gwr-wiki-text-1")
 			},
@@ -70,34 +74,142 @@ func (w *Wiki) Render() app.UI {
 		Class("gwr-wiki-page")
 }
 
+// renderAnalysis shows how the path taken compares with the shortest paths,
+// once the analysis of the finished game has arrived
+func (w *Wiki) renderAnalysis() app.UI {
+	analysis := w.Analysis
+	switch {
+	case w.AnalysisError != "":
+		return app.Div().Body(
+			app.Text("No analysis: " + w.AnalysisError),
+		).
+			Class("gwr-wiki-analysis")
+	case len(analysis.Path) == 0:
+		return app.Div().Body(
+			app.Text("Analysing your path ..."),
+		).
+			Class("gwr-wiki-analysis")
+	}
+
+	shortest := fmt.Sprintf("the shortest path takes %d", analysis.Shortest)
+	if analysis.Path[0].Bound {
+		shortest = fmt.Sprintf("the shortest path takes at most %d", analysis.Shortest)
+	}
+	pages := make([]app.UI, 0, len(analysis.Path))
+	for i, page := range analysis.Path {
+		hops := fmt.Sprintf("%d", page.Hops)
+		if page.Bound {
+			hops = "≤ " + hops
+		}
+		subject, _ := url.PathUnescape(strings.TrimPrefix(page.Subject, "/wiki/"))
+		item := app.Li()
+		if i == analysis.Deviation {
+			item = item.Class("gwr-wiki-analysis-deviation").
+				Title("Your path left every shortest path here")
+		}
+		pages = append(pages, item.Body(
+			app.Span().Text(strings.ReplaceAll(subject, "_", " ")),
+			app.Span().Text(fmt.Sprintf("%s from the goal, at %.1fs", hops, float64(page.ElapsedMS)/1000)),
+		))
+	}
+	return app.Div().Body(
+		app.P().Text(fmt.Sprintf("You took %d steps; %s", analysis.Steps, shortest)),
+		app.If(
+			analysis.Deviation < 0,
+			func() app.UI {
+				return app.P().Text("Your path was a shortest path")
+			},
+		),
+		app.Ol().Body(pages...),
+	).
+		Class("gwr-wiki-analysis")
+}
+
 // ---------------------------------------------------------------------------
 //
 // Controller
 //
 // ---------------------------------------------------------------------------
 
-// get fetches an HTML page or a static asset from Wikipedia
-func (w *Wiki) get(subject string) (s string, err error) {
-	req := api.WikiPageRequest{Subject: subject}
+// get fetches the HTML of the <body> of a page or a static asset from
+// Wikipedia, and the canonical subject of a page after any redirect
+func (w *Wiki) get(subject string) (s, canonical string, err error) {
+	req := api.WikiPageRequest{Subject: subject, Game: w.game}
 	bites, err := json.Marshal(req)
-	resp, err := http.Post("/api/wikipage", "application/json", bytes.NewBuffer(bites))
+	post, err := http.NewRequest(http.MethodPost, "/api/v1/wikipage", bytes.NewBuffer(bites))
 	if err != nil {
 		logger.Error("Wiki.OnMount error fetching "+subject, "error", err.Error())
-		return "", fmt.Errorf("Wiki.OnMount error fetching %s: [%w]", subject, err)
+		return "", "", fmt.Errorf("Wiki.OnMount error fetching %s: [%w]", subject, err)
+	}
+	post.Header.Set("Content-Type", "application/json")
+	post.Header.Set("Accept", wrapi.MediaTypeJSON)
+	resp, err := http.DefaultClient.Do(post)
+	if err != nil {
+		logger.Error("Wiki.OnMount error fetching "+subject, "error", err.Error())
+		return "", "", fmt.Errorf("Wiki.OnMount error fetching %s: [%w]", subject, err)
 	}
 	defer resp.Body.Close()
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
 		logger.Error("Wiki.OnMount error reading WikiPage response", "error", err.Error())
-		return "", fmt.Errorf("Wiki.OnMount error reading WikiPage response: [%w]", err)
+		return "", "", fmt.Errorf("Wiki.OnMount error reading WikiPage response: [%w]", err)
 	}
 	pageResponse := api.WikiPageResponse{}
-	err = json.Unmarshal(body, &pageResponse)
+	err = wrapi.Decode(resp.StatusCode, body, &pageResponse)
 	if err != nil {
-		logger.Error("Wiki.OnMount error unmarshaing WikiPage response", "error", err.Error())
-		return "", fmt.Errorf("Wiki.OnMount error unmarshaing WikiPage response: [%w]", err)
+		logger.Error("Wiki.OnMount error in WikiPage response", "error", err.Error())
+		return "", "", fmt.Errorf("Wiki.OnMount error in WikiPage response: [%w]", err)
+	}
+	if pageResponse.Title != "" {
+		subject = title.Path(pageResponse.Title)
 	}
-	return pageResponse.Page, nil
+	return pageResponse.HTML, subject, nil
+}
+
+// analyse fetches the analysis of the finished game
+func (w *Wiki) analyse() (analysis api.AnalysisResponse, err error) {
+	resp, err := http.Get("/api/v1/analysis?game=" + url.QueryEscape(w.game))
+	if err != nil {
+		logger.Error("Wiki.analyse error fetching analysis", "error", err.Error())
+		return analysis, fmt.Errorf("Wiki.analyse error fetching analysis: [%w]", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		logger.Error("Wiki.analyse error reading Analysis response", "error", err.Error())
+		return analysis, fmt.Errorf("Wiki.analyse error reading Analysis response: [%w]", err)
+	}
+	err = wrapi.Decode(resp.StatusCode, body, &analysis)
+	if err != nil {
+		logger.Error("Wiki.analyse error in Analysis response", "error", err.Error())
+		return analysis, fmt.Errorf("Wiki.analyse error in Analysis response: [%w]", err)
+	}
+	return analysis, nil
+}
+
+// createGame asks the API server to record the moves in this game,
+// returning its ID and the canonical subject of the goal
+func (w *Wiki) createGame() (id, goal string, err error) {
+	req := api.GameRequest{Start: "/wiki/" + w.start, Goal: "/wiki/" + w.goal}
+	bites, err := json.Marshal(req)
+	resp, err := http.Post("/api/v1/game", "application/json", bytes.NewBuffer(bites))
+	if err != nil {
+		logger.Error("Wiki.createGame error creating game", "error", err.Error())
+		return "", "", fmt.Errorf("Wiki.createGame error creating game: [%w]", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		logger.Error("Wiki.createGame error reading Game response", "error", err.Error())
+		return "", "", fmt.Errorf("Wiki.createGame error reading Game response: [%w]", err)
+	}
+	gameResponse := api.GameResponse{}
+	err = wrapi.Decode(resp.StatusCode, body, &gameResponse)
+	if err != nil {
+		logger.Error("Wiki.createGame error in Game response", "error", err.Error())
+		return "", "", fmt.Errorf("Wiki.createGame error in Game response: [%w]", err)
+	}
+	return gameResponse.ID, gameResponse.Goal, nil
 }
 
 // goalReached is an Action handler invoked when the "goal"
@@ -105,6 +217,22 @@ func (w *Wiki) get(subject string) (s string, err error) {
 func (w *Wiki) goalReached(ctx app.Context) {
 	ctx.SetState(observables.WikiState, finished)
 	tmr.finished()
+
+	// Fetch the analysis of the game in the background
+	if w.game == "" {
+		w.AnalysisError = "the game was not recorded"
+		return
+	}
+	ctx.Async(
+		func() {
+			analysis, err := w.analyse()
+			if err != nil {
+				ctx.NewActionWithValue(actions.AnalysisLoaded, err)
+				return
+			}
+			ctx.NewActionWithValue(actions.AnalysisLoaded, analysis)
+		},
+	)
 }
 
 // OnMount is called once, when the Wiki HTML is first added to the DOM
@@ -112,16 +240,25 @@ func (w *Wiki) OnMount(ctx app.Context) {
 	// Register the action "pageloaded" which is triggered each
 	// time a fresh Wkipedia page is fetched
 	ctx.Handle(actions.PageLoaded, w.updatePage)
+	// Register the action "analysisloaded" which is triggered when
+	// the analysis of the finished game arrives
+	ctx.Handle(actions.AnalysisLoaded, w.updateAnalysis)
 	ctx.ObserveState(observables.WikiState, &w.State)
 
-	// Load the starting page in the background
+	// Record the game and load the starting page in the background. A
+	// game which cannot be recorded can still be played, but not analysed
 	ctx.Async(
 		func() {
-			page, err := w.get("/wiki/" + w.start)
+			game, goal, err := w.createGame()
+			if err == nil {
+				w.game = game
+				w.goal = cmp.Or(goal, w.goal)
+			}
+			page, current, err := w.get("/wiki/" + w.start)
 			if err != nil {
 				return
 			}
-			w.current = w.start
+			w.current = current
 			ctx.NewActionWithValue(actions.PageLoaded, page)
 		},
 	)
@@ -133,56 +270,71 @@ func (w *Wiki) Targets(start, goal string) {
 	w.goal = goal
 }
 
+// updateAnalysis is an Action handler invoked when the "analysisloaded"
+// Action is triggered, with either the analysis or the error which
+// prevented it
+func (w *Wiki) updateAnalysis(ctx app.Context, a app.Action) {
+	switch value := a.Value.(type) {
+	case api.AnalysisResponse:
+		w.Analysis = value
+	case error:
+		// Show the server's reason, rather than the whole chain of errors
+		var failure *wrapi.Error
+		if errors.As(value, &failure) {
+			w.AnalysisError = failure.Message
+		} else {
+			w.AnalysisError = value.Error()
+		}
+	default:
+		logger.Error("Wiki.updateAnalysis internal error, unexpected type in Action.Value")
+	}
+}
+
 // updatePage is an Action handler invoked when the "pageloaded"
-// Action is triggered. It extracts the body of the Wikipedia HTML
-// page and inserts an "onclick" attribute at each Wikipedia link
-// in that HTML
+// Action is triggered. It shows the body of the Wikipedia page,
+// whose links are handled by the "onclick" of the page's <div>
 func (w *Wiki) updatePage(ctx app.Context, a app.Action) {
-	// Get the full page HTML source passed via the Action
+	// Get the HTML of the page's <body> passed via the Action
 	page, ok := a.Value.(string)
 	if !ok {
 		logger.Error("Wiki.updatePage internal error, unexpected type in Action.Value")
 		return
 	}
-	// Extract the HTML between (but not including) the <body> and </body> tags
-	matches := pageRe.FindSubmatch([]byte(page))
-	if len(matches) == 0 {
-		logger.Error("Wiki.updatePage got zero matches")
-		return
-	}
 	// Update the Wiki Racing content
-	w.Page = "<div>" + string(matches[1]) + "</div>"
-	if strings.ToLower(w.current) == "/wiki/"+strings.ToLower(w.goal) {
+	w.Page = "<div>" + page + "</div>"
+	if title.Equal(w.current, w.goal) {
 		w.goalReached(ctx)
 	}
 }
 
+// wikiclick follows a link to an article, which the backend has marked as
+// one with its title. Every other link, such as one to a section of the
+// page, to a page outside the articles, to another site or to an article
+// which does not exist, is disabled.
 func (w *Wiki) wikiclick(ctx app.Context, e app.Event) {
 	e.PreventDefault()
 	e.StopImmediatePropagation()
-	tag := e.Value.Get("target").Get("tagName").String()
-	if tag != "A" {
-		logger.TraceID("wiki", "click", "nonAnchor", tag)
+	anchor := e.Value.Get("target").Call("closest", "a")
+	if !anchor.Truthy() {
+		logger.TraceID("wiki", "click", "nonAnchor", e.Value.Get("target").Get("tagName").String())
 		return
 	}
-	href := e.Value.Get("target").Get("href").String()
-	logger.TraceID("wiki", "click", "href", href)
-	url, err := url.Parse(href)
-	if err != nil {
-		logger.Error("cannot parse href", "href", href, "error", err.Error())
+	kind, target := anchor.Call("getAttribute", wrapi.AttrLink), anchor.Call("getAttribute", wrapi.AttrTarget)
+	if kind.IsNull() || wrapi.LinkKind(kind.String()) != wrapi.LinkArticle || target.IsNull() {
+		logger.TraceID("wiki", "click", "disabled", anchor.Get("href").String())
 		return
 	}
-	if strings.HasPrefix(url.Path, "/wiki/") || strings.HasPrefix(url.Path, "/static/") {
-		// Load the requested page in the background
-		ctx.Async(
-			func() {
-				page, err := w.get(url.Path)
-				if err != nil {
-					return
-				}
-				w.current = url.Path
-				ctx.NewActionWithValue(actions.PageLoaded, page)
-			},
-		)
-	}
+	subject := title.Path(target.String())
+	logger.TraceID("wiki", "click", "subject", subject)
+	// Load the requested page in the background
+	ctx.Async(
+		func() {
+			page, current, err := w.get(subject)
+			if err != nil {
+				return
+			}
+			w.current = current
+			ctx.NewActionWithValue(actions.PageLoaded, page)
+		},
+	)
 }
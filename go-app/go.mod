@@ -7,7 +7,9 @@ require (
 	github.com/bruceesmith/echidna v1.1.10
 	github.com/bruceesmith/logger v1.3.8
 	github.com/bruceesmith/terminator v1.2.0
+	github.com/bruceesmith/wrspa/backend/wrserver v0.0.0-00010101000000-000000000000
 	github.com/urfave/cli/v3 v3.7.0
+	golang.org/x/net v0.52.0
 )
 
 require (
@@ -50,6 +52,9 @@ require (
 	honnef.co/go/tools v0.7.0 // indirect
 )
 
+// The api package shared with wrserver is taken from this repository
+replace github.com/bruceesmith/wrspa/backend/wrserver => ../backend_go
+
 tool (
 	github.com/boyter/scc
 	github.com/gojp/goreportcard/cmd/goreportcard-cli